@@ -0,0 +1,127 @@
+// Command apikey issues, lists and revokes API keys directly in the database.
+// It is used to create the first key with the keys:admin scope, other keys can be managed through the API
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/repository"
+	"github.com/PoorMercymain/user-segmenter/internal/service"
+)
+
+const usage = `usage: apikey [-d dsn] [-namespace NAMESPACE] <command> [flags]
+
+commands:
+  issue  -name NAME -scopes SCOPE[,SCOPE...]  issue a new key, the key is printed only once
+  list                                         list keys of the namespace, all keys with -namespace "*"
+  revoke -id ID                                revoke a key
+
+keys issued with -namespace "*" have access to every namespace
+
+scopes: %s
+`
+
+func main() {
+	dsn := flag.String("d", "host=localhost dbname=user-segmenter user=user-segmenter password=user-segmenter port=5432 sslmode=disable", "postgres DSN, DATABASE_URI is used when set")
+	namespace := flag.String("namespace", domain.DefaultNamespace, "namespace of the keys")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), usage, strings.Join(domain.Scopes, ", "))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if uri := os.Getenv("DATABASE_URI"); uri != "" && !isFlagSet("d") {
+		*dsn = uri
+	}
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*dsn, *namespace, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "apikey:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dsn string, namespace string, command string, args []string) error {
+	// the utility manages keys as a client of the namespace, so with "*" it lists and revokes keys of every namespace
+	ctx := domain.ContextWithClient(domain.ContextWithNamespace(context.Background(), namespace), domain.Client{Name: "apikey", Namespace: namespace})
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	pgPool, err := repository.ConnectToPostgres(ctx, dsn, repository.PoolConfig{})
+	if err != nil {
+		return err
+	}
+	defer pgPool.Close()
+
+	keys := service.NewAPIKey(repository.NewAPIKey(repository.NewPostgres(pgPool, nil, repository.RetryConfig{})))
+
+	switch command {
+	case "issue":
+		fs := flag.NewFlagSet("issue", flag.ExitOnError)
+		name := fs.String("name", "", "name of the client the key is issued to")
+		scopes := fs.String("scopes", "", "comma separated scopes of the key")
+		_ = fs.Parse(args)
+
+		if *name == "" || *scopes == "" {
+			return fmt.Errorf("both -name and -scopes should be set")
+		}
+
+		issued, err := keys.IssueAPIKey(ctx, *name, strings.Split(*scopes, ","))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("id:        %s\nnamespace: %s\nscopes:    %s\nkey:       %s\n", issued.ID, issued.Namespace, strings.Join(issued.Scopes, ","), issued.Key)
+		return nil
+	case "list":
+		list, err := keys.ReadAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAMESPACE\tNAME\tSCOPES\tCREATED\tREVOKED")
+		for _, key := range list {
+			revoked := "-"
+			if key.RevokedAt != nil {
+				revoked = key.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Namespace, key.Name, strings.Join(key.Scopes, ","), key.CreatedAt.Format(time.RFC3339), revoked)
+		}
+		return w.Flush()
+	case "revoke":
+		fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+		id := fs.String("id", "", "id of the key")
+		_ = fs.Parse(args)
+
+		if *id == "" {
+			return fmt.Errorf("-id should be set")
+		}
+
+		return keys.RevokeAPIKey(ctx, *id)
+	}
+
+	return fmt.Errorf("unknown command %q", command)
+}
+
+func isFlagSet(name string) bool {
+	found := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+
+	return found
+}
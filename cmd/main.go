@@ -2,92 +2,378 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	echoSwagger "github.com/swaggo/echo-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
 	_ "github.com/PoorMercymain/user-segmenter/docs"
 	"github.com/PoorMercymain/user-segmenter/internal/config"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/grpcserver"
 	"github.com/PoorMercymain/user-segmenter/internal/handler"
+	"github.com/PoorMercymain/user-segmenter/internal/metrics"
 	"github.com/PoorMercymain/user-segmenter/internal/middleware"
 	"github.com/PoorMercymain/user-segmenter/internal/repository"
 	"github.com/PoorMercymain/user-segmenter/internal/service"
+	"github.com/PoorMercymain/user-segmenter/internal/tracing"
+	"github.com/PoorMercymain/user-segmenter/internal/worker"
+	segmenterv1 "github.com/PoorMercymain/user-segmenter/pkg/api/segmenter/v1"
+	backgroundtracker "github.com/PoorMercymain/user-segmenter/pkg/background-tracker"
+	"github.com/PoorMercymain/user-segmenter/pkg/jwks"
 	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+	ratelimiter "github.com/PoorMercymain/user-segmenter/pkg/rate-limiter"
 )
 
-func init() {
-	logger.InitLogger()
+// readinessSwitch is implemented by the health handler
+type readinessSwitch interface {
+	SetShuttingDown()
 }
 
-func router(pgPool *pgxpool.Pool, serverAddress string) (*echo.Echo, error) {
+// configCheckInterval is how often the config file is checked for changes
+const configCheckInterval = 5 * time.Second
+
+// router creates the HTTP router and the gRPC server, which share services. The gRPC server is nil when it is disabled.
+// Components with reloadable settings are updated by the reloader
+func router(repos repositories, conf *config.Config, reloader *config.Reloader, authModes []string, jwtKeys domain.JWTKeys, log *zap.SugaredLogger) (*echo.Echo, *grpc.Server, *worker.Scheduler, readinessSwitch) {
 	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = handler.ErrorHandler
+	e.Server.ReadHeaderTimeout = conf.HTTPReadHeaderTimeout
+	e.Server.ReadTimeout = conf.HTTPReadTimeout
+	e.Server.WriteTimeout = conf.HTTPWriteTimeout
+	e.Server.IdleTimeout = conf.HTTPIdleTimeout
+	e.Use(otelecho.Middleware(tracing.ServiceName, otelecho.WithSkipper(func(c echo.Context) bool {
+		return c.Path() == "/metrics" || c.Path() == "/healthz" || c.Path() == "/readyz"
+	})))
+	e.Use(middleware.RequestID())
+	e.Use(middleware.AccessLog(log))
+	e.Use(middleware.Metrics())
+
+	keySrv := service.NewAPIKey(repos.apiKey)
+	authenticators := make([]domain.Authenticator, 0, len(authModes))
+	for _, mode := range authModes {
+		switch mode {
+		case config.AuthModeAPIKey:
+			authenticators = append(authenticators, keySrv)
+		case config.AuthModeJWT:
+			authenticators = append(authenticators, service.NewJWT(jwtKeys, conf.JWTOptions()))
+		}
+	}
 
-	pg := repository.NewPostgres(pgPool)
+	if len(authenticators) == 0 {
+		log.Warnln("authentication is disabled, every client has all scopes")
+		e.Use(middleware.Anonymous())
+	} else {
+		e.Use(middleware.Authenticate(authenticators...))
+	}
 
-	segRep := repository.NewSegment(pg)
-	usrRep := repository.NewUser(pg)
-	repRep := repository.NewReport(pg)
+	sched := worker.NewScheduler(repos.segment, repos.user, repos.evaluation, repos.idempotency, conf.TTLInterval, conf.TTLBatchSize, log)
+	reloader.OnReload(func(conf *config.Config) {
+		sched.SetInterval(conf.TTLInterval)
+		sched.SetBatchSize(conf.TTLBatchSize)
+	})
 
-	segSrv := service.NewSegment(segRep)
-	usrSrv := service.NewUser(usrRep)
-	repSrv := service.NewReport(repRep)
+	segSrv := service.NewSegment(repos.segment)
+	usrSrv := service.NewUser(repos.user)
+	repSrv := service.NewReport(metrics.NewReportRepository(repos.report))
 
 	segHan := handler.NewSegment(segSrv)
-	usrHan := handler.NewUser(usrSrv)
+	usrHan := handler.NewUser(usrSrv, conf.GzipMinSize)
 	repHan := handler.NewReport(repSrv)
+	keyHan := handler.NewAPIKey(keySrv)
+	evlHan := handler.NewEvaluation(service.NewEvaluation(repos.evaluation))
+	cfgHan := handler.NewConfigVersion(reloader.Version)
+	hltHan := handler.NewHealth(append(repos.checks,
+		domain.HealthCheck{Name: "reports", Check: repos.report.CheckStorage},
+		domain.HealthCheck{Name: "scheduler", Check: sched.Check},
+	)...)
+
+	metrics.Registry.MustRegister(repos.collectors...)
+	metrics.Registry.MustRegister(
+		metrics.NewSchedulerCollector(sched.Stats),
+		metrics.NewConfigCollector(reloader.Version),
+	)
 
-	e.POST("/api/segment", segHan.CreateSegment, middleware.UseGzipReader())
-	e.DELETE("/api/segment", segHan.DeleteSegment, middleware.UseGzipReader())
-	e.POST("/api/user", usrHan.UpdateUserSegments, middleware.UseGzipReader())
-	e.GET("/api/user/:user", usrHan.ReadUserSegments)
-	e.GET("/api/user-history/:user", repHan.CreateUserSegmentsHistoryReport, middleware.AddServerAddressToContext(serverAddress))
-	e.GET("/api/reports/:report", repHan.ReadUserSegmentsHistoryReport)
+	e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
+	e.GET("/healthz", hltHan.Liveness)
+	e.GET("/readyz", hltHan.Readiness)
+
+	// responses of mutating routes are replayed for retries with the same Idempotency-Key. Issuing keys is not covered,
+	// as the response has the issued key, which is never stored
+	idempotent := middleware.Idempotency(service.NewIdempotency(repos.idempotency, conf.IdempotencyTTL))
+
+	// every api route is available both in the namespace from the X-Namespace header and in the one from the path
+	api := func(g *echo.Group) {
+		g.POST("/segment", segHan.CreateSegment, middleware.RequireScope(domain.ScopeSegmentsWrite), idempotent, middleware.UseGzipReader(conf.MaxDecompressedBodySize))
+		g.PATCH("/segment", segHan.UpdateSegment, middleware.RequireScope(domain.ScopeSegmentsWrite), idempotent, middleware.UseGzipReader(conf.MaxDecompressedBodySize))
+		g.GET("/segment", segHan.ReadSegments, middleware.RequireScope(domain.ScopeSegmentsRead))
+		g.DELETE("/segment", segHan.DeleteSegment, middleware.RequireScope(domain.ScopeSegmentsWrite), idempotent, middleware.UseGzipReader(conf.MaxDecompressedBodySize))
+		g.POST("/user", usrHan.UpdateUserSegments, middleware.RequireScope(domain.ScopeUsersWrite), idempotent, middleware.UseGzipReader(conf.MaxDecompressedBodySize))
+		g.GET("/user/:user", usrHan.ReadUserSegments, middleware.RequireScope(domain.ScopeUsersRead))
+		g.GET("/ttl", usrHan.ReadDeletionTimes, middleware.RequireScope(domain.ScopeUsersRead))
+		g.PATCH("/ttl", usrHan.UpdateDeletionTime, middleware.RequireScope(domain.ScopeUsersWrite), idempotent, middleware.UseGzipReader(conf.MaxDecompressedBodySize))
+		g.DELETE("/ttl", usrHan.DeleteDeletionTime, middleware.RequireScope(domain.ScopeUsersWrite), idempotent, middleware.UseGzipReader(conf.MaxDecompressedBodySize))
+		g.POST("/schedule", usrHan.ScheduleUserSegments, middleware.RequireScope(domain.ScopeUsersWrite), idempotent, middleware.UseGzipReader(conf.MaxDecompressedBodySize))
+		g.GET("/schedule/:user", usrHan.ReadScheduledAssignments, middleware.RequireScope(domain.ScopeUsersRead))
+		g.GET("/user-history/:user", repHan.CreateUserSegmentsHistoryReport, middleware.RequireScope(domain.ScopeReportsRead), middleware.AddServerAddressToContext(conf.ServerAddress))
+		g.GET("/reports/:report", repHan.ReadUserSegmentsHistoryReport, middleware.RequireScope(domain.ScopeReportsRead))
+		g.POST("/keys", keyHan.IssueAPIKey, middleware.RequireScope(domain.ScopeKeysAdmin))
+		g.GET("/keys", keyHan.ReadAPIKeys, middleware.RequireScope(domain.ScopeKeysAdmin))
+		g.DELETE("/keys/:id", keyHan.RevokeAPIKey, middleware.RequireScope(domain.ScopeKeysAdmin), idempotent)
+		g.POST("/evaluation/snapshot", evlHan.ReadSnapshot, middleware.RequireScope(domain.ScopeUsersRead))
+		g.GET("/evaluation/changes", evlHan.ReadChanges, middleware.RequireScope(domain.ScopeUsersRead))
+	}
+
+	// the limiter is shared by both groups and the gRPC server, so a client can't multiply its limit by switching APIs.
+	// It is used even when the limit is disabled, so the limit can be enabled by a reload
+	limiter := ratelimiter.New(conf.RateLimit, conf.RateBurst)
+	if conf.RateLimit <= 0 {
+		log.Warnln("rate limiting is disabled")
+	}
+	reloader.OnReload(func(conf *config.Config) {
+		limiter.SetLimit(conf.RateLimit, conf.RateBurst)
+	})
+	apiMiddlewares := []echo.MiddlewareFunc{middleware.Namespace(), middleware.ReadConsistency(), middleware.LimitBody(conf.MaxBodySize), middleware.RateLimit(limiter)}
+
+	api(e.Group("/api/ns/:namespace", apiMiddlewares...))
+	api(e.Group("/api", apiMiddlewares...))
+	e.GET("/api/admin/config", cfgHan.ReadConfigVersion, middleware.RequireScope(domain.ScopeConfigRead))
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
-	log, err := logger.GetLogger()
-	if err != nil {
-		return nil, err
+	if conf.GRPCAddress == "" {
+		return e, nil, sched, hltHan
 	}
-	go func() {
-		for {
-			err := segRep.DeleteExpiredSegments(context.Background())
-			if err != nil {
-				log.Infoln(err)
-			}
-			time.Sleep(7 * time.Second)
-		}
-	}()
 
-	return e, nil
+	grpcSrv := grpcserver.NewServer(log, grpcserver.Options{Limiter: limiter, MaxMessageSize: int(conf.MaxBodySize)}, authenticators...)
+	segmenterv1.RegisterSegmentServiceServer(grpcSrv, grpcserver.NewSegment(segSrv))
+	segmenterv1.RegisterUserServiceServer(grpcSrv, grpcserver.NewUser(usrSrv))
+	segmenterv1.RegisterReportServiceServer(grpcSrv, grpcserver.NewReport(repSrv))
+
+	return e, grpcSrv, sched, hltHan
 }
 
 func main() {
-	log, err := logger.GetLogger()
+	os.Exit(run())
+}
+
+func run() int {
+	conf, err := config.GetServerConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+
+	if conf != nil && conf.PrintConfig {
+		if printErr := conf.Print(os.Stdout); printErr != nil {
+			fmt.Fprintln(os.Stderr, "failed to print config:", printErr)
+			return 1
+		}
+	}
+
+	if conf == nil {
+		fmt.Fprintln(os.Stderr, "failed to read config:", err)
+		return 1
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid config:")
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if conf.PrintConfig {
+		return 0
+	}
+
+	log, logLevel, err := logger.NewLeveled(conf.LoggerConfig())
 	if err != nil {
-		return
+		fmt.Fprintln(os.Stderr, "failed to create logger:", err)
+		return 1
 	}
+	defer log.Sync()
 	log.Infoln("logger started")
 
-	conf := config.GetServerConfig()
+	reloader := config.NewReloader(conf, os.Args[1:])
+	reloader.OnReload(func(conf *config.Config) {
+		_ = logLevel.UnmarshalText([]byte(conf.LogLevel))
+	})
 
-	pgPool, err := repository.ConnectToPostgres(conf.DatabaseURI)
+	authModes, err := conf.AuthModeList()
 	if err != nil {
-		log.Infoln(err)
-		return
+		log.Errorln(err)
+		return 1
 	}
 
-	defer pgPool.Close()
+	var jwtKeys domain.JWTKeys
+	for _, mode := range authModes {
+		if mode == config.AuthModeJWT {
+			jwtKeys, err = jwks.Load(context.Background(), conf.JWKSURL)
+			if err != nil {
+				log.Errorln("failed to load JWKS:", err)
+				return 1
+			}
+		}
+	}
 
-	r, err := router(pgPool, conf.ServerAddress)
+	shutdownTracing, err := tracing.Init(context.Background(), conf.TracingExporter)
 	if err != nil {
-		log.Infoln(err)
-		return
+		log.Errorln(err)
+		return 1
 	}
 
-	if err = r.Start(strings.TrimPrefix(conf.ServerAddress, "http://")); err != nil {
-		log.Infoln(err)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	bg := backgroundtracker.New()
+
+	var repos repositories
+	if conf.Storage == config.StorageMemory {
+		log.Warnln("data is stored in memory and is lost on restart")
+		repos = memoryRepositories(conf, bg)
+	} else {
+		poolConfig := repository.PoolConfig{
+			MaxConns:         conf.DBMaxConns,
+			MinConns:         conf.DBMinConns,
+			MaxConnLifetime:  conf.DBMaxConnLifetime,
+			MaxConnIdleTime:  conf.DBMaxConnIdleTime,
+			ConnectTimeout:   conf.DBConnectTimeout,
+			StatementTimeout: conf.DBStatementTimeout,
+			ConnectAttempts:  conf.DBConnectAttempts,
+			ConnectBackoff:   conf.DBConnectBackoff,
+		}
+
+		pgPool, err := repository.ConnectToPostgres(logger.WithContext(ctx, log), conf.DatabaseURI, poolConfig)
+		if err != nil {
+			log.Errorln(err)
+			return 1
+		}
+
+		defer pgPool.Close()
+
+		// replicas are not waited for, reads go to the primary until a replica passes a health check
+		var replicas *repository.Replicas
+		if replicaURIs := conf.ReplicaURIs(); len(replicaURIs) != 0 {
+			replicaPools := make([]*pgxpool.Pool, 0, len(replicaURIs))
+			for _, uri := range replicaURIs {
+				pool, err := repository.NewPool(ctx, uri, poolConfig)
+				if err != nil {
+					log.Errorln("failed to create a pool of a read replica:", err)
+					return 1
+				}
+				defer pool.Close()
+
+				replicaPools = append(replicaPools, pool)
+			}
+
+			replicas = repository.NewReplicas(replicaPools, conf.DBReplicaMaxLag)
+			go replicas.Watch(logger.WithContext(ctx, log), conf.DBReplicaCheckInterval)
+		}
+
+		repos = postgresRepositories(pgPool, replicas, conf, bg)
+	}
+
+	r, grpcSrv, sched, readiness := router(repos, conf, reloader, authModes, jwtKeys, log)
+
+	sched.Start()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go reloader.Watch(ctx, reload, configCheckInterval, func(changed []string, err error) {
+		if err != nil {
+			log.Errorln("failed to reload config, the current one is kept:", err)
+			return
+		}
+
+		version := reloader.Version()
+		if len(changed) != 0 {
+			log.Infoln("config reloaded, version:", version.Version, "changed:", strings.Join(changed, ", "))
+		}
+
+		if len(version.PendingRestart) != 0 {
+			log.Warnln("changed settings are applied only after a restart:", strings.Join(version.PendingRestart, ", "))
+		}
+	})
+
+	log.Infoln("starting server on", conf.ServerAddress)
+
+	go func() {
+		if err := r.Start(strings.TrimPrefix(conf.ServerAddress, "http://")); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorln(err)
+			stop()
+		}
+	}()
+
+	if grpcSrv != nil {
+		listener, err := net.Listen("tcp", conf.GRPCAddress)
+		if err != nil {
+			log.Errorln(err)
+			return 1
+		}
+
+		log.Infoln("starting gRPC server on", conf.GRPCAddress)
+
+		go func() {
+			if err := grpcSrv.Serve(listener); err != nil {
+				log.Errorln(err)
+				stop()
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	log.Infoln("shutting down")
+
+	readiness.SetShuttingDown()
+	time.Sleep(conf.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+
+	// the server is stopped first, so no new background work is started while it is drained
+	if err = r.Shutdown(shutdownCtx); err != nil {
+		log.Errorln("failed to drain http requests:", err)
+	}
+
+	if grpcSrv != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			log.Errorln("failed to drain gRPC calls:", shutdownCtx.Err())
+			grpcSrv.Stop()
+		}
+	}
+
+	if err = sched.Stop(shutdownCtx); err != nil {
+		log.Errorln("failed to stop scheduler:", err)
 	}
+
+	if err = bg.Shutdown(shutdownCtx); err != nil {
+		log.Errorln("failed to finish background work:", err)
+	}
+
+	if err = shutdownTracing(shutdownCtx); err != nil {
+		log.Errorln("failed to flush traces:", err)
+	}
+
+	log.Infoln("shutdown finished")
+	return 0
 }
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PoorMercymain/user-segmenter/pkg/client"
+)
+
+// monthLayout is the format of report periods, the same as the server accepts
+const monthLayout = "2006-1"
+
+var errRowsFailed = errors.New("some rows failed")
+
+func (c *cli) segmentCommand(command string, args []string) error {
+	switch command {
+	case "list":
+		if err := c.parse(c.flags("segment list"), args); err != nil {
+			return err
+		}
+
+		ctx, cancel := c.context()
+		defer cancel()
+
+		segments, err := c.client.ListSegments(ctx)
+		if err != nil {
+			return err
+		}
+
+		t := table{columns: []string{"slug", "ttl", "expires_at", "created_by", "updated_by"}}
+		for _, segment := range segments {
+			t.add(segment.Slug, formatDuration(segment.TTL), formatTime(segment.ExpiresAt), segment.CreatedBy, segment.UpdatedBy)
+		}
+		return c.print(t)
+	case "create":
+		fs := c.flags("segment create")
+		file := fs.String("f", "", "file with segments to create")
+		slug := fs.String("slug", "", "name of the segment")
+		percent := fs.String("percent", "", "percent of users added to the segment")
+		TTL := fs.String("ttl", "", "default TTL of users added to the segment, e.g. 48h")
+		expiresAt := fs.String("expires-at", "", "time the segment is deleted at")
+		if err := c.parse(fs, args); err != nil {
+			return err
+		}
+
+		records := []record{{"slug": *slug, "percent": *percent, "ttl": *TTL, "expires_at": *expiresAt}}
+		if *file != "" {
+			var err error
+			records, err = c.readRecords(*file, "slug", "percent", "ttl", "expires_at")
+			if err != nil {
+				return err
+			}
+		} else if *slug == "" {
+			return c.usageError("segment create needs -slug or -f")
+		}
+
+		return c.bulk(records, "slug", c.createSegment)
+	case "update":
+		fs := c.flags("segment update")
+		slug := fs.String("slug", "", "name of the segment")
+		TTL := fs.String("ttl", "", "default TTL of users added to the segment, an empty value removes it")
+		expiresAt := fs.String("expires-at", "", "time the segment is deleted at, an empty value removes it")
+		if err := c.parse(fs, args); err != nil {
+			return err
+		}
+
+		if *slug == "" {
+			return c.usageError("segment update needs -slug")
+		}
+
+		update := client.SegmentUpdate{Slug: *slug}
+		var err error
+		fs.Visit(func(f *flag.Flag) {
+			switch {
+			case err != nil:
+			case f.Name == "ttl":
+				var d time.Duration
+				d, err = parseDuration("ttl", *TTL)
+				update.TTL = &d
+			case f.Name == "expires-at":
+				var t time.Time
+				t, err = parseTime("expires_at", *expiresAt)
+				update.ExpiresAt = &t
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		if update.TTL == nil && update.ExpiresAt == nil {
+			return c.usageError("segment update needs -ttl or -expires-at")
+		}
+
+		ctx, cancel := c.context()
+		defer cancel()
+
+		return c.client.UpdateSegment(ctx, update)
+	case "delete":
+		fs := c.flags("segment delete")
+		file := fs.String("f", "", "file with segments to delete")
+		slug := fs.String("slug", "", "name of the segment")
+		if err := c.parse(fs, args); err != nil {
+			return err
+		}
+
+		records := []record{{"slug": *slug}}
+		if *file != "" {
+			var err error
+			records, err = c.readRecords(*file, "slug")
+			if err != nil {
+				return err
+			}
+		} else if *slug == "" {
+			return c.usageError("segment delete needs -slug or -f")
+		}
+
+		return c.bulk(records, "slug", func(rec record) error {
+			ctx, cancel := c.context()
+			defer cancel()
+
+			return c.client.DeleteSegment(ctx, rec["slug"])
+		})
+	}
+
+	return c.usageError("unknown command segment %s", command)
+}
+
+func (c *cli) createSegment(rec record) error {
+	segment := client.Segment{Slug: rec["slug"]}
+
+	var err error
+	if segment.Percent, err = parsePercent(rec["percent"]); err != nil {
+		return err
+	}
+
+	if segment.TTL, err = parseDuration("ttl", rec["ttl"]); err != nil {
+		return err
+	}
+
+	if segment.ExpiresAt, err = parseTime("expires_at", rec["expires_at"]); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	return c.client.CreateSegment(ctx, segment)
+}
+
+func (c *cli) userCommand(command string, args []string) error {
+	switch command {
+	case "get":
+		fs := c.flags("user get")
+		userID := fs.String("id", "", "id of the user")
+		if err := c.parse(fs, args); err != nil {
+			return err
+		}
+
+		if *userID == "" {
+			return c.usageError("user get needs -id")
+		}
+
+		ctx, cancel := c.context()
+		defer cancel()
+
+		slugs, err := c.client.GetUserSegments(ctx, *userID)
+		if err != nil {
+			return err
+		}
+
+		t := table{columns: []string{"slug"}}
+		for _, slug := range slugs {
+			t.add(slug)
+		}
+		return c.print(t)
+	case "update":
+		fs := c.flags("user update")
+		file := fs.String("f", "", "file with users to update")
+		userID := fs.String("id", "", "id of the user")
+		add := fs.String("add", "", "comma separated segments to add the user to")
+		remove := fs.String("delete", "", "comma separated segments to remove the user from")
+		TTL := fs.String("ttl", "", "TTL of every added segment")
+		if err := c.parse(fs, args); err != nil {
+			return err
+		}
+
+		records := []record{{"user_id": *userID, "add": *add, "delete": *remove, "ttl": *TTL}}
+		if *file != "" {
+			var err error
+			records, err = c.readRecords(*file, "user_id", "add", "delete", "ttl")
+			if err != nil {
+				return err
+			}
+		} else if *userID == "" {
+			return c.usageError("user update needs -id or -f")
+		}
+
+		return c.bulk(records, "user_id", c.updateUser)
+	}
+
+	return c.usageError("unknown command user %s", command)
+}
+
+func (c *cli) updateUser(rec record) error {
+	TTL, err := parseTTL(rec["ttl"], time.Now())
+	if err != nil {
+		return err
+	}
+
+	update := client.UserUpdate{UserID: rec["user_id"], Delete: list(rec["delete"])}
+	for _, slug := range list(rec["add"]) {
+		update.Add = append(update.Add, client.Assignment{Slug: slug, TTL: TTL})
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	return c.client.UpdateUserSegments(ctx, update)
+}
+
+func (c *cli) ttlCommand(command string, args []string) error {
+	fs := c.flags("ttl " + command)
+	userID := fs.String("id", "", "id of the user")
+	slug := fs.String("slug", "", "name of the segment")
+
+	switch command {
+	case "list":
+		if err := c.parse(fs, args); err != nil {
+			return err
+		}
+
+		if *userID == "" && *slug == "" {
+			return c.usageError("ttl list needs -id, -slug or both")
+		}
+
+		ctx, cancel := c.context()
+		defer cancel()
+
+		deletionTimes, err := c.client.ListDeletionTimes(ctx, *userID, *slug)
+		if err != nil {
+			return err
+		}
+
+		t := table{columns: []string{"user_id", "slug", "ttl"}}
+		for _, deletionTime := range deletionTimes {
+			t.add(deletionTime.UserID, deletionTime.Slug, formatTime(deletionTime.TTL))
+		}
+		return c.print(t)
+	case "set":
+		TTL := fs.String("ttl", "", "time the user is removed from the segment")
+		if err := c.parse(fs, args); err != nil {
+			return err
+		}
+
+		if *userID == "" || *slug == "" || *TTL == "" {
+			return c.usageError("ttl set needs -id, -slug and -ttl")
+		}
+
+		t, err := parseTTL(*TTL, time.Now())
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := c.context()
+		defer cancel()
+
+		return c.client.UpdateDeletionTime(ctx, *userID, *slug, t)
+	case "delete":
+		if err := c.parse(fs, args); err != nil {
+			return err
+		}
+
+		if *userID == "" || *slug == "" {
+			return c.usageError("ttl delete needs -id and -slug")
+		}
+
+		ctx, cancel := c.context()
+		defer cancel()
+
+		return c.client.DeleteDeletionTime(ctx, *userID, *slug)
+	}
+
+	return c.usageError("unknown command ttl %s", command)
+}
+
+func (c *cli) reportCommand(command string, args []string) error {
+	switch command {
+	case "create":
+		fs := c.flags("report create")
+		userID := fs.String("id", "", "id of the user")
+		from := fs.String("from", "", "first month of the report, e.g. 2023-9")
+		to := fs.String("to", "", "last month of the report, e.g. 2023-10")
+		out := fs.String("out", "", "file the report is saved to, the link is printed when not set")
+		if err := c.parse(fs, args); err != nil {
+			return err
+		}
+
+		if *userID == "" {
+			return c.usageError("report create needs -id")
+		}
+
+		var period client.Period
+		var err error
+		if *from != "" {
+			if period.Start, err = time.Parse(monthLayout, *from); err != nil {
+				return fmt.Errorf("from %q should be a month, e.g. 2023-9", *from)
+			}
+		}
+
+		if *to != "" {
+			if period.End, err = time.Parse(monthLayout, *to); err != nil {
+				return fmt.Errorf("to %q should be a month, e.g. 2023-10", *to)
+			}
+		}
+
+		ctx, cancel := c.context()
+		defer cancel()
+
+		link, err := c.client.CreateHistoryReport(ctx, *userID, period)
+		if err != nil {
+			return err
+		}
+
+		if *out == "" {
+			fmt.Fprintln(c.stdout, link)
+			return nil
+		}
+
+		return c.download(link, *out)
+	case "download":
+		fs := c.flags("report download")
+		name := fs.String("name", "", "name of the report or its link")
+		out := fs.String("out", "", "file the report is saved to, stdout when not set")
+		if err := c.parse(fs, args); err != nil {
+			return err
+		}
+
+		if *name == "" {
+			return c.usageError("report download needs -name")
+		}
+
+		return c.download(*name, *out)
+	}
+
+	return c.usageError("unknown command report %s", command)
+}
+
+func (c *cli) download(link string, out string) error {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	report, err := c.client.ReadHistoryReport(ctx, link)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		_, err = c.stdout.Write(report)
+		return err
+	}
+
+	return os.WriteFile(out, report, 0o644)
+}
+
+// bulk applies every record separately. A single record is reported only by the error,
+// for several records the result of each one is printed
+func (c *cli) bulk(records []record, key string, apply func(record) error) error {
+	if len(records) == 1 {
+		return apply(records[0])
+	}
+
+	t := table{columns: []string{"row", key, "result"}}
+	failed := 0
+	for i, rec := range records {
+		result := "ok"
+		if err := apply(rec); err != nil {
+			result = err.Error()
+			failed++
+		}
+		t.add(strconv.Itoa(i+1), rec[key], strings.ReplaceAll(result, "\n", " "))
+	}
+
+	if err := c.print(t); err != nil {
+		return err
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%w: %d of %d", errRowsFailed, failed, len(records))
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// record is a row of a bulk file, lists are joined by commas
+type record map[string]string
+
+// readRecords reads a JSON array of objects or CSV with a header from the file, "-" is stdin.
+// Fields which are not in fields are rejected, like unknown fields are rejected by the server
+func (c *cli) readRecords(path string, fields ...string) ([]record, error) {
+	var r io.Reader = c.stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	br := bufio.NewReader(r)
+	first, err := firstByte(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []record
+	if first == '[' {
+		records, err = readJSONRecords(br)
+	} else {
+		records, err = readCSVRecords(br)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	allowed := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		allowed[field] = struct{}{}
+	}
+
+	for i, rec := range records {
+		for field := range rec {
+			if _, ok := allowed[field]; !ok {
+				return nil, fmt.Errorf("%s: row %d: unknown field %q, known fields are %s", path, i+1, field, strings.Join(fields, ", "))
+			}
+		}
+	}
+
+	return records, nil
+}
+
+func firstByte(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, br.UnreadByte()
+		}
+	}
+}
+
+func readJSONRecords(r io.Reader) ([]record, error) {
+	var objects []map[string]interface{}
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	if err := d.Decode(&objects); err != nil {
+		return nil, err
+	}
+
+	records := make([]record, 0, len(objects))
+	for i, object := range objects {
+		rec := make(record, len(object))
+		for field, value := range object {
+			switch v := value.(type) {
+			case nil:
+			case string:
+				rec[field] = v
+			case json.Number:
+				rec[field] = v.String()
+			case []interface{}:
+				items := make([]string, 0, len(v))
+				for _, item := range v {
+					s, ok := item.(string)
+					if !ok {
+						return nil, fmt.Errorf("row %d: %s should be a list of strings", i+1, field)
+					}
+					items = append(items, s)
+				}
+				rec[field] = strings.Join(items, ",")
+			default:
+				return nil, fmt.Errorf("row %d: %s should be a string, a number or a list of strings", i+1, field)
+			}
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+func readCSVRecords(r io.Reader) ([]record, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	header := rows[0]
+	records := make([]record, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		rec := make(record, len(header))
+		for i, field := range header {
+			if row[i] != "" {
+				rec[strings.TrimSpace(field)] = row[i]
+			}
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// list splits a comma separated list, an empty string is an empty list
+func list(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+
+	items := strings.Split(s, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+
+	return items
+}
+
+func parsePercent(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	percent, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("percent %q should be a number", s)
+	}
+
+	return percent, nil
+}
+
+// parseTTL parses an RFC3339 time or a duration from now
+func parseTTL(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ttl %q should be an RFC3339 time or a duration", s)
+	}
+
+	return now.Add(d), nil
+}
+
+func parseTime(field string, s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s %q should be an RFC3339 time", field, s)
+	}
+
+	return t, nil
+}
+
+func parseDuration(field string, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q should be a duration, e.g. 48h", field, s)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,196 @@
+// Command segmenterctl manages segments, users, their TTLs and history reports through the HTTP API.
+// Servers, credentials and namespaces of different environments are kept in profiles of the config file
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/PoorMercymain/user-segmenter/pkg/client"
+)
+
+const usage = `usage: segmenterctl [flags] <command> [flags]
+
+commands:
+  segment list                                              list segments of the namespace
+  segment create -slug SLUG [-percent N] [-ttl 48h] [-expires-at TIME]
+  segment create -f FILE                                    create segments from a file (slug, percent, ttl, expires_at)
+  segment update -slug SLUG [-ttl 48h] [-expires-at TIME]   change settings, an empty value removes the setting
+  segment delete -slug SLUG | -f FILE                       delete segments, users are removed from them in the background
+  user get -id ID                                           list segments of the user
+  user update -id ID [-add A,B] [-delete C,D] [-ttl TTL]    add the user to segments and remove it from others
+  user update -f FILE                                       update users from a file (user_id, add, delete, ttl)
+  ttl list [-id ID] [-slug SLUG]                            list scheduled removals of users from segments
+  ttl set -id ID -slug SLUG -ttl TTL                        set the time the user is removed from the segment
+  ttl delete -id ID -slug SLUG                              keep the user in the segment forever
+  report create -id ID [-from 2023-9] [-to 2023-10] [-out FILE]
+                                                            create a history report, print its link or save it to FILE
+  report download -name NAME [-out FILE]                    download a report by its name or link
+  profile list                                              list profiles of the config file
+  profile use NAME                                          make the profile the default one
+
+TIME is RFC3339, e.g. 2023-09-30T20:19:05+03:00. TTL is a TIME or a duration from now, e.g. 48h.
+Files are JSON arrays of objects or CSV with a header, lists in CSV are separated by commas inside quotes,
+"-" reads the file from stdin. Every row is applied separately, failed rows are reported and the exit code is 1.
+
+Percent of users is added to a segment once, when it is created. The API doesn't change the percent of an existing segment.
+
+flags:
+`
+
+// exitUsage is returned for invalid arguments, like flag does
+const exitUsage = 2
+
+var errUsage = errors.New("invalid arguments")
+
+// options are the global flags, settings of the profile are used for the ones which are not set
+type options struct {
+	configPath string
+	profile    string
+	url        string
+	apiKey     string
+	token      string
+	namespace  string
+	output     string
+	timeout    time.Duration
+}
+
+// cli runs one command, stdin and stdout are replaced in tests
+type cli struct {
+	opts   options
+	config *config
+	client *client.Client
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("segmenterctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var opts options
+	fs.StringVar(&opts.configPath, "config", defaultConfigPath(), "config file with profiles")
+	fs.StringVar(&opts.profile, "profile", os.Getenv("SEGMENTERCTL_PROFILE"), "profile of the config file, the current one is used when not set")
+	fs.StringVar(&opts.url, "url", "", "address of the server, "+defaultURL+" when the profile doesn't set it")
+	fs.StringVar(&opts.apiKey, "api-key", os.Getenv("SEGMENTER_API_KEY"), "API key, SEGMENTER_API_KEY is used when set")
+	fs.StringVar(&opts.token, "token", os.Getenv("SEGMENTER_TOKEN"), "JWT sent as a bearer token, SEGMENTER_TOKEN is used when set")
+	fs.StringVar(&opts.namespace, "namespace", "", "namespace, the default one is used when neither the flag nor the profile sets it")
+	fs.StringVar(&opts.output, "o", "", "output format: table (default), json or csv")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "timeout of each request")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	c := &cli{opts: opts, stdin: stdin, stdout: stdout, stderr: stderr}
+	err := c.run(fs.Args())
+	if errors.Is(err, errUsage) {
+		return exitUsage
+	} else if err != nil {
+		fmt.Fprintln(stderr, "segmenterctl:", err)
+		return 1
+	}
+
+	return 0
+}
+
+func (c *cli) run(args []string) error {
+	var err error
+	c.config, err = loadConfig(c.opts.configPath)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "profile" {
+		return c.profileCommand(args[1:])
+	}
+
+	if err = c.connect(); err != nil {
+		return err
+	}
+
+	if len(args) < 2 {
+		return c.usageError("command %q needs a subcommand", args[0])
+	}
+
+	switch args[0] {
+	case "segment":
+		return c.segmentCommand(args[1], args[2:])
+	case "user":
+		return c.userCommand(args[1], args[2:])
+	case "ttl":
+		return c.ttlCommand(args[1], args[2:])
+	case "report":
+		return c.reportCommand(args[1], args[2:])
+	}
+
+	return c.usageError("unknown command %q", args[0])
+}
+
+// connect creates the client with the settings of the flags and the profile
+func (c *cli) connect() error {
+	p, err := c.config.resolve(c.opts)
+	if err != nil {
+		return err
+	}
+
+	if c.opts.output == "" {
+		c.opts.output = p.Output
+	}
+
+	if _, err = newPrinter(c.opts.output); err != nil {
+		return err
+	}
+
+	c.client, err = client.New(p.URL, client.Config{APIKey: p.APIKey, BearerToken: p.Token, Namespace: p.Namespace})
+	return err
+}
+
+func (c *cli) usageError(format string, args ...interface{}) error {
+	fmt.Fprintf(c.stderr, "segmenterctl: "+format+"\n", args...)
+	fmt.Fprintln(c.stderr, "run segmenterctl -h for usage")
+	return errUsage
+}
+
+// context limits a single request, bulk commands make a request for each row
+func (c *cli) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.opts.timeout)
+}
+
+// flags returns a flag set of a subcommand, its errors are printed by the flag package
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+func (c *cli) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if fs.NArg() != 0 {
+		return c.usageError("unexpected arguments of %s: %v", fs.Name(), fs.Args())
+	}
+
+	return nil
+}
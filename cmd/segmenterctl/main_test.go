@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer answers the requests of the commands and records them
+type fakeServer struct {
+	mu       sync.Mutex
+	requests []string
+	bodies   []map[string]interface{}
+	headers  []http.Header
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	s.headers = append(s.headers, r.Header.Clone())
+
+	var body map[string]interface{}
+	if r.Body != nil {
+		data, _ := io.ReadAll(r.Body)
+		if len(data) != 0 {
+			_ = json.Unmarshal(data, &body)
+		}
+	}
+	s.bodies = append(s.bodies, body)
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/segment":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"slug":"A","ttl":"48h0m0s","created_by":"key:1"},{"slug":"B","expires_at":"2030-01-01T00:00:00Z"}]`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/user/1":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`["A","B"]`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/user-history/1":
+		w.Write([]byte("http://segmenter:8080/api/reports/report.csv"))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/reports/report.csv":
+		w.Write([]byte("1;A;add;2023-09-30\n"))
+	case r.Method == http.MethodPost && r.URL.Path == "/api/segment" && body["slug"] == "B":
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"status":409,"code":"segment_already_exists","slug":"B"}`))
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"-config", filepath.Join(t.TempDir(), "config.yaml")}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func testServer(t *testing.T) (*fakeServer, string) {
+	s := &fakeServer{}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	return s, ts.URL
+}
+
+func TestUsage(t *testing.T) {
+	code, _, stderr := runCommand(t, "")
+	require.Equal(t, exitUsage, code)
+	require.Contains(t, stderr, "usage: segmenterctl")
+
+	_, url := testServer(t)
+
+	code, _, stderr = runCommand(t, "", "-url", url, "segment", "rename")
+	require.Equal(t, exitUsage, code)
+	require.Contains(t, stderr, "unknown command segment rename")
+
+	code, _, _ = runCommand(t, "", "-url", url, "segment", "create")
+	require.Equal(t, exitUsage, code)
+
+	code, _, stderr = runCommand(t, "", "-url", url, "-o", "yaml", "segment", "list")
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "unknown output format")
+}
+
+func TestSegmentList(t *testing.T) {
+	_, url := testServer(t)
+
+	code, stdout, _ := runCommand(t, "", "-url", url, "segment", "list")
+	require.Zero(t, code)
+	require.Equal(t, "SLUG  TTL      EXPIRES_AT            CREATED_BY  UPDATED_BY\nA     48h0m0s                        key:1       \nB              2030-01-01T00:00:00Z              \n", stdout)
+
+	code, stdout, _ = runCommand(t, "", "-url", url, "-o", "csv", "segment", "list")
+	require.Zero(t, code)
+	require.Equal(t, "slug,ttl,expires_at,created_by,updated_by\nA,48h0m0s,,key:1,\nB,,2030-01-01T00:00:00Z,,\n", stdout)
+
+	code, stdout, _ = runCommand(t, "", "-url", url, "-o", "json", "segment", "list")
+	require.Zero(t, code)
+	var segments []map[string]string
+	require.NoError(t, json.Unmarshal([]byte(stdout), &segments))
+	require.Equal(t, []map[string]string{{"slug": "A", "ttl": "48h0m0s", "created_by": "key:1"}, {"slug": "B", "expires_at": "2030-01-01T00:00:00Z"}}, segments)
+}
+
+func TestSegmentBulk(t *testing.T) {
+	s, url := testServer(t)
+
+	file := filepath.Join(t.TempDir(), "segments.csv")
+	require.NoError(t, os.WriteFile(file, []byte("slug,percent,ttl\nA,10,48h\nB,,\n"), 0o600))
+
+	code, stdout, stderr := runCommand(t, "", "-url", url, "-o", "csv", "segment", "create", "-f", file)
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "1 of 2")
+	require.Equal(t, "row,slug,result\n1,A,ok\n2,B,409 segment_already_exists\n", stdout)
+
+	require.Equal(t, map[string]interface{}{"slug": "A", "percent": float64(10), "ttl": "48h0m0s"}, s.bodies[0])
+
+	file = filepath.Join(t.TempDir(), "segments.json")
+	require.NoError(t, os.WriteFile(file, []byte(`[{"slug":"A","name":"a"}]`), 0o600))
+	code, _, stderr = runCommand(t, "", "-url", url, "segment", "delete", "-f", file)
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, `unknown field "name"`)
+
+	code, _, _ = runCommand(t, "", "-url", url, "segment", "update", "-slug", "A", "-ttl", "")
+	require.Zero(t, code)
+	require.Equal(t, "PATCH /api/segment", s.requests[len(s.requests)-1])
+}
+
+func TestUserUpdate(t *testing.T) {
+	s, url := testServer(t)
+
+	stdin := `[{"user_id":"1","add":["A","B"],"delete":["C"],"ttl":"2030-01-01T00:00:00Z"},{"user_id":"2","delete":"D, E"}]`
+	code, stdout, stderr := runCommand(t, stdin, "-url", url, "-api-key", "usk_1", "-namespace", "team-a", "user", "update", "-f", "-")
+	require.Zero(t, code, stderr)
+	require.Contains(t, stdout, "ok")
+	require.Len(t, s.requests, 2)
+
+	require.Equal(t, "usk_1", s.headers[0].Get("X-API-Key"))
+	require.Equal(t, "team-a", s.headers[0].Get("X-Namespace"))
+	require.Equal(t, []interface{}{"2030-01-01T00:00:00Z", "2030-01-01T00:00:00Z"}, s.bodies[0]["ttl"])
+	require.Equal(t, []interface{}{"D", "E"}, s.bodies[1]["slugs_to_delete"])
+
+	code, stdout, _ = runCommand(t, "", "-url", url, "user", "get", "-id", "1")
+	require.Zero(t, code)
+	require.Equal(t, "SLUG\nA\nB\n", stdout)
+}
+
+func TestParseTTL(t *testing.T) {
+	now := time.Date(2023, 9, 30, 0, 0, 0, 0, time.UTC)
+
+	TTL, err := parseTTL("48h", now)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(48*time.Hour), TTL)
+
+	TTL, err = parseTTL("2023-10-01T00:00:00Z", now)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(24*time.Hour), TTL)
+
+	_, err = parseTTL("tomorrow", now)
+	require.Error(t, err)
+
+	require.Equal(t, []string{"A", "B"}, list(" A, B"))
+	require.Nil(t, list(""))
+}
+
+func TestReport(t *testing.T) {
+	_, url := testServer(t)
+
+	code, stdout, _ := runCommand(t, "", "-url", url, "report", "create", "-id", "1", "-from", "2023-9")
+	require.Zero(t, code)
+	require.Equal(t, "http://segmenter:8080/api/reports/report.csv\n", stdout)
+
+	out := filepath.Join(t.TempDir(), "report.csv")
+	code, _, _ = runCommand(t, "", "-url", url, "report", "create", "-id", "1", "-out", out)
+	require.Zero(t, code)
+	report, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "1;A;add;2023-09-30\n", string(report))
+
+	code, _, _ = runCommand(t, "", "-url", url, "report", "create", "-id", "1", "-from", "September")
+	require.Equal(t, 1, code)
+}
+
+func TestProfiles(t *testing.T) {
+	s, url := testServer(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`current: staging
+profiles:
+  staging:
+    url: `+url+`
+    api_key: usk_staging
+    namespace: team-a
+    output: csv
+  production:
+    url: http://localhost:1
+    token: jwt
+`), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-config", path, "segment", "list"}, nil, &stdout, &stderr)
+	require.Zero(t, code, stderr.String())
+	require.True(t, strings.HasPrefix(stdout.String(), "slug,ttl"))
+	require.Equal(t, "usk_staging", s.headers[0].Get("X-API-Key"))
+	require.Equal(t, "team-a", s.headers[0].Get("X-Namespace"))
+
+	// flags override the profile, the credential of the profile is replaced and not sent with the flag one
+	code = run([]string{"-config", path, "-profile", "production", "-url", url, "-namespace", "team-b", "segment", "list"}, nil, &stdout, &stderr)
+	require.Zero(t, code, stderr.String())
+	require.Equal(t, "Bearer jwt", s.headers[1].Get("Authorization"))
+	require.Equal(t, "team-b", s.headers[1].Get("X-Namespace"))
+
+	code = run([]string{"-config", path, "-token", "other", "-url", url, "segment", "list"}, nil, &stdout, &stderr)
+	require.Zero(t, code, stderr.String())
+	require.Empty(t, s.headers[2].Get("X-API-Key"))
+	require.Equal(t, "Bearer other", s.headers[2].Get("Authorization"))
+
+	code = run([]string{"-config", path, "-profile", "test", "segment", "list"}, nil, &stdout, &stderr)
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr.String(), `profile "test" is not found`)
+
+	stdout.Reset()
+	code = run([]string{"-config", path, "profile", "use", "production"}, nil, &stdout, &stderr)
+	require.Zero(t, code)
+	code = run([]string{"-config", path, "profile", "list"}, nil, &stdout, &stderr)
+	require.Zero(t, code)
+	require.Contains(t, stdout.String(), "*        production")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
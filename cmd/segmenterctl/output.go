@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// table is the result of a command, it is printed as a table, CSV or a JSON array of objects keyed by the columns
+type table struct {
+	columns []string
+	rows    [][]string
+}
+
+func (t *table) add(row ...string) {
+	t.rows = append(t.rows, row)
+}
+
+type printer func(w io.Writer, t table) error
+
+func newPrinter(format string) (printer, error) {
+	switch format {
+	case "", "table":
+		return printTable, nil
+	case "json":
+		return printJSON, nil
+	case "csv":
+		return printCSV, nil
+	}
+
+	return nil, fmt.Errorf("unknown output format %q, it should be table, json or csv", format)
+}
+
+func (c *cli) print(t table) error {
+	p, err := newPrinter(c.opts.output)
+	if err != nil {
+		return err
+	}
+
+	return p(c.stdout, t)
+}
+
+func printTable(w io.Writer, t table) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(t.columns, "\t")))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+func printCSV(w io.Writer, t table) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.columns); err != nil {
+		return err
+	}
+
+	if err := cw.WriteAll(t.rows); err != nil {
+		return err
+	}
+
+	return cw.Error()
+}
+
+func printJSON(w io.Writer, t table) error {
+	objects := make([]map[string]string, 0, len(t.rows))
+	for _, row := range t.rows {
+		object := make(map[string]string, len(t.columns))
+		for i, column := range t.columns {
+			if row[i] != "" {
+				object[column] = row[i]
+			}
+		}
+		objects = append(objects, object)
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(objects)
+}
+
+// formatTime and formatDuration print zero values as empty cells
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+
+	return d.String()
+}
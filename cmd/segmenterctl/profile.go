@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultURL = "http://localhost:8080"
+
+// config is the file with profiles, e.g.
+//
+//	current: staging
+//	profiles:
+//	  staging:
+//	    url: https://segmenter.staging.example.com
+//	    api_key: usk_...
+//	    namespace: team-a
+//	    output: table
+type config struct {
+	Current  string             `yaml:"current"`
+	Profiles map[string]profile `yaml:"profiles"`
+
+	path string
+}
+
+type profile struct {
+	URL       string `yaml:"url"`
+	APIKey    string `yaml:"api_key,omitempty"`
+	Token     string `yaml:"token,omitempty"`
+	Namespace string `yaml:"namespace,omitempty"`
+	Output    string `yaml:"output,omitempty"`
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "segmenterctl", "config.yaml")
+}
+
+// loadConfig reads the config file, a missing file is an empty config
+func loadConfig(path string) (*config, error) {
+	cfg := &config{Profiles: make(map[string]profile), path: path}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]profile)
+	}
+
+	return cfg, nil
+}
+
+func (c *config) save() error {
+	if c.path == "" {
+		return errors.New("path of the config file is not known, set -config")
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+
+	// profiles keep credentials, so the file is readable only by its owner
+	return os.WriteFile(c.path, data, 0o600)
+}
+
+// resolve returns the settings of the selected profile overridden by the flags
+func (c *config) resolve(opts options) (profile, error) {
+	name := opts.profile
+	if name == "" {
+		name = c.Current
+	}
+
+	var p profile
+	if name != "" {
+		var ok bool
+		p, ok = c.Profiles[name]
+		if !ok {
+			return p, fmt.Errorf("profile %q is not found in %s", name, c.path)
+		}
+	}
+
+	if opts.url != "" {
+		p.URL = opts.url
+	}
+
+	if p.URL == "" {
+		p.URL = defaultURL
+	}
+
+	// the flags set a single credential, so the one of the profile is not sent together with it
+	if opts.apiKey != "" || opts.token != "" {
+		p.APIKey, p.Token = opts.apiKey, opts.token
+	}
+
+	if opts.namespace != "" {
+		p.Namespace = opts.namespace
+	}
+
+	return p, nil
+}
+
+func (c *cli) profileCommand(args []string) error {
+	if len(args) == 0 {
+		return c.usageError("profile needs a subcommand")
+	}
+
+	switch args[0] {
+	case "list":
+		names := make([]string, 0, len(c.config.Profiles))
+		for name := range c.config.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CURRENT\tNAME\tURL\tNAMESPACE")
+		for _, name := range names {
+			current := ""
+			if name == c.config.Current {
+				current = "*"
+			}
+
+			p := c.config.Profiles[name]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", current, name, p.URL, p.Namespace)
+		}
+		return w.Flush()
+	case "use":
+		if len(args) != 2 {
+			return c.usageError("profile use needs a profile name")
+		}
+
+		if _, ok := c.config.Profiles[args[1]]; !ok {
+			return fmt.Errorf("profile %q is not found in %s", args[1], c.config.path)
+		}
+
+		c.config.Current = args[1]
+		return c.config.save()
+	}
+
+	return c.usageError("unknown command profile %s", args[0])
+}
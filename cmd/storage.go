@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/PoorMercymain/user-segmenter/internal/config"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/metrics"
+	"github.com/PoorMercymain/user-segmenter/internal/repository"
+	backgroundtracker "github.com/PoorMercymain/user-segmenter/pkg/background-tracker"
+)
+
+// reportRepository is implemented by the report repositories of both storages
+type reportRepository interface {
+	domain.ReportRepository
+	CheckStorage(ctx context.Context) error
+}
+
+// repositories are the repositories of the storage selected by the config, together with its health checks and metrics
+type repositories struct {
+	segment     domain.SegmentRepository
+	user        domain.UserRepository
+	report      reportRepository
+	evaluation  domain.EvaluationRepository
+	apiKey      domain.APIKeyRepository
+	idempotency domain.IdempotencyRepository
+	checks      []domain.HealthCheck
+	collectors  []prometheus.Collector
+}
+
+func postgresRepositories(pgPool *pgxpool.Pool, replicas *repository.Replicas, conf *config.Config, bg *backgroundtracker.Tracker) repositories {
+	pg := repository.NewPostgres(pgPool, replicas, repository.RetryConfig{Attempts: conf.DBRetryAttempts, Backoff: conf.DBRetryBackoff})
+	hltRep := repository.NewHealth(pg)
+
+	return repositories{
+		segment:     repository.NewSegment(pg, bg),
+		user:        repository.NewUser(pg),
+		report:      repository.NewReport(pg, conf.ReportsDir),
+		evaluation:  repository.NewEvaluation(pg, conf.ChangesRetention),
+		apiKey:      repository.NewAPIKey(pg),
+		idempotency: repository.NewIdempotency(pg),
+		checks: []domain.HealthCheck{
+			{Name: "postgres", Check: hltRep.CheckConnection},
+			{Name: "schema", Check: hltRep.CheckSchemaVersion},
+		},
+		collectors: []prometheus.Collector{metrics.NewPoolCollector(pgPool)},
+	}
+}
+
+// memoryRepositories share one in-memory storage, its data is lost on restart
+func memoryRepositories(conf *config.Config, bg *backgroundtracker.Tracker) repositories {
+	m := repository.NewMemory()
+
+	return repositories{
+		segment:     repository.NewMemorySegment(m, bg),
+		user:        repository.NewMemoryUser(m),
+		report:      repository.NewMemoryReport(m, conf.ReportsDir),
+		evaluation:  repository.NewMemoryEvaluation(m, conf.ChangesRetention),
+		apiKey:      repository.NewMemoryAPIKey(m),
+		idempotency: repository.NewMemoryIdempotency(m),
+	}
+}
@@ -16,255 +16,2127 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/reports/{filename}": {
+        "/api/admin/config": {
             "get": {
-                "description": "Запрос для получения отчета по истории сегментов пользователя в формате csv",
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для получения версии и контрольной суммы конфигурации, с которой работает экземпляр сервиса, результата последней перезагрузки конфигурации и настроек, для применения которых нужен перезапуск",
                 "produces": [
-                    "text/csv"
+                    "application/json"
                 ],
                 "tags": [
-                    "Reports"
+                    "Admin"
                 ],
-                "summary": "Запрос чтения отчета по истории сегментов пользователя",
+                "summary": "Запрос версии конфигурации",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.ConfigVersion"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/evaluation/changes": {
+            "get": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для получения пользователей и сегментов, измененных после курсора. Новое состояние измененных пользователей и сегментов читается запросом снимка. Если изменения после курсора уже удалены, возвращается 410 и нужно заново прочитать снимок",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Evaluation"
+                ],
+                "summary": "Запрос ленты изменений",
                 "parameters": [
                     {
                         "type": "string",
-                        "example": "report12345.csv",
-                        "description": "report filename",
-                        "name": "filename",
-                        "in": "path",
+                        "example": "1024.0",
+                        "description": "cursor of the snapshot or of the previous page",
+                        "name": "cursor",
+                        "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "example": 100,
+                        "description": "max amount of changes, 1000 by default",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
-                    },
-                    "204": {
-                        "description": "No Content"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.ChangesPage"
+                        }
                     },
                     "400": {
-                        "description": "Bad Request"
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     },
-                    "404": {
-                        "description": "Not Found"
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     }
                 }
             }
         },
-        "/api/segment": {
+        "/api/evaluation/snapshot": {
             "post": {
-                "description": "Запрос для создания сегмента по уникальному названию",
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для получения всех сегментов пространства имен и сегментов переданных пользователей (до 1000 за запрос) вместе с курсором ленты изменений. Пользователи, которых не существует, в ответ не попадают",
                 "consumes": [
                     "application/json"
                 ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "Segments"
+                    "Evaluation"
                 ],
-                "summary": "Запрос для создания нового сегмента",
+                "summary": "Запрос снимка состояния для локального вычисления сегментов",
                 "parameters": [
                     {
-                        "description": "segment info",
+                        "description": "users",
                         "name": "input",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Slug"
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.SnapshotRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
-                    },
-                    "202": {
-                        "description": "Accepted"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.EvaluationSnapshot"
+                        }
                     },
                     "400": {
-                        "description": "Bad Request"
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     },
-                    "409": {
-                        "description": "Conflict"
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     }
                 }
-            },
-            "delete": {
-                "description": "Запрос для удаления сегмента из списка существующих сегментов по уникальному названию",
-                "consumes": [
+            }
+        },
+        "/api/keys": {
+            "get": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для получения всех выпущенных API-ключей, включая отозванные, без самих ключей",
+                "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Segments"
+                    "Keys"
                 ],
-                "summary": "Запрос для удаления сегмента",
+                "summary": "Запрос списка API-ключей",
                 "parameters": [
                     {
-                        "description": "segment info",
-                        "name": "input",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.SlugNoPercent"
-                        }
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
                     }
                 ],
                 "responses": {
-                    "202": {
-                        "description": "Accepted"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.APIKey"
+                            }
+                        }
                     },
-                    "400": {
-                        "description": "Bad Request"
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     },
-                    "404": {
-                        "description": "Not Found"
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     }
                 }
-            }
-        },
-        "/api/user": {
+            },
             "post": {
-                "description": "Запрос для обновления списка сегментов пользователя",
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для создания API-ключа с набором прав, сам ключ возвращается только в ответе на этот запрос",
                 "consumes": [
                     "application/json"
                 ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "Users"
+                    "Keys"
                 ],
-                "summary": "Запрос обновления сегментов пользователя",
+                "summary": "Запрос для выпуска API-ключа",
                 "parameters": [
                     {
-                        "description": "user segment info",
+                        "description": "key info",
                         "name": "input",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.UserUpdate"
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.APIKeyRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK"
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.IssuedAPIKey"
+                        }
                     },
                     "400": {
-                        "description": "Bad Request"
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     },
-                    "404": {
-                        "description": "Not Found"
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     }
                 }
             }
         },
-        "/api/user-history/{id}": {
-            "get": {
-                "description": "Запрос для создания отчета по истории сегментов пользователя в формате csv",
-                "produces": [
-                    "text/plain"
+        "/api/keys/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Запрос для отзыва API-ключа по идентификатору, после отзыва ключ перестает приниматься",
                 "tags": [
-                    "Reports"
+                    "Keys"
                 ],
-                "summary": "Запрос формирования отчета по истории сегментов пользователя",
+                "summary": "Запрос для отзыва API-ключа",
                 "parameters": [
                     {
                         "type": "string",
-                        "example": "1",
-                        "description": "user id",
+                        "description": "key id",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "example": "2023-9",
-                        "description": "start date",
-                        "name": "start",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "example": "2023-9",
-                        "description": "end date",
-                        "name": "end",
-                        "in": "query"
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
                     },
                     {
                         "type": "string",
-                        "example": "2023-9",
-                        "description": "exact date",
-                        "name": "exact",
-                        "in": "query"
+                        "description": "key of the request, retries with the same key get the first response instead of being processed again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK"
+                    "204": {
+                        "description": "No Content"
                     },
-                    "400": {
-                        "description": "Bad Request"
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     },
                     "404": {
-                        "description": "Not Found"
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     },
                     "500": {
-                        "description": "Internal Server Error"
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
                     }
                 }
             }
         },
-        "/api/user/{id}": {
+        "/api/reports/{filename}": {
             "get": {
-                "description": "Запрос для получения списка сегментов пользователя",
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для получения отчета по истории сегментов пользователя в формате csv",
                 "produces": [
-                    "application/json"
+                    "text/csv"
                 ],
                 "tags": [
-                    "Users"
+                    "Reports"
                 ],
-                "summary": "Запрос чтения сегментов пользователя",
+                "summary": "Запрос чтения отчета по истории сегментов пользователя",
                 "parameters": [
                     {
                         "type": "string",
-                        "example": "1",
-                        "description": "user id",
+                        "example": "report12345.csv",
+                        "description": "report filename",
+                        "name": "filename",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/schedule": {
+            "post": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для добавления пользователя в сегменты в заданный момент времени. Если указан ends_at, пользователь будет удален из сегментов в это время",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Запрос планирования добавления пользователя в сегменты",
+                "parameters": [
+                    {
+                        "description": "schedule info",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.ScheduleUpdate"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "key of the request, retries with the same key get the first response instead of being processed again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/schedule/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для получения списка еще не активированных добавлений пользователя в сегменты",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Запрос чтения запланированных добавлений пользователя в сегменты",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "1",
+                        "description": "user id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "eventual",
+                            "strong"
+                        ],
+                        "type": "string",
+                        "description": "strong reads from the primary database, so the response includes the writes made just before",
+                        "name": "X-Read-Consistency",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.ScheduledAssignment"
+                            }
+                        }
+                    },
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/segment": {
+            "get": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для получения всех сегментов пространства имен с их настройками",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Запрос списка сегментов",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "eventual",
+                            "strong"
+                        ],
+                        "type": "string",
+                        "description": "strong reads from the primary database, so the response includes the writes made just before",
+                        "name": "X-Read-Consistency",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Segment"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для создания сегмента по уникальному названию",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Запрос для создания нового сегмента",
+                "parameters": [
+                    {
+                        "description": "segment info",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Slug"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "key of the request, retries with the same key get the first response instead of being processed again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "202": {
+                        "description": "Accepted"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для удаления сегмента из списка существующих сегментов по уникальному названию",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Запрос для удаления сегмента",
+                "parameters": [
+                    {
+                        "description": "segment info",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.SlugNoPercent"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "key of the request, retries with the same key get the first response instead of being processed again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для изменения TTL по умолчанию и даты окончания сегмента. Не переданные поля не меняются, пустая строка удаляет настройку",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Запрос для изменения настроек сегмента",
+                "parameters": [
+                    {
+                        "description": "segment settings",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.SegmentUpdate"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "key of the request, retries with the same key get the first response instead of being processed again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/ttl": {
+            "get": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для получения списка запланированных удалений пользователя из сегментов. Нужно указать id пользователя, сегмент или оба параметра",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Запрос чтения TTL сегментов",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "1",
+                        "description": "user id",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "SEGMENT_NAME",
+                        "description": "segment name",
+                        "name": "slug",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "eventual",
+                            "strong"
+                        ],
+                        "type": "string",
+                        "description": "strong reads from the primary database, so the response includes the writes made just before",
+                        "name": "X-Read-Consistency",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.DeletionTime"
+                            }
+                        }
+                    },
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для отмены запланированного удаления пользователя из сегмента, после чего пользователь остается в сегменте бессрочно",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Запрос удаления TTL сегмента пользователя",
+                "parameters": [
+                    {
+                        "description": "ttl info",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.TTLRemoval"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "key of the request, retries with the same key get the first response instead of being processed again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для продления или сокращения времени нахождения пользователя в сегменте. Если TTL еще не был задан, он будет создан",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Запрос изменения TTL сегмента пользователя",
+                "parameters": [
+                    {
+                        "description": "ttl info",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.TTLUpdate"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "key of the request, retries with the same key get the first response instead of being processed again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user": {
+            "post": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для обновления списка сегментов пользователя",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Запрос обновления сегментов пользователя",
+                "parameters": [
+                    {
+                        "description": "user segment info",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.UserUpdate"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "key of the request, retries with the same key get the first response instead of being processed again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user-history/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для создания отчета по истории сегментов пользователя в формате csv",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Reports"
+                ],
+                "summary": "Запрос формирования отчета по истории сегментов пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "1",
+                        "description": "user id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "example": "2023-9",
+                        "description": "start date",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "2023-9",
+                        "description": "end date",
+                        "name": "end",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "2023-9",
+                        "description": "exact date",
+                        "name": "exact",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "eventual",
+                            "strong"
+                        ],
+                        "type": "string",
+                        "description": "strong reads from the primary database, so the response includes the writes made just before",
+                        "name": "X-Read-Consistency",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "APIKey": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос для получения списка сегментов пользователя",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Запрос чтения сегментов пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "1",
+                        "description": "user id",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "namespace, the default one is used when not set",
+                        "name": "X-Namespace",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "eventual",
+                            "strong"
+                        ],
+                        "type": "string",
+                        "description": "strong reads from the primary database, so the response includes the writes made just before",
+                        "name": "X-Read-Consistency",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK"
                     },
-                    "204": {
-                        "description": "No Content"
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "description": "Запрос для проверки того, что процесс сервиса запущен и обрабатывает запросы",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Проверка живости сервиса",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.HealthStatus"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Запрос для проверки готовности сервиса принимать трафик: доступности БД, версии схемы БД, возможности записи отчетов и работы планировщика",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Проверка готовности сервиса",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.HealthStatus"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.HealthStatus"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "github_com_PoorMercymain_user-segmenter_internal_domain.APIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2023-09-30T20:19:05+03:00"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "8f2c1e0a9b7d6c5e"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "billing"
+                },
+                "namespace": {
+                    "type": "string",
+                    "example": "default"
+                },
+                "revoked_at": {
+                    "type": "string",
+                    "example": "2023-10-30T20:19:05+03:00"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "users:read",
+                        "reports:read"
+                    ]
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.APIKeyRequest": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "billing"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "users:read",
+                        "reports:read"
+                    ]
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.Change": {
+            "type": "object",
+            "properties": {
+                "slug": {
+                    "type": "string",
+                    "example": "SEGMENT_NAME"
+                },
+                "user_id": {
+                    "type": "string",
+                    "example": "1"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.ChangesPage": {
+            "type": "object",
+            "properties": {
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.Change"
+                    }
+                },
+                "cursor": {
+                    "type": "string",
+                    "example": "1025.17"
+                },
+                "has_more": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.CheckResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "connection refused"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.ConfigVersion": {
+            "type": "object",
+            "properties": {
+                "checksum": {
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+                },
+                "failed_reloads": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "file": {
+                    "type": "string",
+                    "example": "/etc/user-segmenter/config.yaml"
+                },
+                "last_error": {
+                    "type": "string",
+                    "example": "ttl_batch_size: should be positive, got 0"
+                },
+                "loaded_at": {
+                    "type": "string",
+                    "example": "2023-09-30T20:19:05+03:00"
+                },
+                "pending_restart": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "db_max_conns"
+                    ]
+                },
+                "reloads": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "version": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.DeletionTime": {
+            "type": "object",
+            "properties": {
+                "slug": {
+                    "type": "string",
+                    "example": "SEGMENT_NAME"
+                },
+                "ttl": {
+                    "type": "string",
+                    "example": "2023-09-30T20:19:05+03:00"
+                },
+                "user_id": {
+                    "type": "string",
+                    "example": "1"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.EvaluationMembership": {
+            "type": "object",
+            "properties": {
+                "slug": {
+                    "type": "string",
+                    "example": "SEGMENT_NAME"
+                },
+                "ttl": {
+                    "type": "string",
+                    "example": "2023-09-30T20:19:05+03:00"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.EvaluationSegment": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string",
+                    "example": "2023-09-30T20:19:05+03:00"
+                },
+                "slug": {
+                    "type": "string",
+                    "example": "SEGMENT_NAME"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.EvaluationSnapshot": {
+            "type": "object",
+            "properties": {
+                "cursor": {
+                    "type": "string",
+                    "example": "1024.0"
+                },
+                "segments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.EvaluationSegment"
+                    }
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.EvaluationUser"
+                    }
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.EvaluationUser": {
+            "type": "object",
+            "properties": {
+                "memberships": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.EvaluationMembership"
+                    }
+                },
+                "user_id": {
+                    "type": "string",
+                    "example": "1"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.HealthStatus": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/github_com_PoorMercymain_user-segmenter_internal_domain.CheckResult"
+                    }
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ready"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.IssuedAPIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2023-09-30T20:19:05+03:00"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "8f2c1e0a9b7d6c5e"
+                },
+                "key": {
+                    "type": "string",
+                    "example": "usk_0123456789abcdef0123456789abcdef0123456789abcdef"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "billing"
+                },
+                "namespace": {
+                    "type": "string",
+                    "example": "default"
+                },
+                "revoked_at": {
+                    "type": "string",
+                    "example": "2023-10-30T20:19:05+03:00"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
                     },
-                    "404": {
-                        "description": "Not Found"
+                    "example": [
+                        "users:read",
+                        "reports:read"
+                    ]
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "segment_not_found"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "segment not found: AVITO_VOICE_MESSAGES"
+                },
+                "field": {
+                    "type": "string",
+                    "example": "ttl"
+                },
+                "instance": {
+                    "type": "string",
+                    "example": "/api/segment"
+                },
+                "slug": {
+                    "type": "string",
+                    "example": "AVITO_VOICE_MESSAGES"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 404
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Not Found"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "urn:user-segmenter:problem:segment_not_found"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.ScheduleUpdate": {
+            "type": "object",
+            "properties": {
+                "ends_at": {
+                    "type": "string",
+                    "example": "2023-10-02T00:00:00+03:00"
+                },
+                "slugs": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
                     },
-                    "500": {
-                        "description": "Internal Server Error"
-                    }
+                    "example": [
+                        "SEGMENT_NAME"
+                    ]
+                },
+                "starts_at": {
+                    "type": "string",
+                    "example": "2023-09-30T00:00:00+03:00"
+                },
+                "user_id": {
+                    "type": "string",
+                    "example": "1"
                 }
             }
-        }
-    },
-    "definitions": {
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.ScheduledAssignment": {
+            "type": "object",
+            "properties": {
+                "ends_at": {
+                    "type": "string",
+                    "example": "2023-10-02T00:00:00+03:00"
+                },
+                "slug": {
+                    "type": "string",
+                    "example": "SEGMENT_NAME"
+                },
+                "starts_at": {
+                    "type": "string",
+                    "example": "2023-09-30T00:00:00+03:00"
+                },
+                "user_id": {
+                    "type": "string",
+                    "example": "1"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.Segment": {
+            "type": "object",
+            "properties": {
+                "created_by": {
+                    "type": "string",
+                    "example": "key:8f2c1e0a9b7d6c5e"
+                },
+                "expires_at": {
+                    "type": "string",
+                    "example": "2023-09-30T20:19:05+03:00"
+                },
+                "slug": {
+                    "type": "string",
+                    "example": "SEGMENT_NAME"
+                },
+                "ttl": {
+                    "type": "string",
+                    "example": "48h0m0s"
+                },
+                "updated_by": {
+                    "type": "string",
+                    "example": "key:8f2c1e0a9b7d6c5e"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.SegmentUpdate": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string",
+                    "example": "2023-09-30T20:19:05+03:00"
+                },
+                "slug": {
+                    "type": "string",
+                    "example": "SEGMENT_NAME"
+                },
+                "ttl": {
+                    "type": "string",
+                    "example": "48h"
+                }
+            }
+        },
         "github_com_PoorMercymain_user-segmenter_internal_domain.Slug": {
             "type": "object",
             "properties": {
+                "expires_at": {
+                    "type": "string",
+                    "example": "2023-09-30T20:19:05+03:00"
+                },
                 "percent": {
                     "type": "integer",
                     "example": 10
@@ -272,6 +2144,10 @@ const docTemplate = `{
                 "slug": {
                     "type": "string",
                     "example": "SEGMENT_NAME"
+                },
+                "ttl": {
+                    "type": "string",
+                    "example": "48h"
                 }
             }
         },
@@ -284,6 +2160,51 @@ const docTemplate = `{
                 }
             }
         },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.SnapshotRequest": {
+            "type": "object",
+            "properties": {
+                "user_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "1",
+                        "2"
+                    ]
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.TTLRemoval": {
+            "type": "object",
+            "properties": {
+                "slug": {
+                    "type": "string",
+                    "example": "SEGMENT_NAME"
+                },
+                "user_id": {
+                    "type": "string",
+                    "example": "1"
+                }
+            }
+        },
+        "github_com_PoorMercymain_user-segmenter_internal_domain.TTLUpdate": {
+            "type": "object",
+            "properties": {
+                "slug": {
+                    "type": "string",
+                    "example": "SEGMENT_NAME"
+                },
+                "ttl": {
+                    "type": "string",
+                    "example": "2023-09-30T20:19:05+03:00"
+                },
+                "user_id": {
+                    "type": "string",
+                    "example": "1"
+                }
+            }
+        },
         "github_com_PoorMercymain_user-segmenter_internal_domain.UserUpdate": {
             "type": "object",
             "properties": {
@@ -321,6 +2242,19 @@ const docTemplate = `{
             }
         }
     },
+    "securityDefinitions": {
+        "APIKey": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "description": "API-ключ или JWT в формате \"Bearer \u003cтокен\u003e\"",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
+    },
     "tags": [
         {
             "description": "Группа запросов для управления списком существующих сегментов",
@@ -333,6 +2267,18 @@ const docTemplate = `{
         {
             "description": "Группа запросов для работы с отчетами по истории сегментов пользователя",
             "name": "Reports"
+        },
+        {
+            "description": "Группа запросов для проверки состояния сервиса",
+            "name": "Health"
+        },
+        {
+            "description": "Группа запросов для управления API-ключами",
+            "name": "Keys"
+        },
+        {
+            "description": "Группа запросов для вычисления сегментов на стороне клиента",
+            "name": "Evaluation"
         }
     ]
 }`
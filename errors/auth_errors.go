@@ -0,0 +1,11 @@
+package errors
+
+import "errors"
+
+var (
+	ErrorUnauthenticated         = errors.New("API key or token is missing or invalid")
+	ErrorInsufficientScope       = errors.New("client does not have the required scope")
+	ErrorAPIKeyNotFound    error = &notFoundError{"API key not found"}
+	ErrorUnknownScope            = errors.New("unknown scope")
+	ErrorUnknownAuthMode         = errors.New("unknown auth mode")
+)
@@ -0,0 +1,8 @@
+package errors
+
+import "errors"
+
+var (
+	ErrorCursorExpired = errors.New("changes after the cursor were pruned, a new snapshot should be read")
+	ErrorInvalidCursor = errors.New("cursor is malformed")
+)
@@ -0,0 +1,9 @@
+package errors
+
+import "errors"
+
+var (
+	ErrorUnknownConfigFormat = errors.New("unknown config file format, expected .yaml, .yml or .toml")
+	ErrorUnknownConfigKeys   = errors.New("unknown keys in the config file")
+	ErrorUnknownStorage      = errors.New("unknown storage, expected postgres or memory")
+)
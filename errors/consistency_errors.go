@@ -0,0 +1,5 @@
+package errors
+
+import "errors"
+
+var ErrorUnknownReadConsistency = errors.New("read consistency should be eventual or strong")
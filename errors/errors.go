@@ -0,0 +1,237 @@
+package errors
+
+import "errors"
+
+// Codes are sent to clients to handle errors programmatically, so they should never be changed
+const (
+	CodeInternal                 = "internal"
+	CodeNotFound                 = "not_found"
+	CodeSegmentNotFound          = "segment_not_found"
+	CodeSegmentAlreadyExists     = "segment_already_exists"
+	CodeUserNotFound             = "user_not_found"
+	CodeUserNotInSegment         = "user_not_in_segment"
+	CodeTTLNotFound              = "ttl_not_found"
+	CodeInvalidSlug              = "invalid_slug"
+	CodeInvalidContentType       = "invalid_content_type"
+	CodeInvalidJSON              = "invalid_json"
+	CodeDuplicateJSONKey         = "duplicate_json_key"
+	CodeUnknownField             = "unknown_field"
+	CodeMissingField             = "missing_field"
+	CodeInvalidField             = "invalid_field"
+	CodeReportNotFound           = "report_not_found"
+	CodeInvalidReportName        = "invalid_report_name"
+	CodeUnauthenticated          = "unauthenticated"
+	CodeInsufficientScope        = "insufficient_scope"
+	CodeAPIKeyNotFound           = "api_key_not_found"
+	CodeInvalidNamespace         = "invalid_namespace"
+	CodeNamespaceForbidden       = "namespace_forbidden"
+	CodeRateLimited              = "rate_limited"
+	CodeBodyTooLarge             = "body_too_large"
+	CodeCursorExpired            = "cursor_expired"
+	CodeIdempotencyKeyReused     = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress = "idempotency_key_in_progress"
+)
+
+var (
+	ErrorSegmentNotFound    error = &notFoundError{"segment not found"}
+	ErrorUserNotFound       error = &notFoundError{"user not found"}
+	ErrorUserNotInSegment   error = &notFoundError{"user is not in the segment"}
+	ErrorTTLNotFound        error = &notFoundError{"segment TTL is not set for the user"}
+	ErrorInvalidContentType       = errors.New("content type should be application/json")
+	ErrorInvalidJSON              = errors.New("request body is not a valid JSON")
+	ErrorUnknownField             = errors.New("unknown field")
+	ErrorMissingField             = errors.New("required field is missing or empty")
+	ErrorInvalidField             = errors.New("field has an invalid value")
+)
+
+// notFoundError keeps errors.Is(err, ErrorNoRows) true for the more specific not found errors
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func (e *notFoundError) Unwrap() error {
+	return ErrorNoRows
+}
+
+// Error adds a stable machine-readable code and the offending slug or field to an error
+type Error struct {
+	Code  string
+	Slug  string
+	Field string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Slug != "" {
+		return e.Err.Error() + ": " + e.Slug
+	}
+
+	if e.Field != "" {
+		return e.Err.Error() + ": " + e.Field
+	}
+
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func SegmentNotFound(slug string) error {
+	return &Error{Code: CodeSegmentNotFound, Slug: slug, Err: ErrorSegmentNotFound}
+}
+
+func SegmentAlreadyExists(slug string) error {
+	return &Error{Code: CodeSegmentAlreadyExists, Slug: slug, Err: ErrorUniqueViolation}
+}
+
+func UserNotFound() error {
+	return &Error{Code: CodeUserNotFound, Err: ErrorUserNotFound}
+}
+
+func UserNotInSegment(slug string) error {
+	return &Error{Code: CodeUserNotInSegment, Slug: slug, Err: ErrorUserNotInSegment}
+}
+
+func TTLNotFound(slug string) error {
+	return &Error{Code: CodeTTLNotFound, Slug: slug, Err: ErrorTTLNotFound}
+}
+
+func InvalidSlug(slug string) error {
+	return &Error{Code: CodeInvalidSlug, Slug: slug, Err: ErrorNotASlug}
+}
+
+func InvalidContentType() error {
+	return &Error{Code: CodeInvalidContentType, Err: ErrorInvalidContentType}
+}
+
+func InvalidJSON(err error) error {
+	return &Error{Code: CodeInvalidJSON, Err: errors.Join(ErrorInvalidJSON, err)}
+}
+
+func DuplicateJSONKey(field string) error {
+	return &Error{Code: CodeDuplicateJSONKey, Field: field, Err: ErrorDuplicateInJSON}
+}
+
+func UnknownField(field string) error {
+	return &Error{Code: CodeUnknownField, Field: field, Err: ErrorUnknownField}
+}
+
+func MissingField(field string) error {
+	return &Error{Code: CodeMissingField, Field: field, Err: ErrorMissingField}
+}
+
+func Unauthenticated() error {
+	return &Error{Code: CodeUnauthenticated, Err: ErrorUnauthenticated}
+}
+
+// InsufficientScope names the missing scope in Field, as scopes are what a client has to ask for
+func InsufficientScope(scope string) error {
+	return &Error{Code: CodeInsufficientScope, Field: scope, Err: ErrorInsufficientScope}
+}
+
+func APIKeyNotFound() error {
+	return &Error{Code: CodeAPIKeyNotFound, Err: ErrorAPIKeyNotFound}
+}
+
+// InvalidNamespace and NamespaceForbidden set Field, as the namespace is a parameter of the request
+func InvalidNamespace() error {
+	return &Error{Code: CodeInvalidNamespace, Field: "namespace", Err: ErrorInvalidNamespace}
+}
+
+func NamespaceForbidden() error {
+	return &Error{Code: CodeNamespaceForbidden, Field: "namespace", Err: ErrorNamespaceForbidden}
+}
+
+func RateLimited() error {
+	return &Error{Code: CodeRateLimited, Err: ErrorRateLimited}
+}
+
+func BodyTooLarge() error {
+	return &Error{Code: CodeBodyTooLarge, Err: ErrorBodyTooLarge}
+}
+
+func CursorExpired() error {
+	return &Error{Code: CodeCursorExpired, Field: "cursor", Err: ErrorCursorExpired}
+}
+
+// IdempotencyKeyReused and IdempotencyKeyInProgress set Field, as the key is a header of the request
+func IdempotencyKeyReused() error {
+	return &Error{Code: CodeIdempotencyKeyReused, Field: "Idempotency-Key", Err: ErrorIdempotencyKeyReused}
+}
+
+func IdempotencyKeyInProgress() error {
+	return &Error{Code: CodeIdempotencyKeyInProgress, Field: "Idempotency-Key", Err: ErrorIdempotencyKeyInProgress}
+}
+
+// InvalidField wraps the reason of the field being invalid, e.g. a parsing error
+func InvalidField(field string, err error) error {
+	if err == nil {
+		err = ErrorInvalidField
+	}
+
+	return &Error{Code: CodeInvalidField, Field: field, Err: err}
+}
+
+// CodeOf returns the code of err. Errors without a code get one by the sentinel error they wrap
+func CodeOf(err error) string {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Code
+	}
+
+	switch {
+	case errors.Is(err, ErrorSegmentNotFound):
+		return CodeSegmentNotFound
+	case errors.Is(err, ErrorUserNotFound):
+		return CodeUserNotFound
+	case errors.Is(err, ErrorUserNotInSegment):
+		return CodeUserNotInSegment
+	case errors.Is(err, ErrorTTLNotFound):
+		return CodeTTLNotFound
+	case errors.Is(err, ErrorAPIKeyNotFound):
+		return CodeAPIKeyNotFound
+	case errors.Is(err, ErrorNoRows):
+		return CodeNotFound
+	case errors.Is(err, ErrorUniqueViolation):
+		return CodeSegmentAlreadyExists
+	case errors.Is(err, ErrorNotASlug):
+		return CodeInvalidSlug
+	case errors.Is(err, ErrorDuplicateInJSON):
+		return CodeDuplicateJSONKey
+	case errors.Is(err, ErrorFileNotFound):
+		return CodeReportNotFound
+	case errors.Is(err, ErrorBadFilename):
+		return CodeInvalidReportName
+	case errors.Is(err, ErrorUnauthenticated):
+		return CodeUnauthenticated
+	case errors.Is(err, ErrorInsufficientScope):
+		return CodeInsufficientScope
+	case errors.Is(err, ErrorInvalidNamespace):
+		return CodeInvalidNamespace
+	case errors.Is(err, ErrorNamespaceForbidden):
+		return CodeNamespaceForbidden
+	case errors.Is(err, ErrorRateLimited):
+		return CodeRateLimited
+	case errors.Is(err, ErrorBodyTooLarge):
+		return CodeBodyTooLarge
+	case errors.Is(err, ErrorCursorExpired):
+		return CodeCursorExpired
+	case errors.Is(err, ErrorInvalidCursor):
+		return CodeInvalidField
+	case errors.Is(err, ErrorIdempotencyKeyReused):
+		return CodeIdempotencyKeyReused
+	case errors.Is(err, ErrorIdempotencyKeyInProgress):
+		return CodeIdempotencyKeyInProgress
+	case errors.Is(err, ErrorIdempotencyKeyTooLong):
+		return CodeInvalidField
+	case errors.Is(err, ErrorNotPositiveTTL), errors.Is(err, ErrorExpirationInPast):
+		return CodeInvalidField
+	}
+
+	return CodeInternal
+}
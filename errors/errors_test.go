@@ -0,0 +1,50 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestError(t *testing.T) {
+	err := SegmentNotFound("AVITO_TEST")
+	require.ErrorIs(t, err, ErrorSegmentNotFound)
+	require.ErrorIs(t, err, ErrorNoRows)
+	require.Equal(t, "segment not found: AVITO_TEST", err.Error())
+	require.Equal(t, CodeSegmentNotFound, CodeOf(fmt.Errorf("wrapped: %w", err)))
+
+	err = MissingField("slug")
+	require.ErrorIs(t, err, ErrorMissingField)
+	require.Equal(t, "required field is missing or empty: slug", err.Error())
+
+	parseErr := errors.New("bad duration")
+	err = InvalidField("ttl", parseErr)
+	require.ErrorIs(t, err, parseErr)
+	require.ErrorIs(t, InvalidField("ttl", nil), ErrorInvalidField)
+
+	require.ErrorIs(t, SegmentAlreadyExists("AVITO_TEST"), ErrorUniqueViolation)
+	require.ErrorIs(t, InvalidSlug("bad slug"), ErrorNotASlug)
+}
+
+func TestCodeOf(t *testing.T) {
+	require.Equal(t, CodeNotFound, CodeOf(ErrorNoRows))
+	require.Equal(t, CodeUserNotFound, CodeOf(ErrorUserNotFound))
+	require.Equal(t, CodeSegmentAlreadyExists, CodeOf(ErrorUniqueViolation))
+	require.Equal(t, CodeInvalidSlug, CodeOf(ErrorNotASlug))
+	require.Equal(t, CodeReportNotFound, CodeOf(ErrorFileNotFound))
+	require.Equal(t, CodeInvalidReportName, CodeOf(ErrorBadFilename))
+	require.Equal(t, CodeAPIKeyNotFound, CodeOf(ErrorAPIKeyNotFound))
+	require.Equal(t, CodeUnauthenticated, CodeOf(ErrorUnauthenticated))
+	require.Equal(t, CodeInsufficientScope, CodeOf(fmt.Errorf("wrapped: %w", InsufficientScope("users:read"))))
+	require.Equal(t, CodeInvalidNamespace, CodeOf(InvalidNamespace()))
+	require.Equal(t, CodeNamespaceForbidden, CodeOf(NamespaceForbidden()))
+	require.Equal(t, CodeRateLimited, CodeOf(RateLimited()))
+	require.Equal(t, CodeBodyTooLarge, CodeOf(fmt.Errorf("gzip: %w", BodyTooLarge())))
+	require.Equal(t, CodeCursorExpired, CodeOf(CursorExpired()))
+	require.Equal(t, CodeInvalidField, CodeOf(ErrorInvalidCursor))
+	require.Equal(t, CodeIdempotencyKeyReused, CodeOf(IdempotencyKeyReused()))
+	require.Equal(t, CodeIdempotencyKeyInProgress, CodeOf(ErrorIdempotencyKeyInProgress))
+	require.Equal(t, CodeInternal, CodeOf(errors.New("connection refused")))
+}
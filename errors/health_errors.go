@@ -0,0 +1,9 @@
+package errors
+
+import "errors"
+
+var (
+	ErrorSchemaVersionMismatch = errors.New("database schema version does not match the expected one")
+	ErrorSchedulerStale        = errors.New("scheduler has not finished a run successfully for too long")
+	ErrorShuttingDown          = errors.New("service is shutting down")
+)
@@ -0,0 +1,9 @@
+package errors
+
+import "errors"
+
+var (
+	ErrorIdempotencyKeyReused     = errors.New("idempotency key was already used for another request")
+	ErrorIdempotencyKeyInProgress = errors.New("request with the idempotency key is still in progress, retry later")
+	ErrorIdempotencyKeyTooLong    = errors.New("idempotency key is too long")
+)
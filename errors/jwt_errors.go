@@ -0,0 +1,10 @@
+package errors
+
+import "errors"
+
+var (
+	ErrorJWKSSourceNotSet = errors.New("JWKS file or URL should be set for the jwt auth mode")
+	ErrorJWKNotFound      = errors.New("no key with the token key ID in JWKS")
+	ErrorUnsupportedJWK   = errors.New("unsupported JWK")
+	ErrorNoExpiration     = errors.New("token has no expiration time")
+)
@@ -0,0 +1,8 @@
+package errors
+
+import "errors"
+
+var (
+	ErrorRateLimited  = errors.New("too many requests, retry later")
+	ErrorBodyTooLarge = errors.New("request body is too large")
+)
@@ -4,4 +4,6 @@ import "errors"
 
 var (
 	ErrorLoggerNotInitialized = errors.New("logger should be initialized, but it is nil")
+	ErrorUnknownLogFormat     = errors.New("unknown log format, expected json or console")
+	ErrorNoLogOutputs         = errors.New("at least one log output should be set")
 )
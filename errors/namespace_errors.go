@@ -0,0 +1,8 @@
+package errors
+
+import "errors"
+
+var (
+	ErrorInvalidNamespace   = errors.New("namespace should consist of lowercase latin letters, digits, '-' and '_' and be at most 63 characters long")
+	ErrorNamespaceForbidden = errors.New("client does not have access to the namespace")
+)
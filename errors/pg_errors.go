@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrorUniqueViolation = errors.New("unique violation error")
 	ErrorNoRows          = errors.New("no rows found for the provided slug")
+	ErrorReplicaLagging  = errors.New("replication lag of the replica is above the limit")
 )
@@ -0,0 +1,8 @@
+package errors
+
+import "errors"
+
+var (
+	ErrorNotPositiveTTL   = errors.New("segment TTL should be positive")
+	ErrorExpirationInPast = errors.New("segment expiration time should be in the future")
+)
@@ -0,0 +1,7 @@
+package errors
+
+import "errors"
+
+var (
+	ErrorUnknownTracingExporter = errors.New("unknown tracing exporter, expected none, stdout or otlp")
+)
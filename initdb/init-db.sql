@@ -1,9 +1,47 @@
 BEGIN TRANSACTION;
-CREATE TABLE deletion_times (user_id TEXT, slug TEXT, deletion_timestamp TIMESTAMP WITH TIME ZONE, PRIMARY KEY(user_id, slug));
-CREATE INDEX deletion_times_idx ON deletion_times USING BTREE (user_id, slug, deletion_timestamp);
-CREATE TABLE users_segment_history (user_id TEXT, slug TEXT, modified_at TIMESTAMP WITH TIME ZONE, is_deletion BOOLEAN);
-CREATE TABLE slugs (slug TEXT PRIMARY KEY);
-CREATE INDEX slugs_idx ON slugs USING BTREE (slug);
-CREATE TABLE users (user_id TEXT PRIMARY KEY, slugs TEXT[]);
-CREATE INDEX users_idx ON users USING BTREE (user_id);
-COMMIT;
\ No newline at end of file
+CREATE TABLE deletion_times (namespace TEXT NOT NULL DEFAULT 'default', user_id TEXT, slug TEXT, deletion_timestamp TIMESTAMP WITH TIME ZONE, PRIMARY KEY(namespace, user_id, slug));
+CREATE INDEX deletion_times_idx ON deletion_times USING BTREE (namespace, user_id, slug, deletion_timestamp);
+CREATE INDEX deletion_times_slug_idx ON deletion_times USING BTREE (namespace, slug, deletion_timestamp);
+CREATE TABLE users_segment_history (namespace TEXT NOT NULL DEFAULT 'default', user_id TEXT, slug TEXT, modified_at TIMESTAMP WITH TIME ZONE, is_deletion BOOLEAN, operation TEXT, actor TEXT);
+CREATE INDEX users_segment_history_idx ON users_segment_history USING BTREE (namespace, user_id, modified_at);
+CREATE TABLE slugs (namespace TEXT NOT NULL DEFAULT 'default', slug TEXT, default_ttl BIGINT, expires_at TIMESTAMP WITH TIME ZONE, created_by TEXT, updated_by TEXT, PRIMARY KEY(namespace, slug));
+CREATE INDEX slugs_expires_at_idx ON slugs USING BTREE (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX slugs_idx ON slugs USING BTREE (namespace, slug);
+CREATE TABLE users (namespace TEXT NOT NULL DEFAULT 'default', user_id TEXT, slugs TEXT[], PRIMARY KEY(namespace, user_id));
+CREATE INDEX users_idx ON users USING BTREE (namespace, user_id);
+CREATE TABLE scheduled_assignments (namespace TEXT NOT NULL DEFAULT 'default', user_id TEXT, slug TEXT, starts_at TIMESTAMP WITH TIME ZONE, ends_at TIMESTAMP WITH TIME ZONE, PRIMARY KEY(namespace, user_id, slug, starts_at));
+CREATE INDEX scheduled_assignments_starts_at_idx ON scheduled_assignments USING BTREE (starts_at);
+CREATE TABLE api_keys (id TEXT PRIMARY KEY, name TEXT NOT NULL, namespace TEXT NOT NULL DEFAULT 'default', key_hash TEXT NOT NULL UNIQUE, scopes TEXT[] NOT NULL, created_at TIMESTAMP WITH TIME ZONE NOT NULL, revoked_at TIMESTAMP WITH TIME ZONE);
+CREATE TABLE changes (id BIGSERIAL PRIMARY KEY, tx BIGINT NOT NULL DEFAULT pg_current_xact_id()::text::bigint, namespace TEXT NOT NULL, user_id TEXT, slug TEXT, changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now());
+CREATE INDEX changes_idx ON changes USING BTREE (namespace, tx, id);
+CREATE INDEX changes_changed_at_idx ON changes USING BTREE (changed_at);
+CREATE TABLE changes_horizon (tx BIGINT NOT NULL, id BIGINT NOT NULL);
+INSERT INTO changes_horizon VALUES (0, 0);
+CREATE FUNCTION record_user_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO changes (namespace, user_id) VALUES (OLD.namespace, OLD.user_id);
+    ELSE
+        INSERT INTO changes (namespace, user_id) VALUES (NEW.namespace, NEW.user_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE FUNCTION record_segment_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO changes (namespace, slug) VALUES (OLD.namespace, OLD.slug);
+    ELSE
+        INSERT INTO changes (namespace, slug) VALUES (NEW.namespace, NEW.slug);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER users_changes AFTER INSERT OR UPDATE OR DELETE ON users FOR EACH ROW EXECUTE FUNCTION record_user_change();
+CREATE TRIGGER deletion_times_changes AFTER INSERT OR UPDATE OR DELETE ON deletion_times FOR EACH ROW EXECUTE FUNCTION record_user_change();
+CREATE TRIGGER slugs_changes AFTER INSERT OR UPDATE OR DELETE ON slugs FOR EACH ROW EXECUTE FUNCTION record_segment_change();
+CREATE TABLE idempotency_keys (namespace TEXT NOT NULL, client_id TEXT NOT NULL, key TEXT NOT NULL, fingerprint TEXT NOT NULL, status INT, content_type TEXT, body BYTEA, expires_at TIMESTAMP WITH TIME ZONE NOT NULL, PRIMARY KEY(namespace, client_id, key));
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys USING BTREE (expires_at);
+CREATE TABLE schema_version (version INT NOT NULL);
+INSERT INTO schema_version VALUES (5);
+COMMIT;
@@ -1,52 +1,414 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/caarlos0/env/v6"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/tracing"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
 )
 
+// Config is read from the defaults, the config file, the environment and the flags, each one overrides the previous.
+// A key of the config file is the name of the environment variable in lower case
 type Config struct {
-	ServerAddress string `env:"RUN_ADDRESS"`
-	DatabaseURI   string `env:"DATABASE_URI"`
+	ServerAddress           string        `env:"RUN_ADDRESS" yaml:"run_address" toml:"run_address"`
+	GRPCAddress             string        `env:"GRPC_ADDRESS" yaml:"grpc_address" toml:"grpc_address"`
+	Storage                 string        `env:"STORAGE" yaml:"storage" toml:"storage"`
+	DatabaseURI             string        `env:"DATABASE_URI" yaml:"database_uri" toml:"database_uri"`
+	DBMaxConns              int32         `env:"DB_MAX_CONNS" yaml:"db_max_conns" toml:"db_max_conns"`
+	DBMinConns              int32         `env:"DB_MIN_CONNS" yaml:"db_min_conns" toml:"db_min_conns"`
+	DBMaxConnLifetime       time.Duration `env:"DB_MAX_CONN_LIFETIME" yaml:"db_max_conn_lifetime" toml:"db_max_conn_lifetime"`
+	DBMaxConnIdleTime       time.Duration `env:"DB_MAX_CONN_IDLE_TIME" yaml:"db_max_conn_idle_time" toml:"db_max_conn_idle_time"`
+	DBConnectTimeout        time.Duration `env:"DB_CONNECT_TIMEOUT" yaml:"db_connect_timeout" toml:"db_connect_timeout"`
+	DBStatementTimeout      time.Duration `env:"DB_STATEMENT_TIMEOUT" yaml:"db_statement_timeout" toml:"db_statement_timeout"`
+	DBConnectAttempts       int           `env:"DB_CONNECT_ATTEMPTS" yaml:"db_connect_attempts" toml:"db_connect_attempts"`
+	DBConnectBackoff        time.Duration `env:"DB_CONNECT_BACKOFF" yaml:"db_connect_backoff" toml:"db_connect_backoff"`
+	DBRetryAttempts         int           `env:"DB_RETRY_ATTEMPTS" yaml:"db_retry_attempts" toml:"db_retry_attempts"`
+	DBRetryBackoff          time.Duration `env:"DB_RETRY_BACKOFF" yaml:"db_retry_backoff" toml:"db_retry_backoff"`
+	DBReplicaURIs           string        `env:"DB_REPLICA_URIS" yaml:"db_replica_uris" toml:"db_replica_uris"`
+	DBReplicaCheckInterval  time.Duration `env:"DB_REPLICA_CHECK_INTERVAL" yaml:"db_replica_check_interval" toml:"db_replica_check_interval"`
+	DBReplicaMaxLag         time.Duration `env:"DB_REPLICA_MAX_LAG" yaml:"db_replica_max_lag" toml:"db_replica_max_lag"`
+	TTLInterval             time.Duration `env:"TTL_INTERVAL" yaml:"ttl_interval" toml:"ttl_interval"`
+	TTLBatchSize            int           `env:"TTL_BATCH_SIZE" yaml:"ttl_batch_size" toml:"ttl_batch_size"`
+	ChangesRetention        time.Duration `env:"CHANGES_RETENTION" yaml:"changes_retention" toml:"changes_retention"`
+	IdempotencyTTL          time.Duration `env:"IDEMPOTENCY_TTL" yaml:"idempotency_ttl" toml:"idempotency_ttl"`
+	ReportsDir              string        `env:"REPORTS_DIR" yaml:"reports_dir" toml:"reports_dir"`
+	GzipMinSize             int           `env:"GZIP_MIN_SIZE" yaml:"gzip_min_size" toml:"gzip_min_size"`
+	HTTPReadHeaderTimeout   time.Duration `env:"HTTP_READ_HEADER_TIMEOUT" yaml:"http_read_header_timeout" toml:"http_read_header_timeout"`
+	HTTPReadTimeout         time.Duration `env:"HTTP_READ_TIMEOUT" yaml:"http_read_timeout" toml:"http_read_timeout"`
+	HTTPWriteTimeout        time.Duration `env:"HTTP_WRITE_TIMEOUT" yaml:"http_write_timeout" toml:"http_write_timeout"`
+	HTTPIdleTimeout         time.Duration `env:"HTTP_IDLE_TIMEOUT" yaml:"http_idle_timeout" toml:"http_idle_timeout"`
+	ShutdownTimeout         time.Duration `env:"SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	ShutdownDelay           time.Duration `env:"SHUTDOWN_DELAY" yaml:"shutdown_delay" toml:"shutdown_delay"`
+	TracingExporter         string        `env:"TRACING_EXPORTER" yaml:"tracing_exporter" toml:"tracing_exporter"`
+	LogLevel                string        `env:"LOG_LEVEL" yaml:"log_level" toml:"log_level"`
+	LogFormat               string        `env:"LOG_FORMAT" yaml:"log_format" toml:"log_format"`
+	LogOutputs              string        `env:"LOG_OUTPUTS" yaml:"log_outputs" toml:"log_outputs"`
+	LogMaxSize              int           `env:"LOG_MAX_SIZE" yaml:"log_max_size" toml:"log_max_size"`
+	LogMaxBackups           int           `env:"LOG_MAX_BACKUPS" yaml:"log_max_backups" toml:"log_max_backups"`
+	LogMaxAge               int           `env:"LOG_MAX_AGE" yaml:"log_max_age" toml:"log_max_age"`
+	AuthModes               string        `env:"AUTH_MODES" yaml:"auth_modes" toml:"auth_modes"`
+	JWKSURL                 string        `env:"JWKS_URL" yaml:"jwks_url" toml:"jwks_url"`
+	JWTIssuer               string        `env:"JWT_ISSUER" yaml:"jwt_issuer" toml:"jwt_issuer"`
+	JWTAudience             string        `env:"JWT_AUDIENCE" yaml:"jwt_audience" toml:"jwt_audience"`
+	JWTScopeClaim           string        `env:"JWT_SCOPE_CLAIM" yaml:"jwt_scope_claim" toml:"jwt_scope_claim"`
+	JWTNamespaceClaim       string        `env:"JWT_NAMESPACE_CLAIM" yaml:"jwt_namespace_claim" toml:"jwt_namespace_claim"`
+	JWTLeeway               time.Duration `env:"JWT_LEEWAY" yaml:"jwt_leeway" toml:"jwt_leeway"`
+	RateLimit               float64       `env:"RATE_LIMIT" yaml:"rate_limit" toml:"rate_limit"`
+	RateBurst               int           `env:"RATE_BURST" yaml:"rate_burst" toml:"rate_burst"`
+	MaxBodySize             int64         `env:"MAX_BODY_SIZE" yaml:"max_body_size" toml:"max_body_size"`
+	MaxDecompressedBodySize int64         `env:"MAX_DECOMPRESSED_BODY_SIZE" yaml:"max_decompressed_body_size" toml:"max_decompressed_body_size"`
+
+	// File is the path of the config file, set by -config or CONFIG_FILE
+	File string `yaml:"-" toml:"-"`
+	// PrintConfig asks to print the configuration and exit
+	PrintConfig bool `yaml:"-" toml:"-"`
 }
 
-func GetServerConfig() *Config {
-	var envCfg Config
+const (
+	AuthModeAPIKey = "api_key"
+	AuthModeJWT    = "jwt"
+	AuthModeNone   = "none"
+)
 
-	outCfg := getServerFlags()
+// Storages keep the data in Postgres, or in memory of the process for tests and local development
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
 
-	_ = env.Parse(&envCfg)
+const redacted = "REDACTED"
 
-	flag.Parse()
+// GetServerConfig reads the configuration with the command line arguments args. The configuration is returned
+// together with validation errors, so it can be printed, errors of reading it are returned without it
+func GetServerConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	fs := serverFlags(cfg)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
 
-	foundDSNFlag := false
-	foundAddressFlag := false
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
 
-	flag.Visit(func(f *flag.Flag) {
-		if f.Name == "d" {
-			foundDSNFlag = true
+	if _, ok := flags["config"]; !ok {
+		cfg.File = os.Getenv("CONFIG_FILE")
+	}
+
+	if cfg.File != "" {
+		if err := loadFile(cfg.File, cfg); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", cfg.File, err)
 		}
+	}
+
+	if err := env.Parse(cfg); err != nil {
+		return nil, fmt.Errorf("environment: %w", err)
+	}
 
-		if f.Name == "a" {
-			foundAddressFlag = true
+	// the file and the environment were applied over the flags, so the flags are set again to take precedence
+	for name, value := range flags {
+		if err := fs.Set(name, value); err != nil {
+			return nil, err
 		}
-	})
+	}
 
-	if envCfg.ServerAddress != "" && !foundAddressFlag {
-		outCfg.ServerAddress = envCfg.ServerAddress
+	return cfg, cfg.Validate()
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
 	}
 
-	if envCfg.DatabaseURI != "" && !foundDSNFlag {
-		outCfg.DatabaseURI = envCfg.DatabaseURI
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		d := yaml.NewDecoder(bytes.NewReader(data))
+		d.KnownFields(true)
+		if err = d.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return err
+		}
+
+		if undecoded := meta.Undecoded(); len(undecoded) != 0 {
+			return fmt.Errorf("%w: %v", appErrors.ErrorUnknownConfigKeys, undecoded)
+		}
+	default:
+		return appErrors.ErrorUnknownConfigFormat
 	}
 
-	return outCfg
+	return nil
+}
+
+// Validate returns all problems of the configuration at once, named by the keys of the config file
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key string, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(c.ServerAddress != "", "run_address", "should be set")
+	check(c.Storage == StoragePostgres || c.Storage == StorageMemory, "storage", "%s, got %q", appErrors.ErrorUnknownStorage, c.Storage)
+	check(c.DatabaseURI != "", "database_uri", "should be set")
+	check(c.DBMaxConns >= 0, "db_max_conns", "should not be negative, got %d", c.DBMaxConns)
+	check(c.DBMinConns >= 0, "db_min_conns", "should not be negative, got %d", c.DBMinConns)
+	check(c.DBMaxConns == 0 || c.DBMinConns <= c.DBMaxConns, "db_min_conns", "should not be greater than db_max_conns %d, got %d", c.DBMaxConns, c.DBMinConns)
+	check(c.DBMaxConnLifetime >= 0, "db_max_conn_lifetime", "should not be negative, got %s", c.DBMaxConnLifetime)
+	check(c.DBMaxConnIdleTime >= 0, "db_max_conn_idle_time", "should not be negative, got %s", c.DBMaxConnIdleTime)
+	check(c.DBConnectTimeout >= 0, "db_connect_timeout", "should not be negative, got %s", c.DBConnectTimeout)
+	check(c.DBStatementTimeout >= 0, "db_statement_timeout", "should not be negative, got %s", c.DBStatementTimeout)
+	check(c.DBConnectAttempts > 0, "db_connect_attempts", "should be positive, got %d", c.DBConnectAttempts)
+	check(c.DBConnectBackoff >= 0, "db_connect_backoff", "should not be negative, got %s", c.DBConnectBackoff)
+	check(c.DBRetryAttempts > 0, "db_retry_attempts", "should be positive, got %d", c.DBRetryAttempts)
+	check(c.DBRetryBackoff >= 0, "db_retry_backoff", "should not be negative, got %s", c.DBRetryBackoff)
+	check(c.DBReplicaCheckInterval > 0, "db_replica_check_interval", "should be positive, got %s", c.DBReplicaCheckInterval)
+	check(c.DBReplicaMaxLag >= 0, "db_replica_max_lag", "should not be negative, got %s", c.DBReplicaMaxLag)
+	check(c.TTLInterval > 0, "ttl_interval", "should be positive, got %s", c.TTLInterval)
+	check(c.TTLBatchSize > 0, "ttl_batch_size", "should be positive, got %d", c.TTLBatchSize)
+	check(c.ChangesRetention > 0, "changes_retention", "should be positive, got %s", c.ChangesRetention)
+	check(c.IdempotencyTTL > 0, "idempotency_ttl", "should be positive, got %s", c.IdempotencyTTL)
+	check(c.ReportsDir != "", "reports_dir", "should be set")
+	check(c.GzipMinSize >= 0, "gzip_min_size", "should not be negative, got %d", c.GzipMinSize)
+	check(c.HTTPReadHeaderTimeout >= 0, "http_read_header_timeout", "should not be negative, got %s", c.HTTPReadHeaderTimeout)
+	check(c.HTTPReadTimeout >= 0, "http_read_timeout", "should not be negative, got %s", c.HTTPReadTimeout)
+	check(c.HTTPWriteTimeout >= 0, "http_write_timeout", "should not be negative, got %s", c.HTTPWriteTimeout)
+	check(c.HTTPIdleTimeout >= 0, "http_idle_timeout", "should not be negative, got %s", c.HTTPIdleTimeout)
+	check(c.ShutdownTimeout > 0, "shutdown_timeout", "should be positive, got %s", c.ShutdownTimeout)
+	check(c.ShutdownDelay >= 0, "shutdown_delay", "should not be negative, got %s", c.ShutdownDelay)
+
+	switch c.TracingExporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		check(false, "tracing_exporter", "%s, got %q", appErrors.ErrorUnknownTracingExporter, c.TracingExporter)
+	}
+
+	_, err := zapcore.ParseLevel(c.LogLevel)
+	check(err == nil, "log_level", "should be debug, info, warn or error, got %q", c.LogLevel)
+	check(c.LogFormat == logger.FormatJSON || c.LogFormat == logger.FormatConsole, "log_format", "%s, got %q", appErrors.ErrorUnknownLogFormat, c.LogFormat)
+	check(len(splitList(c.LogOutputs)) != 0, "log_outputs", "%s", appErrors.ErrorNoLogOutputs)
+	check(c.LogMaxSize > 0, "log_max_size", "should be positive, got %d", c.LogMaxSize)
+	check(c.LogMaxBackups >= 0, "log_max_backups", "should not be negative, got %d", c.LogMaxBackups)
+	check(c.LogMaxAge >= 0, "log_max_age", "should not be negative, got %d", c.LogMaxAge)
+
+	_, err = c.AuthModeList()
+	check(err == nil, "auth_modes", "%v", err)
+	check(c.JWTLeeway >= 0, "jwt_leeway", "should not be negative, got %s", c.JWTLeeway)
+	check(c.RateLimit <= 0 || c.RateBurst > 0, "rate_burst", "should be positive when the rate limit is enabled, got %d", c.RateBurst)
+	check(c.MaxBodySize > 0, "max_body_size", "should be positive, got %d", c.MaxBodySize)
+	check(c.MaxDecompressedBodySize >= 0, "max_decompressed_body_size", "should not be negative, got %d", c.MaxDecompressedBodySize)
+
+	return errors.Join(errs...)
+}
+
+// Print writes the configuration in the format of the YAML config file, passwords are redacted
+func (c *Config) Print(w io.Writer) error {
+	printed := *c
+	printed.DatabaseURI = redactDSN(c.DatabaseURI)
+
+	replicaURIs := c.ReplicaURIs()
+	for i := range replicaURIs {
+		replicaURIs[i] = redactDSN(replicaURIs[i])
+	}
+	printed.DBReplicaURIs = strings.Join(replicaURIs, ",")
+	printed.JWKSURL = redactURL(c.JWKSURL)
+
+	e := yaml.NewEncoder(w)
+	defer e.Close()
+
+	return e.Encode(printed)
+}
+
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// redactDSN hides the password of a DSN in the URL or the key=value format
+func redactDSN(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return redacted
+		}
+
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+
+		return redactURL(u.String())
+	}
+
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+
+	return u.String()
+}
+
+// AuthModeList returns the enabled ways of authentication, none disables authentication of all routes
+func (c *Config) AuthModeList() ([]string, error) {
+	modes := splitList(c.AuthModes)
+	for _, mode := range modes {
+		if mode == AuthModeNone {
+			return nil, nil
+		}
+
+		if mode != AuthModeAPIKey && mode != AuthModeJWT {
+			return nil, fmt.Errorf("%w: %s", appErrors.ErrorUnknownAuthMode, mode)
+		}
+
+		if mode == AuthModeJWT && c.JWKSURL == "" {
+			return nil, appErrors.ErrorJWKSSourceNotSet
+		}
+	}
+
+	return modes, nil
+}
+
+// ReplicaURIs returns DSNs of the read replicas, which are set as a comma separated list
+func (c *Config) ReplicaURIs() []string {
+	return splitList(c.DBReplicaURIs)
+}
+
+func (c *Config) JWTOptions() domain.JWTOptions {
+	return domain.JWTOptions{
+		Issuer:         c.JWTIssuer,
+		Audience:       c.JWTAudience,
+		ScopeClaim:     c.JWTScopeClaim,
+		NamespaceClaim: c.JWTNamespaceClaim,
+		Leeway:         c.JWTLeeway,
+	}
+}
+
+// LoggerConfig returns the logger settings, outputs are set as a comma separated list
+func (c *Config) LoggerConfig() logger.Config {
+	return logger.Config{
+		Level:      c.LogLevel,
+		Format:     c.LogFormat,
+		Outputs:    splitList(c.LogOutputs),
+		MaxSize:    c.LogMaxSize,
+		MaxBackups: c.LogMaxBackups,
+		MaxAge:     c.LogMaxAge,
+	}
+}
+
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// serverFlags defines the flags with the default values of the settings
+func serverFlags(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.StringVar(&cfg.File, "config", "", "YAML or TOML config file, CONFIG_FILE is used when not set")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the configuration with passwords redacted and exit")
+	fs.StringVar(&cfg.ServerAddress, "a", "http://localhost:8080", "server address")
+	fs.StringVar(&cfg.GRPCAddress, "grpc-address", "localhost:9090", "gRPC server address, the gRPC server is not started when empty")
+	fs.StringVar(&cfg.Storage, "storage", StoragePostgres, "storage of the data: postgres, or memory for tests and local development, the data is lost on restart")
+	fs.StringVar(&cfg.DatabaseURI, "d", "host=localhost dbname=user-segmenter user=user-segmenter password=user-segmenter port=5432 sslmode=disable", "postgres DSN")
+	int32Var(fs, &cfg.DBMaxConns, "db-max-conns", 0, "max amount of database connections, 0 uses the pgxpool default")
+	int32Var(fs, &cfg.DBMinConns, "db-min-conns", 0, "amount of database connections kept open when idle")
+	fs.DurationVar(&cfg.DBMaxConnLifetime, "db-max-conn-lifetime", 0, "time after which a database connection is closed, 0 uses the pgxpool default")
+	fs.DurationVar(&cfg.DBMaxConnIdleTime, "db-max-conn-idle-time", 0, "time after which an idle database connection is closed, 0 uses the pgxpool default")
+	fs.DurationVar(&cfg.DBConnectTimeout, "db-connect-timeout", 5*time.Second, "max time to establish a database connection, 0 means no limit")
+	fs.DurationVar(&cfg.DBStatementTimeout, "db-statement-timeout", 0, "statement_timeout of database connections, 0 uses the server setting")
+	fs.IntVar(&cfg.DBConnectAttempts, "db-connect-attempts", 10, "amount of attempts to reach the database on startup")
+	fs.DurationVar(&cfg.DBConnectBackoff, "db-connect-backoff", 500*time.Millisecond, "delay before the second attempt to reach the database on startup, doubled for every next one")
+	fs.IntVar(&cfg.DBRetryAttempts, "db-retry-attempts", 3, "max amount of attempts of a database operation failed with a transient error, 1 disables retries")
+	fs.DurationVar(&cfg.DBRetryBackoff, "db-retry-backoff", 50*time.Millisecond, "delay before the first retry of a database operation, doubled for every next one")
+	fs.StringVar(&cfg.DBReplicaURIs, "db-replica-uris", "", "comma separated DSNs of read replicas, reads which may be slightly stale are sent to them")
+	fs.DurationVar(&cfg.DBReplicaCheckInterval, "db-replica-check-interval", 5*time.Second, "interval between health checks of read replicas")
+	fs.DurationVar(&cfg.DBReplicaMaxLag, "db-replica-max-lag", 0, "replication lag after which a read replica is not used, 0 means no limit")
+	fs.DurationVar(&cfg.TTLInterval, "ttl-interval", 7*time.Second, "interval between TTL expiry runs")
+	fs.IntVar(&cfg.TTLBatchSize, "ttl-batch-size", 100, "max amount of expired rows processed in one transaction")
+	fs.DurationVar(&cfg.ChangesRetention, "changes-retention", 24*time.Hour, "time to keep the changes feed for local evaluation clients")
+	fs.DurationVar(&cfg.IdempotencyTTL, "idempotency-ttl", 24*time.Hour, "time to keep responses to requests with an Idempotency-Key, retries made later are processed again")
+	fs.StringVar(&cfg.ReportsDir, "reports-dir", "reports", "directory of history reports")
+	fs.IntVar(&cfg.GzipMinSize, "gzip-min-size", 1024, "size in bytes above which responses with segments of a user are compressed for clients accepting gzip")
+	fs.DurationVar(&cfg.HTTPReadHeaderTimeout, "http-read-header-timeout", 10*time.Second, "max time to read request headers, 0 means no limit")
+	fs.DurationVar(&cfg.HTTPReadTimeout, "http-read-timeout", 0, "max time to read a request, 0 means no limit")
+	fs.DurationVar(&cfg.HTTPWriteTimeout, "http-write-timeout", 0, "max time to write a response, 0 means no limit")
+	fs.DurationVar(&cfg.HTTPIdleTimeout, "http-idle-timeout", 0, "max time to keep an idle connection, 0 means no limit")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "max time to wait for requests and background work on shutdown")
+	fs.DurationVar(&cfg.ShutdownDelay, "shutdown-delay", 0, "time between failing readiness checks and stopping the server on shutdown")
+	fs.StringVar(&cfg.TracingExporter, "tracing-exporter", "none", "tracing exporter: none, stdout or otlp")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "log level: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", "json", "log format: json or console")
+	fs.StringVar(&cfg.LogOutputs, "log-outputs", "stdout,logfile.log", "comma separated log outputs, stdout, stderr or file paths")
+	fs.IntVar(&cfg.LogMaxSize, "log-max-size", 100, "size of a log file in megabytes after which it is rotated")
+	fs.IntVar(&cfg.LogMaxBackups, "log-max-backups", 5, "amount of rotated log files to keep")
+	fs.IntVar(&cfg.LogMaxAge, "log-max-age", 30, "amount of days to keep rotated log files")
+	fs.StringVar(&cfg.AuthModes, "auth-modes", AuthModeAPIKey, "comma separated authentication modes: api_key, jwt, or none to disable authentication")
+	fs.StringVar(&cfg.JWKSURL, "jwks-url", "", "JWKS file path or http(s) URL to validate JWTs with")
+	fs.StringVar(&cfg.JWTIssuer, "jwt-issuer", "", "expected iss claim of JWTs, not checked when empty")
+	fs.StringVar(&cfg.JWTAudience, "jwt-audience", "", "expected aud claim of JWTs, not checked when empty")
+	fs.StringVar(&cfg.JWTScopeClaim, "jwt-scope-claim", "scope", "JWT claim with scopes, a space separated string or an array")
+	fs.StringVar(&cfg.JWTNamespaceClaim, "jwt-namespace-claim", "namespace", "JWT claim with the namespace of the client, \"*\" gives access to every namespace")
+	fs.DurationVar(&cfg.JWTLeeway, "jwt-leeway", 30*time.Second, "allowed clock skew when checking JWT time claims")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", 50, "allowed requests per second of every API key, token or IP, 0 or a negative value disables the limit")
+	fs.IntVar(&cfg.RateBurst, "rate-burst", 100, "amount of requests allowed in a burst above the rate limit")
+	fs.Int64Var(&cfg.MaxBodySize, "max-body-size", 1<<20, "max size of a request body in bytes")
+	fs.Int64Var(&cfg.MaxDecompressedBodySize, "max-decompressed-body-size", 10<<20, "max size of a gzip request body after decompression in bytes, 0 means no limit")
+	return fs
+}
+
+// int32Value is a flag of an int32 setting, the flag package has no such type
+type int32Value int32
+
+func (v *int32Value) Set(s string) error {
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return err
+	}
+
+	*v = int32Value(n)
+	return nil
+}
+
+func (v *int32Value) String() string {
+	return strconv.FormatInt(int64(*v), 10)
 }
 
-func getServerFlags() (cfg *Config) {
-	cfg = &Config{}
-	cfg.ServerAddress = *flag.String("a", "http://localhost:8080", "server address")
-	cfg.DatabaseURI = *flag.String("d", "host=localhost dbname=user-segmenter user=user-segmenter password=user-segmenter port=5432 sslmode=disable", "postgres DSN")
-	return
+func int32Var(fs *flag.FlagSet, p *int32, name string, value int32, usage string) {
+	*p = value
+	fs.Var((*int32Value)(p), name, usage)
 }
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+// reloadable are the keys of the settings which are applied without a restart
+var reloadable = map[string]struct{}{
+	"log_level":      {},
+	"rate_limit":     {},
+	"rate_burst":     {},
+	"ttl_interval":   {},
+	"ttl_batch_size": {},
+}
+
+// Reloader reads the configuration again with the same command line arguments. A new configuration
+// is either applied as a whole or, when it is invalid, not applied at all
+type Reloader struct {
+	args     []string
+	file     string
+	fileInfo fileInfo
+
+	mu      sync.Mutex
+	current *Config
+	version domain.ConfigVersion
+	apply   []func(cfg *Config)
+}
+
+func NewReloader(cfg *Config, args []string) *Reloader {
+	return &Reloader{
+		args:     args,
+		file:     cfg.File,
+		fileInfo: stat(cfg.File),
+		current:  cfg,
+		version: domain.ConfigVersion{
+			Version:  1,
+			Checksum: checksum(cfg),
+			LoadedAt: time.Now(),
+			File:     cfg.File,
+		},
+	}
+}
+
+// OnReload adds a function which applies reloadable settings of a new configuration
+func (r *Reloader) OnReload(apply func(cfg *Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.apply = append(r.apply, apply)
+}
+
+// Reload reads and validates the configuration and applies its reloadable settings, the changed ones are returned.
+// On error the current configuration is kept
+func (r *Reloader) Reload() ([]string, error) {
+	cfg, err := GetServerConfig(r.args)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.version.FailedReloads++
+		r.version.LastError = err.Error()
+		return nil, err
+	}
+
+	r.version.Reloads++
+	r.version.LastError = ""
+
+	next := *r.current
+	nextFields := fields(&next)
+	changed := make([]string, 0)
+	pending := make([]string, 0)
+	for key, value := range fields(cfg) {
+		if reflect.DeepEqual(nextFields[key].Interface(), value.Interface()) {
+			continue
+		}
+
+		if _, ok := reloadable[key]; !ok {
+			pending = append(pending, key)
+			continue
+		}
+
+		nextFields[key].Set(value)
+		changed = append(changed, key)
+	}
+
+	sort.Strings(changed)
+	sort.Strings(pending)
+	r.version.PendingRestart = pending
+
+	if len(changed) == 0 {
+		return changed, nil
+	}
+
+	for _, apply := range r.apply {
+		apply(&next)
+	}
+
+	r.current = &next
+	r.version.Version++
+	r.version.Checksum = checksum(&next)
+	r.version.LoadedAt = time.Now()
+
+	return changed, nil
+}
+
+// Version describes the applied configuration
+func (r *Reloader) Version() domain.ConfigVersion {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	version := r.version
+	version.PendingRestart = append([]string(nil), r.version.PendingRestart...)
+	return version
+}
+
+// Watch reloads the configuration on every signal from reload and when the modification time or the size
+// of the config file changes, the file is checked every interval. report is called with the result of every reload
+func (r *Reloader) Watch(ctx context.Context, reload <-chan os.Signal, interval time.Duration, report func(changed []string, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := r.fileInfo
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+		case <-ticker.C:
+			info := stat(r.file)
+			if info == last {
+				continue
+			}
+			last = info
+		}
+
+		report(r.Reload())
+	}
+}
+
+// fileInfo is compared to find out whether a file was changed
+type fileInfo struct {
+	modTime time.Time
+	size    int64
+}
+
+func stat(path string) fileInfo {
+	if path == "" {
+		return fileInfo{}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileInfo{}
+	}
+
+	return fileInfo{modTime: info.ModTime(), size: info.Size()}
+}
+
+// fields returns the settings of cfg by the keys of the config file
+func fields(cfg *Config) map[string]reflect.Value {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+
+	fields := make(map[string]reflect.Value, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key != "" && key != "-" {
+			fields[key] = v.Field(i)
+		}
+	}
+
+	return fields
+}
+
+// checksum is the same for equal configurations, so instances can be compared without exposing the settings
+func checksum(cfg *Config) string {
+	var buf bytes.Buffer
+	_ = cfg.Print(&buf)
+
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	path := writeFile(t, "config.yaml", "log_level: info\nttl_interval: 10s\n")
+	args := []string{"-config", path}
+
+	cfg, err := GetServerConfig(args)
+	require.NoError(t, err)
+
+	r := NewReloader(cfg, args)
+	var applied []*Config
+	r.OnReload(func(cfg *Config) {
+		applied = append(applied, cfg)
+	})
+	initial := r.Version()
+	require.Equal(t, int64(1), initial.Version)
+	require.Equal(t, path, initial.File)
+
+	changed, err := r.Reload()
+	require.NoError(t, err)
+	require.Empty(t, changed)
+	require.Empty(t, applied)
+	require.Equal(t, initial.Checksum, r.Version().Checksum)
+
+	require.NoError(t, os.WriteFile(path, []byte("log_level: debug\nttl_interval: 1m\ndb_max_conns: 5\n"), 0o600))
+	changed, err = r.Reload()
+	require.NoError(t, err)
+	require.Equal(t, []string{"log_level", "ttl_interval"}, changed)
+	require.Len(t, applied, 1)
+	require.Equal(t, "debug", applied[0].LogLevel)
+	require.Equal(t, time.Minute, applied[0].TTLInterval)
+	// settings which need a restart keep their values
+	require.Zero(t, applied[0].DBMaxConns)
+
+	version := r.Version()
+	require.Equal(t, int64(2), version.Version)
+	require.NotEqual(t, initial.Checksum, version.Checksum)
+	require.Equal(t, []string{"db_max_conns"}, version.PendingRestart)
+
+	// an invalid configuration is rejected as a whole
+	require.NoError(t, os.WriteFile(path, []byte("log_level: trace\nttl_interval: 2m\n"), 0o600))
+	_, err = r.Reload()
+	require.ErrorContains(t, err, "log_level")
+	require.Len(t, applied, 1)
+
+	version = r.Version()
+	require.Equal(t, int64(2), version.Version)
+	require.Equal(t, int64(1), version.FailedReloads)
+	require.Equal(t, int64(2), version.Reloads)
+	require.Contains(t, version.LastError, "log_level")
+}
+
+func TestWatch(t *testing.T) {
+	path := writeFile(t, "config.yaml", "ttl_batch_size: 10\n")
+	args := []string{"-config", path}
+
+	cfg, err := GetServerConfig(args)
+	require.NoError(t, err)
+
+	r := NewReloader(cfg, args)
+	batchSizes := make(chan int, 1)
+	r.OnReload(func(cfg *Config) {
+		batchSizes <- cfg.TTLBatchSize
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reload := make(chan os.Signal, 1)
+	go r.Watch(ctx, reload, 10*time.Millisecond, func([]string, error) {})
+
+	require.NoError(t, os.WriteFile(path, []byte("ttl_batch_size: 200\n"), 0o600))
+	select {
+	case batchSize := <-batchSizes:
+		require.Equal(t, 200, batchSize)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the changed file wasn't reloaded")
+	}
+
+	t.Setenv("TTL_BATCH_SIZE", "300")
+	reload <- os.Interrupt
+	select {
+	case batchSize := <-batchSizes:
+		require.Equal(t, 300, batchSize)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the configuration wasn't reloaded on the signal")
+	}
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Scopes which may be given to API keys, every route of the API requires one of them
+const (
+	ScopeSegmentsWrite = "segments:write"
+	ScopeSegmentsRead  = "segments:read"
+	ScopeUsersWrite    = "users:write"
+	ScopeUsersRead     = "users:read"
+	ScopeReportsRead   = "reports:read"
+	ScopeKeysAdmin     = "keys:admin"
+	ScopeConfigRead    = "config:read"
+)
+
+var Scopes = []string{ScopeSegmentsWrite, ScopeSegmentsRead, ScopeUsersWrite, ScopeUsersRead, ScopeReportsRead, ScopeKeysAdmin, ScopeConfigRead}
+
+// APIKey is stored without the key itself, only its hash is kept in the database
+type APIKey struct {
+	ID        string     `json:"id" example:"8f2c1e0a9b7d6c5e"`
+	Name      string     `json:"name" example:"billing"`
+	Namespace string     `json:"namespace" example:"default"`
+	Scopes    []string   `json:"scopes" example:"users:read,reports:read"`
+	CreatedAt time.Time  `json:"created_at" example:"2023-09-30T20:19:05+03:00"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" example:"2023-10-30T20:19:05+03:00"`
+}
+
+// IssuedAPIKey is returned only once, when the key is created
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key" example:"usk_0123456789abcdef0123456789abcdef0123456789abcdef"`
+}
+
+type APIKeyRequest struct {
+	Name   string   `json:"name" example:"billing"`
+	Scopes []string `json:"scopes" example:"users:read,reports:read"`
+}
+
+// Client is the authenticated caller of the API. ID is unique among all kinds of clients
+type Client struct {
+	ID        string
+	Name      string
+	Namespace string
+	Scopes    []string
+}
+
+func (c Client) CanAccess(namespace string) bool {
+	return c.Namespace == AllNamespaces || c.Namespace == namespace
+}
+
+func (c Client) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ContextWithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, Key("client"), client)
+}
+
+func ClientFromContext(ctx context.Context) (Client, bool) {
+	client, ok := ctx.Value(Key("client")).(Client)
+	return client, ok
+}
+
+// ActorFromContext returns the ID of the client to be recorded on writes, or nil when the
+// change is not made by an authenticated client, e.g. by the scheduler or with auth disabled
+func ActorFromContext(ctx context.Context) *string {
+	client, ok := ClientFromContext(ctx)
+	if !ok || client.ID == "" {
+		return nil
+	}
+
+	return &client.ID
+}
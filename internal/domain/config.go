@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// ConfigVersion describes the configuration the instance runs with. Version is increased every time
+// a reload changes settings, settings which need a restart are listed in PendingRestart and are not applied
+type ConfigVersion struct {
+	Version        int64     `json:"version" example:"2"`
+	Checksum       string    `json:"checksum" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	LoadedAt       time.Time `json:"loaded_at" example:"2023-09-30T20:19:05+03:00"`
+	File           string    `json:"file,omitempty" example:"/etc/user-segmenter/config.yaml"`
+	Reloads        int64     `json:"reloads" example:"3"`
+	FailedReloads  int64     `json:"failed_reloads" example:"1"`
+	LastError      string    `json:"last_error,omitempty" example:"ttl_batch_size: should be positive, got 0"`
+	PendingRestart []string  `json:"pending_restart,omitempty" example:"db_max_conns"`
+}
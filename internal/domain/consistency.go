@@ -0,0 +1,28 @@
+package domain
+
+import "context"
+
+const (
+	// ReadConsistencyEventual allows reads from replicas, which may miss the latest writes. It is the default
+	ReadConsistencyEventual = "eventual"
+	// ReadConsistencyStrong sends reads to the primary, so a client sees its own writes made just before
+	ReadConsistencyStrong = "strong"
+)
+
+func IsValidReadConsistency(consistency string) bool {
+	return consistency == ReadConsistencyEventual || consistency == ReadConsistencyStrong
+}
+
+func ContextWithReadConsistency(ctx context.Context, consistency string) context.Context {
+	return context.WithValue(ctx, Key("read_consistency"), consistency)
+}
+
+// ReadConsistencyFromContext returns the read consistency selected by the request, or the eventual one
+func ReadConsistencyFromContext(ctx context.Context) string {
+	consistency, ok := ctx.Value(Key("read_consistency")).(string)
+	if !ok || consistency == "" {
+		return ReadConsistencyEventual
+	}
+
+	return consistency
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+type DeletionTime struct {
+	UserID       string    `json:"user_id" example:"1"`
+	Slug         string    `json:"slug" example:"SEGMENT_NAME"`
+	DeletionTime time.Time `json:"ttl" example:"2023-09-30T20:19:05+03:00"`
+	// Namespace is filled only for background processing, clients select it with the request
+	Namespace string `json:"-"`
+}
+
+type TTLUpdate struct {
+	UserID string `json:"user_id" example:"1"`
+	Slug   string `json:"slug" example:"SEGMENT_NAME"`
+	TTL    string `json:"ttl" example:"2023-09-30T20:19:05+03:00"`
+}
+
+type TTLRemoval struct {
+	UserID string `json:"user_id" example:"1"`
+	Slug   string `json:"slug" example:"SEGMENT_NAME"`
+}
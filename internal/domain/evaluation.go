@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+const MaxSnapshotUsers = 1000
+
+// EvaluationSnapshot is the state clients evaluate locally, changes made after it are read from the feed starting with Cursor
+type EvaluationSnapshot struct {
+	Cursor   string              `json:"cursor" example:"1024.0"`
+	Segments []EvaluationSegment `json:"segments"`
+	Users    []EvaluationUser    `json:"users"`
+}
+
+type EvaluationSegment struct {
+	Slug      string     `json:"slug" example:"SEGMENT_NAME"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2023-09-30T20:19:05+03:00"`
+}
+
+// EvaluationUser has memberships in the order of assignment, including the ones whose TTL has come
+// but which were not removed by the scheduler yet
+type EvaluationUser struct {
+	UserID      string                 `json:"user_id" example:"1"`
+	Memberships []EvaluationMembership `json:"memberships"`
+}
+
+type EvaluationMembership struct {
+	Slug string     `json:"slug" example:"SEGMENT_NAME"`
+	TTL  *time.Time `json:"ttl,omitempty" example:"2023-09-30T20:19:05+03:00"`
+}
+
+type SnapshotRequest struct {
+	UserIDs []string `json:"user_ids" example:"1,2"`
+}
+
+// Change tells that the segment or the user was changed, their new state is read with a snapshot
+type Change struct {
+	UserID string `json:"user_id,omitempty" example:"1"`
+	Slug   string `json:"slug,omitempty" example:"SEGMENT_NAME"`
+}
+
+type ChangesPage struct {
+	Changes []Change `json:"changes"`
+	Cursor  string   `json:"cursor" example:"1025.17"`
+	HasMore bool     `json:"has_more"`
+}
+
+// ChangesCursor is a position in the changes feed. Changes are ordered by the transaction which made them,
+// so a change committed late can't appear before a cursor which was already returned
+type ChangesCursor struct {
+	Tx int64
+	ID int64
+}
+
+func (c ChangesCursor) String() string {
+	return fmt.Sprintf("%d.%d", c.Tx, c.ID)
+}
+
+func (c ChangesCursor) Before(other ChangesCursor) bool {
+	return c.Tx < other.Tx || (c.Tx == other.Tx && c.ID < other.ID)
+}
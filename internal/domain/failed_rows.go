@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// RowKey identifies a row taken by a batch of the scheduler, the fields which are not a part of the key of the row are empty
+type RowKey struct {
+	Namespace string
+	UserID    string
+	Slug      string
+	StartsAt  time.Time
+}
+
+// FailedRows holds the rows which failed during a run of the scheduler. Batches leave them out and add the rows
+// which fail to it, so rows failing every time don't take the place of the rows due after them
+type FailedRows map[RowKey]struct{}
+
+func (f FailedRows) Add(keys ...RowKey) {
+	for _, key := range keys {
+		f[key] = struct{}{}
+	}
+}
+
+func (f FailedRows) Has(key RowKey) bool {
+	_, ok := f[key]
+	return ok
+}
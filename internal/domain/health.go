@@ -0,0 +1,18 @@
+package domain
+
+import "context"
+
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Status string `json:"status" example:"ok"`
+	Error  string `json:"error,omitempty" example:"connection refused"`
+}
+
+type HealthStatus struct {
+	Status string                 `json:"status" example:"ready"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
@@ -2,6 +2,11 @@ package domain
 
 import "time"
 
+const (
+	OperationTTLUpdate  = "ttl update"
+	OperationTTLRemoval = "ttl removal"
+)
+
 type HistoryElem struct {
 	UserID    string
 	Slug      string
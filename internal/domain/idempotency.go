@@ -0,0 +1,25 @@
+package domain
+
+// MaxIdempotencyKeyLength limits the Idempotency-Key header, clients usually send UUIDs
+const MaxIdempotencyKeyLength = 255
+
+// IdempotentRequest is a mutating request sent with an Idempotency-Key. Keys are scoped to the namespace
+// from the context and the client, Fingerprint tells a retry of the request from another request reusing the key
+type IdempotentRequest struct {
+	ClientID    string
+	Key         string
+	Fingerprint string
+}
+
+// IdempotentResponse is the first response to a request, it is replayed for retries
+type IdempotentResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyRecord is what is stored for a key, Response is nil while the first request is in progress
+type IdempotencyRecord struct {
+	Fingerprint string
+	Response    *IdempotentResponse
+}
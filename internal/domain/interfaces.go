@@ -7,8 +7,10 @@ import (
 )
 
 type SegmentService interface {
-	CreateSegment(ctx context.Context, slug string) error
+	CreateSegment(ctx context.Context, slug string, options SegmentOptions) error
+	UpdateSegment(ctx context.Context, slug string, options SegmentOptions) error
 	DeleteSegment(ctx context.Context, slug string) error
+	ReadSegments(ctx context.Context) ([]Segment, error)
 	AddSegmentToPercentOfUsers(ctx context.Context, slug string, percent int) error
 }
 
@@ -16,20 +18,54 @@ type UserService interface {
 	UpdateUserSegments(ctx context.Context, userID string, slugsToAdd []string, slugsToDelete []string) error
 	ReadUserSegments(ctx context.Context, userID string) ([]string, error)
 	CreateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error
+	ReadDeletionTimes(ctx context.Context, userID string, slug string) ([]DeletionTime, error)
+	UpdateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error
+	DeleteDeletionTime(ctx context.Context, userID string, slug string) error
+	ScheduleUserSegments(ctx context.Context, userID string, slugs []string, startsAt time.Time, endsAt *time.Time) error
+	ReadScheduledAssignments(ctx context.Context, userID string) ([]ScheduledAssignment, error)
 }
 
 type ReportService interface {
 	ReadUserSegmentsHistory(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int) ([]HistoryElem, error)
 	CreateCSV(ctx context.Context, userID string, startDate, endDate time.Time) (string, error)
-	SendCSVReportFile(reportName string, writer io.Writer) error
+	SendCSVReportFile(ctx context.Context, reportName string, writer io.Writer) error
+}
+
+type EvaluationService interface {
+	ReadSnapshot(ctx context.Context, userIDs []string) (EvaluationSnapshot, error)
+	ReadChanges(ctx context.Context, cursor ChangesCursor, limit int) (ChangesPage, error)
+}
+
+type APIKeyService interface {
+	IssueAPIKey(ctx context.Context, name string, scopes []string) (IssuedAPIKey, error)
+	ReadAPIKeys(ctx context.Context) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+	Authenticator
+}
+
+// IdempotencyService reserves Idempotency-Keys for requests and keeps their responses
+type IdempotencyService interface {
+	// Begin returns the stored response when the request is a retry, or nil when the request should be processed
+	Begin(ctx context.Context, request IdempotentRequest) (*IdempotentResponse, error)
+	Complete(ctx context.Context, request IdempotentRequest, response IdempotentResponse) error
+	// Abort releases the key, so the request may be retried, e.g. after an internal error
+	Abort(ctx context.Context, request IdempotentRequest) error
+}
+
+// Authenticator finds the client a credential taken from a request belongs to
+type Authenticator interface {
+	Authenticate(ctx context.Context, credential string) (Client, error)
 }
 
 //go:generate mockgen -destination=mocks/segment_repo_mock.gen.go -package=mocks . SegmentRepository
 type SegmentRepository interface {
-	CreateSegment(ctx context.Context, slug string) error
+	CreateSegment(ctx context.Context, slug string, options SegmentOptions) error
+	UpdateSegment(ctx context.Context, slug string, options SegmentOptions) error
 	DeleteSegment(ctx context.Context, slug string) error
+	ReadSegments(ctx context.Context) ([]Segment, error)
 	AddSegmentToPercentOfUsers(ctx context.Context, slug string, percent int) error
-	DeleteExpiredSegments(ctx context.Context) error
+	DeleteExpiredSegments(ctx context.Context, batchSize int, failedRows FailedRows) (int, int, error)
+	RetireExpiredSegments(ctx context.Context, batchSize int, failedRows FailedRows) (int, int, error)
 }
 
 //go:generate mockgen -destination=mocks/user_repo_mock.gen.go -package=mocks . UserRepository
@@ -37,11 +73,42 @@ type UserRepository interface {
 	UpdateUserSegments(ctx context.Context, userID string, slugsToAdd []string, slugsToDelete []string) error
 	ReadUserSegments(ctx context.Context, userID string) ([]string, error)
 	CreateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error
+	ReadDeletionTimes(ctx context.Context, userID string, slug string) ([]DeletionTime, error)
+	UpdateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error
+	DeleteDeletionTime(ctx context.Context, userID string, slug string) error
+	ScheduleUserSegments(ctx context.Context, userID string, slugs []string, startsAt time.Time, endsAt *time.Time) error
+	ReadScheduledAssignments(ctx context.Context, userID string) ([]ScheduledAssignment, error)
+	ActivateScheduledAssignments(ctx context.Context, batchSize int, failedRows FailedRows) (int, int, error)
 }
 
 //go:generate mockgen -destination=mocks/report_repo_mock.gen.go -package=mocks . ReportRepository
 type ReportRepository interface {
 	ReadUserSegmentsHistory(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int) ([]HistoryElem, error)
 	CreateCSV(ctx context.Context, userID string, startDate, endDate time.Time) (string, error)
-	SendCSVReportFile(reportName string, writer io.Writer) error
+	SendCSVReportFile(ctx context.Context, reportName string, writer io.Writer) error
+}
+
+//go:generate mockgen -destination=mocks/evaluation_repo_mock.gen.go -package=mocks . EvaluationRepository
+type EvaluationRepository interface {
+	ReadSnapshot(ctx context.Context, userIDs []string) (EvaluationSnapshot, error)
+	ReadChanges(ctx context.Context, cursor ChangesCursor, limit int) (ChangesPage, error)
+	PruneChanges(ctx context.Context, batchSize int) (int, int, error)
+}
+
+//go:generate mockgen -destination=mocks/api_key_repo_mock.gen.go -package=mocks . APIKeyRepository
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key APIKey, keyHash string) error
+	ReadAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error)
+	ReadAPIKeys(ctx context.Context) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+}
+
+//go:generate mockgen -destination=mocks/idempotency_repo_mock.gen.go -package=mocks . IdempotencyRepository
+type IdempotencyRepository interface {
+	// ReserveIdempotencyKey stores the request without a response until lockedUntil. If the key is already stored
+	// and has not expired, nothing is changed and its record is returned with false
+	ReserveIdempotencyKey(ctx context.Context, request IdempotentRequest, lockedUntil time.Time) (IdempotencyRecord, bool, error)
+	SaveIdempotentResponse(ctx context.Context, request IdempotentRequest, response IdempotentResponse, expiresAt time.Time) error
+	ReleaseIdempotencyKey(ctx context.Context, request IdempotentRequest) error
+	PruneIdempotencyKeys(ctx context.Context, batchSize int) (int, int, error)
 }
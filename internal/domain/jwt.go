@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"context"
+	"crypto"
+	"time"
+)
+
+// JWTKeys finds the public key a token is signed with by the key ID from the token header
+type JWTKeys interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// JWTOptions are checks of token claims. Empty Issuer and Audience are not checked
+type JWTOptions struct {
+	Issuer         string
+	Audience       string
+	ScopeClaim     string
+	NamespaceClaim string
+	Leeway         time.Duration
+}
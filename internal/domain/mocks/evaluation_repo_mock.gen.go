@@ -0,0 +1,82 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/PoorMercymain/user-segmenter/internal/domain (interfaces: EvaluationRepository)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	domain "github.com/PoorMercymain/user-segmenter/internal/domain"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockEvaluationRepository is a mock of EvaluationRepository interface.
+type MockEvaluationRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockEvaluationRepositoryMockRecorder
+}
+
+// MockEvaluationRepositoryMockRecorder is the mock recorder for MockEvaluationRepository.
+type MockEvaluationRepositoryMockRecorder struct {
+	mock *MockEvaluationRepository
+}
+
+// NewMockEvaluationRepository creates a new mock instance.
+func NewMockEvaluationRepository(ctrl *gomock.Controller) *MockEvaluationRepository {
+	mock := &MockEvaluationRepository{ctrl: ctrl}
+	mock.recorder = &MockEvaluationRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEvaluationRepository) EXPECT() *MockEvaluationRepositoryMockRecorder {
+	return m.recorder
+}
+
+// PruneChanges mocks base method.
+func (m *MockEvaluationRepository) PruneChanges(arg0 context.Context, arg1 int) (int, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PruneChanges", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// PruneChanges indicates an expected call of PruneChanges.
+func (mr *MockEvaluationRepositoryMockRecorder) PruneChanges(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PruneChanges", reflect.TypeOf((*MockEvaluationRepository)(nil).PruneChanges), arg0, arg1)
+}
+
+// ReadChanges mocks base method.
+func (m *MockEvaluationRepository) ReadChanges(arg0 context.Context, arg1 domain.ChangesCursor, arg2 int) (domain.ChangesPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadChanges", arg0, arg1, arg2)
+	ret0, _ := ret[0].(domain.ChangesPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadChanges indicates an expected call of ReadChanges.
+func (mr *MockEvaluationRepositoryMockRecorder) ReadChanges(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadChanges", reflect.TypeOf((*MockEvaluationRepository)(nil).ReadChanges), arg0, arg1, arg2)
+}
+
+// ReadSnapshot mocks base method.
+func (m *MockEvaluationRepository) ReadSnapshot(arg0 context.Context, arg1 []string) (domain.EvaluationSnapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadSnapshot", arg0, arg1)
+	ret0, _ := ret[0].(domain.EvaluationSnapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadSnapshot indicates an expected call of ReadSnapshot.
+func (mr *MockEvaluationRepositoryMockRecorder) ReadSnapshot(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadSnapshot", reflect.TypeOf((*MockEvaluationRepository)(nil).ReadSnapshot), arg0, arg1)
+}
@@ -68,15 +68,15 @@ func (mr *MockReportRepositoryMockRecorder) ReadUserSegmentsHistory(arg0, arg1,
 }
 
 // SendCSVReportFile mocks base method.
-func (m *MockReportRepository) SendCSVReportFile(arg0 string, arg1 io.Writer) error {
+func (m *MockReportRepository) SendCSVReportFile(arg0 context.Context, arg1 string, arg2 io.Writer) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendCSVReportFile", arg0, arg1)
+	ret := m.ctrl.Call(m, "SendCSVReportFile", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SendCSVReportFile indicates an expected call of SendCSVReportFile.
-func (mr *MockReportRepositoryMockRecorder) SendCSVReportFile(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockReportRepositoryMockRecorder) SendCSVReportFile(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCSVReportFile", reflect.TypeOf((*MockReportRepository)(nil).SendCSVReportFile), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCSVReportFile", reflect.TypeOf((*MockReportRepository)(nil).SendCSVReportFile), arg0, arg1, arg2)
 }
@@ -8,6 +8,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	domain "github.com/PoorMercymain/user-segmenter/internal/domain"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -49,31 +50,33 @@ func (mr *MockSegmentRepositoryMockRecorder) AddSegmentToPercentOfUsers(arg0, ar
 }
 
 // CreateSegment mocks base method.
-func (m *MockSegmentRepository) CreateSegment(arg0 context.Context, arg1 string) error {
+func (m *MockSegmentRepository) CreateSegment(arg0 context.Context, arg1 string, arg2 domain.SegmentOptions) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateSegment", arg0, arg1)
+	ret := m.ctrl.Call(m, "CreateSegment", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreateSegment indicates an expected call of CreateSegment.
-func (mr *MockSegmentRepositoryMockRecorder) CreateSegment(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockSegmentRepositoryMockRecorder) CreateSegment(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSegment", reflect.TypeOf((*MockSegmentRepository)(nil).CreateSegment), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSegment", reflect.TypeOf((*MockSegmentRepository)(nil).CreateSegment), arg0, arg1, arg2)
 }
 
 // DeleteExpiredSegments mocks base method.
-func (m *MockSegmentRepository) DeleteExpiredSegments(arg0 context.Context) error {
+func (m *MockSegmentRepository) DeleteExpiredSegments(arg0 context.Context, arg1 int, arg2 domain.FailedRows) (int, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteExpiredSegments", arg0)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "DeleteExpiredSegments", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // DeleteExpiredSegments indicates an expected call of DeleteExpiredSegments.
-func (mr *MockSegmentRepositoryMockRecorder) DeleteExpiredSegments(arg0 interface{}) *gomock.Call {
+func (mr *MockSegmentRepositoryMockRecorder) DeleteExpiredSegments(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredSegments", reflect.TypeOf((*MockSegmentRepository)(nil).DeleteExpiredSegments), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredSegments", reflect.TypeOf((*MockSegmentRepository)(nil).DeleteExpiredSegments), arg0, arg1, arg2)
 }
 
 // DeleteSegment mocks base method.
@@ -89,3 +92,48 @@ func (mr *MockSegmentRepositoryMockRecorder) DeleteSegment(arg0, arg1 interface{
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSegment", reflect.TypeOf((*MockSegmentRepository)(nil).DeleteSegment), arg0, arg1)
 }
+
+// ReadSegments mocks base method.
+func (m *MockSegmentRepository) ReadSegments(arg0 context.Context) ([]domain.Segment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadSegments", arg0)
+	ret0, _ := ret[0].([]domain.Segment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadSegments indicates an expected call of ReadSegments.
+func (mr *MockSegmentRepositoryMockRecorder) ReadSegments(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadSegments", reflect.TypeOf((*MockSegmentRepository)(nil).ReadSegments), arg0)
+}
+
+// RetireExpiredSegments mocks base method.
+func (m *MockSegmentRepository) RetireExpiredSegments(arg0 context.Context, arg1 int, arg2 domain.FailedRows) (int, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetireExpiredSegments", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RetireExpiredSegments indicates an expected call of RetireExpiredSegments.
+func (mr *MockSegmentRepositoryMockRecorder) RetireExpiredSegments(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetireExpiredSegments", reflect.TypeOf((*MockSegmentRepository)(nil).RetireExpiredSegments), arg0, arg1, arg2)
+}
+
+// UpdateSegment mocks base method.
+func (m *MockSegmentRepository) UpdateSegment(arg0 context.Context, arg1 string, arg2 domain.SegmentOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSegment", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateSegment indicates an expected call of UpdateSegment.
+func (mr *MockSegmentRepositoryMockRecorder) UpdateSegment(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSegment", reflect.TypeOf((*MockSegmentRepository)(nil).UpdateSegment), arg0, arg1, arg2)
+}
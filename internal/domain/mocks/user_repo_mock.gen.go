@@ -9,6 +9,7 @@ import (
 	reflect "reflect"
 	time "time"
 
+	domain "github.com/PoorMercymain/user-segmenter/internal/domain"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -35,6 +36,22 @@ func (m *MockUserRepository) EXPECT() *MockUserRepositoryMockRecorder {
 	return m.recorder
 }
 
+// ActivateScheduledAssignments mocks base method.
+func (m *MockUserRepository) ActivateScheduledAssignments(arg0 context.Context, arg1 int, arg2 domain.FailedRows) (int, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ActivateScheduledAssignments", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ActivateScheduledAssignments indicates an expected call of ActivateScheduledAssignments.
+func (mr *MockUserRepositoryMockRecorder) ActivateScheduledAssignments(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ActivateScheduledAssignments", reflect.TypeOf((*MockUserRepository)(nil).ActivateScheduledAssignments), arg0, arg1, arg2)
+}
+
 // CreateDeletionTime mocks base method.
 func (m *MockUserRepository) CreateDeletionTime(arg0 context.Context, arg1, arg2 string, arg3 time.Time) error {
 	m.ctrl.T.Helper()
@@ -49,6 +66,50 @@ func (mr *MockUserRepositoryMockRecorder) CreateDeletionTime(arg0, arg1, arg2, a
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateDeletionTime", reflect.TypeOf((*MockUserRepository)(nil).CreateDeletionTime), arg0, arg1, arg2, arg3)
 }
 
+// DeleteDeletionTime mocks base method.
+func (m *MockUserRepository) DeleteDeletionTime(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDeletionTime", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteDeletionTime indicates an expected call of DeleteDeletionTime.
+func (mr *MockUserRepositoryMockRecorder) DeleteDeletionTime(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDeletionTime", reflect.TypeOf((*MockUserRepository)(nil).DeleteDeletionTime), arg0, arg1, arg2)
+}
+
+// ReadDeletionTimes mocks base method.
+func (m *MockUserRepository) ReadDeletionTimes(arg0 context.Context, arg1, arg2 string) ([]domain.DeletionTime, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadDeletionTimes", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]domain.DeletionTime)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadDeletionTimes indicates an expected call of ReadDeletionTimes.
+func (mr *MockUserRepositoryMockRecorder) ReadDeletionTimes(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadDeletionTimes", reflect.TypeOf((*MockUserRepository)(nil).ReadDeletionTimes), arg0, arg1, arg2)
+}
+
+// ReadScheduledAssignments mocks base method.
+func (m *MockUserRepository) ReadScheduledAssignments(arg0 context.Context, arg1 string) ([]domain.ScheduledAssignment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadScheduledAssignments", arg0, arg1)
+	ret0, _ := ret[0].([]domain.ScheduledAssignment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadScheduledAssignments indicates an expected call of ReadScheduledAssignments.
+func (mr *MockUserRepositoryMockRecorder) ReadScheduledAssignments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadScheduledAssignments", reflect.TypeOf((*MockUserRepository)(nil).ReadScheduledAssignments), arg0, arg1)
+}
+
 // ReadUserSegments mocks base method.
 func (m *MockUserRepository) ReadUserSegments(arg0 context.Context, arg1 string) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +125,34 @@ func (mr *MockUserRepositoryMockRecorder) ReadUserSegments(arg0, arg1 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadUserSegments", reflect.TypeOf((*MockUserRepository)(nil).ReadUserSegments), arg0, arg1)
 }
 
+// ScheduleUserSegments mocks base method.
+func (m *MockUserRepository) ScheduleUserSegments(arg0 context.Context, arg1 string, arg2 []string, arg3 time.Time, arg4 *time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScheduleUserSegments", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ScheduleUserSegments indicates an expected call of ScheduleUserSegments.
+func (mr *MockUserRepositoryMockRecorder) ScheduleUserSegments(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScheduleUserSegments", reflect.TypeOf((*MockUserRepository)(nil).ScheduleUserSegments), arg0, arg1, arg2, arg3, arg4)
+}
+
+// UpdateDeletionTime mocks base method.
+func (m *MockUserRepository) UpdateDeletionTime(arg0 context.Context, arg1, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateDeletionTime", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateDeletionTime indicates an expected call of UpdateDeletionTime.
+func (mr *MockUserRepositoryMockRecorder) UpdateDeletionTime(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDeletionTime", reflect.TypeOf((*MockUserRepository)(nil).UpdateDeletionTime), arg0, arg1, arg2, arg3)
+}
+
 // UpdateUserSegments mocks base method.
 func (m *MockUserRepository) UpdateUserSegments(arg0 context.Context, arg1 string, arg2, arg3 []string) error {
 	m.ctrl.T.Helper()
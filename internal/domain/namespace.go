@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"context"
+	"regexp"
+)
+
+const (
+	// DefaultNamespace is used for requests which do not select a namespace, so clients
+	// not aware of namespaces keep working
+	DefaultNamespace = "default"
+	// AllNamespaces as the namespace of a client gives it access to every namespace
+	AllNamespaces = "*"
+)
+
+var namespaceRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// IsValidNamespace reports whether a namespace selected by a request is well-formed, AllNamespaces is not
+func IsValidNamespace(namespace string) bool {
+	return namespaceRegexp.MatchString(namespace)
+}
+
+func ContextWithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, Key("namespace"), namespace)
+}
+
+// NamespaceFromContext returns the namespace selected by the request, or the default one
+func NamespaceFromContext(ctx context.Context) string {
+	namespace, ok := ctx.Value(Key("namespace")).(string)
+	if !ok || namespace == "" {
+		return DefaultNamespace
+	}
+
+	return namespace
+}
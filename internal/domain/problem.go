@@ -0,0 +1,13 @@
+package domain
+
+// Problem is an RFC 7807 error response
+type Problem struct {
+	Type     string `json:"type" example:"urn:user-segmenter:problem:segment_not_found"`
+	Title    string `json:"title" example:"Not Found"`
+	Status   int    `json:"status" example:"404"`
+	Detail   string `json:"detail,omitempty" example:"segment not found: AVITO_VOICE_MESSAGES"`
+	Instance string `json:"instance,omitempty" example:"/api/segment"`
+	Code     string `json:"code" example:"segment_not_found"`
+	Slug     string `json:"slug,omitempty" example:"AVITO_VOICE_MESSAGES"`
+	Field    string `json:"field,omitempty" example:"ttl"`
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+type ScheduledAssignment struct {
+	UserID   string     `json:"user_id" example:"1"`
+	Slug     string     `json:"slug" example:"SEGMENT_NAME"`
+	StartsAt time.Time  `json:"starts_at" example:"2023-09-30T00:00:00+03:00"`
+	EndsAt   *time.Time `json:"ends_at,omitempty" example:"2023-10-02T00:00:00+03:00"`
+	// Namespace is filled only for background processing, clients select it with the request
+	Namespace string `json:"-"`
+}
+
+type ScheduleUpdate struct {
+	UserID   string   `json:"user_id" example:"1"`
+	Slugs    []string `json:"slugs" example:"SEGMENT_NAME"`
+	StartsAt string   `json:"starts_at" example:"2023-09-30T00:00:00+03:00"`
+	EndsAt   string   `json:"ends_at,omitempty" example:"2023-10-02T00:00:00+03:00"`
+}
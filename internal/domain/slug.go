@@ -1,10 +1,37 @@
 package domain
 
+import "time"
+
 type Slug struct {
 	Slug           string `json:"slug" example:"SEGMENT_NAME"`
 	PercentOfUsers int    `json:"percent,omitempty" example:"10"`
+	TTL            string `json:"ttl,omitempty" example:"48h"`
+	ExpiresAt      string `json:"expires_at,omitempty" example:"2023-09-30T20:19:05+03:00"`
 }
 
 type SlugNoPercent struct {
 	Slug string `json:"slug" example:"SEGMENT_NAME"`
 }
+
+// SegmentUpdate changes only the provided fields, an empty string removes the value
+type SegmentUpdate struct {
+	Slug      string  `json:"slug" example:"SEGMENT_NAME"`
+	TTL       *string `json:"ttl,omitempty" example:"48h"`
+	ExpiresAt *string `json:"expires_at,omitempty" example:"2023-09-30T20:19:05+03:00"`
+}
+
+// Segment is a segment with its settings, as it is listed by the API
+type Segment struct {
+	Slug      string     `json:"slug" example:"SEGMENT_NAME"`
+	TTL       string     `json:"ttl,omitempty" example:"48h0m0s"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2023-09-30T20:19:05+03:00"`
+	CreatedBy string     `json:"created_by,omitempty" example:"key:8f2c1e0a9b7d6c5e"`
+	UpdatedBy string     `json:"updated_by,omitempty" example:"key:8f2c1e0a9b7d6c5e"`
+}
+
+// SegmentOptions are optional segment settings. A nil field is not set (or left unchanged on update),
+// a zero value removes the setting
+type SegmentOptions struct {
+	DefaultTTL *time.Duration
+	ExpiresAt  *time.Time
+}
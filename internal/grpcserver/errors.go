@@ -0,0 +1,125 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	segmenterv1 "github.com/PoorMercymain/user-segmenter/pkg/api/segmenter/v1"
+)
+
+// ErrorDomain is the domain of ErrorInfo details sent with failed calls
+const ErrorDomain = "user-segmenter"
+
+// grpcCodes are chosen like HTTP statuses of the same errors in handlers, codes not listed here are internal errors
+var grpcCodes = map[string]codes.Code{
+	appErrors.CodeNotFound:             codes.NotFound,
+	appErrors.CodeSegmentNotFound:      codes.NotFound,
+	appErrors.CodeUserNotFound:         codes.NotFound,
+	appErrors.CodeUserNotInSegment:     codes.NotFound,
+	appErrors.CodeTTLNotFound:          codes.NotFound,
+	appErrors.CodeReportNotFound:       codes.NotFound,
+	appErrors.CodeAPIKeyNotFound:       codes.NotFound,
+	appErrors.CodeSegmentAlreadyExists: codes.AlreadyExists,
+	appErrors.CodeInvalidSlug:          codes.InvalidArgument,
+	appErrors.CodeInvalidJSON:          codes.InvalidArgument,
+	appErrors.CodeDuplicateJSONKey:     codes.InvalidArgument,
+	appErrors.CodeUnknownField:         codes.InvalidArgument,
+	appErrors.CodeMissingField:         codes.InvalidArgument,
+	appErrors.CodeInvalidField:         codes.InvalidArgument,
+	appErrors.CodeInvalidReportName:    codes.InvalidArgument,
+	appErrors.CodeInvalidNamespace:     codes.InvalidArgument,
+	appErrors.CodeUnauthenticated:      codes.Unauthenticated,
+	appErrors.CodeInsufficientScope:    codes.PermissionDenied,
+	appErrors.CodeNamespaceForbidden:   codes.PermissionDenied,
+	appErrors.CodeRateLimited:          codes.ResourceExhausted,
+	appErrors.CodeBodyTooLarge:         codes.ResourceExhausted,
+}
+
+// statusCode returns the gRPC code a call failed with err is answered with
+func statusCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+
+	if st, ok := status.FromError(err); ok {
+		return st.Code()
+	}
+
+	if code, ok := grpcCodes[appErrors.CodeOf(err)]; ok {
+		return code
+	}
+
+	return codes.Internal
+}
+
+// toStatus converts err to a status with the error code in the ErrorInfo detail, like handlers send problem details.
+// Details of internal errors are not sent to clients
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := statusCode(err)
+	if code == codes.Internal {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	info := &errdetails.ErrorInfo{Reason: appErrors.CodeOf(err), Domain: ErrorDomain}
+
+	var typed *appErrors.Error
+	if errors.As(err, &typed) {
+		info.Metadata = make(map[string]string)
+		if typed.Slug != "" {
+			info.Metadata["slug"] = typed.Slug
+		}
+		if typed.Field != "" {
+			info.Metadata["field"] = typed.Field
+		}
+	}
+
+	st, detailsErr := status.New(code, err.Error()).WithDetails(info)
+	if detailsErr != nil {
+		return status.Error(code, err.Error())
+	}
+
+	return st.Err()
+}
+
+// itemError describes a failed item of a batch call the same way toStatus does
+func itemError(err error) *segmenterv1.Error {
+	if err == nil {
+		return nil
+	}
+
+	if statusCode(err) == codes.Internal {
+		return &segmenterv1.Error{Code: appErrors.CodeInternal, Message: "internal error"}
+	}
+
+	itemErr := &segmenterv1.Error{Code: appErrors.CodeOf(err), Message: err.Error()}
+
+	var typed *appErrors.Error
+	if errors.As(err, &typed) {
+		itemErr.Slug = typed.Slug
+		itemErr.Field = typed.Field
+	}
+
+	return itemErr
+}
+
+// errorStatus converts errors returned by services and interceptors to statuses, like ErrorHandler does for HTTP
+func errorStatus() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+
+		return resp, nil
+	}
+}
@@ -0,0 +1,328 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/domain/mocks"
+	"github.com/PoorMercymain/user-segmenter/internal/service"
+	segmenterv1 "github.com/PoorMercymain/user-segmenter/pkg/api/segmenter/v1"
+	ratelimiter "github.com/PoorMercymain/user-segmenter/pkg/rate-limiter"
+)
+
+type authenticatorFunc func(ctx context.Context, credential string) (domain.Client, error)
+
+func (f authenticatorFunc) Authenticate(ctx context.Context, credential string) (domain.Client, error) {
+	return f(ctx, credential)
+}
+
+type testRepos struct {
+	seg *mocks.MockSegmentRepository
+	usr *mocks.MockUserRepository
+	rep *mocks.MockReportRepository
+}
+
+func testConn(t *testing.T, options Options) (*grpc.ClientConn, testRepos) {
+	ctrl := gomock.NewController(t)
+
+	repos := testRepos{
+		seg: mocks.NewMockSegmentRepository(ctrl),
+		usr: mocks.NewMockUserRepository(ctrl),
+		rep: mocks.NewMockReportRepository(ctrl),
+	}
+
+	auth := authenticatorFunc(func(_ context.Context, credential string) (domain.Client, error) {
+		switch credential {
+		case "admin":
+			return domain.Client{ID: "api_key:1", Namespace: domain.AllNamespaces, Scopes: domain.Scopes}, nil
+		case "reader":
+			return domain.Client{ID: "api_key:2", Namespace: domain.DefaultNamespace, Scopes: []string{domain.ScopeUsersRead}}, nil
+		}
+		return domain.Client{}, appErrors.Unauthenticated()
+	})
+
+	srv := NewServer(zaptest.NewLogger(t).Sugar(), options, auth)
+	segmenterv1.RegisterSegmentServiceServer(srv, NewSegment(service.NewSegment(repos.seg)))
+	segmenterv1.RegisterUserServiceServer(srv, NewUser(service.NewUser(repos.usr)))
+	segmenterv1.RegisterReportServiceServer(srv, NewReport(service.NewReport(repos.rep)))
+
+	listener := bufconn.Listen(1 << 20)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, repos
+}
+
+func withKey(key string, pairs ...string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), append([]string{APIKeyMetadata, key}, pairs...)...)
+}
+
+// requireStatus checks the gRPC code and the application error code of err
+func requireStatus(t *testing.T, err error, code codes.Code, reason string) {
+	t.Helper()
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, code, st.Code(), st.Message())
+
+	if reason == "" {
+		require.Empty(t, st.Details())
+		return
+	}
+
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	require.Equal(t, reason, info.Reason)
+	require.Equal(t, ErrorDomain, info.Domain)
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	conn, repos := testConn(t, Options{})
+	client := segmenterv1.NewUserServiceClient(conn)
+
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "1").DoAndReturn(func(ctx context.Context, _ string) ([]string, error) {
+		require.Equal(t, "team-a", domain.NamespaceFromContext(ctx))
+		return []string{"A"}, nil
+	})
+
+	_, err := client.GetUserSegments(context.Background(), &segmenterv1.GetUserSegmentsRequest{UserId: "1"})
+	requireStatus(t, err, codes.Unauthenticated, appErrors.CodeUnauthenticated)
+
+	_, err = client.GetUserSegments(withKey("unknown"), &segmenterv1.GetUserSegmentsRequest{UserId: "1"})
+	requireStatus(t, err, codes.Unauthenticated, appErrors.CodeUnauthenticated)
+
+	_, err = client.UpdateUserSegments(withKey("reader"), &segmenterv1.UpdateUserSegmentsRequest{UserId: "1"})
+	requireStatus(t, err, codes.PermissionDenied, appErrors.CodeInsufficientScope)
+
+	_, err = client.GetUserSegments(withKey("reader", NamespaceMetadata, "team-a"), &segmenterv1.GetUserSegmentsRequest{UserId: "1"})
+	requireStatus(t, err, codes.PermissionDenied, appErrors.CodeNamespaceForbidden)
+
+	_, err = client.GetUserSegments(withKey("admin", NamespaceMetadata, "Team A"), &segmenterv1.GetUserSegmentsRequest{UserId: "1"})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeInvalidNamespace)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer admin", NamespaceMetadata, "team-a")
+	resp, err := client.GetUserSegments(ctx, &segmenterv1.GetUserSegmentsRequest{UserId: "1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"A"}, resp.Slugs)
+}
+
+func TestReadConsistency(t *testing.T) {
+	conn, repos := testConn(t, Options{})
+	client := segmenterv1.NewUserServiceClient(conn)
+
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "1").DoAndReturn(func(ctx context.Context, _ string) ([]string, error) {
+		require.Equal(t, domain.ReadConsistencyStrong, domain.ReadConsistencyFromContext(ctx))
+		return []string{"A"}, nil
+	})
+
+	_, err := client.GetUserSegments(withKey("admin", ReadConsistencyMetadata, domain.ReadConsistencyStrong), &segmenterv1.GetUserSegmentsRequest{UserId: "1"})
+	require.NoError(t, err)
+
+	_, err = client.GetUserSegments(withKey("admin", ReadConsistencyMetadata, "primary"), &segmenterv1.GetUserSegmentsRequest{UserId: "1"})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeInvalidField)
+}
+
+func TestSegmentService(t *testing.T) {
+	conn, repos := testConn(t, Options{})
+	client := segmenterv1.NewSegmentServiceClient(conn)
+	ctx := withKey("admin")
+
+	_, err := client.CreateSegment(ctx, &segmenterv1.CreateSegmentRequest{})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeMissingField)
+
+	_, err = client.CreateSegment(ctx, &segmenterv1.CreateSegmentRequest{Slug: "A", Percent: 101})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeInvalidField)
+
+	_, err = client.CreateSegment(ctx, &segmenterv1.CreateSegmentRequest{Slug: "A", Ttl: durationpb.New(-time.Hour)})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeInvalidField)
+
+	_, err = client.CreateSegment(ctx, &segmenterv1.CreateSegmentRequest{Slug: "not a slug!"})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeInvalidSlug)
+
+	repos.seg.EXPECT().CreateSegment(gomock.Any(), "A", gomock.Any()).DoAndReturn(func(_ context.Context, _ string, options domain.SegmentOptions) error {
+		require.Equal(t, 48*time.Hour, *options.DefaultTTL)
+		require.Nil(t, options.ExpiresAt)
+		return nil
+	})
+	repos.seg.EXPECT().AddSegmentToPercentOfUsers(gomock.Any(), "A", 10).Return(nil)
+
+	resp, err := client.CreateSegment(ctx, &segmenterv1.CreateSegmentRequest{Slug: "A", Percent: 10, Ttl: durationpb.New(48 * time.Hour)})
+	require.NoError(t, err)
+	require.True(t, resp.UsersAssignmentStarted)
+
+	repos.seg.EXPECT().CreateSegment(gomock.Any(), "A", gomock.Any()).Return(appErrors.ErrorUniqueViolation)
+
+	_, err = client.CreateSegment(ctx, &segmenterv1.CreateSegmentRequest{Slug: "A"})
+	requireStatus(t, err, codes.AlreadyExists, appErrors.CodeSegmentAlreadyExists)
+
+	_, err = client.UpdateSegment(ctx, &segmenterv1.UpdateSegmentRequest{Slug: "A"})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeMissingField)
+
+	_, err = client.UpdateSegment(ctx, &segmenterv1.UpdateSegmentRequest{Slug: "A", Ttl: durationpb.New(time.Hour), RemoveTtl: true})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeInvalidField)
+
+	repos.seg.EXPECT().UpdateSegment(gomock.Any(), "A", gomock.Any()).DoAndReturn(func(_ context.Context, _ string, options domain.SegmentOptions) error {
+		require.Nil(t, options.DefaultTTL)
+		require.True(t, options.ExpiresAt.IsZero())
+		return appErrors.SegmentNotFound("A")
+	})
+
+	_, err = client.UpdateSegment(ctx, &segmenterv1.UpdateSegmentRequest{Slug: "A", RemoveExpiration: true})
+	requireStatus(t, err, codes.NotFound, appErrors.CodeSegmentNotFound)
+
+	repos.seg.EXPECT().DeleteSegment(gomock.Any(), "A").Return(appErrors.ErrorLoggerNotInitialized)
+
+	_, err = client.DeleteSegment(ctx, &segmenterv1.DeleteSegmentRequest{Slug: "A"})
+	requireStatus(t, err, codes.Internal, "")
+	require.Equal(t, "internal error", status.Convert(err).Message())
+}
+
+func TestUserService(t *testing.T) {
+	conn, repos := testConn(t, Options{})
+	client := segmenterv1.NewUserServiceClient(conn)
+	ctx := withKey("admin")
+
+	ttl := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	_, err := client.UpdateUserSegments(ctx, &segmenterv1.UpdateUserSegmentsRequest{UserId: "1", SlugsToAdd: []string{"A", "B"}, Ttl: []*timestamppb.Timestamp{timestamppb.New(ttl)}})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeInvalidField)
+
+	repos.usr.EXPECT().UpdateUserSegments(gomock.Any(), "1", []string{"A"}, []string{"B"}).Return(nil)
+	repos.usr.EXPECT().CreateDeletionTime(gomock.Any(), "1", "A", gomock.Any()).DoAndReturn(func(_ context.Context, _, _ string, deletionTime time.Time) error {
+		require.True(t, ttl.Equal(deletionTime))
+		return nil
+	})
+
+	_, err = client.UpdateUserSegments(ctx, &segmenterv1.UpdateUserSegmentsRequest{UserId: "1", SlugsToAdd: []string{"A"}, SlugsToDelete: []string{"B"}, Ttl: []*timestamppb.Timestamp{timestamppb.New(ttl)}})
+	require.NoError(t, err)
+
+	repos.usr.EXPECT().UpdateUserSegments(gomock.Any(), "2", []string{"A"}, nil).Return(nil)
+	repos.usr.EXPECT().UpdateUserSegments(gomock.Any(), "3", []string{"A"}, nil).Return(appErrors.SegmentNotFound("A"))
+
+	batch, err := client.BatchUpdateUserSegments(ctx, &segmenterv1.BatchUpdateUserSegmentsRequest{Updates: []*segmenterv1.UpdateUserSegmentsRequest{
+		{UserId: "2", SlugsToAdd: []string{"A"}},
+		{SlugsToAdd: []string{"A"}},
+		{UserId: "3", SlugsToAdd: []string{"A"}},
+	}})
+	require.NoError(t, err)
+	require.Len(t, batch.Results, 3)
+	require.Nil(t, batch.Results[0].Error)
+	require.Equal(t, appErrors.CodeMissingField, batch.Results[1].Error.Code)
+	require.Equal(t, "user_id", batch.Results[1].Error.Field)
+	require.Equal(t, "3", batch.Results[2].UserId)
+	require.Equal(t, appErrors.CodeSegmentNotFound, batch.Results[2].Error.Code)
+	require.Equal(t, "A", batch.Results[2].Error.Slug)
+
+	_, err = client.BatchUpdateUserSegments(ctx, &segmenterv1.BatchUpdateUserSegmentsRequest{Updates: make([]*segmenterv1.UpdateUserSegmentsRequest, MaxBatchSize+1)})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeInvalidField)
+
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "1").Return(nil, appErrors.UserNotFound())
+
+	_, err = client.GetUserSegments(ctx, &segmenterv1.GetUserSegmentsRequest{UserId: "1"})
+	requireStatus(t, err, codes.NotFound, appErrors.CodeUserNotFound)
+
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "1").Return([]string{"A", "B"}, nil)
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "2").Return(nil, appErrors.UserNotFound())
+
+	users, err := client.BatchGetUserSegments(ctx, &segmenterv1.BatchGetUserSegmentsRequest{UserIds: []string{"1", "2"}})
+	require.NoError(t, err)
+	require.Len(t, users.Users, 2)
+	require.Equal(t, []string{"A", "B"}, users.Users[0].Slugs)
+	require.Nil(t, users.Users[0].Error)
+	require.Equal(t, appErrors.CodeUserNotFound, users.Users[1].Error.Code)
+
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "1").Return(nil, appErrors.ErrorLoggerNotInitialized)
+
+	_, err = client.BatchGetUserSegments(ctx, &segmenterv1.BatchGetUserSegmentsRequest{UserIds: []string{"1", "2"}})
+	requireStatus(t, err, codes.Internal, "")
+}
+
+func TestReportService(t *testing.T) {
+	conn, repos := testConn(t, Options{})
+	client := segmenterv1.NewReportServiceClient(conn)
+	ctx := withKey("admin")
+
+	now := time.Now()
+	history := []domain.HistoryElem{
+		{UserID: "1", Slug: "A", Operation: "addition", DateTime: now},
+		{UserID: "1", Slug: "B", Operation: "addition", DateTime: now.Add(-time.Minute)},
+		{UserID: "1", Slug: "A", Operation: "deletion", DateTime: now.Add(-time.Hour)},
+	}
+
+	_, err := client.ListUserSegmentsHistory(ctx, &segmenterv1.ListUserSegmentsHistoryRequest{UserId: "1", Start: timestamppb.New(now), End: timestamppb.New(now.Add(-time.Hour))})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeInvalidField)
+
+	_, err = client.ListUserSegmentsHistory(ctx, &segmenterv1.ListUserSegmentsHistoryRequest{UserId: "1", PageToken: "page"})
+	requireStatus(t, err, codes.InvalidArgument, appErrors.CodeInvalidField)
+
+	repos.rep.EXPECT().ReadUserSegmentsHistory(gomock.Any(), "1", gomock.Any(), gomock.Any(), 3, 0).Return(history, nil)
+
+	page, err := client.ListUserSegmentsHistory(ctx, &segmenterv1.ListUserSegmentsHistoryRequest{UserId: "1", PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 2)
+	require.Equal(t, "B", page.Entries[1].Slug)
+	require.True(t, now.Equal(page.Entries[0].Time.AsTime()))
+	require.Equal(t, "2", page.NextPageToken)
+
+	repos.rep.EXPECT().ReadUserSegmentsHistory(gomock.Any(), "1", gomock.Any(), gomock.Any(), 3, 2).Return(history[2:], nil)
+
+	page, err = client.ListUserSegmentsHistory(ctx, &segmenterv1.ListUserSegmentsHistoryRequest{UserId: "1", PageSize: 2, PageToken: page.NextPageToken})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	require.Equal(t, "deletion", page.Entries[0].Operation)
+	require.Empty(t, page.NextPageToken)
+
+	repos.rep.EXPECT().ReadUserSegmentsHistory(gomock.Any(), "2", gomock.Any(), gomock.Any(), defaultPageSize+1, 0).Return(nil, appErrors.UserNotFound())
+
+	_, err = client.ListUserSegmentsHistory(ctx, &segmenterv1.ListUserSegmentsHistoryRequest{UserId: "2"})
+	requireStatus(t, err, codes.NotFound, appErrors.CodeUserNotFound)
+}
+
+func TestRateLimit(t *testing.T) {
+	conn, repos := testConn(t, Options{Limiter: ratelimiter.New(0.5, 1)})
+	client := segmenterv1.NewUserServiceClient(conn)
+
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "1").Return([]string{"A"}, nil)
+
+	_, err := client.GetUserSegments(withKey("admin"), &segmenterv1.GetUserSegmentsRequest{UserId: "1"})
+	require.NoError(t, err)
+
+	var header metadata.MD
+	_, err = client.GetUserSegments(withKey("admin"), &segmenterv1.GetUserSegmentsRequest{UserId: "1"}, grpc.Header(&header))
+	requireStatus(t, err, codes.ResourceExhausted, appErrors.CodeRateLimited)
+	require.Equal(t, []string{"2"}, header.Get("retry-after"))
+
+	// every client has its own bucket
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "1").Return([]string{"A"}, nil)
+	_, err = client.GetUserSegments(withKey("reader"), &segmenterv1.GetUserSegmentsRequest{UserId: "1"})
+	require.NoError(t, err)
+}
@@ -0,0 +1,241 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	segmenterv1 "github.com/PoorMercymain/user-segmenter/pkg/api/segmenter/v1"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+	ratelimiter "github.com/PoorMercymain/user-segmenter/pkg/rate-limiter"
+)
+
+// metadata keys are the lowercase names of the HTTP headers
+const (
+	APIKeyMetadata          = "x-api-key"
+	NamespaceMetadata       = "x-namespace"
+	ReadConsistencyMetadata = "x-read-consistency"
+	RequestIDMetadata       = "x-request-id"
+
+	maxRequestIDLength = 128
+)
+
+// methodScopes are the scopes required by the methods, methods without a scope (e.g. health checks) are public
+var methodScopes = map[string]string{
+	segmenterv1.SegmentService_CreateSegment_FullMethodName:          domain.ScopeSegmentsWrite,
+	segmenterv1.SegmentService_UpdateSegment_FullMethodName:          domain.ScopeSegmentsWrite,
+	segmenterv1.SegmentService_DeleteSegment_FullMethodName:          domain.ScopeSegmentsWrite,
+	segmenterv1.UserService_UpdateUserSegments_FullMethodName:        domain.ScopeUsersWrite,
+	segmenterv1.UserService_BatchUpdateUserSegments_FullMethodName:   domain.ScopeUsersWrite,
+	segmenterv1.UserService_GetUserSegments_FullMethodName:           domain.ScopeUsersRead,
+	segmenterv1.UserService_BatchGetUserSegments_FullMethodName:      domain.ScopeUsersRead,
+	segmenterv1.ReportService_ListUserSegmentsHistory_FullMethodName: domain.ScopeReportsRead,
+}
+
+// accessLog puts the logger with the request ID to the context and writes one line per handled call
+func accessLog(log *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		requestID := metadataValue(ctx, RequestIDMetadata)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			b := make([]byte, 16)
+			_, _ = rand.Read(b)
+			requestID = hex.EncodeToString(b)
+		}
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadata, requestID))
+
+		ctx = context.WithValue(ctx, domain.Key("request_id"), requestID)
+		ctx = logger.WithContext(ctx, log.With("request_id", requestID))
+
+		resp, err := handler(ctx, req)
+
+		code := statusCode(err)
+
+		fields := []interface{}{
+			"method", info.FullMethod,
+			"code", code.String(),
+			"latency", time.Since(start),
+		}
+		if p, ok := peer.FromContext(ctx); ok {
+			fields = append(fields, "remote_addr", p.Addr.String())
+		}
+		if err != nil {
+			fields = append(fields, "error", err.Error())
+		}
+
+		if code == codes.Internal || code == codes.Unknown {
+			log.Errorw("call handled", fields...)
+		} else {
+			log.Infow("call handled", fields...)
+		}
+
+		return resp, err
+	}
+}
+
+// authenticate puts the client of the credential sent in the x-api-key or authorization (Bearer) metadata to the context.
+// Authenticators are tried in order until one of them accepts the credential, without authenticators
+// every call gets all scopes, like with the Anonymous middleware
+func authenticate(authenticators []domain.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if len(authenticators) == 0 {
+			client := domain.Client{Name: "anonymous", Namespace: domain.AllNamespaces, Scopes: domain.Scopes}
+			return handler(domain.ContextWithClient(ctx, client), req)
+		}
+
+		credential := credentialFromMetadata(ctx)
+		if credential == "" {
+			return handler(ctx, req)
+		}
+
+		client, err := authenticateCredential(ctx, authenticators, credential)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx = domain.ContextWithClient(ctx, client)
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).With("client", client.ID))
+
+		return handler(ctx, req)
+	}
+}
+
+func authenticateCredential(ctx context.Context, authenticators []domain.Authenticator, credential string) (domain.Client, error) {
+	for _, auth := range authenticators {
+		client, err := auth.Authenticate(ctx, credential)
+		if !errors.Is(err, appErrors.ErrorUnauthenticated) {
+			return client, err
+		}
+	}
+
+	return domain.Client{}, appErrors.Unauthenticated()
+}
+
+func credentialFromMetadata(ctx context.Context) string {
+	if key := metadataValue(ctx, APIKeyMetadata); key != "" {
+		return key
+	}
+
+	scheme, credential, found := strings.Cut(metadataValue(ctx, "authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(credential)
+}
+
+// rateLimit limits calls of every client like the RateLimit middleware does, the time to wait is sent in the retry-after header
+func rateLimit(limiter *ratelimiter.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if ok, retryAfter := limiter.Allow(clientKey(ctx)); !ok {
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))))
+			return nil, appErrors.RateLimited()
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func clientKey(ctx context.Context) string {
+	if client, ok := domain.ClientFromContext(ctx); ok && client.ID != "" {
+		return client.ID
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return "ip:" + host
+		}
+		return "ip:" + p.Addr.String()
+	}
+
+	return "ip:"
+}
+
+// namespace puts the namespace selected by the x-namespace metadata to the context, the default one is used without it
+func namespace() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		namespace := metadataValue(ctx, NamespaceMetadata)
+		if namespace == "" {
+			namespace = domain.DefaultNamespace
+		}
+
+		if !domain.IsValidNamespace(namespace) {
+			return nil, appErrors.InvalidNamespace()
+		}
+
+		ctx = domain.ContextWithNamespace(ctx, namespace)
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).With("namespace", namespace))
+
+		return handler(ctx, req)
+	}
+}
+
+// readConsistency puts the read consistency selected by the x-read-consistency metadata to the context
+func readConsistency() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		consistency := metadataValue(ctx, ReadConsistencyMetadata)
+		if consistency == "" {
+			return handler(ctx, req)
+		}
+
+		if !domain.IsValidReadConsistency(consistency) {
+			return nil, appErrors.InvalidField(ReadConsistencyMetadata, appErrors.ErrorUnknownReadConsistency)
+		}
+
+		return handler(domain.ContextWithReadConsistency(ctx, consistency), req)
+	}
+}
+
+// requireScope rejects calls of clients without the scope of the method or without access to the namespace
+func requireScope() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		scope, ok := methodScopes[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		client, ok := domain.ClientFromContext(ctx)
+		if !ok {
+			return nil, appErrors.Unauthenticated()
+		}
+
+		if !client.HasScope(scope) {
+			return nil, appErrors.InsufficientScope(scope)
+		}
+
+		if !client.CanAccess(domain.NamespaceFromContext(ctx)) {
+			return nil, appErrors.NamespaceForbidden()
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
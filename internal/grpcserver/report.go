@@ -0,0 +1,99 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	segmenterv1 "github.com/PoorMercymain/user-segmenter/pkg/api/segmenter/v1"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+var _ segmenterv1.ReportServiceServer = (*report)(nil)
+
+type report struct {
+	segmenterv1.UnimplementedReportServiceServer
+	srv domain.ReportService
+}
+
+func NewReport(srv domain.ReportService) *report {
+	return &report{srv: srv}
+}
+
+// ListUserSegmentsHistory returns the history from the newest changes, the page token is the offset of the next page
+func (s *report) ListUserSegmentsHistory(ctx context.Context, req *segmenterv1.ListUserSegmentsHistoryRequest) (*segmenterv1.ListUserSegmentsHistoryResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, appErrors.MissingField("user_id")
+	}
+
+	startDate := time.Unix(0, 0)
+	if req.GetStart() != nil {
+		if err := req.GetStart().CheckValid(); err != nil {
+			return nil, appErrors.InvalidField("start", err)
+		}
+		startDate = req.GetStart().AsTime()
+	}
+
+	endDate := time.Now()
+	if req.GetEnd() != nil {
+		if err := req.GetEnd().CheckValid(); err != nil {
+			return nil, appErrors.InvalidField("end", err)
+		}
+		endDate = req.GetEnd().AsTime()
+	}
+
+	if endDate.Before(startDate) {
+		return nil, appErrors.InvalidField("end", errors.New("end date should not be before the start date"))
+	}
+
+	pageSize := int(req.GetPageSize())
+	if pageSize < 0 || pageSize > maxPageSize {
+		return nil, appErrors.InvalidField("page_size", nil)
+	}
+
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+
+	var offset int
+	if req.GetPageToken() != "" {
+		var err error
+		offset, err = strconv.Atoi(req.GetPageToken())
+		if err != nil || offset < 0 {
+			return nil, appErrors.InvalidField("page_token", nil)
+		}
+	}
+
+	// one more entry is read to know whether there is a next page
+	history, err := s.srv.ReadUserSegmentsHistory(ctx, req.GetUserId(), startDate, endDate, pageSize+1, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &segmenterv1.ListUserSegmentsHistoryResponse{}
+	if len(history) > pageSize {
+		history = history[:pageSize]
+		resp.NextPageToken = strconv.Itoa(offset + pageSize)
+	}
+
+	resp.Entries = make([]*segmenterv1.HistoryEntry, 0, len(history))
+	for _, elem := range history {
+		resp.Entries = append(resp.Entries, &segmenterv1.HistoryEntry{
+			UserId:    elem.UserID,
+			Slug:      elem.Slug,
+			Operation: elem.Operation,
+			Time:      timestamppb.New(elem.DateTime),
+		})
+	}
+
+	return resp, nil
+}
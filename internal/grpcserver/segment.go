@@ -0,0 +1,137 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	segmenterv1 "github.com/PoorMercymain/user-segmenter/pkg/api/segmenter/v1"
+)
+
+var _ segmenterv1.SegmentServiceServer = (*segment)(nil)
+
+type segment struct {
+	segmenterv1.UnimplementedSegmentServiceServer
+	srv domain.SegmentService
+}
+
+func NewSegment(srv domain.SegmentService) *segment {
+	return &segment{srv: srv}
+}
+
+func (s *segment) CreateSegment(ctx context.Context, req *segmenterv1.CreateSegmentRequest) (*segmenterv1.CreateSegmentResponse, error) {
+	if req.GetSlug() == "" {
+		return nil, appErrors.MissingField("slug")
+	}
+
+	if req.GetPercent() < 0 || req.GetPercent() > 100 {
+		return nil, appErrors.InvalidField("percent", nil)
+	}
+
+	options, err := segmentOptions(req.GetTtl(), false, req.GetExpiresAt(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.srv.CreateSegment(ctx, req.GetSlug(), options)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetPercent() == 0 {
+		return &segmenterv1.CreateSegmentResponse{}, nil
+	}
+
+	err = s.srv.AddSegmentToPercentOfUsers(ctx, req.GetSlug(), int(req.GetPercent()))
+	if err != nil && !errors.Is(err, appErrors.ErrorNoRows) {
+		return nil, err
+	}
+
+	return &segmenterv1.CreateSegmentResponse{UsersAssignmentStarted: true}, nil
+}
+
+func (s *segment) UpdateSegment(ctx context.Context, req *segmenterv1.UpdateSegmentRequest) (*segmenterv1.UpdateSegmentResponse, error) {
+	if req.GetSlug() == "" {
+		return nil, appErrors.MissingField("slug")
+	}
+
+	if req.GetTtl() == nil && !req.GetRemoveTtl() && req.GetExpiresAt() == nil && !req.GetRemoveExpiration() {
+		return nil, appErrors.MissingField("ttl")
+	}
+
+	options, err := segmentOptions(req.GetTtl(), req.GetRemoveTtl(), req.GetExpiresAt(), req.GetRemoveExpiration())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.srv.UpdateSegment(ctx, req.GetSlug(), options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &segmenterv1.UpdateSegmentResponse{}, nil
+}
+
+func (s *segment) DeleteSegment(ctx context.Context, req *segmenterv1.DeleteSegmentRequest) (*segmenterv1.DeleteSegmentResponse, error) {
+	if req.GetSlug() == "" {
+		return nil, appErrors.MissingField("slug")
+	}
+
+	err := s.srv.DeleteSegment(ctx, req.GetSlug())
+	if err != nil {
+		return nil, err
+	}
+
+	return &segmenterv1.DeleteSegmentResponse{}, nil
+}
+
+// segmentOptions validates the settings like parseSegmentOptions of the HTTP handlers does,
+// remove flags result in zero values, which remove the settings
+func segmentOptions(ttl *durationpb.Duration, removeTTL bool, expiresAt *timestamppb.Timestamp, removeExpiration bool) (domain.SegmentOptions, error) {
+	var options domain.SegmentOptions
+
+	if ttl != nil && removeTTL {
+		return options, appErrors.InvalidField("remove_ttl", errors.New("ttl can't be set and removed at once"))
+	}
+
+	if expiresAt != nil && removeExpiration {
+		return options, appErrors.InvalidField("remove_expiration", errors.New("expiration can't be set and removed at once"))
+	}
+
+	if ttl != nil || removeTTL {
+		var defaultTTL time.Duration
+		if ttl != nil {
+			if err := ttl.CheckValid(); err != nil {
+				return options, appErrors.InvalidField("ttl", err)
+			}
+
+			defaultTTL = ttl.AsDuration()
+			if defaultTTL <= 0 {
+				return options, appErrors.InvalidField("ttl", appErrors.ErrorNotPositiveTTL)
+			}
+		}
+		options.DefaultTTL = &defaultTTL
+	}
+
+	if expiresAt != nil || removeExpiration {
+		var expirationTime time.Time
+		if expiresAt != nil {
+			if err := expiresAt.CheckValid(); err != nil {
+				return options, appErrors.InvalidField("expires_at", err)
+			}
+
+			expirationTime = expiresAt.AsTime()
+			if !expirationTime.After(time.Now()) {
+				return options, appErrors.InvalidField("expires_at", appErrors.ErrorExpirationInPast)
+			}
+		}
+		options.ExpiresAt = &expirationTime
+	}
+
+	return options, nil
+}
@@ -0,0 +1,41 @@
+// Package grpcserver serves the gRPC API, which mirrors the HTTP one and uses the same services
+package grpcserver
+
+import (
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	ratelimiter "github.com/PoorMercymain/user-segmenter/pkg/rate-limiter"
+)
+
+// Options are limits shared with the HTTP API, a nil limiter disables rate limiting
+type Options struct {
+	Limiter        *ratelimiter.Limiter
+	MaxMessageSize int
+}
+
+// NewServer creates a server which authenticates and limits calls like the HTTP API does, services are registered by the caller.
+// Errors are converted to statuses after the access log, so it keeps details of internal errors
+func NewServer(log *zap.SugaredLogger, options Options, authenticators ...domain.Authenticator) *grpc.Server {
+	interceptors := []grpc.UnaryServerInterceptor{
+		otelgrpc.UnaryServerInterceptor(),
+		errorStatus(),
+		accessLog(log),
+		authenticate(authenticators),
+	}
+
+	if options.Limiter != nil {
+		interceptors = append(interceptors, rateLimit(options.Limiter))
+	}
+
+	interceptors = append(interceptors, namespace(), readConsistency(), requireScope())
+
+	serverOptions := []grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors...)}
+	if options.MaxMessageSize > 0 {
+		serverOptions = append(serverOptions, grpc.MaxRecvMsgSize(options.MaxMessageSize))
+	}
+
+	return grpc.NewServer(serverOptions...)
+}
@@ -0,0 +1,125 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	segmenterv1 "github.com/PoorMercymain/user-segmenter/pkg/api/segmenter/v1"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+)
+
+// MaxBatchSize limits the amount of items in one batch call
+const MaxBatchSize = 1000
+
+var _ segmenterv1.UserServiceServer = (*user)(nil)
+
+type user struct {
+	segmenterv1.UnimplementedUserServiceServer
+	srv domain.UserService
+}
+
+func NewUser(srv domain.UserService) *user {
+	return &user{srv: srv}
+}
+
+func (s *user) UpdateUserSegments(ctx context.Context, req *segmenterv1.UpdateUserSegmentsRequest) (*segmenterv1.UpdateUserSegmentsResponse, error) {
+	err := s.updateUserSegments(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &segmenterv1.UpdateUserSegmentsResponse{}, nil
+}
+
+func (s *user) BatchUpdateUserSegments(ctx context.Context, req *segmenterv1.BatchUpdateUserSegmentsRequest) (*segmenterv1.BatchUpdateUserSegmentsResponse, error) {
+	if len(req.GetUpdates()) > MaxBatchSize {
+		return nil, appErrors.InvalidField("updates", fmt.Errorf("at most %d updates can be sent at once", MaxBatchSize))
+	}
+
+	results := make([]*segmenterv1.UpdateUserSegmentsResult, 0, len(req.GetUpdates()))
+	for _, update := range req.GetUpdates() {
+		err := s.updateUserSegments(ctx, update)
+		if err != nil && statusCode(err) == codes.Internal {
+			logger.FromContext(ctx).Errorw("failed to update user segments", "user_id", update.GetUserId(), "error", err)
+		}
+
+		results = append(results, &segmenterv1.UpdateUserSegmentsResult{UserId: update.GetUserId(), Error: itemError(err)})
+	}
+
+	return &segmenterv1.BatchUpdateUserSegmentsResponse{Results: results}, nil
+}
+
+// updateUserSegments validates the update like the UpdateUserSegments HTTP handler does
+func (s *user) updateUserSegments(ctx context.Context, req *segmenterv1.UpdateUserSegmentsRequest) error {
+	if req.GetUserId() == "" {
+		return appErrors.MissingField("user_id")
+	}
+
+	if len(req.GetSlugsToAdd()) != len(req.GetTtl()) && len(req.GetTtl()) != 0 {
+		return appErrors.InvalidField("ttl", errors.New("amount of TTLs should match amount of segments to add"))
+	}
+
+	TTLs := make([]time.Time, 0, len(req.GetTtl()))
+	for i, TTL := range req.GetTtl() {
+		if err := TTL.CheckValid(); err != nil {
+			return appErrors.InvalidField(fmt.Sprintf("ttl.%d", i), err)
+		}
+		TTLs = append(TTLs, TTL.AsTime())
+	}
+
+	err := s.srv.UpdateUserSegments(ctx, req.GetUserId(), req.GetSlugsToAdd(), req.GetSlugsToDelete())
+	if err != nil {
+		return err
+	}
+
+	for i, TTL := range TTLs {
+		err = s.srv.CreateDeletionTime(ctx, req.GetUserId(), req.GetSlugsToAdd()[i], TTL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *user) GetUserSegments(ctx context.Context, req *segmenterv1.GetUserSegmentsRequest) (*segmenterv1.GetUserSegmentsResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, appErrors.MissingField("user_id")
+	}
+
+	slugs, err := s.srv.ReadUserSegments(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &segmenterv1.GetUserSegmentsResponse{Slugs: slugs}, nil
+}
+
+func (s *user) BatchGetUserSegments(ctx context.Context, req *segmenterv1.BatchGetUserSegmentsRequest) (*segmenterv1.BatchGetUserSegmentsResponse, error) {
+	if len(req.GetUserIds()) > MaxBatchSize {
+		return nil, appErrors.InvalidField("user_ids", fmt.Errorf("at most %d users can be requested at once", MaxBatchSize))
+	}
+
+	users := make([]*segmenterv1.UserSegments, 0, len(req.GetUserIds()))
+	for i, userID := range req.GetUserIds() {
+		if userID == "" {
+			return nil, appErrors.MissingField(fmt.Sprintf("user_ids.%d", i))
+		}
+
+		slugs, err := s.srv.ReadUserSegments(ctx, userID)
+		if err != nil && statusCode(err) == codes.Internal {
+			// an internal error would most likely fail the rest of the users too
+			return nil, err
+		}
+
+		users = append(users, &segmenterv1.UserSegments{UserId: userID, Slugs: slugs, Error: itemError(err)})
+	}
+
+	return &segmenterv1.BatchGetUserSegmentsResponse{Users: users}, nil
+}
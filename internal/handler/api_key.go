@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	jsonduplicatechecker "github.com/PoorMercymain/user-segmenter/pkg/json-duplicate-checker"
+	jsonmimechecker "github.com/PoorMercymain/user-segmenter/pkg/json-mime-checker"
+)
+
+type apiKey struct {
+	srv domain.APIKeyService
+}
+
+func NewAPIKey(srv domain.APIKeyService) *apiKey {
+	return &apiKey{srv: srv}
+}
+
+// @Tags Keys
+// @Summary Запрос для выпуска API-ключа
+// @Description Запрос для создания API-ключа с набором прав, сам ключ возвращается только в ответе на этот запрос
+// @Accept json
+// @Produce json
+// @Param input body domain.APIKeyRequest true "key info"
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Success 201 {object} domain.IssuedAPIKey
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 413 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/keys [post]
+func (h *apiKey) IssueAPIKey(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	if !jsonmimechecker.IsJSONContentTypeCorrect(c.Request()) {
+		return problem(c, http.StatusBadRequest, appErrors.InvalidContentType())
+	}
+
+	bytesToCheck, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return problem(c, readingStatus(err), err)
+	}
+
+	reader := bytes.NewReader(bytes.Clone(bytesToCheck))
+
+	err = jsonduplicatechecker.CheckDuplicatesInJSON(json.NewDecoder(reader), nil)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	d := json.NewDecoder(bytes.NewReader(bytesToCheck))
+	d.DisallowUnknownFields()
+
+	var keyRequest domain.APIKeyRequest
+
+	if err := d.Decode(&keyRequest); err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	if keyRequest.Name == "" {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("name"))
+	}
+
+	if len(keyRequest.Scopes) == 0 {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("scopes"))
+	}
+
+	issued, err := h.srv.IssueAPIKey(c.Request().Context(), keyRequest.Name, keyRequest.Scopes)
+	if err != nil {
+		if errors.Is(err, appErrors.ErrorUnknownScope) {
+			return problem(c, http.StatusBadRequest, err)
+		}
+
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, issued)
+}
+
+// @Tags Keys
+// @Summary Запрос списка API-ключей
+// @Description Запрос для получения всех выпущенных API-ключей, включая отозванные, без самих ключей
+// @Produce json
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Success 200 {array} domain.APIKey
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/keys [get]
+func (h *apiKey) ReadAPIKeys(c echo.Context) error {
+	keys, err := h.srv.ReadAPIKeys(c.Request().Context())
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+// @Tags Keys
+// @Summary Запрос для отзыва API-ключа
+// @Description Запрос для отзыва API-ключа по идентификатору, после отзыва ключ перестает приниматься
+// @Param id path string true "key id"
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param Idempotency-Key header string false "key of the request, retries with the same key get the first response instead of being processed again"
+// @Success 204
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 422 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/keys/{id} [delete]
+func (h *apiKey) RevokeAPIKey(c echo.Context) error {
+	err := h.srv.RevokeAPIKey(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, appErrors.ErrorNoRows) {
+			return problem(c, http.StatusNotFound, err)
+		}
+
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
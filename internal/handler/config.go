@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+type configVersion struct {
+	version func() domain.ConfigVersion
+}
+
+func NewConfigVersion(version func() domain.ConfigVersion) *configVersion {
+	return &configVersion{version: version}
+}
+
+// @Tags Admin
+// @Summary Запрос версии конфигурации
+// @Description Запрос для получения версии и контрольной суммы конфигурации, с которой работает экземпляр сервиса, результата последней перезагрузки конфигурации и настроек, для применения которых нужен перезапуск
+// @Produce json
+// @Success 200 {object} domain.ConfigVersion
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/admin/config [get]
+func (h *configVersion) ReadConfigVersion(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.version())
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	jsonduplicatechecker "github.com/PoorMercymain/user-segmenter/pkg/json-duplicate-checker"
+	jsonmimechecker "github.com/PoorMercymain/user-segmenter/pkg/json-mime-checker"
+)
+
+const (
+	defaultChangesLimit = 1000
+	maxChangesLimit     = 1000
+)
+
+type evaluation struct {
+	srv domain.EvaluationService
+}
+
+func NewEvaluation(srv domain.EvaluationService) *evaluation {
+	return &evaluation{srv: srv}
+}
+
+// @Tags Evaluation
+// @Summary Запрос снимка состояния для локального вычисления сегментов
+// @Description Запрос для получения всех сегментов пространства имен и сегментов переданных пользователей (до 1000 за запрос) вместе с курсором ленты изменений. Пользователи, которых не существует, в ответ не попадают
+// @Accept json
+// @Produce json
+// @Param input body domain.SnapshotRequest true "users"
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Success 200 {object} domain.EvaluationSnapshot
+// @Failure 500 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 413 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/evaluation/snapshot [post]
+func (h *evaluation) ReadSnapshot(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	if !jsonmimechecker.IsJSONContentTypeCorrect(c.Request()) {
+		return problem(c, http.StatusBadRequest, appErrors.InvalidContentType())
+	}
+
+	bytesToCheck, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return problem(c, readingStatus(err), err)
+	}
+
+	reader := bytes.NewReader(bytes.Clone(bytesToCheck))
+
+	err = jsonduplicatechecker.CheckDuplicatesInJSON(json.NewDecoder(reader), nil)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	d := json.NewDecoder(bytes.NewReader(bytesToCheck))
+	d.DisallowUnknownFields()
+
+	var snapshotRequest domain.SnapshotRequest
+
+	if err := d.Decode(&snapshotRequest); err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	if len(snapshotRequest.UserIDs) > domain.MaxSnapshotUsers {
+		return problem(c, http.StatusBadRequest, appErrors.InvalidField("user_ids", errors.New("too many users, the limit is "+strconv.Itoa(domain.MaxSnapshotUsers))))
+	}
+
+	snapshot, err := h.srv.ReadSnapshot(c.Request().Context(), snapshotRequest.UserIDs)
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, snapshot)
+}
+
+// @Tags Evaluation
+// @Summary Запрос ленты изменений
+// @Description Запрос для получения пользователей и сегментов, измененных после курсора. Новое состояние измененных пользователей и сегментов читается запросом снимка. Если изменения после курсора уже удалены, возвращается 410 и нужно заново прочитать снимок
+// @Produce json
+// @Param cursor query string true "cursor of the snapshot or of the previous page" Example(1024.0)
+// @Param limit query int false "max amount of changes, 1000 by default" Example(100)
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Success 200 {object} domain.ChangesPage
+// @Failure 500 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 410 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/evaluation/changes [get]
+func (h *evaluation) ReadChanges(c echo.Context) error {
+	cursorStr := c.QueryParam("cursor")
+	if cursorStr == "" {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("cursor"))
+	}
+
+	cursor, err := parseCursor(cursorStr)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err)
+	}
+
+	limit := defaultChangesLimit
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxChangesLimit {
+			return problem(c, http.StatusBadRequest, appErrors.InvalidField("limit", err))
+		}
+	}
+
+	page, err := h.srv.ReadChanges(c.Request().Context(), cursor, limit)
+	if err != nil {
+		if errors.Is(err, appErrors.ErrorCursorExpired) {
+			return problem(c, http.StatusGone, err)
+		}
+
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// parseCursor parses a cursor in the format of domain.ChangesCursor.String
+func parseCursor(s string) (domain.ChangesCursor, error) {
+	tx, id, found := strings.Cut(s, ".")
+	if !found {
+		return domain.ChangesCursor{}, appErrors.InvalidField("cursor", appErrors.ErrorInvalidCursor)
+	}
+
+	var cursor domain.ChangesCursor
+	var txErr, idErr error
+	cursor.Tx, txErr = strconv.ParseInt(tx, 10, 64)
+	cursor.ID, idErr = strconv.ParseInt(id, 10, 64)
+	if txErr != nil || idErr != nil || cursor.Tx < 0 || cursor.ID < 0 {
+		return domain.ChangesCursor{}, appErrors.InvalidField("cursor", appErrors.ErrorInvalidCursor)
+	}
+
+	return cursor, nil
+}
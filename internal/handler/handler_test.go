@@ -11,17 +11,18 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
 
 	appErrors "github.com/PoorMercymain/user-segmenter/errors"
 	"github.com/PoorMercymain/user-segmenter/internal/domain"
 	"github.com/PoorMercymain/user-segmenter/internal/domain/mocks"
 	"github.com/PoorMercymain/user-segmenter/internal/middleware"
 	"github.com/PoorMercymain/user-segmenter/internal/service"
-	"github.com/PoorMercymain/user-segmenter/pkg/logger"
 )
 
 func testRouter(t *testing.T) *echo.Echo {
 	e := echo.New()
+	e.HTTPErrorHandler = ErrorHandler
 
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -29,12 +30,20 @@ func testRouter(t *testing.T) *echo.Echo {
 	mockSegRepo := mocks.NewMockSegmentRepository(ctrl)
 	mockUsrRepo := mocks.NewMockUserRepository(ctrl)
 	mockRepRepo := mocks.NewMockReportRepository(ctrl)
+	mockKeyRepo := mocks.NewMockAPIKeyRepository(ctrl)
+	mockEvlRepo := mocks.NewMockEvaluationRepository(ctrl)
 
-	mockSegRepo.EXPECT().CreateSegment(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockSegRepo.EXPECT().CreateSegment(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	mockSegRepo.EXPECT().UpdateSegment(gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorNoRows).MaxTimes(1)
+	mockSegRepo.EXPECT().UpdateSegment(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 	mockSegRepo.EXPECT().DeleteSegment(gomock.Any(), gomock.Any()).Return(appErrors.ErrorNoRows).MaxTimes(1)
 	mockSegRepo.EXPECT().DeleteSegment(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
+	mockSegRepo.EXPECT().ReadSegments(gomock.Any()).Return(nil, appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
+	mockSegRepo.EXPECT().ReadSegments(gomock.Any()).Return([]domain.Segment{{Slug: "test", TTL: "48h0m0s"}}, nil).AnyTimes()
+
 	mockUsrRepo.EXPECT().UpdateUserSegments(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorNoRows).MaxTimes(1)
 	mockUsrRepo.EXPECT().UpdateUserSegments(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
@@ -43,6 +52,23 @@ func testRouter(t *testing.T) *echo.Echo {
 	mockUsrRepo.EXPECT().ReadUserSegments(gomock.Any(), gomock.Any()).Return(nil, appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
 	mockUsrRepo.EXPECT().ReadUserSegments(gomock.Any(), gomock.Any()).Return([]string{"a"}, nil).AnyTimes()
 
+	mockUsrRepo.EXPECT().ReadDeletionTimes(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
+	mockUsrRepo.EXPECT().ReadDeletionTimes(gomock.Any(), gomock.Any(), gomock.Any()).Return(make([]domain.DeletionTime, 0), nil).MaxTimes(1)
+	mockUsrRepo.EXPECT().ReadDeletionTimes(gomock.Any(), gomock.Any(), gomock.Any()).Return([]domain.DeletionTime{{UserID: "1", Slug: "a", DeletionTime: time.Now()}}, nil).AnyTimes()
+
+	mockUsrRepo.EXPECT().UpdateDeletionTime(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorNoRows).MaxTimes(1)
+	mockUsrRepo.EXPECT().UpdateDeletionTime(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	mockUsrRepo.EXPECT().DeleteDeletionTime(gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorNoRows).MaxTimes(1)
+	mockUsrRepo.EXPECT().DeleteDeletionTime(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	mockUsrRepo.EXPECT().ScheduleUserSegments(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorNoRows).MaxTimes(1)
+	mockUsrRepo.EXPECT().ScheduleUserSegments(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	mockUsrRepo.EXPECT().ReadScheduledAssignments(gomock.Any(), gomock.Any()).Return(nil, appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
+	mockUsrRepo.EXPECT().ReadScheduledAssignments(gomock.Any(), gomock.Any()).Return(make([]domain.ScheduledAssignment, 0), nil).MaxTimes(1)
+	mockUsrRepo.EXPECT().ReadScheduledAssignments(gomock.Any(), gomock.Any()).Return([]domain.ScheduledAssignment{{UserID: "1", Slug: "a", StartsAt: time.Now()}}, nil).AnyTimes()
+
 	mockRepRepo.EXPECT().ReadUserSegmentsHistory(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, appErrors.ErrorNoRows).MaxTimes(1)
 	mockRepRepo.EXPECT().ReadUserSegmentsHistory(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
 	mockRepRepo.EXPECT().ReadUserSegmentsHistory(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(make([]domain.HistoryElem, 0), nil).MaxTimes(1)
@@ -55,26 +81,56 @@ func testRouter(t *testing.T) *echo.Echo {
 	mockRepRepo.EXPECT().CreateCSV(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("", appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
 	mockRepRepo.EXPECT().CreateCSV(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("report1.csv", nil).AnyTimes()
 
-	mockRepRepo.EXPECT().SendCSVReportFile(gomock.Any(), gomock.Any()).Return(appErrors.ErrorBadFilename).MaxTimes(1)
-	mockRepRepo.EXPECT().SendCSVReportFile(gomock.Any(), gomock.Any()).Return(appErrors.ErrorFileNotFound).MaxTimes(1)
-	mockRepRepo.EXPECT().SendCSVReportFile(gomock.Any(), gomock.Any()).Return(appErrors.ErrorEmptyFile).MaxTimes(1)
-	mockRepRepo.EXPECT().SendCSVReportFile(gomock.Any(), gomock.Any()).Return(appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
-	mockRepRepo.EXPECT().SendCSVReportFile(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockRepRepo.EXPECT().SendCSVReportFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorBadFilename).MaxTimes(1)
+	mockRepRepo.EXPECT().SendCSVReportFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorFileNotFound).MaxTimes(1)
+	mockRepRepo.EXPECT().SendCSVReportFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorEmptyFile).MaxTimes(1)
+	mockRepRepo.EXPECT().SendCSVReportFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
+	mockRepRepo.EXPECT().SendCSVReportFile(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	mockKeyRepo.EXPECT().CreateAPIKey(gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
+	mockKeyRepo.EXPECT().CreateAPIKey(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	mockKeyRepo.EXPECT().ReadAPIKeys(gomock.Any()).Return(nil, appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
+	mockKeyRepo.EXPECT().ReadAPIKeys(gomock.Any()).Return([]domain.APIKey{{ID: "1", Name: "billing", Scopes: []string{domain.ScopeUsersRead}}}, nil).AnyTimes()
+
+	mockKeyRepo.EXPECT().RevokeAPIKey(gomock.Any(), gomock.Any()).Return(appErrors.APIKeyNotFound()).MaxTimes(1)
+	mockKeyRepo.EXPECT().RevokeAPIKey(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	mockEvlRepo.EXPECT().ReadSnapshot(gomock.Any(), gomock.Any()).Return(domain.EvaluationSnapshot{}, appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
+	mockEvlRepo.EXPECT().ReadSnapshot(gomock.Any(), gomock.Any()).Return(domain.EvaluationSnapshot{Cursor: "10.0"}, nil).AnyTimes()
+
+	mockEvlRepo.EXPECT().ReadChanges(gomock.Any(), gomock.Any(), gomock.Any()).Return(domain.ChangesPage{}, appErrors.CursorExpired()).MaxTimes(1)
+	mockEvlRepo.EXPECT().ReadChanges(gomock.Any(), domain.ChangesCursor{Tx: 10, ID: 5}, 100).Return(domain.ChangesPage{Cursor: "11.0"}, nil).AnyTimes()
 
 	segSrv := service.NewSegment(mockSegRepo)
 	usrSrv := service.NewUser(mockUsrRepo)
 	repSrv := service.NewReport(mockRepRepo)
 
 	segHan := NewSegment(segSrv)
-	usrHan := NewUser(usrSrv)
+	usrHan := NewUser(usrSrv, 1024)
 	repHan := NewReport(repSrv)
+	keyHan := NewAPIKey(service.NewAPIKey(mockKeyRepo))
+	evlHan := NewEvaluation(service.NewEvaluation(mockEvlRepo))
 
-	e.POST("/api/segment", segHan.CreateSegment, middleware.UseGzipReader())
-	e.DELETE("/api/segment", segHan.DeleteSegment, middleware.UseGzipReader())
-	e.POST("/api/user", usrHan.UpdateUserSegments, middleware.UseGzipReader())
+	e.POST("/api/segment", segHan.CreateSegment, middleware.UseGzipReader(0))
+	e.PATCH("/api/segment", segHan.UpdateSegment, middleware.UseGzipReader(0))
+	e.DELETE("/api/segment", segHan.DeleteSegment, middleware.UseGzipReader(0))
+	e.GET("/api/segment", segHan.ReadSegments)
+	e.POST("/api/user", usrHan.UpdateUserSegments, middleware.UseGzipReader(0))
 	e.GET("/api/user/:user", usrHan.ReadUserSegments)
+	e.GET("/api/ttl", usrHan.ReadDeletionTimes)
+	e.PATCH("/api/ttl", usrHan.UpdateDeletionTime, middleware.UseGzipReader(0))
+	e.DELETE("/api/ttl", usrHan.DeleteDeletionTime, middleware.UseGzipReader(0))
+	e.POST("/api/schedule", usrHan.ScheduleUserSegments, middleware.UseGzipReader(0))
+	e.GET("/api/schedule/:user", usrHan.ReadScheduledAssignments)
 	e.GET("/api/user-history/:user", repHan.CreateUserSegmentsHistoryReport, middleware.AddServerAddressToContext(""))
 	e.GET("/api/reports/:report", repHan.ReadUserSegmentsHistoryReport)
+	e.GET("/api/ns/:namespace/user-history/:user", repHan.CreateUserSegmentsHistoryReport, middleware.Namespace(), middleware.AddServerAddressToContext(""))
+	e.POST("/api/keys", keyHan.IssueAPIKey)
+	e.GET("/api/keys", keyHan.ReadAPIKeys)
+	e.DELETE("/api/keys/:id", keyHan.RevokeAPIKey)
+	e.POST("/api/evaluation/snapshot", evlHan.ReadSnapshot)
+	e.GET("/api/evaluation/changes", evlHan.ReadChanges)
 
 	return e
 }
@@ -91,8 +147,7 @@ func request(t *testing.T, ts *httptest.Server, code int, method, content, body,
 	b, err := io.ReadAll(resp.Body)
 	require.NoError(t, err)
 
-	logger.InitLogger()
-	log, _ := logger.GetLogger()
+	log := zaptest.NewLogger(t).Sugar()
 
 	log.Infoln(string(b))
 
@@ -113,13 +168,6 @@ func TestCreateSegment(t *testing.T) {
 		code     int
 		body     string
 	}{
-		{
-			"/api/segment",
-			http.MethodPost,
-			"application/json",
-			http.StatusInternalServerError, // logger should not be initialized for the first test case to get 500
-			"{\"slug\":\"test\"}",
-		},
 		{
 			"/api/segment",
 			http.MethodPost,
@@ -190,15 +238,101 @@ func TestCreateSegment(t *testing.T) {
 			http.StatusBadRequest,
 			"{\"slug\":\"test\",\"percent\":\"10\"}",
 		},
+		{
+			"/api/segment",
+			http.MethodPost,
+			"application/json",
+			http.StatusOK,
+			"{\"slug\":\"test\",\"ttl\":\"48h\",\"expires_at\":\"2999-09-30T20:19:05+03:00\"}",
+		},
+		{
+			"/api/segment",
+			http.MethodPost,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"slug\":\"test\",\"ttl\":\"two days\"}",
+		},
+		{
+			"/api/segment",
+			http.MethodPost,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"slug\":\"test\",\"ttl\":\"-1h\"}",
+		},
+		{
+			"/api/segment",
+			http.MethodPost,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"slug\":\"test\",\"expires_at\":\"2000-09-30T20:19:05+03:00\"}",
+		},
 	}
 
-	for i, testCase := range testTable {
+	for _, testCase := range testTable {
 		resp := request(t, ts, testCase.code, testCase.method, testCase.content, testCase.body, testCase.endpoint)
 		resp.Body.Close()
+	}
+}
+
+func TestUpdateSegment(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
 
-		if i == 0 {
-			logger.InitLogger()
-		}
+	defer ts.Close()
+
+	var testTable = []struct {
+		endpoint string
+		method   string
+		content  string
+		code     int
+		body     string
+	}{
+		{
+			"/api/segment",
+			http.MethodPatch,
+			"application/json",
+			http.StatusNotFound,
+			"{\"slug\":\"test\",\"ttl\":\"48h\"}",
+		},
+		{
+			"/api/segment",
+			http.MethodPatch,
+			"application/json",
+			http.StatusOK,
+			"{\"slug\":\"test\",\"ttl\":\"48h\"}",
+		},
+		{
+			"/api/segment",
+			http.MethodPatch,
+			"application/json",
+			http.StatusOK,
+			"{\"slug\":\"test\",\"ttl\":\"\",\"expires_at\":\"\"}",
+		},
+		{
+			"/api/segment",
+			http.MethodPatch,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"slug\":\"test\"}",
+		},
+		{
+			"/api/segment",
+			http.MethodPatch,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"slug\":\"test\",\"expires_at\":\"tomorrow\"}",
+		},
+		{
+			"/api/segment",
+			http.MethodPatch,
+			"text/plain",
+			http.StatusBadRequest,
+			"{\"slug\":\"test\",\"ttl\":\"48h\"}",
+		},
+	}
+
+	for _, testCase := range testTable {
+		resp := request(t, ts, testCase.code, testCase.method, testCase.content, testCase.body, testCase.endpoint)
+		resp.Body.Close()
 	}
 }
 
@@ -264,6 +398,18 @@ func TestDeleteSegment(t *testing.T) {
 	}
 }
 
+func TestReadSegments(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	resp := request(t, ts, http.StatusInternalServerError, http.MethodGet, "", "", "/api/segment")
+	resp.Body.Close()
+
+	resp = request(t, ts, http.StatusOK, http.MethodGet, "", "", "/api/segment")
+	resp.Body.Close()
+}
+
 func TestUpdateUserSegments(t *testing.T) {
 	ts := httptest.NewServer(testRouter(t))
 
@@ -374,6 +520,281 @@ func TestReadUserSegments(t *testing.T) {
 	}
 }
 
+func TestReadDeletionTimes(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	var testTable = []struct {
+		endpoint string
+		method   string
+		content  string
+		code     int
+		body     string
+	}{
+		{
+			"/api/ttl?user_id=1",
+			http.MethodGet,
+			"",
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"/api/ttl?user_id=1",
+			http.MethodGet,
+			"",
+			http.StatusNoContent,
+			"",
+		},
+		{
+			"/api/ttl?slug=a",
+			http.MethodGet,
+			"",
+			http.StatusOK,
+			"",
+		},
+		{
+			"/api/ttl?user_id=1&slug=a",
+			http.MethodGet,
+			"",
+			http.StatusOK,
+			"",
+		},
+		{
+			"/api/ttl",
+			http.MethodGet,
+			"",
+			http.StatusBadRequest,
+			"",
+		},
+	}
+
+	for _, testCase := range testTable {
+		resp := request(t, ts, testCase.code, testCase.method, testCase.content, testCase.body, testCase.endpoint)
+		resp.Body.Close()
+	}
+}
+
+func TestUpdateDeletionTime(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	var testTable = []struct {
+		endpoint string
+		method   string
+		content  string
+		code     int
+		body     string
+	}{
+		{
+			"/api/ttl",
+			http.MethodPatch,
+			"application/json",
+			http.StatusNotFound,
+			"{\"user_id\":\"1\", \"slug\":\"a\", \"ttl\":\"2023-09-30T20:19:05+03:00\"}",
+		},
+		{
+			"/api/ttl",
+			http.MethodPatch,
+			"application/json",
+			http.StatusOK,
+			"{\"user_id\":\"1\", \"slug\":\"a\", \"ttl\":\"2023-09-30T20:19:05+03:00\"}",
+		},
+		{
+			"/api/ttl",
+			http.MethodPatch,
+			"text/plain",
+			http.StatusBadRequest,
+			"{\"user_id\":\"1\", \"slug\":\"a\", \"ttl\":\"2023-09-30T20:19:05+03:00\"}",
+		},
+		{
+			"/api/ttl",
+			http.MethodPatch,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"user_id\":\"1\", \"slug\":\"a\", \"ttl\":\"2023-09-30\"}",
+		},
+		{
+			"/api/ttl",
+			http.MethodPatch,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"user_id\":\"1\", \"ttl\":\"2023-09-30T20:19:05+03:00\"}",
+		},
+		{
+			"/api/ttl",
+			http.MethodPatch,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"user_id\":\"1\", \"slug\":\"a\", \"slug\":\"b\", \"ttl\":\"2023-09-30T20:19:05+03:00\"}",
+		},
+	}
+
+	for _, testCase := range testTable {
+		resp := request(t, ts, testCase.code, testCase.method, testCase.content, testCase.body, testCase.endpoint)
+		resp.Body.Close()
+	}
+}
+
+func TestDeleteDeletionTime(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	var testTable = []struct {
+		endpoint string
+		method   string
+		content  string
+		code     int
+		body     string
+	}{
+		{
+			"/api/ttl",
+			http.MethodDelete,
+			"application/json",
+			http.StatusNotFound,
+			"{\"user_id\":\"1\", \"slug\":\"a\"}",
+		},
+		{
+			"/api/ttl",
+			http.MethodDelete,
+			"application/json",
+			http.StatusOK,
+			"{\"user_id\":\"1\", \"slug\":\"a\"}",
+		},
+		{
+			"/api/ttl",
+			http.MethodDelete,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"user_id\":\"1\"}",
+		},
+		{
+			"/api/ttl",
+			http.MethodDelete,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"user_id\":\"1\", \"slug\":\"a\", \"ttl\":\"2023-09-30T20:19:05+03:00\"}",
+		},
+	}
+
+	for _, testCase := range testTable {
+		resp := request(t, ts, testCase.code, testCase.method, testCase.content, testCase.body, testCase.endpoint)
+		resp.Body.Close()
+	}
+}
+
+func TestScheduleUserSegments(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	var testTable = []struct {
+		endpoint string
+		method   string
+		content  string
+		code     int
+		body     string
+	}{
+		{
+			"/api/schedule",
+			http.MethodPost,
+			"application/json",
+			http.StatusNotFound,
+			"{\"user_id\":\"1\", \"slugs\":[\"a\"], \"starts_at\":\"2999-09-30T00:00:00+03:00\"}",
+		},
+		{
+			"/api/schedule",
+			http.MethodPost,
+			"application/json",
+			http.StatusAccepted,
+			"{\"user_id\":\"1\", \"slugs\":[\"a\"], \"starts_at\":\"2999-09-30T00:00:00+03:00\"}",
+		},
+		{
+			"/api/schedule",
+			http.MethodPost,
+			"application/json",
+			http.StatusAccepted,
+			"{\"user_id\":\"1\", \"slugs\":[\"a\", \"b\"], \"starts_at\":\"2999-09-30T00:00:00+03:00\", \"ends_at\":\"2999-10-02T00:00:00+03:00\"}",
+		},
+		{
+			"/api/schedule",
+			http.MethodPost,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"user_id\":\"1\", \"slugs\":[\"a\"], \"starts_at\":\"2999-09-30T00:00:00+03:00\", \"ends_at\":\"2999-09-29T00:00:00+03:00\"}",
+		},
+		{
+			"/api/schedule",
+			http.MethodPost,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"user_id\":\"1\", \"slugs\":[\"a\"]}",
+		},
+		{
+			"/api/schedule",
+			http.MethodPost,
+			"application/json",
+			http.StatusBadRequest,
+			"{\"user_id\":\"1\", \"slugs\":[], \"starts_at\":\"2999-09-30T00:00:00+03:00\"}",
+		},
+		{
+			"/api/schedule",
+			http.MethodPost,
+			"text/plain",
+			http.StatusBadRequest,
+			"{\"user_id\":\"1\", \"slugs\":[\"a\"], \"starts_at\":\"2999-09-30T00:00:00+03:00\"}",
+		},
+	}
+
+	for _, testCase := range testTable {
+		resp := request(t, ts, testCase.code, testCase.method, testCase.content, testCase.body, testCase.endpoint)
+		resp.Body.Close()
+	}
+}
+
+func TestReadScheduledAssignments(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	var testTable = []struct {
+		endpoint string
+		method   string
+		content  string
+		code     int
+		body     string
+	}{
+		{
+			"/api/schedule/1",
+			http.MethodGet,
+			"",
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"/api/schedule/1",
+			http.MethodGet,
+			"",
+			http.StatusNoContent,
+			"",
+		},
+		{
+			"/api/schedule/1",
+			http.MethodGet,
+			"",
+			http.StatusOK,
+			"",
+		},
+	}
+
+	for _, testCase := range testTable {
+		resp := request(t, ts, testCase.code, testCase.method, testCase.content, testCase.body, testCase.endpoint)
+		resp.Body.Close()
+	}
+}
+
 func TestCreateUserSegmentsHistoryReport(t *testing.T) {
 	ts := httptest.NewServer(testRouter(t))
 
@@ -471,14 +892,26 @@ func TestCreateUserSegmentsHistoryReport(t *testing.T) {
 			"",
 		},
 	}
-	logger.InitLogger()
-	log, _ := logger.GetLogger()
+	log := zaptest.NewLogger(t).Sugar()
 
 	for i, testCase := range testTable {
 		log.Infoln(i)
 		resp := request(t, ts, testCase.code, testCase.method, testCase.content, testCase.body, testCase.endpoint)
 		resp.Body.Close()
 	}
+
+	for endpoint, link := range map[string]string{
+		"/api/user-history/1":           "http:///api/reports/report1.csv",
+		"/api/ns/team-a/user-history/1": "http:///api/ns/team-a/reports/report1.csv",
+	} {
+		resp, err := ts.Client().Get(ts.URL + endpoint)
+		require.NoError(t, err)
+
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, link, string(b))
+	}
 }
 
 func TestReadUserSegmentsHistoryReport(t *testing.T) {
@@ -536,8 +969,7 @@ func TestReadUserSegmentsHistoryReport(t *testing.T) {
 			"",
 		},
 	}
-	logger.InitLogger()
-	log, _ := logger.GetLogger()
+	log := zaptest.NewLogger(t).Sugar()
 
 	for i, testCase := range testTable {
 		log.Infoln(i)
@@ -545,3 +977,103 @@ func TestReadUserSegmentsHistoryReport(t *testing.T) {
 		resp.Body.Close()
 	}
 }
+
+func TestIssueAPIKey(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	var testTable = []struct {
+		content string
+		code    int
+		body    string
+	}{
+		{"application/json", http.StatusInternalServerError, "{\"name\":\"billing\",\"scopes\":[\"users:read\"]}"},
+		{"application/json", http.StatusCreated, "{\"name\":\"billing\",\"scopes\":[\"users:read\",\"reports:read\"]}"},
+		{"text/plain", http.StatusBadRequest, "{\"name\":\"billing\",\"scopes\":[\"users:read\"]}"},
+		{"application/json", http.StatusBadRequest, "{\"name\":\"billing\",\"scopes\":[\"users:delete\"]}"},
+		{"application/json", http.StatusBadRequest, "{\"name\":\"\",\"scopes\":[\"users:read\"]}"},
+		{"application/json", http.StatusBadRequest, "{\"name\":\"billing\",\"scopes\":[]}"},
+		{"application/json", http.StatusBadRequest, "{\"name\":\"billing\",\"name\":\"billing\"}"},
+		{"application/json", http.StatusBadRequest, "{\"name\":\"billing\",\"scopes\":\"users:read\"}"},
+	}
+
+	for _, testCase := range testTable {
+		resp := request(t, ts, testCase.code, http.MethodPost, testCase.content, testCase.body, "/api/keys")
+		resp.Body.Close()
+	}
+}
+
+func TestReadAPIKeys(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	resp := request(t, ts, http.StatusInternalServerError, http.MethodGet, "", "", "/api/keys")
+	resp.Body.Close()
+
+	resp = request(t, ts, http.StatusOK, http.MethodGet, "", "", "/api/keys")
+	resp.Body.Close()
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	resp := request(t, ts, http.StatusNotFound, http.MethodDelete, "", "", "/api/keys/1")
+	resp.Body.Close()
+
+	resp = request(t, ts, http.StatusNoContent, http.MethodDelete, "", "", "/api/keys/1")
+	resp.Body.Close()
+}
+
+func TestReadSnapshot(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	var testTable = []struct {
+		content string
+		code    int
+		body    string
+	}{
+		{"application/json", http.StatusInternalServerError, "{\"user_ids\":[\"1\"]}"},
+		{"application/json", http.StatusOK, "{\"user_ids\":[\"1\",\"2\"]}"},
+		{"application/json", http.StatusOK, "{}"},
+		{"text/plain", http.StatusBadRequest, "{\"user_ids\":[\"1\"]}"},
+		{"application/json", http.StatusBadRequest, "{\"user_ids\":\"1\"}"},
+		{"application/json", http.StatusBadRequest, "{\"users\":[\"1\"]}"},
+		{"application/json", http.StatusBadRequest, "{\"user_ids\":[" + strings.Repeat("\"1\",", domain.MaxSnapshotUsers) + "\"1\"]}"},
+	}
+
+	for _, testCase := range testTable {
+		resp := request(t, ts, testCase.code, http.MethodPost, testCase.content, testCase.body, "/api/evaluation/snapshot")
+		resp.Body.Close()
+	}
+}
+
+func TestReadChanges(t *testing.T) {
+	ts := httptest.NewServer(testRouter(t))
+
+	defer ts.Close()
+
+	var testTable = []struct {
+		code     int
+		endpoint string
+	}{
+		{http.StatusGone, "/api/evaluation/changes?cursor=1.0"},
+		{http.StatusOK, "/api/evaluation/changes?cursor=10.5&limit=100"},
+		{http.StatusBadRequest, "/api/evaluation/changes"},
+		{http.StatusBadRequest, "/api/evaluation/changes?cursor=10"},
+		{http.StatusBadRequest, "/api/evaluation/changes?cursor=10.a"},
+		{http.StatusBadRequest, "/api/evaluation/changes?cursor=-1.0"},
+		{http.StatusBadRequest, "/api/evaluation/changes?cursor=10.5&limit=0"},
+		{http.StatusBadRequest, "/api/evaluation/changes?cursor=10.5&limit=1001"},
+	}
+
+	for _, testCase := range testTable {
+		resp := request(t, ts, testCase.code, http.MethodGet, "", "", testCase.endpoint)
+		resp.Body.Close()
+	}
+}
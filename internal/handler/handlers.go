@@ -5,6 +5,7 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -42,6 +43,24 @@ func NewSegment(srv domain.SegmentService) *segment {
 // @Tag.name Reports
 // @Tag.description Группа запросов для работы с отчетами по истории сегментов пользователя
 
+// @Tag.name Health
+// @Tag.description Группа запросов для проверки состояния сервиса
+
+// @Tag.name Keys
+// @Tag.description Группа запросов для управления API-ключами
+
+// @Tag.name Evaluation
+// @Tag.description Группа запросов для вычисления сегментов на стороне клиента
+
+// @securityDefinitions.apikey APIKey
+// @in header
+// @name X-API-Key
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description API-ключ или JWT в формате "Bearer <токен>"
+
 // @Schemes http
 
 // @Tags Segments
@@ -49,32 +68,38 @@ func NewSegment(srv domain.SegmentService) *segment {
 // @Description Запрос для создания сегмента по уникальному названию
 // @Accept json
 // @Param input body domain.Slug true "segment info"
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param Idempotency-Key header string false "key of the request, retries with the same key get the first response instead of being processed again"
 // @Success 200
 // @Success 202
-// @Failure 500
-// @Failure 400
-// @Failure 409
+// @Failure 500 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 413 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 422 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
 // @Router /api/segment [post]
 func (h *segment) CreateSegment(c echo.Context) error {
 	defer c.Request().Body.Close()
 
 	if !jsonmimechecker.IsJSONContentTypeCorrect(c.Request()) {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return nil
+		return problem(c, http.StatusBadRequest, appErrors.InvalidContentType())
 	}
 
 	bytesToCheck, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, readingStatus(err), err)
 	}
 
 	reader := bytes.NewReader(bytes.Clone(bytesToCheck))
 
 	err = jsonduplicatechecker.CheckDuplicatesInJSON(json.NewDecoder(reader), nil)
 	if err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
 	}
 
 	c.Request().Body = io.NopCloser(bytes.NewBuffer(bytesToCheck))
@@ -85,36 +110,48 @@ func (h *segment) CreateSegment(c echo.Context) error {
 	var slug domain.Slug
 
 	if err := d.Decode(&slug); err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
 	}
 
-	if slug.Slug == "" || slug.PercentOfUsers < 0 || slug.PercentOfUsers > 100 {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return nil
+	if slug.Slug == "" {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("slug"))
+	}
+
+	if slug.PercentOfUsers < 0 || slug.PercentOfUsers > 100 {
+		return problem(c, http.StatusBadRequest, appErrors.InvalidField("percent", nil))
+	}
+
+	var TTL, expiresAt *string
+	if slug.TTL != "" {
+		TTL = &slug.TTL
+	}
+
+	if slug.ExpiresAt != "" {
+		expiresAt = &slug.ExpiresAt
 	}
 
-	err = h.srv.CreateSegment(c.Request().Context(), slug.Slug)
+	options, err := parseSegmentOptions(TTL, expiresAt)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err)
+	}
+
+	err = h.srv.CreateSegment(c.Request().Context(), slug.Slug, options)
 	if err != nil {
 		if errors.Is(err, appErrors.ErrorNotASlug) {
-			c.Response().WriteHeader(http.StatusUnprocessableEntity)
-			return err
+			return problem(c, http.StatusUnprocessableEntity, err)
 		}
 
 		if errors.Is(err, appErrors.ErrorUniqueViolation) {
-			c.Response().WriteHeader(http.StatusConflict)
-			return err
+			return problem(c, http.StatusConflict, err)
 		}
 
-		c.Response().WriteHeader(http.StatusInternalServerError)
-		return err
+		return problem(c, http.StatusInternalServerError, err)
 	}
 
 	if slug.PercentOfUsers != 0 {
 		err = h.srv.AddSegmentToPercentOfUsers(c.Request().Context(), slug.Slug, slug.PercentOfUsers)
 		if err != nil && !errors.Is(err, appErrors.ErrorNoRows) {
-			c.Response().WriteHeader(http.StatusInternalServerError)
-			return err
+			return problem(c, http.StatusInternalServerError, err)
 		}
 	}
 
@@ -126,36 +163,159 @@ func (h *segment) CreateSegment(c echo.Context) error {
 	return nil
 }
 
+// @Tags Segments
+// @Summary Запрос для изменения настроек сегмента
+// @Description Запрос для изменения TTL по умолчанию и даты окончания сегмента. Не переданные поля не меняются, пустая строка удаляет настройку
+// @Accept json
+// @Param input body domain.SegmentUpdate true "segment settings"
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param Idempotency-Key header string false "key of the request, retries with the same key get the first response instead of being processed again"
+// @Success 200
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 413 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 422 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/segment [patch]
+func (h *segment) UpdateSegment(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	if !jsonmimechecker.IsJSONContentTypeCorrect(c.Request()) {
+		return problem(c, http.StatusBadRequest, appErrors.InvalidContentType())
+	}
+
+	bytesToCheck, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return problem(c, readingStatus(err), err)
+	}
+
+	reader := bytes.NewReader(bytes.Clone(bytesToCheck))
+
+	err = jsonduplicatechecker.CheckDuplicatesInJSON(json.NewDecoder(reader), nil)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	c.Request().Body = io.NopCloser(bytes.NewBuffer(bytesToCheck))
+
+	d := json.NewDecoder(c.Request().Body)
+	d.DisallowUnknownFields()
+
+	var segmentUpdate domain.SegmentUpdate
+
+	if err := d.Decode(&segmentUpdate); err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	if segmentUpdate.Slug == "" {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("slug"))
+	}
+
+	if segmentUpdate.TTL == nil && segmentUpdate.ExpiresAt == nil {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("ttl"))
+	}
+
+	options, err := parseSegmentOptions(segmentUpdate.TTL, segmentUpdate.ExpiresAt)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, err)
+	}
+
+	err = h.srv.UpdateSegment(c.Request().Context(), segmentUpdate.Slug, options)
+	if err != nil {
+		if errors.Is(err, appErrors.ErrorNoRows) {
+			return problem(c, http.StatusNotFound, err)
+		}
+
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	c.Response().WriteHeader(http.StatusOK)
+	return nil
+}
+
+// parseSegmentOptions parses the default TTL (a Go duration, e.g. 48h) and the segment expiration time (RFC3339).
+// An empty string results in a zero value, which removes the setting
+func parseSegmentOptions(TTL *string, expiresAt *string) (domain.SegmentOptions, error) {
+	var options domain.SegmentOptions
+
+	if TTL != nil {
+		var defaultTTL time.Duration
+		if *TTL != "" {
+			var err error
+			defaultTTL, err = time.ParseDuration(*TTL)
+			if err != nil {
+				return options, appErrors.InvalidField("ttl", err)
+			}
+
+			if defaultTTL <= 0 {
+				return options, appErrors.InvalidField("ttl", appErrors.ErrorNotPositiveTTL)
+			}
+		}
+		options.DefaultTTL = &defaultTTL
+	}
+
+	if expiresAt != nil {
+		var expirationTime time.Time
+		if *expiresAt != "" {
+			var err error
+			expirationTime, err = time.Parse(time.RFC3339, *expiresAt)
+			if err != nil {
+				return options, appErrors.InvalidField("expires_at", err)
+			}
+
+			if !expirationTime.After(time.Now()) {
+				return options, appErrors.InvalidField("expires_at", appErrors.ErrorExpirationInPast)
+			}
+		}
+		options.ExpiresAt = &expirationTime
+	}
+
+	return options, nil
+}
+
 // @Tags Segments
 // @Summary Запрос для удаления сегмента
 // @Description Запрос для удаления сегмента из списка существующих сегментов по уникальному названию
 // @Accept json
 // @Param input body domain.SlugNoPercent true "segment info"
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param Idempotency-Key header string false "key of the request, retries with the same key get the first response instead of being processed again"
 // @Success 202
-// @Failure 404
-// @Failure 500
-// @Failure 400
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 413 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 422 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
 // @Router /api/segment [delete]
 func (h *segment) DeleteSegment(c echo.Context) error {
 	defer c.Request().Body.Close()
 
 	if !jsonmimechecker.IsJSONContentTypeCorrect(c.Request()) {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return nil
+		return problem(c, http.StatusBadRequest, appErrors.InvalidContentType())
 	}
 
 	bytesToCheck, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, readingStatus(err), err)
 	}
 
 	reader := bytes.NewReader(bytes.Clone(bytesToCheck))
 
 	err = jsonduplicatechecker.CheckDuplicatesInJSON(json.NewDecoder(reader), nil)
 	if err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
 	}
 
 	c.Request().Body = io.NopCloser(bytes.NewBuffer(bytesToCheck))
@@ -166,36 +326,57 @@ func (h *segment) DeleteSegment(c echo.Context) error {
 	var slug domain.SlugNoPercent
 
 	if err := d.Decode(&slug); err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
 	}
 
 	if slug.Slug == "" {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return nil
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("slug"))
 	}
 
 	err = h.srv.DeleteSegment(c.Request().Context(), slug.Slug)
 	if err != nil {
 		if errors.Is(err, appErrors.ErrorNoRows) {
-			c.Response().WriteHeader(http.StatusNotFound)
-			return err
+			return problem(c, http.StatusNotFound, err)
 		}
 
-		c.Response().WriteHeader(http.StatusInternalServerError)
-		return err
+		return problem(c, http.StatusInternalServerError, err)
 	}
 
 	c.Response().WriteHeader(http.StatusAccepted)
 	return nil
 }
 
+// @Tags Segments
+// @Summary Запрос списка сегментов
+// @Description Запрос для получения всех сегментов пространства имен с их настройками
+// @Produce json
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param X-Read-Consistency header string false "strong reads from the primary database, so the response includes the writes made just before" Enums(eventual, strong)
+// @Success 200 {array} domain.Segment
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/segment [get]
+func (h *segment) ReadSegments(c echo.Context) error {
+	segments, err := h.srv.ReadSegments(c.Request().Context())
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, segments)
+}
+
 type user struct {
-	srv domain.UserService
+	srv         domain.UserService
+	gzipMinSize int
 }
 
-func NewUser(srv domain.UserService) *user {
-	return &user{srv: srv}
+// NewUser compresses responses with segments of a user larger than gzipMinSize bytes for clients accepting gzip
+func NewUser(srv domain.UserService, gzipMinSize int) *user {
+	return &user{srv: srv, gzipMinSize: gzipMinSize}
 }
 
 // @Tags Users
@@ -203,31 +384,38 @@ func NewUser(srv domain.UserService) *user {
 // @Description Запрос для обновления списка сегментов пользователя
 // @Accept json
 // @Param input body domain.UserUpdate true "user segment info"
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param Idempotency-Key header string false "key of the request, retries with the same key get the first response instead of being processed again"
 // @Success 200
-// @Failure 404
-// @Failure 500
-// @Failure 400
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 413 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 422 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
 // @Router /api/user [post]
 func (h *user) UpdateUserSegments(c echo.Context) error {
 	defer c.Request().Body.Close()
 
 	if !jsonmimechecker.IsJSONContentTypeCorrect(c.Request()) {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return nil
+		return problem(c, http.StatusBadRequest, appErrors.InvalidContentType())
 	}
 
 	bytesToCheck, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, readingStatus(err), err)
 	}
 
 	reader := bytes.NewReader(bytes.Clone(bytesToCheck))
 
 	err = jsonduplicatechecker.CheckDuplicatesInJSON(json.NewDecoder(reader), nil)
 	if err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
 	}
 
 	c.Request().Body = io.NopCloser(bytes.NewBuffer(bytesToCheck))
@@ -238,26 +426,22 @@ func (h *user) UpdateUserSegments(c echo.Context) error {
 	var userUpdate domain.UserUpdate
 
 	if err := d.Decode(&userUpdate); err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
 	}
 
 	if userUpdate.UserID == "" {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return nil
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("user_id"))
 	}
 
 	if len(userUpdate.SlugsToAdd) != len(userUpdate.TTL) && len(userUpdate.TTL) != 0 {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return nil
+		return problem(c, http.StatusBadRequest, appErrors.InvalidField("ttl", errors.New("amount of TTLs should match amount of segments to add")))
 	}
 
 	var TTLs []time.Time
-	for _, TTL := range userUpdate.TTL {
+	for i, TTL := range userUpdate.TTL {
 		oneOfTTLs, err := time.Parse(time.RFC3339, TTL)
 		if err != nil {
-			c.Response().WriteHeader(http.StatusBadRequest)
-			return err
+			return problem(c, http.StatusBadRequest, appErrors.InvalidField(fmt.Sprintf("ttl.%d", i), err))
 		}
 		TTLs = append(TTLs, oneOfTTLs)
 	}
@@ -265,19 +449,16 @@ func (h *user) UpdateUserSegments(c echo.Context) error {
 	err = h.srv.UpdateUserSegments(c.Request().Context(), userUpdate.UserID, userUpdate.SlugsToAdd, userUpdate.SlugsToDelete)
 	if err != nil {
 		if errors.Is(err, appErrors.ErrorNoRows) {
-			c.Response().WriteHeader(http.StatusNotFound)
-			return err
+			return problem(c, http.StatusNotFound, err)
 		}
 
-		c.Response().WriteHeader(http.StatusInternalServerError)
-		return err
+		return problem(c, http.StatusInternalServerError, err)
 	}
 
 	for i, TTL := range TTLs {
 		err = h.srv.CreateDeletionTime(c.Request().Context(), userUpdate.UserID, userUpdate.SlugsToAdd[i], TTL)
 		if err != nil {
-			c.Response().WriteHeader(http.StatusInternalServerError)
-			return err
+			return problem(c, http.StatusInternalServerError, err)
 		}
 	}
 
@@ -290,10 +471,17 @@ func (h *user) UpdateUserSegments(c echo.Context) error {
 // @Description Запрос для получения списка сегментов пользователя
 // @Produce json
 // @Param id path string true "user id" Example(1)
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param X-Read-Consistency header string false "strong reads from the primary database, so the response includes the writes made just before" Enums(eventual, strong)
 // @Success 200
 // @Success 204
-// @Failure 404
-// @Failure 500
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
 // @Router /api/user/{id} [get]
 func (h *user) ReadUserSegments(c echo.Context) error {
 	defer c.Request().Body.Close()
@@ -303,12 +491,10 @@ func (h *user) ReadUserSegments(c echo.Context) error {
 	slugs, err := h.srv.ReadUserSegments(c.Request().Context(), userID)
 	if err != nil {
 		if errors.Is(err, appErrors.ErrorNoRows) {
-			c.Response().WriteHeader(http.StatusNotFound)
-			return err
+			return problem(c, http.StatusNotFound, err)
 		}
 
-		c.Response().WriteHeader(http.StatusInternalServerError)
-		return err
+		return problem(c, http.StatusInternalServerError, err)
 	}
 
 	if len(slugs) == 0 {
@@ -320,12 +506,11 @@ func (h *user) ReadUserSegments(c echo.Context) error {
 	buf := bytes.NewBuffer(slugsBytes)
 	err = json.NewEncoder(buf).Encode(slugs)
 	if err != nil {
-		c.Response().WriteHeader(http.StatusInternalServerError)
-		return err
+		return problem(c, http.StatusInternalServerError, err)
 	}
 	c.Response().Header().Set("Content-Type", "application/json")
 
-	if len(buf.Bytes()) > 1024 {
+	if len(buf.Bytes()) > h.gzipMinSize {
 		acceptsEncoding := c.Request().Header.Values("Accept-Encoding")
 		for _, encoding := range acceptsEncoding {
 			if strings.Contains(encoding, "gzip") {
@@ -344,14 +529,330 @@ func (h *user) ReadUserSegments(c echo.Context) error {
 
 	_, err = c.Response().Write(buf.Bytes())
 	if err != nil {
-		c.Response().WriteHeader(http.StatusInternalServerError)
-		return err
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	c.Response().WriteHeader(http.StatusOK)
+	return nil
+}
+
+// @Tags Users
+// @Summary Запрос чтения TTL сегментов
+// @Description Запрос для получения списка запланированных удалений пользователя из сегментов. Нужно указать id пользователя, сегмент или оба параметра
+// @Produce json
+// @Param user_id query string false "user id" Example(1)
+// @Param slug query string false "segment name" Example(SEGMENT_NAME)
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param X-Read-Consistency header string false "strong reads from the primary database, so the response includes the writes made just before" Enums(eventual, strong)
+// @Success 200 {array} domain.DeletionTime
+// @Success 204
+// @Failure 400 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/ttl [get]
+func (h *user) ReadDeletionTimes(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	userID := c.QueryParam("user_id")
+	slug := c.QueryParam("slug")
+
+	if userID == "" && slug == "" {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("user_id"))
+	}
+
+	deletionTimes, err := h.srv.ReadDeletionTimes(c.Request().Context(), userID, slug)
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	if len(deletionTimes) == 0 {
+		c.Response().WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	c.Response().Header().Set("Content-Type", "application/json")
+	c.Response().WriteHeader(http.StatusOK)
+
+	return json.NewEncoder(c.Response()).Encode(deletionTimes)
+}
+
+// @Tags Users
+// @Summary Запрос изменения TTL сегмента пользователя
+// @Description Запрос для продления или сокращения времени нахождения пользователя в сегменте. Если TTL еще не был задан, он будет создан
+// @Accept json
+// @Param input body domain.TTLUpdate true "ttl info"
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param Idempotency-Key header string false "key of the request, retries with the same key get the first response instead of being processed again"
+// @Success 200
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 413 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 422 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/ttl [patch]
+func (h *user) UpdateDeletionTime(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	if !jsonmimechecker.IsJSONContentTypeCorrect(c.Request()) {
+		return problem(c, http.StatusBadRequest, appErrors.InvalidContentType())
+	}
+
+	bytesToCheck, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return problem(c, readingStatus(err), err)
+	}
+
+	reader := bytes.NewReader(bytes.Clone(bytesToCheck))
+
+	err = jsonduplicatechecker.CheckDuplicatesInJSON(json.NewDecoder(reader), nil)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	c.Request().Body = io.NopCloser(bytes.NewBuffer(bytesToCheck))
+
+	d := json.NewDecoder(c.Request().Body)
+	d.DisallowUnknownFields()
+
+	var ttlUpdate domain.TTLUpdate
+
+	if err := d.Decode(&ttlUpdate); err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	if ttlUpdate.UserID == "" {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("user_id"))
+	}
+
+	if ttlUpdate.Slug == "" {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("slug"))
+	}
+
+	TTL, err := time.Parse(time.RFC3339, ttlUpdate.TTL)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, appErrors.InvalidField("ttl", err))
+	}
+
+	err = h.srv.UpdateDeletionTime(c.Request().Context(), ttlUpdate.UserID, ttlUpdate.Slug, TTL)
+	if err != nil {
+		if errors.Is(err, appErrors.ErrorNoRows) {
+			return problem(c, http.StatusNotFound, err)
+		}
+
+		return problem(c, http.StatusInternalServerError, err)
 	}
 
 	c.Response().WriteHeader(http.StatusOK)
 	return nil
 }
 
+// @Tags Users
+// @Summary Запрос удаления TTL сегмента пользователя
+// @Description Запрос для отмены запланированного удаления пользователя из сегмента, после чего пользователь остается в сегменте бессрочно
+// @Accept json
+// @Param input body domain.TTLRemoval true "ttl info"
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param Idempotency-Key header string false "key of the request, retries with the same key get the first response instead of being processed again"
+// @Success 200
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 413 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 422 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/ttl [delete]
+func (h *user) DeleteDeletionTime(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	if !jsonmimechecker.IsJSONContentTypeCorrect(c.Request()) {
+		return problem(c, http.StatusBadRequest, appErrors.InvalidContentType())
+	}
+
+	bytesToCheck, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return problem(c, readingStatus(err), err)
+	}
+
+	reader := bytes.NewReader(bytes.Clone(bytesToCheck))
+
+	err = jsonduplicatechecker.CheckDuplicatesInJSON(json.NewDecoder(reader), nil)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	c.Request().Body = io.NopCloser(bytes.NewBuffer(bytesToCheck))
+
+	d := json.NewDecoder(c.Request().Body)
+	d.DisallowUnknownFields()
+
+	var ttlRemoval domain.TTLRemoval
+
+	if err := d.Decode(&ttlRemoval); err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	if ttlRemoval.UserID == "" {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("user_id"))
+	}
+
+	if ttlRemoval.Slug == "" {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("slug"))
+	}
+
+	err = h.srv.DeleteDeletionTime(c.Request().Context(), ttlRemoval.UserID, ttlRemoval.Slug)
+	if err != nil {
+		if errors.Is(err, appErrors.ErrorNoRows) {
+			return problem(c, http.StatusNotFound, err)
+		}
+
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	c.Response().WriteHeader(http.StatusOK)
+	return nil
+}
+
+// @Tags Users
+// @Summary Запрос планирования добавления пользователя в сегменты
+// @Description Запрос для добавления пользователя в сегменты в заданный момент времени. Если указан ends_at, пользователь будет удален из сегментов в это время
+// @Accept json
+// @Param input body domain.ScheduleUpdate true "schedule info"
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param Idempotency-Key header string false "key of the request, retries with the same key get the first response instead of being processed again"
+// @Success 202
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 413 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Failure 409 {object} domain.Problem
+// @Failure 422 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/schedule [post]
+func (h *user) ScheduleUserSegments(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	if !jsonmimechecker.IsJSONContentTypeCorrect(c.Request()) {
+		return problem(c, http.StatusBadRequest, appErrors.InvalidContentType())
+	}
+
+	bytesToCheck, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return problem(c, readingStatus(err), err)
+	}
+
+	reader := bytes.NewReader(bytes.Clone(bytesToCheck))
+
+	err = jsonduplicatechecker.CheckDuplicatesInJSON(json.NewDecoder(reader), nil)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	c.Request().Body = io.NopCloser(bytes.NewBuffer(bytesToCheck))
+
+	d := json.NewDecoder(c.Request().Body)
+	d.DisallowUnknownFields()
+
+	var scheduleUpdate domain.ScheduleUpdate
+
+	if err := d.Decode(&scheduleUpdate); err != nil {
+		return problem(c, http.StatusBadRequest, decodingProblem(err))
+	}
+
+	if scheduleUpdate.UserID == "" {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("user_id"))
+	}
+
+	if len(scheduleUpdate.Slugs) == 0 {
+		return problem(c, http.StatusBadRequest, appErrors.MissingField("slugs"))
+	}
+
+	startsAt, err := time.Parse(time.RFC3339, scheduleUpdate.StartsAt)
+	if err != nil {
+		return problem(c, http.StatusBadRequest, appErrors.InvalidField("starts_at", err))
+	}
+
+	var endsAt *time.Time
+	if scheduleUpdate.EndsAt != "" {
+		endTime, err := time.Parse(time.RFC3339, scheduleUpdate.EndsAt)
+		if err != nil {
+			return problem(c, http.StatusBadRequest, appErrors.InvalidField("ends_at", err))
+		}
+
+		if !endTime.After(startsAt) || !endTime.After(time.Now()) {
+			return problem(c, http.StatusBadRequest, appErrors.InvalidField("ends_at", errors.New("end time should be after the start time and in the future")))
+		}
+		endsAt = &endTime
+	}
+
+	err = h.srv.ScheduleUserSegments(c.Request().Context(), scheduleUpdate.UserID, scheduleUpdate.Slugs, startsAt, endsAt)
+	if err != nil {
+		if errors.Is(err, appErrors.ErrorNoRows) {
+			return problem(c, http.StatusNotFound, err)
+		}
+
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	c.Response().WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// @Tags Users
+// @Summary Запрос чтения запланированных добавлений пользователя в сегменты
+// @Description Запрос для получения списка еще не активированных добавлений пользователя в сегменты
+// @Produce json
+// @Param id path string true "user id" Example(1)
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param X-Read-Consistency header string false "strong reads from the primary database, so the response includes the writes made just before" Enums(eventual, strong)
+// @Success 200 {array} domain.ScheduledAssignment
+// @Success 204
+// @Failure 500 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
+// @Router /api/schedule/{id} [get]
+func (h *user) ReadScheduledAssignments(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	userID := c.Param("user")
+
+	assignments, err := h.srv.ReadScheduledAssignments(c.Request().Context(), userID)
+	if err != nil {
+		return problem(c, http.StatusInternalServerError, err)
+	}
+
+	if len(assignments) == 0 {
+		c.Response().WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	c.Response().Header().Set("Content-Type", "application/json")
+	c.Response().WriteHeader(http.StatusOK)
+
+	return json.NewEncoder(c.Response()).Encode(assignments)
+}
+
 type report struct {
 	srv domain.ReportService
 }
@@ -368,10 +869,17 @@ func NewReport(srv domain.ReportService) *report {
 // @Param start query string false "start date" Example(2023-9)
 // @Param end query string false "end date" Example(2023-9)
 // @Param exact query string false "exact date" Example(2023-9)
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
+// @Param X-Read-Consistency header string false "strong reads from the primary database, so the response includes the writes made just before" Enums(eventual, strong)
 // @Success 200
-// @Failure 404
-// @Failure 400
-// @Failure 500
+// @Failure 404 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
 // @Router /api/user-history/{id} [get]
 func (h *report) CreateUserSegmentsHistoryReport(c echo.Context) error {
 	defer c.Request().Body.Close()
@@ -397,8 +905,7 @@ func (h *report) CreateUserSegmentsHistoryReport(c echo.Context) error {
 
 	startDate, err := time.Parse("2006-1", startDateStr)
 	if err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, http.StatusBadRequest, appErrors.InvalidField("start", err))
 	}
 
 	endDateBuf, err := time.Parse("2006-1", endDateStr)
@@ -406,8 +913,7 @@ func (h *report) CreateUserSegmentsHistoryReport(c echo.Context) error {
 		wasEndDateProvided = false
 		endDateBuf = time.Now()
 	} else if err != nil {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return err
+		return problem(c, http.StatusBadRequest, appErrors.InvalidField("end", err))
 	}
 
 	endDateBuf = endDateBuf.AddDate(0, 1, 0)
@@ -416,26 +922,22 @@ func (h *report) CreateUserSegmentsHistoryReport(c echo.Context) error {
 	endDate := endDateBuf
 
 	if (wasStartDateProvided || wasEndDateProvided) && wasExactDateProvided {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return nil
+		return problem(c, http.StatusBadRequest, appErrors.InvalidField("exact", errors.New("exact date can't be used with start or end date")))
 	}
 
 	if endDate.UnixNano() < startDate.UnixNano() {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return nil
+		return problem(c, http.StatusBadRequest, appErrors.InvalidField("end", errors.New("end date should not be before the start date")))
 	}
 
 	if wasExactDateProvided {
 		startDate, err = time.Parse("2006-1", exactDateStr)
 		if err != nil {
-			c.Response().WriteHeader(http.StatusBadRequest)
-			return err
+			return problem(c, http.StatusBadRequest, appErrors.InvalidField("exact", err))
 		}
 
 		endDate, err = time.Parse("2006-1", exactDateStr)
 		if err != nil {
-			c.Response().WriteHeader(http.StatusBadRequest)
-			return err
+			return problem(c, http.StatusBadRequest, appErrors.InvalidField("exact", err))
 		}
 
 		endDate = endDate.AddDate(0, 1, 0)
@@ -444,23 +946,19 @@ func (h *report) CreateUserSegmentsHistoryReport(c echo.Context) error {
 
 	oldDate, err := time.Parse("2006-1", "1970-02")
 	if err != nil {
-		c.Response().WriteHeader(http.StatusInternalServerError)
-		return err
+		return problem(c, http.StatusInternalServerError, err)
 	}
 
 	if endDate.UnixNano() < oldDate.UnixNano() || startDate.UnixNano() < oldDate.UnixNano() {
-		c.Response().WriteHeader(http.StatusBadRequest)
-		return nil
+		return problem(c, http.StatusBadRequest, appErrors.InvalidField("start", errors.New("dates before 1970-02 are not supported")))
 	}
 
 	filename, err := h.srv.CreateCSV(c.Request().Context(), userID, startDate, endDate)
 	if err != nil {
 		if errors.Is(err, appErrors.ErrorNoRows) {
-			c.Response().WriteHeader(http.StatusNotFound)
-			return err
+			return problem(c, http.StatusNotFound, err)
 		}
-		c.Response().WriteHeader(http.StatusInternalServerError)
-		return err
+		return problem(c, http.StatusInternalServerError, err)
 	}
 
 	addr := strings.TrimPrefix(c.Request().Context().Value(domain.Key("server")).(string), "http://")
@@ -471,7 +969,12 @@ func (h *report) CreateUserSegmentsHistoryReport(c echo.Context) error {
 
 	addr = "http://" + addr
 
-	c.Response().Write([]byte(addr + "/api/" + strings.Replace(filename, "\\", "/", -1)))
+	link := "/api/reports/" + filename
+	if namespace := domain.NamespaceFromContext(c.Request().Context()); namespace != domain.DefaultNamespace {
+		link = "/api/ns/" + namespace + "/reports/" + filename
+	}
+
+	c.Response().Write([]byte(addr + link))
 	return nil
 }
 
@@ -480,11 +983,17 @@ func (h *report) CreateUserSegmentsHistoryReport(c echo.Context) error {
 // @Description Запрос для получения отчета по истории сегментов пользователя в формате csv
 // @Produce text/csv
 // @Param filename path string true "report filename" Example(report12345.csv)
+// @Param X-Namespace header string false "namespace, the default one is used when not set"
 // @Success 200
 // @Success 204
-// @Failure 404
-// @Failure 500
-// @Failure 400
+// @Failure 404 {object} domain.Problem
+// @Failure 500 {object} domain.Problem
+// @Failure 400 {object} domain.Problem
+// @Failure 401 {object} domain.Problem
+// @Failure 403 {object} domain.Problem
+// @Failure 429 {object} domain.Problem
+// @Security APIKey
+// @Security BearerAuth
 // @Router /api/reports/{filename} [get]
 func (h *report) ReadUserSegmentsHistoryReport(c echo.Context) error {
 	defer c.Request().Body.Close()
@@ -494,11 +1003,10 @@ func (h *report) ReadUserSegmentsHistoryReport(c echo.Context) error {
 	c.Response().Header().Set("Content-Type", "text/csv")
 	c.Response().Header().Set("Content-Disposition", "attachment; filename="+reportName)
 
-	err := h.srv.SendCSVReportFile(reportName, c.Response())
+	err := h.srv.SendCSVReportFile(c.Request().Context(), reportName, c.Response())
 	if err != nil {
 		if errors.Is(err, appErrors.ErrorFileNotFound) {
-			c.Response().WriteHeader(http.StatusNotFound)
-			return err
+			return problem(c, http.StatusNotFound, err)
 		}
 
 		if errors.Is(err, appErrors.ErrorEmptyFile) {
@@ -507,11 +1015,10 @@ func (h *report) ReadUserSegmentsHistoryReport(c echo.Context) error {
 		}
 
 		if errors.Is(err, appErrors.ErrorBadFilename) {
-			c.Response().WriteHeader(http.StatusBadRequest)
-			return err
+			return problem(c, http.StatusBadRequest, err)
 		}
 
-		c.Response().WriteHeader(http.StatusInternalServerError)
+		return problem(c, http.StatusInternalServerError, err)
 	}
 	return nil
 }
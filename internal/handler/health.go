@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+const healthCheckTimeout = 3 * time.Second
+
+type health struct {
+	checks       []domain.HealthCheck
+	shuttingDown atomic.Bool
+}
+
+func NewHealth(checks ...domain.HealthCheck) *health {
+	return &health{checks: checks}
+}
+
+// SetShuttingDown makes readiness checks fail, so the instance is taken out of load balancing before it stops
+func (h *health) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// @Tags Health
+// @Summary Проверка живости сервиса
+// @Description Запрос для проверки того, что процесс сервиса запущен и обрабатывает запросы
+// @Produce json
+// @Success 200 {object} domain.HealthStatus
+// @Router /healthz [get]
+func (h *health) Liveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, domain.HealthStatus{Status: "ok"})
+}
+
+// @Tags Health
+// @Summary Проверка готовности сервиса
+// @Description Запрос для проверки готовности сервиса принимать трафик: доступности БД, версии схемы БД, возможности записи отчетов и работы планировщика
+// @Produce json
+// @Success 200 {object} domain.HealthStatus
+// @Failure 503 {object} domain.HealthStatus
+// @Router /readyz [get]
+func (h *health) Readiness(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), healthCheckTimeout)
+	defer cancel()
+
+	status := domain.HealthStatus{
+		Status: "ready",
+		Checks: make(map[string]domain.CheckResult, len(h.checks)+1),
+	}
+
+	if h.shuttingDown.Load() {
+		status.Status = "not ready"
+		status.Checks["shutdown"] = domain.CheckResult{Status: "error", Error: appErrors.ErrorShuttingDown.Error()}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check domain.HealthCheck) {
+			defer wg.Done()
+
+			result := domain.CheckResult{Status: "ok"}
+			if err := check.Check(ctx); err != nil {
+				result = domain.CheckResult{Status: "error", Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			status.Checks[check.Name] = result
+			if result.Status != "ok" {
+				status.Status = "not ready"
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	if status.Status != "ready" {
+		return c.JSON(http.StatusServiceUnavailable, status)
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+func TestHealth(t *testing.T) {
+	failing := false
+
+	healthHan := NewHealth(
+		domain.HealthCheck{Name: "postgres", Check: func(ctx context.Context) error {
+			return nil
+		}},
+		domain.HealthCheck{Name: "scheduler", Check: func(ctx context.Context) error {
+			if failing {
+				return appErrors.ErrorSchedulerStale
+			}
+			return nil
+		}},
+	)
+
+	e := echo.New()
+	e.GET("/healthz", healthHan.Liveness)
+	e.GET("/readyz", healthHan.Readiness)
+
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	readiness := func(code int) domain.HealthStatus {
+		resp, err := ts.Client().Get(ts.URL + "/readyz")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, code, resp.StatusCode)
+
+		var status domain.HealthStatus
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		return status
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	status := readiness(http.StatusOK)
+	require.Equal(t, "ready", status.Status)
+	require.Equal(t, "ok", status.Checks["postgres"].Status)
+	require.Equal(t, "ok", status.Checks["scheduler"].Status)
+
+	failing = true
+	status = readiness(http.StatusServiceUnavailable)
+	require.Equal(t, "not ready", status.Status)
+	require.Equal(t, "error", status.Checks["scheduler"].Status)
+	require.Equal(t, appErrors.ErrorSchedulerStale.Error(), status.Checks["scheduler"].Error)
+
+	failing = false
+	healthHan.SetShuttingDown()
+	status = readiness(http.StatusServiceUnavailable)
+	require.Equal(t, "error", status.Checks["shutdown"].Status)
+
+	resp, err = ts.Client().Get(ts.URL + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestReadConfigVersion(t *testing.T) {
+	version := domain.ConfigVersion{Version: 2, Checksum: "abc", Reloads: 1, PendingRestart: []string{"db_max_conns"}}
+	cfgHan := NewConfigVersion(func() domain.ConfigVersion {
+		return version
+	})
+
+	e := echo.New()
+	e.GET("/api/admin/config", cfgHan.ReadConfigVersion)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/config", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"version":2,"checksum":"abc","loaded_at":"0001-01-01T00:00:00Z","reloads":1,"failed_reloads":0,"pending_restart":["db_max_conns"]}`, rec.Body.String())
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+
+	problemTypePrefix = "urn:user-segmenter:problem:"
+)
+
+// problem writes err as problem details and returns it, so it still reaches the access log.
+// Details of internal errors are not sent to clients
+func problem(c echo.Context, status int, err error) error {
+	if c.Response().Committed {
+		return err
+	}
+
+	if err == nil {
+		err = errors.New(strings.ToLower(http.StatusText(status)))
+	}
+
+	p := domain.Problem{
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: c.Request().URL.Path,
+		Code:     appErrors.CodeInternal,
+	}
+
+	if status < http.StatusInternalServerError {
+		p.Code = appErrors.CodeOf(err)
+		if p.Code == appErrors.CodeInternal {
+			p.Code = codeFromStatus(status)
+		}
+		p.Detail = err.Error()
+
+		var typed *appErrors.Error
+		if errors.As(err, &typed) {
+			p.Slug = typed.Slug
+			p.Field = typed.Field
+		}
+	}
+
+	p.Type = problemTypePrefix + p.Code
+
+	c.Response().Header().Del("Content-Disposition")
+	c.Response().Header().Set(echo.HeaderContentType, ProblemContentType)
+	c.Response().WriteHeader(status)
+
+	if encodeErr := json.NewEncoder(c.Response()).Encode(p); encodeErr != nil {
+		return errors.Join(err, encodeErr)
+	}
+
+	return err
+}
+
+// decodingProblem turns an error of decoding a request body to a client error with a code
+func decodingProblem(err error) error {
+	var typed *appErrors.Error
+	if errors.As(err, &typed) {
+		return err
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return appErrors.InvalidField(typeErr.Field, err)
+	}
+
+	// encoding/json has no typed error for unknown fields
+	if field, found := strings.CutPrefix(err.Error(), "json: unknown field "); found {
+		return appErrors.UnknownField(strings.Trim(field, "\""))
+	}
+
+	return appErrors.InvalidJSON(err)
+}
+
+// readingStatus returns the status for an error of reading a request body, which is either too large or broken
+func readingStatus(err error) int {
+	if errors.Is(err, appErrors.ErrorBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadRequest
+}
+
+// ErrorHandler sends errors which were not handled by handlers, e.g. unknown routes, as problem details
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		status = httpErr.Code
+		if httpErr.Internal != nil {
+			// middlewares set typed errors as internal ones to keep their codes
+			err = httpErr.Internal
+		} else if message, ok := httpErr.Message.(string); ok {
+			err = errors.New(strings.ToLower(message))
+		}
+	}
+
+	if c.Request().Method == http.MethodHead {
+		_ = c.NoContent(status)
+		return
+	}
+
+	_ = problem(c, status, err)
+}
+
+func codeFromStatus(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
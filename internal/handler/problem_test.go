@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/domain/mocks"
+	"github.com/PoorMercymain/user-segmenter/internal/middleware"
+	"github.com/PoorMercymain/user-segmenter/internal/service"
+)
+
+func TestProblemDetails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSegRepo := mocks.NewMockSegmentRepository(ctrl)
+	mockUsrRepo := mocks.NewMockUserRepository(ctrl)
+
+	mockSegRepo.EXPECT().DeleteSegment(gomock.Any(), "AVITO_TEST").Return(appErrors.SegmentNotFound("AVITO_TEST"))
+	mockSegRepo.EXPECT().DeleteSegment(gomock.Any(), "AVITO_FAIL").Return(context.DeadlineExceeded)
+	mockUsrRepo.EXPECT().DeleteDeletionTime(gomock.Any(), "1", "AVITO_TEST").Return(appErrors.TTLNotFound("AVITO_TEST"))
+
+	e := echo.New()
+	e.HTTPErrorHandler = ErrorHandler
+
+	segHan := NewSegment(service.NewSegment(mockSegRepo))
+	usrHan := NewUser(service.NewUser(mockUsrRepo), 1024)
+
+	e.POST("/api/segment", segHan.CreateSegment)
+	e.DELETE("/api/segment", segHan.DeleteSegment)
+	e.DELETE("/api/ttl", usrHan.DeleteDeletionTime)
+	e.PATCH("/api/ttl", usrHan.UpdateDeletionTime, middleware.UseGzipReader(0))
+	e.GET("/api/keys", func(c echo.Context) error { return nil }, middleware.RequireScope(domain.ScopeKeysAdmin))
+	e.GET("/api/user/:user", func(c echo.Context) error { return nil }, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetRequest(c.Request().WithContext(domain.ContextWithClient(c.Request().Context(), domain.Client{ID: "api_key:1"})))
+			return next(c)
+		}
+	}, middleware.RequireScope(domain.ScopeUsersRead))
+
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	var testTable = []struct {
+		method string
+		path   string
+		body   string
+		want   domain.Problem
+	}{
+		{
+			http.MethodDelete, "/api/segment", "{\"slug\":\"AVITO_TEST\"}",
+			domain.Problem{Status: http.StatusNotFound, Code: appErrors.CodeSegmentNotFound, Slug: "AVITO_TEST"},
+		},
+		{
+			http.MethodDelete, "/api/ttl", "{\"user_id\":\"1\",\"slug\":\"AVITO_TEST\"}",
+			domain.Problem{Status: http.StatusNotFound, Code: appErrors.CodeTTLNotFound, Slug: "AVITO_TEST"},
+		},
+		{
+			http.MethodDelete, "/api/segment", "{\"slug\":\"AVITO_FAIL\"}",
+			domain.Problem{Status: http.StatusInternalServerError, Code: appErrors.CodeInternal},
+		},
+		{
+			http.MethodDelete, "/api/ttl", "{\"user_id\":\"1\"}",
+			domain.Problem{Status: http.StatusBadRequest, Code: appErrors.CodeMissingField, Field: "slug"},
+		},
+		{
+			http.MethodPost, "/api/segment", "{\"slug\":\"test\",\"percent\":\"10\"}",
+			domain.Problem{Status: http.StatusBadRequest, Code: appErrors.CodeInvalidField, Field: "percent"},
+		},
+		{
+			http.MethodPost, "/api/segment", "{\"slug\":\"test\",\"ttl\":\"-1h\"}",
+			domain.Problem{Status: http.StatusBadRequest, Code: appErrors.CodeInvalidField, Field: "ttl"},
+		},
+		{
+			http.MethodPost, "/api/segment", "{\"slug\":\"test\",\"test\":\"testing\"}",
+			domain.Problem{Status: http.StatusBadRequest, Code: appErrors.CodeUnknownField, Field: "test"},
+		},
+		{
+			http.MethodPost, "/api/segment", "{\"slug\":\"test\",\"slug\":\"test1\"}",
+			domain.Problem{Status: http.StatusBadRequest, Code: appErrors.CodeDuplicateJSONKey, Field: "slug"},
+		},
+		{
+			http.MethodPost, "/api/segment", "{\"slug\":",
+			domain.Problem{Status: http.StatusBadRequest, Code: appErrors.CodeInvalidJSON},
+		},
+		{
+			http.MethodGet, "/api/keys", "",
+			domain.Problem{Status: http.StatusUnauthorized, Code: appErrors.CodeUnauthenticated},
+		},
+		{
+			http.MethodGet, "/api/user/1", "",
+			domain.Problem{Status: http.StatusForbidden, Code: appErrors.CodeInsufficientScope, Field: domain.ScopeUsersRead},
+		},
+		{
+			http.MethodGet, "/api/unknown", "",
+			domain.Problem{Status: http.StatusNotFound, Code: appErrors.CodeNotFound},
+		},
+	}
+
+	for _, testCase := range testTable {
+		req, err := http.NewRequest(testCase.method, ts.URL+testCase.path, strings.NewReader(testCase.body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+
+		require.Equal(t, testCase.want.Status, resp.StatusCode)
+		require.Equal(t, ProblemContentType, resp.Header.Get("Content-Type"))
+
+		var got domain.Problem
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+		resp.Body.Close()
+
+		require.Equal(t, testCase.want.Status, got.Status)
+		require.Equal(t, testCase.want.Code, got.Code)
+		require.Equal(t, testCase.want.Slug, got.Slug)
+		require.Equal(t, testCase.want.Field, got.Field)
+		require.Equal(t, "urn:user-segmenter:problem:"+testCase.want.Code, got.Type)
+		require.Equal(t, testCase.path, got.Instance)
+
+		if testCase.want.Status == http.StatusInternalServerError {
+			require.Empty(t, got.Detail)
+		} else {
+			require.NotEmpty(t, got.Detail)
+		}
+	}
+	// a body which is not gzip, though the header says it is, is rejected before the handler
+	req, err := http.NewRequest(http.MethodPatch, ts.URL+"/api/ttl", strings.NewReader("{\"user_id\":\"1\"}"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, ProblemContentType, resp.Header.Get("Content-Type"))
+
+	var got domain.Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, appErrors.CodeInvalidField, got.Code)
+	require.Equal(t, "Content-Encoding", got.Field)
+	require.NotEmpty(t, got.Detail)
+}
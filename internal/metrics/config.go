@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+type configCollector struct {
+	version func() domain.ConfigVersion
+
+	configVersion  *prometheus.Desc
+	reloads        *prometheus.Desc
+	pendingRestart *prometheus.Desc
+}
+
+// NewConfigCollector exposes the version of the configuration and results of its reloads, which are read on every scrape
+func NewConfigCollector(version func() domain.ConfigVersion) prometheus.Collector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "config", name), help, labels, nil)
+	}
+
+	return &configCollector{
+		version:        version,
+		configVersion:  desc("version", "Version of the applied configuration, increased by every reload which changes settings."),
+		reloads:        desc("reloads_total", "Amount of configuration reloads by result.", "result"),
+		pendingRestart: desc("pending_restart_settings", "Amount of changed settings which are applied only after a restart."),
+	}
+}
+
+func (c *configCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *configCollector) Collect(ch chan<- prometheus.Metric) {
+	version := c.version()
+
+	ch <- prometheus.MustNewConstMetric(c.configVersion, prometheus.GaugeValue, float64(version.Version))
+	ch <- prometheus.MustNewConstMetric(c.reloads, prometheus.CounterValue, float64(version.Reloads), "success")
+	ch <- prometheus.MustNewConstMetric(c.reloads, prometheus.CounterValue, float64(version.FailedReloads), "failure")
+	ch <- prometheus.MustNewConstMetric(c.pendingRestart, prometheus.GaugeValue, float64(len(version.PendingRestart)))
+}
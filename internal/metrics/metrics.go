@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "segmenter"
+
+// Registry holds all service metrics, it is exposed on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Amount of handled HTTP requests.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latencies.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	PercentRolloutEnrolled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rollout",
+		Name:      "users_enrolled_total",
+		Help:      "Amount of users added to segments by percent rollout.",
+	})
+
+	DeletionFanoutsInProgress = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "deletion_fanout",
+		Name:      "in_progress",
+		Help:      "Amount of segment deletions which are removing the segment from users right now.",
+	})
+
+	DeletionFanoutPendingUsers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "deletion_fanout",
+		Name:      "pending_users",
+		Help:      "Amount of users the segments being deleted still have to be removed from.",
+	})
+
+	DeletionFanoutUsers = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "deletion_fanout",
+		Name:      "users_total",
+		Help:      "Amount of users deleted segments were removed from.",
+	})
+
+	ReportGenerationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "reports",
+		Name:      "generation_duration_seconds",
+		Help:      "Time spent generating CSV history reports.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"result"})
+
+	DBRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "retries_total",
+		Help:      "Amount of database operations retried after transient errors by reason.",
+	}, []string{"reason"})
+
+	DBReads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "reads_total",
+		Help:      "Amount of reads which may be served by read replicas by the database they were made on.",
+	}, []string{"target"})
+
+	DBReplicaHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "replica_healthy",
+		Help:      "Whether the read replica passed the last health check.",
+	}, []string{"replica"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		PercentRolloutEnrolled,
+		DeletionFanoutsInProgress,
+		DeletionFanoutPendingUsers,
+		DeletionFanoutUsers,
+		ReportGenerationDuration,
+		DBRetries,
+		DBReads,
+		DBReplicaHealthy,
+	)
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/domain/mocks"
+	"github.com/PoorMercymain/user-segmenter/internal/worker"
+)
+
+func TestSchedulerCollector(t *testing.T) {
+	collector := NewSchedulerCollector(func() worker.Stats {
+		return worker.Stats{
+			Runs:            5,
+			FailedRuns:      1,
+			Expired:         10,
+			Retired:         2,
+			Activated:       3,
+			PrunedChanges:   6,
+			PrunedKeys:      7,
+			FailedRows:      4,
+			LastSuccess:     time.Unix(100, 0),
+			LastRunDuration: time.Second,
+		}
+	})
+
+	expected := `
+# HELP segmenter_scheduler_processed_total Amount of rows processed by the scheduler by job.
+# TYPE segmenter_scheduler_processed_total counter
+segmenter_scheduler_processed_total{job="changes_pruning"} 6
+segmenter_scheduler_processed_total{job="idempotency_pruning"} 7
+segmenter_scheduler_processed_total{job="scheduled_activation"} 3
+segmenter_scheduler_processed_total{job="segment_expiry"} 2
+segmenter_scheduler_processed_total{job="ttl_expiry"} 10
+# HELP segmenter_scheduler_runs_total Amount of scheduler runs by result.
+# TYPE segmenter_scheduler_runs_total counter
+segmenter_scheduler_runs_total{result="failure"} 1
+segmenter_scheduler_runs_total{result="success"} 4
+# HELP segmenter_scheduler_last_success_timestamp_seconds Time of the last successful scheduler run.
+# TYPE segmenter_scheduler_last_success_timestamp_seconds gauge
+segmenter_scheduler_last_success_timestamp_seconds 100
+`
+
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"segmenter_scheduler_processed_total", "segmenter_scheduler_runs_total", "segmenter_scheduler_last_success_timestamp_seconds"))
+	require.Equal(t, 10, testutil.CollectAndCount(collector))
+}
+
+func TestConfigCollector(t *testing.T) {
+	collector := NewConfigCollector(func() domain.ConfigVersion {
+		return domain.ConfigVersion{Version: 3, Reloads: 4, FailedReloads: 1, PendingRestart: []string{"db_max_conns"}}
+	})
+
+	expected := `
+# HELP segmenter_config_version Version of the applied configuration, increased by every reload which changes settings.
+# TYPE segmenter_config_version gauge
+segmenter_config_version 3
+# HELP segmenter_config_reloads_total Amount of configuration reloads by result.
+# TYPE segmenter_config_reloads_total counter
+segmenter_config_reloads_total{result="failure"} 1
+segmenter_config_reloads_total{result="success"} 4
+# HELP segmenter_config_pending_restart_settings Amount of changed settings which are applied only after a restart.
+# TYPE segmenter_config_pending_restart_settings gauge
+segmenter_config_pending_restart_settings 1
+`
+
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
+
+func TestReportRepository(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockReportRepository(ctrl)
+	gomock.InOrder(
+		mockRepo.EXPECT().CreateCSV(gomock.Any(), "1", gomock.Any(), gomock.Any()).Return("report.csv", nil),
+		mockRepo.EXPECT().CreateCSV(gomock.Any(), "2", gomock.Any(), gomock.Any()).Return("", appErrors.ErrorNoRows),
+	)
+
+	repo := NewReportRepository(mockRepo)
+
+	filename, err := repo.CreateCSV(context.Background(), "1", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, "report.csv", filename)
+
+	_, err = repo.CreateCSV(context.Background(), "2", time.Time{}, time.Time{})
+	require.ErrorIs(t, err, appErrors.ErrorNoRows)
+
+	require.Equal(t, 2, testutil.CollectAndCount(ReportGenerationDuration))
+}
+
+func TestPoolCollector(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "host=localhost dbname=test pool_max_conns=3")
+	require.NoError(t, err)
+	defer pool.Close()
+
+	expected := `
+# HELP segmenter_db_pool_max_conns Max size of the pool.
+# TYPE segmenter_db_pool_max_conns gauge
+segmenter_db_pool_max_conns 3
+`
+
+	require.NoError(t, testutil.CollectAndCompare(NewPoolCollector(pool), strings.NewReader(expected), "segmenter_db_pool_max_conns"))
+}
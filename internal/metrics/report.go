@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.ReportRepository = (*report)(nil)
+)
+
+// report measures report generation without changing the wrapped repository
+type report struct {
+	domain.ReportRepository
+}
+
+func NewReportRepository(repo domain.ReportRepository) *report {
+	return &report{repo}
+}
+
+func (r *report) CreateCSV(ctx context.Context, userID string, startDate, endDate time.Time) (string, error) {
+	start := time.Now()
+
+	filename, err := r.ReportRepository.CreateCSV(ctx, userID, startDate, endDate)
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	ReportGenerationDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+
+	return filename, err
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/PoorMercymain/user-segmenter/internal/worker"
+)
+
+type schedulerCollector struct {
+	stats func() worker.Stats
+
+	runs            *prometheus.Desc
+	processed       *prometheus.Desc
+	failedRows      *prometheus.Desc
+	lastSuccess     *prometheus.Desc
+	lastRunDuration *prometheus.Desc
+}
+
+// NewSchedulerCollector exposes the scheduler counters, which are read on every scrape
+func NewSchedulerCollector(stats func() worker.Stats) prometheus.Collector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "scheduler", name), help, labels, nil)
+	}
+
+	return &schedulerCollector{
+		stats:           stats,
+		runs:            desc("runs_total", "Amount of scheduler runs by result.", "result"),
+		processed:       desc("processed_total", "Amount of rows processed by the scheduler by job.", "job"),
+		failedRows:      desc("failed_rows_total", "Amount of rows the scheduler failed to process."),
+		lastSuccess:     desc("last_success_timestamp_seconds", "Time of the last successful scheduler run."),
+		lastRunDuration: desc("last_run_duration_seconds", "Duration of the last scheduler run."),
+	}
+}
+
+func (c *schedulerCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *schedulerCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+
+	ch <- prometheus.MustNewConstMetric(c.runs, prometheus.CounterValue, float64(stats.Runs-stats.FailedRuns), "success")
+	ch <- prometheus.MustNewConstMetric(c.runs, prometheus.CounterValue, float64(stats.FailedRuns), "failure")
+	ch <- prometheus.MustNewConstMetric(c.processed, prometheus.CounterValue, float64(stats.Expired), "ttl_expiry")
+	ch <- prometheus.MustNewConstMetric(c.processed, prometheus.CounterValue, float64(stats.Retired), "segment_expiry")
+	ch <- prometheus.MustNewConstMetric(c.processed, prometheus.CounterValue, float64(stats.Activated), "scheduled_activation")
+	ch <- prometheus.MustNewConstMetric(c.processed, prometheus.CounterValue, float64(stats.PrunedChanges), "changes_pruning")
+	ch <- prometheus.MustNewConstMetric(c.processed, prometheus.CounterValue, float64(stats.PrunedKeys), "idempotency_pruning")
+	ch <- prometheus.MustNewConstMetric(c.failedRows, prometheus.CounterValue, float64(stats.FailedRows))
+
+	var lastSuccess float64
+	if !stats.LastSuccess.IsZero() {
+		lastSuccess = float64(stats.LastSuccess.UnixNano()) / 1e9
+	}
+	ch <- prometheus.MustNewConstMetric(c.lastSuccess, prometheus.GaugeValue, lastSuccess)
+	ch <- prometheus.MustNewConstMetric(c.lastRunDuration, prometheus.GaugeValue, stats.LastRunDuration.Seconds())
+}
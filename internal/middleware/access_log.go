@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+)
+
+// AccessLog puts the logger with the request ID to the request context and writes one line per handled request
+func AccessLog(log *zap.SugaredLogger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			requestLog := log.With("request_id", RequestIDFromContext(c.Request().Context()))
+			c.SetRequest(c.Request().WithContext(logger.WithContext(c.Request().Context(), requestLog)))
+
+			err := next(c)
+
+			status := responseStatus(c, err)
+
+			fields := []interface{}{
+				"method", c.Request().Method,
+				"uri", c.Request().RequestURI,
+				"route", c.Path(),
+				"status", status,
+				"latency", time.Since(start),
+				"bytes_in", c.Request().ContentLength,
+				"bytes_out", c.Response().Size,
+				"remote_ip", c.RealIP(),
+				"user_agent", c.Request().UserAgent(),
+			}
+			if err != nil {
+				fields = append(fields, "error", err.Error())
+			}
+
+			accessLog := logger.FromContext(c.Request().Context())
+			if status >= http.StatusInternalServerError {
+				accessLog.Errorw("request handled", fields...)
+			} else {
+				accessLog.Infow("request handled", fields...)
+			}
+
+			return err
+		}
+	}
+}
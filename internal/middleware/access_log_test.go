@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+)
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+
+	e := echo.New()
+	e.Use(RequestID())
+	e.Use(AccessLog(zap.New(core).Sugar()))
+
+	e.GET("/test/:user", func(c echo.Context) error {
+		logger.FromContext(c.Request().Context()).Debugln("in handler")
+		return c.String(http.StatusOK, "ok")
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		c.Response().WriteHeader(http.StatusInternalServerError)
+		return nil
+	})
+
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/test/1", nil)
+	require.NoError(t, err)
+	req.Header.Set(RequestIDHeader, "test-id")
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = ts.Client().Get(ts.URL + "/fail")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	entries := logs.All()
+	require.Len(t, entries, 3)
+
+	require.Equal(t, "in handler", entries[0].Message)
+	require.Equal(t, "test-id", entries[0].ContextMap()["request_id"])
+
+	require.Equal(t, zapcore.InfoLevel, entries[1].Level)
+	fields := entries[1].ContextMap()
+	require.Equal(t, "test-id", fields["request_id"])
+	require.Equal(t, http.MethodGet, fields["method"])
+	require.Equal(t, "/test/:user", fields["route"])
+	require.Equal(t, "/test/1", fields["uri"])
+	require.Equal(t, int64(http.StatusOK), fields["status"])
+	require.Equal(t, int64(2), fields["bytes_out"])
+
+	require.Equal(t, zapcore.ErrorLevel, entries[2].Level)
+	require.Equal(t, int64(http.StatusInternalServerError), entries[2].ContextMap()["status"])
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// Authenticate puts the client of the credential sent in the Authorization (Bearer) or X-API-Key header
+// to the request context. Authenticators are tried in order until one of them accepts the credential.
+// Requests without a credential are passed on, so routes without scopes stay public
+func Authenticate(authenticators ...domain.Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			credential := credentialFromRequest(c.Request())
+			if credential == "" {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+			client, err := authenticate(ctx, authenticators, credential)
+			if errors.Is(err, appErrors.ErrorUnauthenticated) {
+				return unauthenticated(c, err)
+			} else if err != nil {
+				return err
+			}
+
+			ctx = domain.ContextWithClient(ctx, client)
+			ctx = logger.WithContext(ctx, logger.FromContext(ctx).With("client", client.ID))
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
+
+func authenticate(ctx context.Context, authenticators []domain.Authenticator, credential string) (domain.Client, error) {
+	for _, auth := range authenticators {
+		client, err := auth.Authenticate(ctx, credential)
+		if !errors.Is(err, appErrors.ErrorUnauthenticated) {
+			return client, err
+		}
+	}
+
+	return domain.Client{}, appErrors.Unauthenticated()
+}
+
+// Anonymous gives every request all scopes, it replaces Authenticate when authentication is disabled
+func Anonymous() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			client := domain.Client{Name: "anonymous", Namespace: domain.AllNamespaces, Scopes: domain.Scopes}
+			c.SetRequest(c.Request().WithContext(domain.ContextWithClient(c.Request().Context(), client)))
+
+			return next(c)
+		}
+	}
+}
+
+// RequireScope rejects requests of clients without the scope or without access to the namespace of the request,
+// it should be set on every route which is not public
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			client, ok := domain.ClientFromContext(c.Request().Context())
+			if !ok {
+				return unauthenticated(c, appErrors.Unauthenticated())
+			}
+
+			if !client.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden).SetInternal(appErrors.InsufficientScope(scope))
+			}
+
+			if !client.CanAccess(domain.NamespaceFromContext(c.Request().Context())) {
+				return echo.NewHTTPError(http.StatusForbidden).SetInternal(appErrors.NamespaceForbidden())
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func unauthenticated(c echo.Context, err error) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="user-segmenter"`)
+	return echo.NewHTTPError(http.StatusUnauthorized).SetInternal(err)
+}
+
+func credentialFromRequest(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+
+	scheme, credential, found := strings.Cut(r.Header.Get(echo.HeaderAuthorization), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(credential)
+}
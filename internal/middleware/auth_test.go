@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+type authenticatorFunc func(ctx context.Context, credential string) (domain.Client, error)
+
+func (f authenticatorFunc) Authenticate(ctx context.Context, credential string) (domain.Client, error) {
+	return f(ctx, credential)
+}
+
+func TestAuthenticate(t *testing.T) {
+	auth := authenticatorFunc(func(_ context.Context, credential string) (domain.Client, error) {
+		switch credential {
+		case "reader":
+			return domain.Client{ID: "api_key:1", Namespace: domain.DefaultNamespace, Scopes: []string{domain.ScopeUsersRead}}, nil
+		case "broken":
+			return domain.Client{}, appErrors.ErrorLoggerNotInitialized
+		}
+		return domain.Client{}, appErrors.Unauthenticated()
+	})
+
+	tokens := authenticatorFunc(func(_ context.Context, credential string) (domain.Client, error) {
+		if credential == "token" {
+			return domain.Client{ID: "jwt:service", Namespace: domain.DefaultNamespace, Scopes: []string{domain.ScopeUsersWrite}}, nil
+		}
+		return domain.Client{}, appErrors.Unauthenticated()
+	})
+
+	e := echo.New()
+	e.Use(Authenticate(auth, tokens))
+
+	var actor *string
+	e.GET("/public", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/users", func(c echo.Context) error {
+		actor = domain.ActorFromContext(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	}, RequireScope(domain.ScopeUsersRead))
+	e.POST("/users", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, RequireScope(domain.ScopeUsersWrite))
+
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	do := func(method, endpoint string, header ...string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+endpoint, nil)
+		require.NoError(t, err)
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/public").StatusCode)
+
+	resp := do(http.MethodGet, "/users")
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.NotEmpty(t, resp.Header.Get(echo.HeaderWWWAuthenticate))
+
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/public", APIKeyHeader, "unknown").StatusCode)
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/users", echo.HeaderAuthorization, "Basic reader").StatusCode)
+	require.Equal(t, http.StatusInternalServerError, do(http.MethodGet, "/users", APIKeyHeader, "broken").StatusCode)
+
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/users", APIKeyHeader, "reader").StatusCode)
+	require.NotNil(t, actor)
+	require.Equal(t, "api_key:1", *actor)
+
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/users", echo.HeaderAuthorization, "Bearer reader").StatusCode)
+	require.Equal(t, http.StatusForbidden, do(http.MethodPost, "/users", echo.HeaderAuthorization, "Bearer reader").StatusCode)
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/users", echo.HeaderAuthorization, "Bearer token").StatusCode)
+	require.Equal(t, http.StatusForbidden, do(http.MethodGet, "/users", echo.HeaderAuthorization, "Bearer token").StatusCode)
+}
+
+func TestAnonymous(t *testing.T) {
+	e := echo.New()
+	e.Use(Anonymous())
+
+	var actor *string
+	e.POST("/segment", func(c echo.Context) error {
+		actor = domain.ActorFromContext(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	}, RequireScope(domain.ScopeSegmentsWrite))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/segment", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Nil(t, actor)
+}
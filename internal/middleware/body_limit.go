@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+)
+
+// LimitBody rejects requests with bodies larger than maxSize bytes, before decompression.
+// Bodies with a known length are rejected right away, others fail when the handler reads past the limit
+func LimitBody(maxSize int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().ContentLength > maxSize {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge).SetInternal(appErrors.BodyTooLarge())
+			}
+
+			c.Request().Body = newLimitedReader(c.Request().Body, maxSize)
+
+			return next(c)
+		}
+	}
+}
+
+// limitedReader fails with a body too large error instead of silently stopping at the limit like io.LimitReader
+type limitedReader struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func newLimitedReader(r io.ReadCloser, maxSize int64) io.ReadCloser {
+	if maxSize <= 0 {
+		return r
+	}
+
+	return &limitedReader{ReadCloser: r, remaining: maxSize}
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.exceeded {
+		return 0, appErrors.BodyTooLarge()
+	}
+
+	// one more byte is read to tell a body of exactly maxSize bytes from a larger one
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	if int64(n) > r.remaining {
+		n = int(r.remaining)
+		r.remaining = 0
+		r.exceeded = true
+		return n, appErrors.BodyTooLarge()
+	}
+
+	r.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+)
+
+func TestLimitBody(t *testing.T) {
+	e := echo.New()
+
+	var readErr error
+	e.POST("/test", func(c echo.Context) error {
+		_, readErr = io.ReadAll(c.Request().Body)
+		if readErr != nil {
+			return c.NoContent(http.StatusRequestEntityTooLarge)
+		}
+		return c.NoContent(http.StatusOK)
+	}, LimitBody(64), UseGzipReader(100))
+
+	do := func(body io.Reader, contentLength int64, gzipped bool) int {
+		readErr = nil
+		req := httptest.NewRequest(http.MethodPost, "/test", body)
+		req.ContentLength = contentLength
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, do(strings.NewReader(strings.Repeat("a", 64)), 64, false))
+	require.NoError(t, readErr)
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, do(strings.NewReader(strings.Repeat("a", 65)), 65, false))
+	require.NoError(t, readErr)
+
+	// the length of chunked bodies is unknown, so they fail while being read
+	require.Equal(t, http.StatusRequestEntityTooLarge, do(strings.NewReader(strings.Repeat("a", 65)), -1, false))
+	require.Equal(t, appErrors.CodeBodyTooLarge, appErrors.CodeOf(readErr))
+
+	gzipped := func(size int) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		w := gzip.NewWriter(buf)
+		_, err := w.Write(bytes.Repeat([]byte("a"), size))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return buf
+	}
+
+	require.Equal(t, http.StatusOK, do(gzipped(100), -1, true))
+	require.NoError(t, readErr)
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, do(gzipped(101), -1, true))
+	require.Equal(t, appErrors.CodeBodyTooLarge, appErrors.CodeOf(readErr))
+}
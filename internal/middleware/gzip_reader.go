@@ -2,48 +2,55 @@ package middleware
 
 import (
 	"compress/gzip"
+	"io"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 
-	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
 )
 
-func UseGzipReader() echo.MiddlewareFunc {
+// UseGzipReader decompresses gzip request bodies, maxSize limits the size of a decompressed body, 0 means no limit.
+// Bodies which are not valid gzip are rejected with 400
+func UseGzipReader(maxSize int64) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			log, err := logger.GetLogger()
-			if err != nil {
-				c.Response().WriteHeader(http.StatusInternalServerError)
-				return err
-			}
-			log.Infoln("in gzip")
-			if len(c.Request().Header.Values("Content-Encoding")) == 0 {
-				log.Infoln("no gzip")
-				return next(c)
-			}
-			for i, headerValue := range c.Request().Header.Values("Content-Encoding") {
+			isGzip := false
+			for _, headerValue := range c.Request().Header.Values("Content-Encoding") {
 				if headerValue == "gzip" {
+					isGzip = true
 					break
 				}
-				log.Infoln(i, (len(c.Request().Header.Values("Content-Encoding")) - 1))
-				if i == (len(c.Request().Header.Values("Content-Encoding")) - 1) {
-					log.Infoln("no gzip")
-					return next(c)
-				}
 			}
 
-			gzipReader, err := gzip.NewReader(c.Request().Body)
+			if !isGzip {
+				return next(c)
+			}
+
+			body := c.Request().Body
+			gzipReader, err := gzip.NewReader(body)
 			if err != nil {
-				log.Infoln("no")
-				c.Response().WriteHeader(http.StatusBadRequest)
-				return err
+				return echo.NewHTTPError(http.StatusBadRequest).SetInternal(appErrors.InvalidField("Content-Encoding", err))
 			}
-			c.Request().Body.Close()
 
-			c.Request().Body = gzipReader
+			c.Request().Body = newLimitedReader(gzipBody{Reader: gzipReader, body: body}, maxSize)
 
 			return next(c)
 		}
 	}
 }
+
+// gzipBody reads the original body while the request is handled, so it is closed together with the gzip reader
+type gzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (b gzipBody) Close() error {
+	err := b.Reader.Close()
+	if bodyErr := b.body.Close(); err == nil {
+		err = bodyErr
+	}
+
+	return err
+}
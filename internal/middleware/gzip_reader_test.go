@@ -3,6 +3,8 @@ package middleware
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/rand"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -10,14 +12,11 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/require"
-
-	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+	"go.uber.org/zap/zaptest"
 )
 
 func TestUseGzipReader(t *testing.T) {
-	logger.InitLogger()
-	log, err := logger.GetLogger()
-	require.NoError(t, err)
+	log := zaptest.NewLogger(t).Sugar()
 
 	e := echo.New()
 
@@ -53,7 +52,7 @@ func TestUseGzipReader(t *testing.T) {
 			ctx.Response().WriteHeader(http.StatusOK)
 			return nil
 		}
-	}, UseGzipReader())
+	}, UseGzipReader(0))
 
 	resp, err := ts.Client().Do(req)
 	require.NoError(t, err)
@@ -82,3 +81,60 @@ func TestUseGzipReader(t *testing.T) {
 	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
 	resp.Body.Close()
 }
+
+// closeTracker reports whether the body was closed and fails reads after it, as request bodies of the server do
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Read(p []byte) (int, error) {
+	if c.closed {
+		return 0, errors.New("read on closed body")
+	}
+
+	return c.Reader.Read(p)
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestUseGzipReaderLargeBody(t *testing.T) {
+	// the body is larger than the part gzip reads ahead, so it is still read while the request is handled
+	payload := make([]byte, 20*1024)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	_, err = w.Write(payload)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	for _, maxSize := range []int64{0, 1 << 20} {
+		e := echo.New()
+		e.POST("/test", func(c echo.Context) error {
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return err
+			}
+
+			if !bytes.Equal(payload, body) {
+				return c.NoContent(http.StatusUnprocessableEntity)
+			}
+
+			return c.Request().Body.Close()
+		}, UseGzipReader(maxSize))
+
+		body := &closeTracker{Reader: bytes.NewReader(compressed.Bytes())}
+		req := httptest.NewRequest(http.MethodPost, "/test", body)
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, maxSize)
+		require.True(t, body.closed, maxSize)
+	}
+}
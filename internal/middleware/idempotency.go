@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed for retries
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// Idempotency makes retries of a request with the same Idempotency-Key header get the response to the first request
+// instead of processing it again. A key reused for a request with another method, path or body gets 422, a retry
+// made while the first request is in progress gets 409. Responses with 5xx statuses are not stored, so such requests
+// may be retried. It should be set after RequireScope, so keys are not taken by requests without access,
+// and before UseGzipReader, as the body is compared as it was sent
+func Idempotency(srv domain.IdempotencyService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				return next(c)
+			}
+
+			if len(key) > domain.MaxIdempotencyKeyLength {
+				return echo.NewHTTPError(http.StatusBadRequest).SetInternal(appErrors.InvalidField(IdempotencyKeyHeader, appErrors.ErrorIdempotencyKeyTooLong))
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if errors.Is(err, appErrors.ErrorBodyTooLarge) {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge).SetInternal(err)
+			} else if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest).SetInternal(err)
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := c.Request().Context()
+			request := domain.IdempotentRequest{ClientID: clientKey(c), Key: key, Fingerprint: fingerprint(c.Request(), body)}
+
+			stored, err := srv.Begin(ctx, request)
+			switch {
+			case errors.Is(err, appErrors.ErrorIdempotencyKeyInProgress):
+				return echo.NewHTTPError(http.StatusConflict).SetInternal(err)
+			case errors.Is(err, appErrors.ErrorIdempotencyKeyReused):
+				return echo.NewHTTPError(http.StatusUnprocessableEntity).SetInternal(err)
+			case err != nil:
+				return err
+			}
+
+			if stored != nil {
+				c.Response().Header().Set(IdempotentReplayedHeader, "true")
+				if stored.ContentType == "" {
+					return c.NoContent(stored.Status)
+				}
+
+				return c.Blob(stored.Status, stored.ContentType, stored.Body)
+			}
+
+			response := c.Response()
+			writer := response.Writer
+			var recorded bytes.Buffer
+			response.Writer = domain.RespWriter{Writer: io.MultiWriter(writer, &recorded), ResponseWriter: writer}
+
+			err = next(c)
+			response.Writer = writer
+
+			// the client may have gone away while waiting, which is when it is going to retry, so the context
+			// of the request is not used to store the response
+			storeCtx := detached(ctx)
+			log := logger.FromContext(ctx)
+
+			// errors not written by the handler are sent later by the error handler, their responses are not recorded
+			if !response.Committed || response.Status >= http.StatusInternalServerError {
+				if abortErr := srv.Abort(storeCtx, request); abortErr != nil {
+					log.Errorln("failed to release idempotency key:", abortErr)
+				}
+
+				return err
+			}
+
+			first := domain.IdempotentResponse{Status: response.Status, ContentType: response.Header().Get(echo.HeaderContentType), Body: recorded.Bytes()}
+			if completeErr := srv.Complete(storeCtx, request, first); completeErr != nil {
+				log.Errorln("failed to store response for idempotency key:", completeErr)
+			}
+
+			return err
+		}
+	}
+}
+
+// fingerprint tells requests reusing a key apart by the method, the path with the query and the body
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// detached keeps the namespace and the logger of ctx without its cancellation
+func detached(ctx context.Context) context.Context {
+	detachedCtx := domain.ContextWithNamespace(context.Background(), domain.NamespaceFromContext(ctx))
+	return logger.WithContext(detachedCtx, logger.FromContext(ctx))
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PoorMercymain/user-segmenter/internal/repository"
+	"github.com/PoorMercymain/user-segmenter/internal/service"
+)
+
+func TestIdempotency(t *testing.T) {
+	e := echo.New()
+	e.Use(LimitBody(1024))
+
+	var processed atomic.Int64
+	e.POST("/segment", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+
+		if string(body) == "broken" {
+			processed.Add(1)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+
+		return c.JSON(http.StatusCreated, map[string]any{"processed": processed.Add(1), "body": string(body)})
+	}, Idempotency(service.NewIdempotency(repository.NewMemoryIdempotency(repository.NewMemory()), time.Hour)))
+
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	do := func(key, body string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/segment", strings.NewReader(body))
+		require.NoError(t, err)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(respBody)
+	}
+
+	resp, first := do("key-1", "A")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Empty(t, resp.Header.Get(IdempotentReplayedHeader))
+
+	// the retry gets the first response and is not processed again
+	resp, replayed := do("key-1", "A")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(IdempotentReplayedHeader))
+	require.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, resp.Header.Get(echo.HeaderContentType))
+	require.Equal(t, first, replayed)
+	require.Equal(t, int64(1), processed.Load())
+
+	resp, _ = do("key-1", "B")
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	// requests without a key are always processed
+	do("", "A")
+	do("", "A")
+	require.Equal(t, int64(3), processed.Load())
+
+	// responses with 5xx statuses are not stored, so the request is processed again
+	resp, _ = do("key-2", "broken")
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	resp, _ = do("key-2", "broken")
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	require.Equal(t, int64(5), processed.Load())
+
+	resp, _ = do(strings.Repeat("k", 256), "A")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = do("key-3", strings.Repeat("A", 2048))
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	require.Equal(t, int64(5), processed.Load())
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	e := echo.New()
+	e.POST("/user", func(c echo.Context) error {
+		close(started)
+		<-release
+		return c.NoContent(http.StatusOK)
+	}, Idempotency(service.NewIdempotency(repository.NewMemoryIdempotency(repository.NewMemory()), time.Hour)))
+
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	do := func() int {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/user", strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	first := make(chan int)
+	go func() {
+		first <- do()
+	}()
+
+	<-started
+	require.Equal(t, http.StatusConflict, do())
+
+	close(release)
+	require.Equal(t, http.StatusOK, <-first)
+	require.Equal(t, http.StatusOK, do())
+}
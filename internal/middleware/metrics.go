@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/PoorMercymain/user-segmenter/internal/metrics"
+)
+
+// Metrics records request counts and latencies by route template, so paths with parameters do not create new series
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+
+			status := responseStatus(c, err)
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			labels := []string{c.Request().Method, route, strconv.Itoa(status)}
+			metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
+
+// responseStatus returns the status code which is sent to the client, including errors not handled yet by echo
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PoorMercymain/user-segmenter/internal/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	e := echo.New()
+	e.Use(Metrics())
+
+	e.GET("/test/:user", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		c.Response().WriteHeader(http.StatusBadRequest)
+		return nil
+	})
+
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	for _, path := range []string{"/test/1", "/test/2", "/fail"} {
+		resp, err := ts.Client().Get(ts.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	require.Equal(t, float64(2), testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/test/:user", "200")))
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/fail", "400")))
+	require.Equal(t, 2, testutil.CollectAndCount(metrics.HTTPRequests))
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+)
+
+const NamespaceHeader = "X-Namespace"
+
+// Namespace puts the namespace selected by the :namespace path parameter or the X-Namespace header
+// to the request context, the path parameter takes precedence. Requests without a namespace get the default one
+func Namespace() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			namespace := c.Param("namespace")
+			if namespace == "" {
+				namespace = c.Request().Header.Get(NamespaceHeader)
+			}
+
+			if namespace == "" {
+				namespace = domain.DefaultNamespace
+			}
+
+			if !domain.IsValidNamespace(namespace) {
+				return echo.NewHTTPError(http.StatusBadRequest).SetInternal(appErrors.InvalidNamespace())
+			}
+
+			ctx := domain.ContextWithNamespace(c.Request().Context(), namespace)
+			ctx = logger.WithContext(ctx, logger.FromContext(ctx).With("namespace", namespace))
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+func TestNamespace(t *testing.T) {
+	e := echo.New()
+
+	var namespace string
+	h := func(c echo.Context) error {
+		namespace = domain.NamespaceFromContext(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	}
+	e.GET("/api/segment", h, Namespace())
+	e.GET("/api/ns/:namespace/segment", h, Namespace())
+
+	do := func(target, header string) int {
+		namespace = ""
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if header != "" {
+			req.Header.Set(NamespaceHeader, header)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, do("/api/segment", ""))
+	require.Equal(t, domain.DefaultNamespace, namespace)
+
+	require.Equal(t, http.StatusOK, do("/api/segment", "team-a"))
+	require.Equal(t, "team-a", namespace)
+
+	require.Equal(t, http.StatusOK, do("/api/ns/team_b/segment", "team-a"))
+	require.Equal(t, "team_b", namespace)
+
+	require.Equal(t, http.StatusBadRequest, do("/api/segment", "Team A"))
+	require.Equal(t, http.StatusBadRequest, do("/api/ns/-team/segment", ""))
+	require.Equal(t, http.StatusBadRequest, do("/api/segment", domain.AllNamespaces))
+	require.Empty(t, namespace)
+}
+
+func TestRequireScopeNamespace(t *testing.T) {
+	client := domain.Client{ID: "api_key:1", Namespace: "team-a", Scopes: []string{domain.ScopeUsersRead}}
+
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetRequest(c.Request().WithContext(domain.ContextWithClient(c.Request().Context(), client)))
+			return next(c)
+		}
+	})
+	e.GET("/api/ns/:namespace/user", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, Namespace(), RequireScope(domain.ScopeUsersRead))
+
+	do := func(target string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, do("/api/ns/team-a/user"))
+	require.Equal(t, http.StatusForbidden, do("/api/ns/team-b/user"))
+
+	client.Namespace = domain.AllNamespaces
+	require.Equal(t, http.StatusOK, do("/api/ns/team-b/user"))
+}
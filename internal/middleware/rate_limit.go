@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	ratelimiter "github.com/PoorMercymain/user-segmenter/pkg/rate-limiter"
+)
+
+// RateLimit limits requests of every client with the limiter. Clients are told apart by the API key or token,
+// unauthenticated requests by IP. It should be set after Authenticate, rejected requests get 429 with Retry-After
+func RateLimit(limiter *ratelimiter.Limiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if ok, retryAfter := limiter.Allow(clientKey(c)); !ok {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				return echo.NewHTTPError(http.StatusTooManyRequests).SetInternal(appErrors.RateLimited())
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func clientKey(c echo.Context) string {
+	if client, ok := domain.ClientFromContext(c.Request().Context()); ok && client.ID != "" {
+		return client.ID
+	}
+
+	return "ip:" + c.RealIP()
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	ratelimiter "github.com/PoorMercymain/user-segmenter/pkg/rate-limiter"
+)
+
+func TestRateLimit(t *testing.T) {
+	e := echo.New()
+	e.Use(Authenticate(authenticatorFunc(func(_ context.Context, credential string) (domain.Client, error) {
+		return domain.Client{ID: "api_key:" + credential, Namespace: domain.DefaultNamespace}, nil
+	})))
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, RateLimit(ratelimiter.New(0.5, 2)))
+
+	do := func(key, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = ip + ":1234"
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, do("first", "10.0.0.1").Code)
+	require.Equal(t, http.StatusOK, do("first", "10.0.0.2").Code)
+
+	rec := do("first", "10.0.0.3")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	// every key and every IP of unauthenticated requests has its own bucket
+	require.Equal(t, http.StatusOK, do("second", "10.0.0.1").Code)
+	require.Equal(t, http.StatusOK, do("", "10.0.0.1").Code)
+	require.Equal(t, http.StatusOK, do("", "10.0.0.1").Code)
+	require.Equal(t, http.StatusTooManyRequests, do("", "10.0.0.1").Code)
+	require.Equal(t, http.StatusOK, do("", "10.0.0.2").Code)
+}
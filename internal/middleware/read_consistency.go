@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+const ReadConsistencyHeader = "X-Read-Consistency"
+
+// ReadConsistency puts the read consistency selected by the X-Read-Consistency header to the request context.
+// Clients which need to see their own writes send strong, so reads go to the primary instead of replicas
+func ReadConsistency() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			consistency := c.Request().Header.Get(ReadConsistencyHeader)
+			if consistency == "" {
+				return next(c)
+			}
+
+			if !domain.IsValidReadConsistency(consistency) {
+				return echo.NewHTTPError(http.StatusBadRequest).SetInternal(appErrors.InvalidField(ReadConsistencyHeader, appErrors.ErrorUnknownReadConsistency))
+			}
+
+			c.SetRequest(c.Request().WithContext(domain.ContextWithReadConsistency(c.Request().Context(), consistency)))
+
+			return next(c)
+		}
+	}
+}
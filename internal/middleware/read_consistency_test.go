@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+func TestReadConsistency(t *testing.T) {
+	e := echo.New()
+
+	var consistency string
+	e.GET("/api/user/:user", func(c echo.Context) error {
+		consistency = domain.ReadConsistencyFromContext(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	}, ReadConsistency())
+
+	do := func(header string) int {
+		consistency = ""
+		req := httptest.NewRequest(http.MethodGet, "/api/user/1", nil)
+		if header != "" {
+			req.Header.Set(ReadConsistencyHeader, header)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, do(""))
+	require.Equal(t, domain.ReadConsistencyEventual, consistency)
+
+	require.Equal(t, http.StatusOK, do(domain.ReadConsistencyStrong))
+	require.Equal(t, domain.ReadConsistencyStrong, consistency)
+
+	require.Equal(t, http.StatusBadRequest, do("primary"))
+	require.Empty(t, consistency)
+}
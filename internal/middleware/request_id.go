@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength = 128
+)
+
+// RequestID takes the request ID from the X-Request-ID header or generates a new one,
+// puts it to the request context and sends it back in the response header
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			requestID := c.Request().Header.Get(RequestIDHeader)
+			if !isValidRequestID(requestID) {
+				requestID = generateRequestID()
+			}
+
+			c.Response().Header().Set(RequestIDHeader, requestID)
+			c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), domain.Key("request_id"), requestID)))
+
+			return next(c)
+		}
+	}
+}
+
+// RequestIDFromContext returns the request ID put to ctx by RequestID, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(domain.Key("request_id")).(string)
+	return requestID
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range requestID {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func generateRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
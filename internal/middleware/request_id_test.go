@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	e := echo.New()
+	e.Use(RequestID())
+
+	var fromContext string
+	e.GET("/test", func(c echo.Context) error {
+		fromContext = RequestIDFromContext(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	})
+
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	do := func(requestID string) string {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/test", nil)
+		require.NoError(t, err)
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		require.Equal(t, fromContext, resp.Header.Get(RequestIDHeader))
+		return fromContext
+	}
+
+	require.Equal(t, "abc-123", do("abc-123"))
+
+	generated := do("")
+	require.Len(t, generated, 32)
+	require.NotEqual(t, generated, do(""))
+
+	require.Len(t, do(strings.Repeat("a", maxRequestIDLength+1)), 32)
+	require.Len(t, do("with space"), 32)
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.APIKeyRepository = (*apiKey)(nil)
+)
+
+type apiKey struct {
+	*postgres
+}
+
+func NewAPIKey(pg *postgres) *apiKey {
+	return &apiKey{pg}
+}
+
+func (r *apiKey) CreateAPIKey(ctx context.Context, key domain.APIKey, keyHash string) error {
+	return r.retry(ctx, false, func(ctx context.Context) error {
+		_, err := r.Exec(ctx, "INSERT INTO api_keys (id, name, namespace, key_hash, scopes, created_at) VALUES ($1, $2, $3, $4, $5, $6)", key.ID, key.Name, key.Namespace, keyHash, key.Scopes, key.CreatedAt)
+		return err
+	})
+}
+
+// ReadAPIKeyByHash returns only keys which are not revoked
+func (r *apiKey) ReadAPIKeyByHash(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	return retryResult(ctx, r.postgres, true, func(ctx context.Context) (domain.APIKey, error) {
+		var key domain.APIKey
+		err := r.QueryRow(ctx, "SELECT id, name, namespace, scopes, created_at FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL", keyHash).Scan(&key.ID, &key.Name, &key.Namespace, &key.Scopes, &key.CreatedAt)
+		if err == pgx.ErrNoRows {
+			return domain.APIKey{}, appErrors.APIKeyNotFound()
+		}
+
+		return key, err
+	})
+}
+
+// ReadAPIKeys returns keys of the namespace from ctx, or all keys for a client with access to all namespaces
+func (r *apiKey) ReadAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	return retryResult(ctx, r.postgres, true, func(ctx context.Context) ([]domain.APIKey, error) {
+		rows, err := r.Query(ctx, "SELECT id, name, namespace, scopes, created_at, revoked_at FROM api_keys WHERE $1 = '*' OR namespace = $1 ORDER BY created_at", apiKeysNamespace(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		keys := make([]domain.APIKey, 0)
+		for rows.Next() {
+			var key domain.APIKey
+			err = rows.Scan(&key.ID, &key.Name, &key.Namespace, &key.Scopes, &key.CreatedAt, &key.RevokedAt)
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, key)
+		}
+
+		return keys, rows.Err()
+	})
+}
+
+// RevokeAPIKey revokes a key of the namespace from ctx, or a key of any namespace for a client with access to all namespaces
+func (r *apiKey) RevokeAPIKey(ctx context.Context, id string) error {
+	return r.retry(ctx, false, func(ctx context.Context) error {
+		updateResult, err := r.Exec(ctx, "UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND ($2 = '*' OR namespace = $2) AND revoked_at IS NULL", id, apiKeysNamespace(ctx))
+		if err != nil {
+			return err
+		}
+
+		if updateResult.RowsAffected() == 0 {
+			return appErrors.APIKeyNotFound()
+		}
+
+		return nil
+	})
+}
+
+// apiKeysNamespace returns the namespace whose keys the client manages. A request always selects a valid namespace,
+// so clients with access to all namespaces, e.g. keys issued by cmd/apikey with "*", get AllNamespaces from their own one
+func apiKeysNamespace(ctx context.Context) string {
+	if client, ok := domain.ClientFromContext(ctx); ok && client.Namespace == domain.AllNamespaces {
+		return domain.AllNamespaces
+	}
+
+	return domain.NamespaceFromContext(ctx)
+}
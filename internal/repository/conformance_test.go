@@ -0,0 +1,621 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	backgroundtracker "github.com/PoorMercymain/user-segmenter/pkg/background-tracker"
+	evaluationvectors "github.com/PoorMercymain/user-segmenter/pkg/evaluation"
+)
+
+// backend is a storage the conformance suite runs against, every subtest gets an empty one
+type backend struct {
+	segments    domain.SegmentRepository
+	users       domain.UserRepository
+	reports     domain.ReportRepository
+	evaluation  domain.EvaluationRepository
+	idempotency domain.IdempotencyRepository
+	apiKeys     domain.APIKeyRepository
+	// dropSegment deletes a segment without the background removal of its memberships, which can't be paused
+	dropSegment func(t *testing.T, ctx context.Context, slug string)
+}
+
+func TestMemoryConformance(t *testing.T) {
+	runConformance(t, func(t *testing.T) backend {
+		m := NewMemory()
+		return backend{
+			segments:    NewMemorySegment(m, backgroundtracker.New()),
+			users:       NewMemoryUser(m),
+			reports:     NewMemoryReport(m, t.TempDir()),
+			evaluation:  NewMemoryEvaluation(m, time.Hour),
+			idempotency: NewMemoryIdempotency(m),
+			apiKeys:     NewMemoryAPIKey(m),
+			dropSegment: func(t *testing.T, ctx context.Context, slug string) {
+				m.mu.Lock()
+				defer m.mu.Unlock()
+
+				m.deleteSegment(m.namespace(domain.NamespaceFromContext(ctx)), slug)
+			},
+		}
+	})
+}
+
+// TestPostgresConformance runs against the database from SEGMENTER_TEST_DATABASE_URI, created by initdb/init-db.sql.
+// The tables are truncated before every subtest
+func TestPostgresConformance(t *testing.T) {
+	uri := os.Getenv("SEGMENTER_TEST_DATABASE_URI")
+	if uri == "" {
+		t.Skip("SEGMENTER_TEST_DATABASE_URI is not set")
+	}
+
+	pool, err := NewPool(context.Background(), uri, PoolConfig{})
+	require.NoError(t, err)
+	defer pool.Close()
+
+	runConformance(t, postgresBackend(pool))
+}
+
+func postgresBackend(pool *pgxpool.Pool) func(t *testing.T) backend {
+	return func(t *testing.T) backend {
+		_, err := pool.Exec(context.Background(), "TRUNCATE slugs, users, deletion_times, users_segment_history, scheduled_assignments, api_keys, changes, idempotency_keys")
+		require.NoError(t, err)
+
+		_, err = pool.Exec(context.Background(), "UPDATE changes_horizon SET tx = 0, id = 0")
+		require.NoError(t, err)
+
+		pg := NewPostgres(pool, nil, RetryConfig{Attempts: 3, Backoff: 10 * time.Millisecond})
+		return backend{
+			segments:    NewSegment(pg, backgroundtracker.New()),
+			users:       NewUser(pg),
+			reports:     NewReport(pg, t.TempDir()),
+			evaluation:  NewEvaluation(pg, time.Hour),
+			idempotency: NewIdempotency(pg),
+			apiKeys:     NewAPIKey(pg),
+			dropSegment: func(t *testing.T, ctx context.Context, slug string) {
+				_, err := pool.Exec(ctx, "DELETE FROM slugs WHERE namespace = $1 AND slug = $2", domain.NamespaceFromContext(ctx), slug)
+				require.NoError(t, err)
+			},
+		}
+	}
+}
+
+// runConformance checks the semantics every storage should have, so the memory storage behaves like Postgres
+func runConformance(t *testing.T, newBackend func(t *testing.T) backend) {
+	ctx := domain.ContextWithClient(context.Background(), domain.Client{ID: "key-1"})
+
+	t.Run("segments", func(t *testing.T) {
+		b := newBackend(t)
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		ttl := 90 * time.Second
+
+		require.NoError(t, b.segments.CreateSegment(ctx, "B", domain.SegmentOptions{}))
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{DefaultTTL: &ttl, ExpiresAt: &expiresAt}))
+		require.Equal(t, appErrors.CodeSegmentAlreadyExists, appErrors.CodeOf(b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{})))
+
+		segments, err := b.segments.ReadSegments(ctx)
+		require.NoError(t, err)
+		require.Len(t, segments, 2)
+		require.Equal(t, "A", segments[0].Slug)
+		require.Equal(t, "1m30s", segments[0].TTL)
+		require.WithinDuration(t, expiresAt, *segments[0].ExpiresAt, 0)
+		require.Equal(t, "key-1", segments[0].CreatedBy)
+		require.Empty(t, segments[0].UpdatedBy)
+		require.Equal(t, domain.Segment{Slug: "B", CreatedBy: "key-1"}, segments[1])
+
+		require.Equal(t, appErrors.CodeSegmentNotFound, appErrors.CodeOf(b.segments.UpdateSegment(ctx, "C", domain.SegmentOptions{})))
+
+		noTTL := time.Duration(0)
+		require.NoError(t, b.segments.UpdateSegment(domain.ContextWithClient(ctx, domain.Client{ID: "key-2"}), "A", domain.SegmentOptions{DefaultTTL: &noTTL}))
+
+		segments, err = b.segments.ReadSegments(ctx)
+		require.NoError(t, err)
+		require.Empty(t, segments[0].TTL)
+		require.NotNil(t, segments[0].ExpiresAt)
+		require.Equal(t, "key-2", segments[0].UpdatedBy)
+
+		otherNamespace, err := b.segments.ReadSegments(domain.ContextWithNamespace(ctx, "other"))
+		require.NoError(t, err)
+		require.Empty(t, otherNamespace)
+	})
+
+	t.Run("user segments", func(t *testing.T) {
+		b := newBackend(t)
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{}))
+		require.NoError(t, b.segments.CreateSegment(ctx, "B", domain.SegmentOptions{}))
+
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "1", []string{"B", "A"}, nil))
+		requireUserSegments(t, b, "1", "B", "A")
+
+		require.Equal(t, appErrors.CodeSegmentNotFound, appErrors.CodeOf(b.users.UpdateUserSegments(ctx, "1", nil, []string{"C"})))
+		requireUserSegments(t, b, "1", "B", "A")
+
+		// the user is created, but the additions are rolled back
+		require.Equal(t, appErrors.CodeUserNotInSegment, appErrors.CodeOf(b.users.UpdateUserSegments(ctx, "2", []string{"A"}, []string{"B"})))
+		requireUserSegments(t, b, "2")
+
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "1", []string{"A"}, []string{"B"}))
+		requireUserSegments(t, b, "1", "A")
+
+		_, err := b.users.ReadUserSegments(ctx, "3")
+		require.Equal(t, appErrors.CodeUserNotFound, appErrors.CodeOf(err))
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		b := newBackend(t)
+		ttl := time.Hour
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{DefaultTTL: &ttl}))
+		require.NoError(t, b.segments.CreateSegment(ctx, "B", domain.SegmentOptions{}))
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "1", []string{"A", "B"}, nil))
+
+		deletionTimes, err := b.users.ReadDeletionTimes(ctx, "1", "")
+		require.NoError(t, err)
+		require.Len(t, deletionTimes, 1)
+		require.Equal(t, "A", deletionTimes[0].Slug)
+		require.WithinDuration(t, time.Now().Add(ttl), deletionTimes[0].DeletionTime, time.Minute)
+
+		require.Equal(t, appErrors.CodeUserNotInSegment, appErrors.CodeOf(b.users.UpdateDeletionTime(ctx, "1", "C", time.Now())))
+		require.Equal(t, appErrors.CodeTTLNotFound, appErrors.CodeOf(b.users.DeleteDeletionTime(ctx, "1", "B")))
+
+		require.NoError(t, b.users.CreateDeletionTime(ctx, "1", "B", time.Now().Add(time.Hour)))
+		require.NoError(t, b.users.DeleteDeletionTime(ctx, "1", "B"))
+
+		// a membership whose TTL has come is not active even before the scheduler removes it
+		require.NoError(t, b.users.UpdateDeletionTime(ctx, "1", "A", time.Now().Add(-time.Second)))
+		requireUserSegments(t, b, "1", "B")
+
+		processed, failed, err := b.segments.DeleteExpiredSegments(ctx, 10, make(domain.FailedRows))
+		require.NoError(t, err)
+		require.Equal(t, 1, processed)
+		require.Zero(t, failed)
+		requireUserSegments(t, b, "1", "B")
+
+		deletionTimes, err = b.users.ReadDeletionTimes(ctx, "", "")
+		require.NoError(t, err)
+		require.Empty(t, deletionTimes)
+
+		requireHistory(t, b, "1", "deletion A", domain.OperationTTLUpdate+" A", domain.OperationTTLRemoval+" B", "addition B", "addition A")
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		b := newBackend(t)
+		expiresAt := time.Now().Add(-time.Second)
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{ExpiresAt: &expiresAt}))
+		require.NoError(t, b.segments.CreateSegment(ctx, "B", domain.SegmentOptions{}))
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "1", []string{"A", "B"}, nil))
+		requireUserSegments(t, b, "1", "B")
+
+		processed, failed, err := b.segments.RetireExpiredSegments(ctx, 10, make(domain.FailedRows))
+		require.NoError(t, err)
+		require.Equal(t, 1, processed)
+		require.Zero(t, failed)
+
+		segments, err := b.segments.ReadSegments(ctx)
+		require.NoError(t, err)
+		require.Len(t, segments, 1)
+		require.Equal(t, "B", segments[0].Slug)
+
+		requireUserSegments(t, b, "1", "B")
+		requireHistory(t, b, "1", "deletion A", "addition B", "addition A")
+	})
+
+	t.Run("schedules", func(t *testing.T) {
+		b := newBackend(t)
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{}))
+		require.NoError(t, b.segments.CreateSegment(ctx, "B", domain.SegmentOptions{}))
+
+		now := time.Now().Truncate(time.Second)
+		require.Equal(t, appErrors.CodeSegmentNotFound, appErrors.CodeOf(b.users.ScheduleUserSegments(ctx, "1", []string{"A", "C"}, now, nil)))
+
+		assignments, err := b.users.ReadScheduledAssignments(ctx, "1")
+		require.NoError(t, err)
+		require.Empty(t, assignments)
+
+		endsAt := now.Add(time.Hour)
+		require.NoError(t, b.users.ScheduleUserSegments(ctx, "1", []string{"B"}, now.Add(time.Hour), nil))
+		require.NoError(t, b.users.ScheduleUserSegments(ctx, "1", []string{"A"}, now.Add(-time.Minute), nil))
+		require.NoError(t, b.users.ScheduleUserSegments(ctx, "1", []string{"A"}, now.Add(-time.Minute), &endsAt))
+
+		assignments, err = b.users.ReadScheduledAssignments(ctx, "1")
+		require.NoError(t, err)
+		require.Len(t, assignments, 2)
+		require.Equal(t, "A", assignments[0].Slug)
+		require.WithinDuration(t, endsAt, *assignments[0].EndsAt, 0)
+		require.Equal(t, "B", assignments[1].Slug)
+
+		processed, failed, err := b.users.ActivateScheduledAssignments(ctx, 10, make(domain.FailedRows))
+		require.NoError(t, err)
+		require.Equal(t, 1, processed)
+		require.Zero(t, failed)
+		requireUserSegments(t, b, "1", "A")
+
+		deletionTimes, err := b.users.ReadDeletionTimes(ctx, "1", "A")
+		require.NoError(t, err)
+		require.Len(t, deletionTimes, 1)
+		require.WithinDuration(t, endsAt, deletionTimes[0].DeletionTime, 0)
+
+		assignments, err = b.users.ReadScheduledAssignments(ctx, "1")
+		require.NoError(t, err)
+		require.Len(t, assignments, 1)
+		require.Equal(t, "B", assignments[0].Slug)
+	})
+
+	t.Run("failed rows", func(t *testing.T) {
+		b := newBackend(t)
+		namespace := domain.NamespaceFromContext(ctx)
+		expiresAt := time.Now().Add(-time.Second)
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{}))
+		require.NoError(t, b.segments.CreateSegment(ctx, "B", domain.SegmentOptions{ExpiresAt: &expiresAt}))
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "1", []string{"A"}, nil))
+		require.NoError(t, b.users.UpdateDeletionTime(ctx, "1", "A", time.Now().Add(-time.Second)))
+
+		startsAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+		require.NoError(t, b.users.ScheduleUserSegments(ctx, "2", []string{"A"}, startsAt, nil))
+
+		// the rows which failed earlier in the run are left out of the batch
+		failedRows := domain.FailedRows{
+			{Namespace: namespace, UserID: "1", Slug: "A"}:                     {},
+			{Namespace: namespace, Slug: "B"}:                                  {},
+			{Namespace: namespace, UserID: "2", Slug: "A", StartsAt: startsAt}: {},
+		}
+		for _, batch := range []func(ctx context.Context, batchSize int, failedRows domain.FailedRows) (int, int, error){
+			b.segments.DeleteExpiredSegments, b.segments.RetireExpiredSegments, b.users.ActivateScheduledAssignments,
+		} {
+			processed, failed, err := batch(ctx, 10, failedRows)
+			require.NoError(t, err)
+			require.Zero(t, processed)
+			require.Zero(t, failed)
+
+			processed, failed, err = batch(ctx, 10, make(domain.FailedRows))
+			require.NoError(t, err)
+			require.Equal(t, 1, processed)
+			require.Zero(t, failed)
+		}
+	})
+
+	t.Run("history", func(t *testing.T) {
+		b := newBackend(t)
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{}))
+		require.NoError(t, b.segments.CreateSegment(ctx, "B", domain.SegmentOptions{}))
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "1", []string{"A"}, nil))
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "1", []string{"B"}, nil))
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "1", nil, []string{"A"}))
+		requireHistory(t, b, "1", "deletion A", "addition B", "addition A")
+
+		page, err := b.reports.ReadUserSegmentsHistory(ctx, "1", time.Now().Add(-time.Hour), time.Now().Add(time.Hour), 1, 1)
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		require.Equal(t, "B", page[0].Slug)
+
+		page, err = b.reports.ReadUserSegmentsHistory(ctx, "1", time.Now().Add(-time.Hour), time.Now().Add(time.Hour), 10, 3)
+		require.NoError(t, err)
+		require.Empty(t, page)
+
+		page, err = b.reports.ReadUserSegmentsHistory(ctx, "1", time.Now().Add(time.Minute), time.Now().Add(time.Hour), 10, 0)
+		require.NoError(t, err)
+		require.Empty(t, page)
+
+		_, err = b.reports.ReadUserSegmentsHistory(ctx, "2", time.Now().Add(-time.Hour), time.Now(), 10, 0)
+		require.Equal(t, appErrors.CodeUserNotFound, appErrors.CodeOf(err))
+
+		reportName, err := b.reports.CreateCSV(ctx, "1", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		var report bytes.Buffer
+		require.NoError(t, b.reports.SendCSVReportFile(ctx, reportName, &report))
+		require.Contains(t, report.String(), "1;B;addition;")
+		require.Contains(t, report.String(), "1;A;deletion;")
+	})
+
+	t.Run("segment deletion", func(t *testing.T) {
+		b := newBackend(t)
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{}))
+		require.NoError(t, b.segments.CreateSegment(ctx, "B", domain.SegmentOptions{}))
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "1", []string{"A", "B"}, nil))
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "2", []string{"A"}, nil))
+		require.NoError(t, b.users.CreateDeletionTime(ctx, "2", "A", time.Now().Add(time.Hour)))
+
+		require.NoError(t, b.segments.DeleteSegment(ctx, "A"))
+		require.Equal(t, appErrors.CodeSegmentNotFound, appErrors.CodeOf(b.segments.DeleteSegment(ctx, "A")))
+
+		// users are updated in the background
+		require.Eventually(t, func() bool {
+			slugs, err := b.users.ReadUserSegments(ctx, "2")
+			return err == nil && len(slugs) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+		requireUserSegments(t, b, "1", "B")
+		requireHistory(t, b, "1", "deletion A", "addition B", "addition A")
+
+		deletionTimes, err := b.users.ReadDeletionTimes(ctx, "", "A")
+		require.NoError(t, err)
+		require.Empty(t, deletionTimes)
+	})
+
+	t.Run("percent rollout", func(t *testing.T) {
+		b := newBackend(t)
+		ttl := time.Hour
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{DefaultTTL: &ttl}))
+		for i := 0; i < 10; i++ {
+			require.NoError(t, b.users.UpdateUserSegments(ctx, fmt.Sprint(i), nil, nil))
+		}
+
+		require.NoError(t, b.segments.AddSegmentToPercentOfUsers(ctx, "A", 50))
+
+		require.Eventually(t, func() bool {
+			deletionTimes, err := b.users.ReadDeletionTimes(ctx, "", "A")
+			return err == nil && len(deletionTimes) == 5
+		}, 5*time.Second, 10*time.Millisecond)
+
+		enrolled := 0
+		for i := 0; i < 10; i++ {
+			slugs, err := b.users.ReadUserSegments(ctx, fmt.Sprint(i))
+			require.NoError(t, err)
+			enrolled += len(slugs)
+		}
+		require.Equal(t, 5, enrolled)
+	})
+
+	t.Run("percent rollout to members", func(t *testing.T) {
+		b := newBackend(t)
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{}))
+		for i := 0; i < 8; i++ {
+			var slugs []string
+			if i < 4 {
+				slugs = []string{"A"}
+			}
+			require.NoError(t, b.users.UpdateUserSegments(ctx, fmt.Sprint(i), slugs, nil))
+		}
+
+		require.NoError(t, b.segments.AddSegmentToPercentOfUsers(ctx, "A", 100))
+
+		// the rollout is made in one transaction, so it is over when the new members have the segment
+		require.Eventually(t, func() bool {
+			for i := 4; i < 8; i++ {
+				slugs, err := b.users.ReadUserSegments(ctx, fmt.Sprint(i))
+				if err != nil || len(slugs) == 0 {
+					return false
+				}
+			}
+			return true
+		}, 5*time.Second, 10*time.Millisecond)
+
+		// users which were already in the segment get neither a second copy of it nor a history entry
+		for i := 0; i < 8; i++ {
+			requireUserSegments(t, b, fmt.Sprint(i), "A")
+			requireHistory(t, b, fmt.Sprint(i), "addition A")
+		}
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		b := newBackend(t)
+		require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{}))
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "1", []string{"A"}, nil))
+		require.NoError(t, b.users.CreateDeletionTime(ctx, "1", "A", time.Now().Add(time.Hour)))
+
+		snapshot, err := b.evaluation.ReadSnapshot(ctx, []string{"2", "1"})
+		require.NoError(t, err)
+		require.Equal(t, []domain.EvaluationSegment{{Slug: "A"}}, snapshot.Segments)
+		require.Len(t, snapshot.Users, 1)
+		require.Equal(t, "1", snapshot.Users[0].UserID)
+		require.Len(t, snapshot.Users[0].Memberships, 1)
+		require.NotNil(t, snapshot.Users[0].Memberships[0].TTL)
+
+		var cursor domain.ChangesCursor
+		_, err = fmt.Sscanf(snapshot.Cursor, "%d.%d", &cursor.Tx, &cursor.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, b.users.UpdateUserSegments(ctx, "2", []string{"A"}, nil))
+		require.NoError(t, b.segments.CreateSegment(domain.ContextWithNamespace(ctx, "other"), "B", domain.SegmentOptions{}))
+
+		page, err := b.evaluation.ReadChanges(ctx, cursor, 100)
+		require.NoError(t, err)
+		require.False(t, page.HasMore)
+		require.Contains(t, page.Changes, domain.Change{UserID: "2"})
+		for _, change := range page.Changes {
+			require.NotEqual(t, "B", change.Slug)
+		}
+	})
+
+	t.Run("idempotency keys", func(t *testing.T) {
+		b := newBackend(t)
+		request := domain.IdempotentRequest{ClientID: "key-1", Key: "retry-1", Fingerprint: "A"}
+
+		_, reserved, err := b.idempotency.ReserveIdempotencyKey(ctx, request, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.True(t, reserved)
+
+		record, reserved, err := b.idempotency.ReserveIdempotencyKey(ctx, domain.IdempotentRequest{ClientID: "key-1", Key: "retry-1", Fingerprint: "B"}, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.False(t, reserved)
+		require.Equal(t, domain.IdempotencyRecord{Fingerprint: "A"}, record)
+
+		// keys are scoped to the client and the namespace
+		for _, other := range []struct {
+			ctx     context.Context
+			request domain.IdempotentRequest
+		}{
+			{ctx, domain.IdempotentRequest{ClientID: "key-2", Key: "retry-1", Fingerprint: "A"}},
+			{domain.ContextWithNamespace(ctx, "other"), request},
+		} {
+			_, reserved, err = b.idempotency.ReserveIdempotencyKey(other.ctx, other.request, time.Now().Add(time.Minute))
+			require.NoError(t, err)
+			require.True(t, reserved)
+		}
+
+		response := domain.IdempotentResponse{Status: 201, ContentType: "application/json", Body: []byte(`{"ok":true}`)}
+		require.NoError(t, b.idempotency.SaveIdempotentResponse(ctx, request, response, time.Now().Add(time.Hour)))
+
+		record, reserved, err = b.idempotency.ReserveIdempotencyKey(ctx, request, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.False(t, reserved)
+		require.Equal(t, domain.IdempotencyRecord{Fingerprint: "A", Response: &response}, record)
+
+		// a stored response is not released
+		require.NoError(t, b.idempotency.ReleaseIdempotencyKey(ctx, request))
+		_, reserved, err = b.idempotency.ReserveIdempotencyKey(ctx, request, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.False(t, reserved)
+
+		released := domain.IdempotentRequest{ClientID: "key-1", Key: "retry-2", Fingerprint: "A"}
+		_, _, err = b.idempotency.ReserveIdempotencyKey(ctx, released, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.NoError(t, b.idempotency.ReleaseIdempotencyKey(ctx, released))
+		_, reserved, err = b.idempotency.ReserveIdempotencyKey(ctx, released, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.True(t, reserved)
+
+		// an expired reservation of an interrupted request is taken over, its response is not saved
+		interrupted := domain.IdempotentRequest{ClientID: "key-1", Key: "retry-3", Fingerprint: "A"}
+		_, _, err = b.idempotency.ReserveIdempotencyKey(ctx, interrupted, time.Now().Add(-time.Second))
+		require.NoError(t, err)
+		takenOver := domain.IdempotentRequest{ClientID: "key-1", Key: "retry-3", Fingerprint: "B"}
+		_, reserved, err = b.idempotency.ReserveIdempotencyKey(ctx, takenOver, time.Now().Add(-time.Second))
+		require.NoError(t, err)
+		require.True(t, reserved)
+		require.NoError(t, b.idempotency.SaveIdempotentResponse(ctx, interrupted, response, time.Now().Add(time.Hour)))
+
+		// only the reservation which took over the interrupted one has expired
+		processed, failed, err := b.idempotency.PruneIdempotencyKeys(ctx, 100)
+		require.NoError(t, err)
+		require.Equal(t, 1, processed)
+		require.Zero(t, failed)
+
+		processed, _, err = b.idempotency.PruneIdempotencyKeys(ctx, 100)
+		require.NoError(t, err)
+		require.Zero(t, processed)
+	})
+
+	t.Run("api keys", func(t *testing.T) {
+		b := newBackend(t)
+		createdAt := time.Now().Truncate(time.Second)
+		require.NoError(t, b.apiKeys.CreateAPIKey(ctx, domain.APIKey{ID: "1", Name: "default", Namespace: domain.DefaultNamespace, Scopes: []string{domain.ScopeUsersRead}, CreatedAt: createdAt}, "hash-1"))
+		require.NoError(t, b.apiKeys.CreateAPIKey(ctx, domain.APIKey{ID: "2", Name: "other", Namespace: "other", Scopes: []string{domain.ScopeUsersRead}, CreatedAt: createdAt.Add(time.Second)}, "hash-2"))
+
+		// a client of one namespace manages only its keys
+		nsClient := domain.ContextWithClient(ctx, domain.Client{ID: "key-ns", Namespace: domain.DefaultNamespace})
+		keys, err := b.apiKeys.ReadAPIKeys(nsClient)
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		require.Equal(t, "1", keys[0].ID)
+		require.Equal(t, appErrors.CodeAPIKeyNotFound, appErrors.CodeOf(b.apiKeys.RevokeAPIKey(nsClient, "2")))
+
+		// a client with access to all namespaces manages keys of every namespace, whatever namespace the request selects
+		adminClient := domain.ContextWithClient(ctx, domain.Client{ID: "key-admin", Namespace: domain.AllNamespaces})
+		keys, err = b.apiKeys.ReadAPIKeys(adminClient)
+		require.NoError(t, err)
+		require.Len(t, keys, 2)
+		require.NoError(t, b.apiKeys.RevokeAPIKey(adminClient, "2"))
+
+		_, err = b.apiKeys.ReadAPIKeyByHash(ctx, "hash-2")
+		require.Equal(t, appErrors.CodeAPIKeyNotFound, appErrors.CodeOf(err))
+	})
+
+	vectors, err := evaluationvectors.Vectors()
+	require.NoError(t, err)
+
+	// the vectors are the server side of the suite the local evaluation of pkg/client is checked with
+	for _, v := range vectors {
+		v := v
+		t.Run("vector "+v.Name, func(t *testing.T) {
+			b := newBackend(t)
+
+			// the vectors are shifted to the current time, as the storages compare times with it
+			shift := time.Since(v.Now)
+			for _, segment := range v.Segments {
+				var options domain.SegmentOptions
+				if segment.ExpiresAt != nil {
+					expiresAt := segment.ExpiresAt.Add(shift)
+					options.ExpiresAt = &expiresAt
+				}
+
+				require.NoError(t, b.segments.CreateSegment(ctx, segment.Slug, options))
+			}
+
+			// memberships of deleted segments can't be created with the API, so the segments are created and dropped after it
+			deleted := deletedSegments(v)
+			for _, slug := range deleted {
+				require.NoError(t, b.segments.CreateSegment(ctx, slug, domain.SegmentOptions{}))
+			}
+
+			for _, user := range v.Users {
+				slugs := make([]string, 0, len(user.Memberships))
+				for _, membership := range user.Memberships {
+					slugs = append(slugs, membership.Slug)
+				}
+				require.NoError(t, b.users.UpdateUserSegments(ctx, user.UserID, slugs, nil))
+
+				for _, membership := range user.Memberships {
+					if membership.TTL != nil {
+						require.NoError(t, b.users.CreateDeletionTime(ctx, user.UserID, membership.Slug, membership.TTL.Add(shift)))
+					}
+				}
+			}
+
+			for _, slug := range deleted {
+				b.dropSegment(t, ctx, slug)
+			}
+
+			for _, expected := range v.Expected {
+				slugs, err := b.users.ReadUserSegments(ctx, expected.UserID)
+				if !expected.Found {
+					require.Equal(t, appErrors.CodeUserNotFound, appErrors.CodeOf(err))
+					continue
+				}
+
+				require.NoError(t, err)
+				require.Equal(t, expected.Segments, slugs)
+			}
+		})
+	}
+}
+
+// deletedSegments returns the slugs of memberships of the vector whose segments don't exist
+func deletedSegments(v evaluationvectors.Vector) []string {
+	slugs := make(map[string]bool, len(v.Segments))
+	for _, segment := range v.Segments {
+		slugs[segment.Slug] = true
+	}
+
+	deleted := make([]string, 0)
+	for _, user := range v.Users {
+		for _, membership := range user.Memberships {
+			if !slugs[membership.Slug] {
+				slugs[membership.Slug] = true
+				deleted = append(deleted, membership.Slug)
+			}
+		}
+	}
+
+	return deleted
+}
+
+func requireUserSegments(t *testing.T, b backend, userID string, slugs ...string) {
+	t.Helper()
+
+	actual, err := b.users.ReadUserSegments(context.Background(), userID)
+	require.NoError(t, err)
+	require.Equal(t, append(make([]string, 0), slugs...), actual)
+}
+
+// requireHistory checks the operations of the user, newest first, written as "operation slug"
+func requireHistory(t *testing.T, b backend, userID string, operations ...string) {
+	t.Helper()
+
+	history, err := b.reports.ReadUserSegmentsHistory(context.Background(), userID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), 100, 0)
+	require.NoError(t, err)
+
+	actual := make([]string, 0, len(history))
+	for _, historyElement := range history {
+		require.Equal(t, userID, historyElement.UserID)
+		actual = append(actual, historyElement.Operation+" "+historyElement.Slug)
+	}
+	require.Equal(t, operations, actual)
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.EvaluationRepository = (*evaluation)(nil)
+)
+
+// evaluation reads the state for local evaluation and the changes feed, which is filled by triggers
+// on slugs, users and deletion_times. Both are read from the primary, as cursors are positions among its transactions
+type evaluation struct {
+	*postgres
+	retention time.Duration
+}
+
+// NewEvaluation keeps changes for retention, cursors older than that are expired
+func NewEvaluation(pg *postgres, retention time.Duration) *evaluation {
+	return &evaluation{postgres: pg, retention: retention}
+}
+
+// ReadSnapshot returns all segments of the namespace and the users from userIDs which exist. The cursor points
+// before every transaction which was running when the snapshot was taken, so the feed may repeat some changes
+// already included into the snapshot, but it never skips one
+func (r *evaluation) ReadSnapshot(ctx context.Context, userIDs []string) (domain.EvaluationSnapshot, error) {
+	return retryResult(ctx, r.postgres, true, func(ctx context.Context) (domain.EvaluationSnapshot, error) {
+		snapshot := domain.EvaluationSnapshot{
+			Segments: make([]domain.EvaluationSegment, 0),
+			Users:    make([]domain.EvaluationUser, 0),
+		}
+
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return snapshot, err
+		}
+		defer conn.Release()
+
+		tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+		if err != nil {
+			return snapshot, err
+		}
+		defer tx.Rollback(ctx)
+
+		var cursor domain.ChangesCursor
+		err = tx.QueryRow(ctx, "SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint").Scan(&cursor.Tx)
+		if err != nil {
+			return snapshot, err
+		}
+		snapshot.Cursor = cursor.String()
+
+		namespace := domain.NamespaceFromContext(ctx)
+
+		rows, err := tx.Query(ctx, "SELECT slug, expires_at FROM slugs WHERE namespace = $1 ORDER BY slug", namespace)
+		if err != nil {
+			return snapshot, err
+		}
+
+		for rows.Next() {
+			var segment domain.EvaluationSegment
+			err = rows.Scan(&segment.Slug, &segment.ExpiresAt)
+			if err != nil {
+				rows.Close()
+				return snapshot, err
+			}
+
+			snapshot.Segments = append(snapshot.Segments, segment)
+		}
+		rows.Close()
+
+		if err = rows.Err(); err != nil || len(userIDs) == 0 {
+			return snapshot, err
+		}
+
+		rows, err = tx.Query(ctx, `SELECT u.user_id, s.slug, d.deletion_timestamp FROM users u
+			LEFT JOIN LATERAL unnest(u.slugs) WITH ORDINALITY AS s(slug, ord) ON true
+			LEFT JOIN deletion_times d ON d.namespace = u.namespace AND d.user_id = u.user_id AND d.slug = s.slug
+			WHERE u.namespace = $1 AND u.user_id = ANY($2) ORDER BY u.user_id, s.ord`, namespace, userIDs)
+		if err != nil {
+			return snapshot, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var userID string
+			var slug *string
+			var TTL *time.Time
+			err = rows.Scan(&userID, &slug, &TTL)
+			if err != nil {
+				return snapshot, err
+			}
+
+			if len(snapshot.Users) == 0 || snapshot.Users[len(snapshot.Users)-1].UserID != userID {
+				snapshot.Users = append(snapshot.Users, domain.EvaluationUser{UserID: userID, Memberships: make([]domain.EvaluationMembership, 0)})
+			}
+
+			if slug != nil {
+				user := &snapshot.Users[len(snapshot.Users)-1]
+				user.Memberships = append(user.Memberships, domain.EvaluationMembership{Slug: *slug, TTL: TTL})
+			}
+		}
+
+		return snapshot, rows.Err()
+	})
+}
+
+// ReadChanges returns changes of the namespace after the cursor, made by transactions older than every running one.
+// When there are no more changes the cursor is moved up to the running transactions, so cursors of quiet namespaces
+// don't expire
+func (r *evaluation) ReadChanges(ctx context.Context, cursor domain.ChangesCursor, limit int) (domain.ChangesPage, error) {
+	return retryResult(ctx, r.postgres, true, func(ctx context.Context) (domain.ChangesPage, error) {
+		page := domain.ChangesPage{Changes: make([]domain.Change, 0), Cursor: cursor.String()}
+
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return page, err
+		}
+		defer conn.Release()
+
+		tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+		if err != nil {
+			return page, err
+		}
+		defer tx.Rollback(ctx)
+
+		var horizon domain.ChangesCursor
+		var xmin int64
+		err = tx.QueryRow(ctx, "SELECT tx, id, pg_snapshot_xmin(pg_current_snapshot())::text::bigint FROM changes_horizon").Scan(&horizon.Tx, &horizon.ID, &xmin)
+		if err != nil {
+			return page, err
+		}
+
+		if cursor.Before(horizon) {
+			return page, appErrors.CursorExpired()
+		}
+
+		rows, err := tx.Query(ctx, `SELECT tx, id, COALESCE(user_id, ''), COALESCE(slug, '') FROM changes
+			WHERE namespace = $1 AND (tx, id) > ($2, $3) AND tx < $4 ORDER BY tx, id LIMIT $5`, domain.NamespaceFromContext(ctx), cursor.Tx, cursor.ID, xmin, limit+1)
+		if err != nil {
+			return page, err
+		}
+		defer rows.Close()
+
+		last := cursor
+		for rows.Next() {
+			var change domain.Change
+			var position domain.ChangesCursor
+			err = rows.Scan(&position.Tx, &position.ID, &change.UserID, &change.Slug)
+			if err != nil {
+				return page, err
+			}
+
+			if len(page.Changes) == limit {
+				page.HasMore = true
+				break
+			}
+
+			page.Changes = append(page.Changes, change)
+			last = position
+		}
+
+		if err = rows.Err(); err != nil {
+			return page, err
+		}
+
+		if !page.HasMore && last.Before(domain.ChangesCursor{Tx: xmin}) {
+			last = domain.ChangesCursor{Tx: xmin}
+		}
+		page.Cursor = last.String()
+
+		return page, nil
+	})
+}
+
+// PruneChanges deletes a batch of changes older than the retention and moves the horizon after them
+func (r *evaluation) PruneChanges(ctx context.Context, batchSize int) (int, int, error) {
+	return retryBatch(ctx, r.postgres, func(ctx context.Context) (int, int, error) {
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer conn.Release()
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer tx.Rollback(ctx)
+
+		var pruned int
+		var horizon *int64
+		var horizonID *int64
+		err = tx.QueryRow(ctx, `WITH pruned AS (
+			DELETE FROM changes WHERE id IN (SELECT id FROM changes WHERE changed_at < $1 ORDER BY changed_at LIMIT $2) RETURNING tx, id
+		) SELECT COUNT(*), (SELECT tx FROM pruned ORDER BY tx DESC, id DESC LIMIT 1), (SELECT id FROM pruned ORDER BY tx DESC, id DESC LIMIT 1) FROM pruned`,
+			time.Now().Add(-r.retention), batchSize).Scan(&pruned, &horizon, &horizonID)
+		if err != nil || pruned == 0 {
+			return 0, 0, err
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE changes_horizon SET tx = $1, id = $2 WHERE (tx, id) < ($1, $2)", *horizon, *horizonID)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return pruned, 0, tx.Commit(ctx)
+	})
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+)
+
+// SchemaVersion should be increased together with the version in initdb when the schema changes
+const SchemaVersion = 5
+
+type health struct {
+	*postgres
+}
+
+func NewHealth(pg *postgres) *health {
+	return &health{pg}
+}
+
+func (r *health) CheckConnection(ctx context.Context) error {
+	return r.Ping(ctx)
+}
+
+func (r *health) CheckSchemaVersion(ctx context.Context) error {
+	var version int
+	err := r.QueryRow(ctx, "SELECT version FROM schema_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	if version != SchemaVersion {
+		return fmt.Errorf("%w: expected %d, got %d", appErrors.ErrorSchemaVersionMismatch, SchemaVersion, version)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.IdempotencyRepository = (*idempotency)(nil)
+)
+
+type idempotency struct {
+	*postgres
+}
+
+func NewIdempotency(pg *postgres) *idempotency {
+	return &idempotency{pg}
+}
+
+// ReserveIdempotencyKey takes over keys which have expired, including reservations of interrupted requests
+func (r *idempotency) ReserveIdempotencyKey(ctx context.Context, request domain.IdempotentRequest, lockedUntil time.Time) (domain.IdempotencyRecord, bool, error) {
+	namespace := domain.NamespaceFromContext(ctx)
+
+	var record domain.IdempotencyRecord
+	var reserved bool
+	// a reservation made by a broken attempt would be reported as a request in progress, so it is not retried
+	err := r.retry(ctx, false, func(ctx context.Context) error {
+		now := time.Now()
+		err := r.QueryRow(ctx, `INSERT INTO idempotency_keys (namespace, client_id, key, fingerprint, expires_at) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (namespace, client_id, key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, status = NULL, content_type = NULL, body = NULL, expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= $6 RETURNING true`, namespace, request.ClientID, request.Key, request.Fingerprint, lockedUntil, now).Scan(&reserved)
+		if err != pgx.ErrNoRows {
+			return err
+		}
+
+		var status *int
+		var contentType *string
+		var body []byte
+		err = r.QueryRow(ctx, "SELECT fingerprint, status, content_type, body FROM idempotency_keys WHERE namespace = $1 AND client_id = $2 AND key = $3",
+			namespace, request.ClientID, request.Key).Scan(&record.Fingerprint, &status, &contentType, &body)
+		if err == pgx.ErrNoRows {
+			// the key expired and was pruned between the statements, it is reported as in progress, so the client retries
+			record = domain.IdempotencyRecord{Fingerprint: request.Fingerprint}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if status != nil {
+			record.Response = &domain.IdempotentResponse{Status: *status, Body: body}
+			if contentType != nil {
+				record.Response.ContentType = *contentType
+			}
+		}
+
+		return nil
+	})
+
+	return record, reserved, err
+}
+
+// SaveIdempotentResponse does nothing if the reservation of the request has been taken over
+func (r *idempotency) SaveIdempotentResponse(ctx context.Context, request domain.IdempotentRequest, response domain.IdempotentResponse, expiresAt time.Time) error {
+	return r.retry(ctx, true, func(ctx context.Context) error {
+		_, err := r.Exec(ctx, `UPDATE idempotency_keys SET status = $1, content_type = $2, body = $3, expires_at = $4
+			WHERE namespace = $5 AND client_id = $6 AND key = $7 AND fingerprint = $8 AND status IS NULL`,
+			response.Status, response.ContentType, response.Body, expiresAt, domain.NamespaceFromContext(ctx), request.ClientID, request.Key, request.Fingerprint)
+		return err
+	})
+}
+
+func (r *idempotency) ReleaseIdempotencyKey(ctx context.Context, request domain.IdempotentRequest) error {
+	return r.retry(ctx, true, func(ctx context.Context) error {
+		_, err := r.Exec(ctx, "DELETE FROM idempotency_keys WHERE namespace = $1 AND client_id = $2 AND key = $3 AND fingerprint = $4 AND status IS NULL",
+			domain.NamespaceFromContext(ctx), request.ClientID, request.Key, request.Fingerprint)
+		return err
+	})
+}
+
+// PruneIdempotencyKeys deletes a batch of expired keys of every namespace
+func (r *idempotency) PruneIdempotencyKeys(ctx context.Context, batchSize int) (int, int, error) {
+	return retryBatch(ctx, r.postgres, func(ctx context.Context) (int, int, error) {
+		deleteResult, err := r.Exec(ctx, `DELETE FROM idempotency_keys WHERE (namespace, client_id, key) IN
+			(SELECT namespace, client_id, key FROM idempotency_keys WHERE expires_at <= $1 LIMIT $2)`, time.Now(), batchSize)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return int(deleteResult.RowsAffected()), 0, nil
+	})
+}
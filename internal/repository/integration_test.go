@@ -0,0 +1,567 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+// The integration suite starts a throwaway Postgres with initdb and pg_ctl, which are looked up in PG_BIN, in PATH
+// and in /usr/lib/postgresql/*/bin. The tests are skipped when they are not installed or when they are run as root,
+// the reason is printed to stderr. CI should set SEGMENTER_INTEGRATION_REQUIRED, so the suite fails instead. Run it with
+//
+//	go test -tags integration ./internal/repository/
+
+var integration struct {
+	pool *pgxpool.Pool
+	// skip is the reason to skip the tests when Postgres can't be started
+	skip string
+}
+
+var errPostgresUnavailable = errors.New("postgres can't be started")
+
+func TestMain(m *testing.M) {
+	os.Exit(runWithPostgres(m))
+}
+
+func runWithPostgres(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "segmenter-pg")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	uri, stop, err := startPostgres(dir)
+	if errors.Is(err, errPostgresUnavailable) {
+		if os.Getenv("SEGMENTER_INTEGRATION_REQUIRED") != "" {
+			fmt.Fprintln(os.Stderr, "integration tests can't run:", err)
+			return 1
+		}
+
+		fmt.Fprintln(os.Stderr, "SKIP: integration tests are skipped:", err)
+		integration.skip = err.Error()
+		return m.Run()
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to start postgres:", err)
+		return 1
+	}
+	defer stop()
+
+	ctx := context.Background()
+	pool, err := NewPool(ctx, uri, PoolConfig{MaxConns: 20})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer pool.Close()
+
+	schema, err := os.ReadFile(filepath.Join("..", "..", "initdb", "init-db.sql"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// without arguments the script is sent with the simple protocol, which allows several statements
+	if _, err = pool.Exec(ctx, string(schema)); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to apply the schema:", err)
+		return 1
+	}
+
+	integration.pool = pool
+	return m.Run()
+}
+
+// startPostgres creates a cluster in dir and starts it on a free port, stop shuts it down without waiting for clients
+func startPostgres(dir string) (string, func(), error) {
+	initdb, pgCtl := findPostgresBinary("initdb"), findPostgresBinary("pg_ctl")
+	if initdb == "" || pgCtl == "" {
+		return "", nil, fmt.Errorf("%w: initdb and pg_ctl are not installed", errPostgresUnavailable)
+	}
+
+	if os.Geteuid() == 0 {
+		return "", nil, fmt.Errorf("%w: it refuses to run as root", errPostgresUnavailable)
+	}
+
+	data := filepath.Join(dir, "data")
+	output, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync").CombinedOutput()
+	if err != nil {
+		return "", nil, fmt.Errorf("initdb: %w: %s", err, output)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	// durability is not needed for a throwaway database, so it is turned off to speed the tests up
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off -c synchronous_commit=off -c full_page_writes=off", port, dir)
+	output, err = exec.Command(pgCtl, "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-o", options, "-w", "start").CombinedOutput()
+	if err != nil {
+		return "", nil, fmt.Errorf("pg_ctl start: %w: %s", err, output)
+	}
+
+	stop := func() {
+		_ = exec.Command(pgCtl, "-D", data, "-m", "immediate", "-w", "stop").Run()
+	}
+
+	return fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port), stop, nil
+}
+
+func findPostgresBinary(name string) string {
+	if dir := os.Getenv("PG_BIN"); dir != "" {
+		if path := filepath.Join(dir, name); isFile(path) {
+			return path
+		}
+	}
+
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+
+	// Debian and Ubuntu don't put the server binaries into PATH
+	paths, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql/*/bin", name))
+	return newestPostgresBinary(paths)
+}
+
+// newestPostgresBinary takes the binary of the newest version out of paths like /usr/lib/postgresql/9.6/bin/initdb
+func newestPostgresBinary(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+
+	paths = append([]string(nil), paths...)
+	sort.Slice(paths, func(i, j int) bool {
+		return versionLess(postgresVersion(paths[i]), postgresVersion(paths[j]))
+	})
+
+	return paths[len(paths)-1]
+}
+
+// postgresVersion parses the version from a path like /usr/lib/postgresql/9.6/bin/initdb, directories
+// which are not versions get an empty one
+func postgresVersion(path string) []int {
+	parts := strings.Split(filepath.Base(filepath.Dir(filepath.Dir(path))), ".")
+	version := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		version = append(version, n)
+	}
+
+	return version
+}
+
+// versionLess compares versions numerically, so 9.6 is older than 16
+func versionLess(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+
+	return len(a) < len(b)
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func TestNewestPostgresBinary(t *testing.T) {
+	require.Empty(t, newestPostgresBinary(nil))
+
+	paths := []string{"/usr/lib/postgresql/16/bin/initdb", "/usr/lib/postgresql/9.6/bin/initdb", "/usr/lib/postgresql/10/bin/initdb", "/usr/lib/postgresql/9.10/bin/initdb"}
+	require.Equal(t, "/usr/lib/postgresql/16/bin/initdb", newestPostgresBinary(paths))
+	require.Equal(t, "/usr/lib/postgresql/10/bin/initdb", newestPostgresBinary(paths[1:]))
+	require.Equal(t, "/usr/lib/postgresql/9.10/bin/initdb", newestPostgresBinary([]string{"/usr/lib/postgresql/9.10/bin/initdb", "/usr/lib/postgresql/9.6/bin/initdb"}))
+}
+
+// integrationBackend skips the test when Postgres is not started, the tables are truncated
+func integrationBackend(t *testing.T) (*pgxpool.Pool, backend) {
+	if integration.pool == nil {
+		t.Skip(integration.skip)
+	}
+
+	return integration.pool, postgresBackend(integration.pool)(t)
+}
+
+func TestIntegrationConformance(t *testing.T) {
+	if integration.pool == nil {
+		t.Skip(integration.skip)
+	}
+
+	runConformance(t, postgresBackend(integration.pool))
+}
+
+func TestIntegrationConcurrentUpdates(t *testing.T) {
+	pool, b := integrationBackend(t)
+	ctx := context.Background()
+
+	const segments = 20
+	slugs := make([]string, 0, segments)
+	for i := 0; i < segments; i++ {
+		slug := fmt.Sprintf("SEGMENT_%d", i)
+		require.NoError(t, b.segments.CreateSegment(ctx, slug, domain.SegmentOptions{}))
+		slugs = append(slugs, slug)
+	}
+
+	// every segment is added to a new user twice at once, the user should be created once and get every segment once
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*segments)
+	for _, slug := range slugs {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(slug string) {
+				defer wg.Done()
+				errs <- b.users.UpdateUserSegments(ctx, "1", []string{slug}, nil)
+			}(slug)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	userSlugs, err := b.users.ReadUserSegments(ctx, "1")
+	require.NoError(t, err)
+	require.ElementsMatch(t, slugs, userSlugs)
+
+	var additions int
+	require.NoError(t, pool.QueryRow(ctx, "SELECT COUNT(*) FROM users_segment_history WHERE user_id = '1' AND NOT is_deletion").Scan(&additions))
+	require.Equal(t, segments, additions)
+}
+
+func TestIntegrationConcurrentSegmentCreation(t *testing.T) {
+	_, b := integrationBackend(t)
+	ctx := context.Background()
+
+	const attempts = 10
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		require.Equal(t, appErrors.CodeSegmentAlreadyExists, appErrors.CodeOf(err))
+	}
+	require.Equal(t, 1, created)
+}
+
+// TestIntegrationConcurrentIdempotencyKeys checks that concurrent retries can't reserve a key twice, including
+// a key whose reservation has expired
+func TestIntegrationConcurrentIdempotencyKeys(t *testing.T) {
+	_, b := integrationBackend(t)
+	ctx := context.Background()
+
+	expired := domain.IdempotentRequest{ClientID: "key-1", Key: "expired", Fingerprint: "A"}
+	_, _, err := b.idempotency.ReserveIdempotencyKey(ctx, expired, time.Now().Add(-time.Second))
+	require.NoError(t, err)
+
+	for _, key := range []string{"new", "expired"} {
+		const attempts = 10
+		reservations := make(chan bool, attempts)
+		var wg sync.WaitGroup
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, reserved, err := b.idempotency.ReserveIdempotencyKey(ctx, domain.IdempotentRequest{ClientID: "key-1", Key: key, Fingerprint: "B"}, time.Now().Add(time.Minute))
+				require.NoError(t, err)
+				reservations <- reserved
+			}()
+		}
+		wg.Wait()
+		close(reservations)
+
+		reserved := 0
+		for r := range reservations {
+			if r {
+				reserved++
+			}
+		}
+		require.Equal(t, 1, reserved, key)
+	}
+}
+
+func TestIntegrationDeleteExpiredSegments(t *testing.T) {
+	pool, b := integrationBackend(t)
+	ctx := context.Background()
+
+	require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{}))
+
+	const expired = 25
+	for i := 0; i < expired; i++ {
+		userID := fmt.Sprintf("user-%02d", i)
+		require.NoError(t, b.users.UpdateUserSegments(ctx, userID, []string{"A"}, nil))
+		require.NoError(t, b.users.CreateDeletionTime(ctx, userID, "A", time.Now().Add(-time.Duration(i+1)*time.Second)))
+	}
+
+	require.NoError(t, b.users.UpdateUserSegments(ctx, "future", []string{"A"}, nil))
+	require.NoError(t, b.users.CreateDeletionTime(ctx, "future", "A", time.Now().Add(time.Hour)))
+
+	// a TTL of a membership which no longer exists is removed without a history entry
+	require.NoError(t, b.users.CreateDeletionTime(ctx, "orphan", "A", time.Now().Add(-time.Second)))
+
+	processed, failed, err := b.segments.DeleteExpiredSegments(ctx, 10, make(domain.FailedRows))
+	require.NoError(t, err)
+	require.Equal(t, 10, processed)
+	require.Zero(t, failed)
+
+	// concurrent runs skip the rows locked by each other, so every row is processed once
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	total := processed
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				processed, _, err := b.segments.DeleteExpiredSegments(ctx, 5, make(domain.FailedRows))
+				if err != nil || processed == 0 {
+					return
+				}
+
+				mu.Lock()
+				total += processed
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, expired+1, total)
+
+	deletionTimes, err := b.users.ReadDeletionTimes(ctx, "", "")
+	require.NoError(t, err)
+	require.Len(t, deletionTimes, 1)
+	require.Equal(t, "future", deletionTimes[0].UserID)
+
+	for i := 0; i < expired; i++ {
+		requireUserSegments(t, b, fmt.Sprintf("user-%02d", i))
+	}
+	requireUserSegments(t, b, "future", "A")
+
+	var deletions, users int
+	require.NoError(t, pool.QueryRow(ctx, "SELECT COUNT(*), COUNT(DISTINCT user_id) FROM users_segment_history WHERE is_deletion AND actor IS NULL").Scan(&deletions, &users))
+	require.Equal(t, expired, deletions)
+	require.Equal(t, expired, users)
+}
+
+func TestIntegrationDeleteExpiredSegmentsFailure(t *testing.T) {
+	pool, b := integrationBackend(t)
+	ctx := context.Background()
+
+	require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{}))
+	for _, userID := range []string{"1", "broken", "2"} {
+		require.NoError(t, b.users.UpdateUserSegments(ctx, userID, []string{"A"}, nil))
+		require.NoError(t, b.users.CreateDeletionTime(ctx, userID, "A", time.Now().Add(-time.Second)))
+	}
+
+	// the history of one user can't be written, so only its row of the batch should be rolled back
+	failHistory(t, pool)
+
+	failedRows := make(domain.FailedRows)
+	processed, failed, err := b.segments.DeleteExpiredSegments(ctx, 10, failedRows)
+	require.NoError(t, err)
+	require.Equal(t, 2, processed)
+	require.Equal(t, 1, failed)
+	require.Equal(t, domain.FailedRows{{Namespace: domain.NamespaceFromContext(ctx), UserID: "broken", Slug: "A"}: {}}, failedRows)
+
+	deletionTimes, err := b.users.ReadDeletionTimes(ctx, "", "")
+	require.NoError(t, err)
+	require.Len(t, deletionTimes, 1)
+	require.Equal(t, "broken", deletionTimes[0].UserID)
+
+	var slugs []string
+	require.NoError(t, pool.QueryRow(ctx, "SELECT slugs FROM users WHERE user_id = 'broken'").Scan(&slugs))
+	require.Equal(t, []string{"A"}, slugs)
+}
+
+func TestIntegrationDeleteExpiredSegmentsAfterFailedBatch(t *testing.T) {
+	pool, b := integrationBackend(t)
+	ctx := context.Background()
+
+	// the rows which fail are due first, so they fill the whole first batch
+	require.NoError(t, b.segments.CreateSegment(ctx, "A", domain.SegmentOptions{}))
+	for i, userID := range []string{"broken", "broken-2", "1", "2"} {
+		require.NoError(t, b.users.UpdateUserSegments(ctx, userID, []string{"A"}, nil))
+		require.NoError(t, b.users.CreateDeletionTime(ctx, userID, "A", time.Now().Add(-time.Duration(10-i)*time.Second)))
+	}
+
+	failHistory(t, pool)
+
+	failedRows := make(domain.FailedRows)
+	processed, failed, err := b.segments.DeleteExpiredSegments(ctx, 2, failedRows)
+	require.NoError(t, err)
+	require.Zero(t, processed)
+	require.Equal(t, 2, failed)
+
+	processed, failed, err = b.segments.DeleteExpiredSegments(ctx, 2, failedRows)
+	require.NoError(t, err)
+	require.Equal(t, 2, processed)
+	require.Zero(t, failed)
+
+	requireUserSegments(t, b, "1")
+	requireUserSegments(t, b, "2")
+
+	processed, failed, err = b.segments.DeleteExpiredSegments(ctx, 2, failedRows)
+	require.NoError(t, err)
+	require.Zero(t, processed)
+	require.Zero(t, failed)
+}
+
+// failHistory makes writes of the history of users whose IDs start with "broken" fail
+func failHistory(t *testing.T, pool *pgxpool.Pool) {
+	_, err := pool.Exec(context.Background(), `CREATE FUNCTION fail_history() RETURNS TRIGGER AS $$
+	BEGIN
+		RAISE EXCEPTION 'history of % is broken', NEW.user_id;
+	END;
+	$$ LANGUAGE plpgsql;
+	CREATE TRIGGER fail_history BEFORE INSERT ON users_segment_history FOR EACH ROW WHEN (NEW.user_id LIKE 'broken%') EXECUTE FUNCTION fail_history();`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := pool.Exec(context.Background(), "DROP TRIGGER fail_history ON users_segment_history; DROP FUNCTION fail_history();")
+		require.NoError(t, err)
+	})
+}
+
+func TestIntegrationPercentRollout(t *testing.T) {
+	pool, b := integrationBackend(t)
+	ctx := context.Background()
+
+	const users = 100
+	for i := 0; i < users; i++ {
+		require.NoError(t, b.users.UpdateUserSegments(ctx, fmt.Sprintf("user-%03d", i), nil, nil))
+	}
+
+	// the rollouts are run one by one, as concurrent ones update the same users in random order and may deadlock
+	const rollouts = 20
+	for i := 0; i < rollouts; i++ {
+		slug := fmt.Sprintf("ROLLOUT_%d", i)
+		require.NoError(t, b.segments.CreateSegment(ctx, slug, domain.SegmentOptions{}))
+		require.NoError(t, b.segments.AddSegmentToPercentOfUsers(ctx, slug, 50))
+
+		require.Eventually(t, func() bool {
+			var enrolled int
+			err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM users WHERE $1 = ANY(slugs)", slug).Scan(&enrolled)
+			return err == nil && enrolled == users/2
+		}, 10*time.Second, 10*time.Millisecond)
+	}
+
+	rows, err := pool.Query(ctx, "SELECT user_id, cardinality(slugs) FROM users ORDER BY user_id")
+	require.NoError(t, err)
+
+	counts := make([]int, 0, users)
+	for rows.Next() {
+		var userID string
+		var count int
+		require.NoError(t, rows.Scan(&userID, &count))
+		counts = append(counts, count)
+	}
+	require.NoError(t, rows.Err())
+	require.Len(t, counts, users)
+
+	// every user is enrolled into a rollout with the probability of 1/2, so a user which is never or always enrolled,
+	// or a half of users enrolled much more often than the other, means the generator is biased
+	firstHalf := 0
+	for i, count := range counts {
+		require.Greater(t, count, 0, "user %d", i)
+		require.Less(t, count, rollouts, "user %d", i)
+		if i < users/2 {
+			firstHalf += count
+		}
+	}
+	require.InDelta(t, rollouts*users/4, firstHalf, 100)
+
+	var additions int
+	require.NoError(t, pool.QueryRow(ctx, "SELECT COUNT(*) FROM users_segment_history WHERE NOT is_deletion").Scan(&additions))
+	require.Equal(t, rollouts*users/2, additions)
+}
+
+func TestIntegrationHistory(t *testing.T) {
+	pool, b := integrationBackend(t)
+	firstClient := domain.ContextWithClient(context.Background(), domain.Client{ID: "key-1"})
+	secondClient := domain.ContextWithClient(context.Background(), domain.Client{ID: "key-2"})
+
+	require.NoError(t, b.segments.CreateSegment(firstClient, "A", domain.SegmentOptions{}))
+	require.NoError(t, b.segments.CreateSegment(firstClient, "B", domain.SegmentOptions{}))
+	require.NoError(t, b.users.UpdateUserSegments(firstClient, "1", []string{"A", "B"}, nil))
+
+	// a failed update writes no history
+	require.Error(t, b.users.UpdateUserSegments(firstClient, "2", []string{"A"}, []string{"B"}))
+
+	require.NoError(t, b.segments.DeleteSegment(secondClient, "A"))
+	require.Eventually(t, func() bool {
+		slugs, err := b.users.ReadUserSegments(firstClient, "1")
+		return err == nil && len(slugs) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, b.users.UpdateDeletionTime(firstClient, "1", "B", time.Now().Add(-time.Second)))
+	_, _, err := b.segments.DeleteExpiredSegments(firstClient, 10, make(domain.FailedRows))
+	require.NoError(t, err)
+
+	type historyRow struct {
+		userID     string
+		slug       string
+		isDeletion bool
+		operation  *string
+		actor      *string
+	}
+
+	rows, err := pool.Query(firstClient, "SELECT user_id, slug, is_deletion, operation, actor FROM users_segment_history ORDER BY modified_at")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var history []historyRow
+	for rows.Next() {
+		var row historyRow
+		require.NoError(t, rows.Scan(&row.userID, &row.slug, &row.isDeletion, &row.operation, &row.actor))
+		history = append(history, row)
+	}
+	require.NoError(t, rows.Err())
+
+	firstKey, secondKey, ttlUpdate := "key-1", "key-2", domain.OperationTTLUpdate
+	require.Equal(t, []historyRow{
+		{userID: "1", slug: "A", actor: &firstKey},
+		{userID: "1", slug: "B", actor: &firstKey},
+		{userID: "1", slug: "A", isDeletion: true, actor: &secondKey},
+		{userID: "1", slug: "B", operation: &ttlUpdate, actor: &firstKey},
+		{userID: "1", slug: "B", isDeletion: true},
+	}, history)
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/metrics"
+)
+
+// memory keeps the data of every namespace in maps guarded by one mutex, so each operation is atomic like
+// a transaction of the Postgres repositories. It is meant for tests and local development, the data is lost on restart
+type memory struct {
+	mu         sync.Mutex
+	namespaces map[string]*memoryNamespace
+	apiKeys    []storedAPIKey
+	// changes is the changes feed, every change gets its own position like if it was made by its own transaction
+	changes    []storedChange
+	lastChange int64
+	horizon    domain.ChangesCursor
+	// idempotencyKeys are kept for every namespace together, as they are pruned across namespaces
+	idempotencyKeys map[idempotencyKey]*storedIdempotencyKey
+}
+
+type memoryNamespace struct {
+	name     string
+	segments map[string]*storedSegment
+	// users keep slugs in the order of assignment
+	users         map[string][]string
+	deletionTimes map[membership]time.Time
+	scheduled     []domain.ScheduledAssignment
+	history       []domain.HistoryElem
+}
+
+// storedSegment keeps the default TTL in seconds, as Postgres does
+type storedSegment struct {
+	defaultTTL *int64
+	expiresAt  *time.Time
+	createdBy  *string
+	updatedBy  *string
+}
+
+type membership struct {
+	userID string
+	slug   string
+}
+
+type storedChange struct {
+	cursor    domain.ChangesCursor
+	namespace string
+	change    domain.Change
+	changedAt time.Time
+}
+
+type storedAPIKey struct {
+	domain.APIKey
+	keyHash string
+}
+
+type idempotencyKey struct {
+	namespace string
+	clientID  string
+	key       string
+}
+
+type storedIdempotencyKey struct {
+	domain.IdempotencyRecord
+	expiresAt time.Time
+}
+
+func NewMemory() *memory {
+	return &memory{namespaces: make(map[string]*memoryNamespace), idempotencyKeys: make(map[idempotencyKey]*storedIdempotencyKey)}
+}
+
+// The methods below are called with mu locked
+
+func (m *memory) namespace(name string) *memoryNamespace {
+	n, ok := m.namespaces[name]
+	if !ok {
+		n = &memoryNamespace{
+			name:          name,
+			segments:      make(map[string]*storedSegment),
+			users:         make(map[string][]string),
+			deletionTimes: make(map[membership]time.Time),
+		}
+		m.namespaces[name] = n
+	}
+
+	return n
+}
+
+func (m *memory) recordChange(n *memoryNamespace, change domain.Change) {
+	m.lastChange++
+	m.changes = append(m.changes, storedChange{
+		cursor:    domain.ChangesCursor{Tx: m.lastChange, ID: m.lastChange},
+		namespace: n.name,
+		change:    change,
+		changedAt: time.Now(),
+	})
+}
+
+func (m *memory) setSegment(n *memoryNamespace, slug string, segment *storedSegment) {
+	n.segments[slug] = segment
+	m.recordChange(n, domain.Change{Slug: slug})
+}
+
+func (m *memory) deleteSegment(n *memoryNamespace, slug string) {
+	delete(n.segments, slug)
+	m.recordChange(n, domain.Change{Slug: slug})
+}
+
+func (m *memory) createUser(n *memoryNamespace, userID string) {
+	if _, ok := n.users[userID]; ok {
+		return
+	}
+
+	n.users[userID] = make([]string, 0)
+	m.recordChange(n, domain.Change{UserID: userID})
+}
+
+// addToUser returns false when the user already has the segment
+func (m *memory) addToUser(n *memoryNamespace, userID string, slug string) bool {
+	if hasSlug(n.users[userID], slug) {
+		return false
+	}
+
+	n.users[userID] = append(n.users[userID], slug)
+	m.recordChange(n, domain.Change{UserID: userID})
+
+	return true
+}
+
+// removeFromUser returns false when the user doesn't have the segment
+func (m *memory) removeFromUser(n *memoryNamespace, userID string, slug string) bool {
+	slugs := n.users[userID]
+	for i := range slugs {
+		if slugs[i] == slug {
+			n.users[userID] = append(slugs[:i:i], slugs[i+1:]...)
+			m.recordChange(n, domain.Change{UserID: userID})
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *memory) setDeletionTime(n *memoryNamespace, userID string, slug string, deletionTime time.Time) {
+	n.deletionTimes[membership{userID: userID, slug: slug}] = deletionTime
+	m.recordChange(n, domain.Change{UserID: userID})
+}
+
+// deleteDeletionTime returns false when the TTL is not set
+func (m *memory) deleteDeletionTime(n *memoryNamespace, userID string, slug string) bool {
+	key := membership{userID: userID, slug: slug}
+	if _, ok := n.deletionTimes[key]; !ok {
+		return false
+	}
+
+	delete(n.deletionTimes, key)
+	m.recordChange(n, domain.Change{UserID: userID})
+
+	return true
+}
+
+// applyDefaultTTL schedules deletion of a just added segment if the segment has a default TTL
+func (m *memory) applyDefaultTTL(n *memoryNamespace, userID string, slug string) {
+	segment, ok := n.segments[slug]
+	if !ok || segment.defaultTTL == nil {
+		return
+	}
+
+	m.setDeletionTime(n, userID, slug, time.Now().Add(time.Duration(*segment.defaultTTL)*time.Second))
+}
+
+// removeSegmentFromUsers removes the segment from every user which has it, writing the deletions to history
+func (m *memory) removeSegmentFromUsers(n *memoryNamespace, slug string) {
+	for _, userID := range sortedUserIDs(n) {
+		if m.removeFromUser(n, userID, slug) {
+			n.addHistory(userID, slug, "deletion")
+			metrics.DeletionFanoutUsers.Inc()
+		}
+	}
+
+	for key := range n.deletionTimes {
+		if key.slug == slug {
+			m.deleteDeletionTime(n, key.userID, key.slug)
+		}
+	}
+
+	scheduled := n.scheduled[:0]
+	for _, assignment := range n.scheduled {
+		if assignment.Slug != slug {
+			scheduled = append(scheduled, assignment)
+		}
+	}
+	n.scheduled = scheduled
+}
+
+func (n *memoryNamespace) addHistory(userID string, slug string, operation string) {
+	n.history = append(n.history, domain.HistoryElem{UserID: userID, Slug: slug, Operation: operation, DateTime: time.Now()})
+}
+
+func sortedUserIDs(n *memoryNamespace) []string {
+	userIDs := make([]string, 0, len(n.users))
+	for userID := range n.users {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+
+	return userIDs
+}
+
+func hasSlug(slugs []string, slug string) bool {
+	for _, s := range slugs {
+		if s == slug {
+			return true
+		}
+	}
+
+	return false
+}
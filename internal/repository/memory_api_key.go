@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.APIKeyRepository = (*memoryAPIKey)(nil)
+)
+
+type memoryAPIKey struct {
+	*memory
+}
+
+func NewMemoryAPIKey(m *memory) *memoryAPIKey {
+	return &memoryAPIKey{m}
+}
+
+func (r *memoryAPIKey) CreateAPIKey(ctx context.Context, key domain.APIKey, keyHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.apiKeys {
+		if stored.ID == key.ID || stored.keyHash == keyHash {
+			return appErrors.ErrorUniqueViolation
+		}
+	}
+
+	key.Scopes = append([]string(nil), key.Scopes...)
+	r.apiKeys = append(r.apiKeys, storedAPIKey{APIKey: key, keyHash: keyHash})
+
+	return nil
+}
+
+// ReadAPIKeyByHash returns only keys which are not revoked
+func (r *memoryAPIKey) ReadAPIKeyByHash(ctx context.Context, keyHash string) (domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.apiKeys {
+		if stored.keyHash == keyHash && stored.RevokedAt == nil {
+			return copyAPIKey(stored.APIKey), nil
+		}
+	}
+
+	return domain.APIKey{}, appErrors.APIKeyNotFound()
+}
+
+// ReadAPIKeys returns keys of the namespace from ctx, or all keys for a client with access to all namespaces
+func (r *memoryAPIKey) ReadAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	namespace := apiKeysNamespace(ctx)
+	keys := make([]domain.APIKey, 0)
+	for _, stored := range r.apiKeys {
+		if namespace == domain.AllNamespaces || stored.Namespace == namespace {
+			keys = append(keys, copyAPIKey(stored.APIKey))
+		}
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes a key of the namespace from ctx, or a key of any namespace for a client with access to all namespaces
+func (r *memoryAPIKey) RevokeAPIKey(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	namespace := apiKeysNamespace(ctx)
+	for i := range r.apiKeys {
+		stored := &r.apiKeys[i]
+		if stored.ID == id && (namespace == domain.AllNamespaces || stored.Namespace == namespace) && stored.RevokedAt == nil {
+			revokedAt := time.Now()
+			stored.RevokedAt = &revokedAt
+			return nil
+		}
+	}
+
+	return appErrors.APIKeyNotFound()
+}
+
+func copyAPIKey(key domain.APIKey) domain.APIKey {
+	key.Scopes = append([]string(nil), key.Scopes...)
+	return key
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.EvaluationRepository = (*memoryEvaluation)(nil)
+)
+
+// memoryEvaluation reads the feed kept by memory, where every change has its own position
+type memoryEvaluation struct {
+	*memory
+	retention time.Duration
+}
+
+// NewMemoryEvaluation keeps changes for retention, cursors older than that are expired
+func NewMemoryEvaluation(m *memory, retention time.Duration) *memoryEvaluation {
+	return &memoryEvaluation{memory: m, retention: retention}
+}
+
+// ReadSnapshot returns all segments of the namespace and the users from userIDs which exist, the cursor points
+// after the last change made before the snapshot
+func (r *memoryEvaluation) ReadSnapshot(ctx context.Context, userIDs []string) (domain.EvaluationSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := domain.EvaluationSnapshot{
+		Cursor:   domain.ChangesCursor{Tx: r.lastChange, ID: r.lastChange}.String(),
+		Segments: make([]domain.EvaluationSegment, 0),
+		Users:    make([]domain.EvaluationUser, 0),
+	}
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	for slug, segment := range n.segments {
+		snapshot.Segments = append(snapshot.Segments, domain.EvaluationSegment{Slug: slug, ExpiresAt: segment.expiresAt})
+	}
+	sort.Slice(snapshot.Segments, func(i, j int) bool { return snapshot.Segments[i].Slug < snapshot.Segments[j].Slug })
+
+	requested := make(map[string]struct{}, len(userIDs))
+	for _, userID := range userIDs {
+		requested[userID] = struct{}{}
+	}
+
+	for _, userID := range sortedUserIDs(n) {
+		if _, ok := requested[userID]; !ok {
+			continue
+		}
+
+		user := domain.EvaluationUser{UserID: userID, Memberships: make([]domain.EvaluationMembership, 0)}
+		for _, slug := range n.users[userID] {
+			evaluationMembership := domain.EvaluationMembership{Slug: slug}
+			if deletionTime, ok := n.deletionTimes[membership{userID: userID, slug: slug}]; ok {
+				evaluationMembership.TTL = &deletionTime
+			}
+
+			user.Memberships = append(user.Memberships, evaluationMembership)
+		}
+
+		snapshot.Users = append(snapshot.Users, user)
+	}
+
+	return snapshot, nil
+}
+
+// ReadChanges returns changes of the namespace after the cursor. When there are no more changes the cursor
+// is moved up to the last change, so cursors of quiet namespaces don't expire
+func (r *memoryEvaluation) ReadChanges(ctx context.Context, cursor domain.ChangesCursor, limit int) (domain.ChangesPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	page := domain.ChangesPage{Changes: make([]domain.Change, 0), Cursor: cursor.String()}
+	if cursor.Before(r.horizon) {
+		return page, appErrors.CursorExpired()
+	}
+
+	namespace := domain.NamespaceFromContext(ctx)
+	last := cursor
+	for _, change := range r.changes {
+		if change.namespace != namespace || !cursor.Before(change.cursor) {
+			continue
+		}
+
+		if len(page.Changes) == limit {
+			page.HasMore = true
+			break
+		}
+
+		page.Changes = append(page.Changes, change.change)
+		last = change.cursor
+	}
+
+	latest := domain.ChangesCursor{Tx: r.lastChange, ID: r.lastChange}
+	if !page.HasMore && last.Before(latest) {
+		last = latest
+	}
+	page.Cursor = last.String()
+
+	return page, nil
+}
+
+// PruneChanges deletes a batch of changes older than the retention and moves the horizon after them
+func (r *memoryEvaluation) PruneChanges(ctx context.Context, batchSize int) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	threshold := time.Now().Add(-r.retention)
+	pruned := 0
+	for pruned < len(r.changes) && pruned < batchSize && r.changes[pruned].changedAt.Before(threshold) {
+		pruned++
+	}
+
+	if pruned == 0 {
+		return 0, 0, nil
+	}
+
+	r.horizon = r.changes[pruned-1].cursor
+	r.changes = append(r.changes[:0:0], r.changes[pruned:]...)
+
+	return pruned, 0, nil
+}
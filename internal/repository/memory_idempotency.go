@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.IdempotencyRepository = (*memoryIdempotency)(nil)
+)
+
+type memoryIdempotency struct {
+	*memory
+}
+
+func NewMemoryIdempotency(m *memory) *memoryIdempotency {
+	return &memoryIdempotency{m}
+}
+
+func (r *memoryIdempotency) ReserveIdempotencyKey(ctx context.Context, request domain.IdempotentRequest, lockedUntil time.Time) (domain.IdempotencyRecord, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := idempotencyKey{namespace: domain.NamespaceFromContext(ctx), clientID: request.ClientID, key: request.Key}
+	if stored, ok := r.idempotencyKeys[key]; ok && stored.expiresAt.After(time.Now()) {
+		return copyIdempotencyRecord(stored.IdempotencyRecord), false, nil
+	}
+
+	r.idempotencyKeys[key] = &storedIdempotencyKey{
+		IdempotencyRecord: domain.IdempotencyRecord{Fingerprint: request.Fingerprint},
+		expiresAt:         lockedUntil,
+	}
+
+	return domain.IdempotencyRecord{}, true, nil
+}
+
+func (r *memoryIdempotency) SaveIdempotentResponse(ctx context.Context, request domain.IdempotentRequest, response domain.IdempotentResponse, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.reservation(ctx, request)
+	if !ok {
+		return nil
+	}
+
+	response.Body = bytes.Clone(response.Body)
+	stored.Response = &response
+	stored.expiresAt = expiresAt
+
+	return nil
+}
+
+func (r *memoryIdempotency) ReleaseIdempotencyKey(ctx context.Context, request domain.IdempotentRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.reservation(ctx, request); ok {
+		delete(r.idempotencyKeys, idempotencyKey{namespace: domain.NamespaceFromContext(ctx), clientID: request.ClientID, key: request.Key})
+	}
+
+	return nil
+}
+
+func (r *memoryIdempotency) PruneIdempotencyKeys(ctx context.Context, batchSize int) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	expired := make([]idempotencyKey, 0)
+	for key, stored := range r.idempotencyKeys {
+		if !stored.expiresAt.After(now) {
+			expired = append(expired, key)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		return r.idempotencyKeys[expired[i]].expiresAt.Before(r.idempotencyKeys[expired[j]].expiresAt)
+	})
+	if len(expired) > batchSize {
+		expired = expired[:batchSize]
+	}
+
+	for _, key := range expired {
+		delete(r.idempotencyKeys, key)
+	}
+
+	return len(expired), 0, nil
+}
+
+// reservation returns the stored key of the request while it has no response, as in Postgres the key is matched
+// by the fingerprint, so a reservation taken over by another request is not changed
+func (r *memoryIdempotency) reservation(ctx context.Context, request domain.IdempotentRequest) (*storedIdempotencyKey, bool) {
+	stored, ok := r.idempotencyKeys[idempotencyKey{namespace: domain.NamespaceFromContext(ctx), clientID: request.ClientID, key: request.Key}]
+	if !ok || stored.Fingerprint != request.Fingerprint || stored.Response != nil {
+		return nil, false
+	}
+
+	return stored, true
+}
+
+func copyIdempotencyRecord(record domain.IdempotencyRecord) domain.IdempotencyRecord {
+	if record.Response != nil {
+		response := *record.Response
+		response.Body = bytes.Clone(response.Body)
+		record.Response = &response
+	}
+
+	return record
+}
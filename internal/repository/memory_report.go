@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.ReportRepository = (*memoryReport)(nil)
+)
+
+type memoryReport struct {
+	*memory
+	reportFiles
+}
+
+// NewMemoryReport stores reports in subdirectories of dir, one for each namespace
+func NewMemoryReport(m *memory, dir string) *memoryReport {
+	return &memoryReport{memory: m, reportFiles: reportFiles{dir: dir}}
+}
+
+func (r *memoryReport) ReadUserSegmentsHistory(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int) ([]domain.HistoryElem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	if _, ok := n.users[userID]; !ok {
+		return nil, appErrors.UserNotFound()
+	}
+
+	var history []domain.HistoryElem
+	for i := len(n.history) - 1; i >= 0; i-- {
+		historyElement := n.history[i]
+		if historyElement.UserID == userID && !historyElement.DateTime.After(endDate) && !historyElement.DateTime.Before(startDate) {
+			history = append(history, historyElement)
+		}
+	}
+
+	sort.SliceStable(history, func(i, j int) bool { return history[i].DateTime.After(history[j].DateTime) })
+
+	if offset >= len(history) {
+		return nil, nil
+	}
+	history = history[offset:]
+
+	if len(history) > limit {
+		history = history[:limit]
+	}
+
+	return history, nil
+}
+
+func (r *memoryReport) CreateCSV(ctx context.Context, userID string, startDate, endDate time.Time) (string, error) {
+	return r.createCSV(ctx, userID, startDate, endDate, r.ReadUserSegmentsHistory)
+}
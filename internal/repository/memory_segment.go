@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/metrics"
+	backgroundtracker "github.com/PoorMercymain/user-segmenter/pkg/background-tracker"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+	uniquenumbersgenerator "github.com/PoorMercymain/user-segmenter/pkg/unique-numbers-generator"
+)
+
+var (
+	_ domain.SegmentRepository = (*memorySegment)(nil)
+)
+
+type memorySegment struct {
+	*memory
+	bg *backgroundtracker.Tracker
+}
+
+func NewMemorySegment(m *memory, bg *backgroundtracker.Tracker) *memorySegment {
+	return &memorySegment{memory: m, bg: bg}
+}
+
+func (r *memorySegment) CreateSegment(ctx context.Context, slug string, options domain.SegmentOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	if _, ok := n.segments[slug]; ok {
+		return appErrors.SegmentAlreadyExists(slug)
+	}
+
+	r.setSegment(n, slug, &storedSegment{
+		defaultTTL: defaultTTLSeconds(options.DefaultTTL),
+		expiresAt:  expiresAt(options.ExpiresAt),
+		createdBy:  domain.ActorFromContext(ctx),
+	})
+
+	return nil
+}
+
+func (r *memorySegment) UpdateSegment(ctx context.Context, slug string, options domain.SegmentOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	stored, ok := n.segments[slug]
+	if !ok {
+		return appErrors.SegmentNotFound(slug)
+	}
+
+	updated := *stored
+	if options.DefaultTTL != nil {
+		updated.defaultTTL = defaultTTLSeconds(options.DefaultTTL)
+	}
+
+	if options.ExpiresAt != nil {
+		updated.expiresAt = expiresAt(options.ExpiresAt)
+	}
+
+	updated.updatedBy = domain.ActorFromContext(ctx)
+	r.setSegment(n, slug, &updated)
+
+	return nil
+}
+
+func (r *memorySegment) DeleteSegment(ctx context.Context, slug string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	if _, ok := n.segments[slug]; !ok {
+		return appErrors.SegmentNotFound(slug)
+	}
+
+	r.deleteSegment(n, slug)
+
+	r.bg.Go(func(c context.Context) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.removeSegmentFromUsers(n, slug)
+	})
+
+	return nil
+}
+
+func (r *memorySegment) ReadSegments(ctx context.Context) ([]domain.Segment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	segments := make([]domain.Segment, 0, len(n.segments))
+	for slug, stored := range n.segments {
+		segment := domain.Segment{Slug: slug, ExpiresAt: stored.expiresAt}
+		if stored.defaultTTL != nil {
+			segment.TTL = (time.Duration(*stored.defaultTTL) * time.Second).String()
+		}
+
+		if stored.createdBy != nil {
+			segment.CreatedBy = *stored.createdBy
+		}
+
+		if stored.updatedBy != nil {
+			segment.UpdatedBy = *stored.updatedBy
+		}
+
+		segments = append(segments, segment)
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Slug < segments[j].Slug })
+
+	return segments, nil
+}
+
+func (r *memorySegment) AddSegmentToPercentOfUsers(ctx context.Context, slug string, percent int) error {
+	log := logger.FromContext(ctx)
+
+	r.mu.Lock()
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	usersAmount := len(n.users)
+	r.mu.Unlock()
+
+	r.bg.Go(func(c context.Context) {
+		choosenAmount := int((float64(usersAmount) / 100) * float64(percent))
+		randomNumbersMap, err := uniquenumbersgenerator.GenerateUniqueNonNegativeNumbers(choosenAmount, usersAmount)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		// users are chosen by their position in descending order of IDs, as in Postgres
+		userIDs := sortedUserIDs(n)
+		sort.Sort(sort.Reverse(sort.StringSlice(userIDs)))
+
+		enrolled := 0
+		for randNum := range randomNumbersMap {
+			if randNum >= len(userIDs) {
+				continue
+			}
+
+			userID := userIDs[randNum]
+			if !r.addToUser(n, userID, slug) {
+				continue
+			}
+
+			n.addHistory(userID, slug, "addition")
+			r.applyDefaultTTL(n, userID, slug)
+			enrolled++
+		}
+
+		metrics.PercentRolloutEnrolled.Add(float64(enrolled))
+	})
+
+	return nil
+}
+
+func (r *memorySegment) DeleteExpiredSegments(ctx context.Context, batchSize int, failedRows domain.FailedRows) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type expired struct {
+		namespace    *memoryNamespace
+		key          membership
+		deletionTime time.Time
+	}
+
+	now := time.Now()
+	expiredTTLs := make([]expired, 0)
+	for _, n := range r.namespaces {
+		for key, deletionTime := range n.deletionTimes {
+			if !deletionTime.After(now) && !failedRows.Has(domain.RowKey{Namespace: n.name, UserID: key.userID, Slug: key.slug}) {
+				expiredTTLs = append(expiredTTLs, expired{namespace: n, key: key, deletionTime: deletionTime})
+			}
+		}
+	}
+
+	sort.Slice(expiredTTLs, func(i, j int) bool { return expiredTTLs[i].deletionTime.Before(expiredTTLs[j].deletionTime) })
+	if len(expiredTTLs) > batchSize {
+		expiredTTLs = expiredTTLs[:batchSize]
+	}
+
+	for _, ttl := range expiredTTLs {
+		if r.removeFromUser(ttl.namespace, ttl.key.userID, ttl.key.slug) {
+			ttl.namespace.addHistory(ttl.key.userID, ttl.key.slug, "deletion")
+		}
+
+		r.deleteDeletionTime(ttl.namespace, ttl.key.userID, ttl.key.slug)
+	}
+
+	return len(expiredTTLs), 0, nil
+}
+
+func (r *memorySegment) RetireExpiredSegments(ctx context.Context, batchSize int, failedRows domain.FailedRows) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type expired struct {
+		namespace *memoryNamespace
+		slug      string
+		expiresAt time.Time
+	}
+
+	now := time.Now()
+	expiredSegments := make([]expired, 0)
+	for _, n := range r.namespaces {
+		for slug, segment := range n.segments {
+			if segment.expiresAt != nil && !segment.expiresAt.After(now) && !failedRows.Has(domain.RowKey{Namespace: n.name, Slug: slug}) {
+				expiredSegments = append(expiredSegments, expired{namespace: n, slug: slug, expiresAt: *segment.expiresAt})
+			}
+		}
+	}
+
+	sort.Slice(expiredSegments, func(i, j int) bool { return expiredSegments[i].expiresAt.Before(expiredSegments[j].expiresAt) })
+	if len(expiredSegments) > batchSize {
+		expiredSegments = expiredSegments[:batchSize]
+	}
+
+	for _, segment := range expiredSegments {
+		r.deleteSegment(segment.namespace, segment.slug)
+		r.removeSegmentFromUsers(segment.namespace, segment.slug)
+	}
+
+	return len(expiredSegments), 0, nil
+}
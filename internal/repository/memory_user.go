@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.UserRepository = (*memoryUser)(nil)
+)
+
+type memoryUser struct {
+	*memory
+}
+
+func NewMemoryUser(m *memory) *memoryUser {
+	return &memoryUser{m}
+}
+
+func (r *memoryUser) UpdateUserSegments(ctx context.Context, userID string, slugsToAdd []string, slugsToDelete []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	for _, slugs := range [][]string{slugsToAdd, slugsToDelete} {
+		for _, slug := range slugs {
+			if _, ok := n.segments[slug]; !ok {
+				return appErrors.SegmentNotFound(slug)
+			}
+		}
+	}
+
+	// as in Postgres, the user is created even if the update fails later
+	r.createUser(n, userID)
+
+	// deletions are checked against the segments the user will have after the additions,
+	// so nothing is changed when the user is not in a segment to delete
+	for _, slug := range slugsToDelete {
+		if !hasSlug(n.users[userID], slug) && !hasSlug(slugsToAdd, slug) {
+			return appErrors.UserNotInSegment(slug)
+		}
+	}
+
+	for _, slug := range slugsToAdd {
+		if r.addToUser(n, userID, slug) {
+			n.addHistory(userID, slug, "addition")
+			r.applyDefaultTTL(n, userID, slug)
+		}
+	}
+
+	for _, slug := range slugsToDelete {
+		if r.removeFromUser(n, userID, slug) {
+			n.addHistory(userID, slug, "deletion")
+		}
+
+		r.deleteDeletionTime(n, userID, slug)
+	}
+
+	return nil
+}
+
+func (r *memoryUser) ReadUserSegments(ctx context.Context, userID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	slugs, ok := n.users[userID]
+	if !ok {
+		return nil, appErrors.UserNotFound()
+	}
+
+	// segments, which have already expired but were not processed by the scheduler yet, are not active
+	now := time.Now()
+	active := make([]string, 0, len(slugs))
+	for _, slug := range slugs {
+		if deletionTime, ok := n.deletionTimes[membership{userID: userID, slug: slug}]; ok && !deletionTime.After(now) {
+			continue
+		}
+
+		if segment, ok := n.segments[slug]; ok && segment.expiresAt != nil && !segment.expiresAt.After(now) {
+			continue
+		}
+
+		active = append(active, slug)
+	}
+
+	return active, nil
+}
+
+func (r *memoryUser) CreateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.setDeletionTime(r.namespace(domain.NamespaceFromContext(ctx)), userID, slug, deletionTime)
+
+	return nil
+}
+
+func (r *memoryUser) ReadDeletionTimes(ctx context.Context, userID string, slug string) ([]domain.DeletionTime, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	deletionTimes := make([]domain.DeletionTime, 0)
+	for key, deletionTime := range n.deletionTimes {
+		if (userID == "" || key.userID == userID) && (slug == "" || key.slug == slug) {
+			deletionTimes = append(deletionTimes, domain.DeletionTime{UserID: key.userID, Slug: key.slug, DeletionTime: deletionTime})
+		}
+	}
+
+	sort.Slice(deletionTimes, func(i, j int) bool {
+		return deletionTimes[i].DeletionTime.Before(deletionTimes[j].DeletionTime)
+	})
+
+	return deletionTimes, nil
+}
+
+func (r *memoryUser) UpdateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	if !hasSlug(n.users[userID], slug) {
+		return appErrors.UserNotInSegment(slug)
+	}
+
+	r.setDeletionTime(n, userID, slug, deletionTime)
+	n.addHistory(userID, slug, domain.OperationTTLUpdate)
+
+	return nil
+}
+
+func (r *memoryUser) DeleteDeletionTime(ctx context.Context, userID string, slug string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	if !r.deleteDeletionTime(n, userID, slug) {
+		return appErrors.TTLNotFound(slug)
+	}
+
+	n.addHistory(userID, slug, domain.OperationTTLRemoval)
+
+	return nil
+}
+
+func (r *memoryUser) ScheduleUserSegments(ctx context.Context, userID string, slugs []string, startsAt time.Time, endsAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	for _, slug := range slugs {
+		if _, ok := n.segments[slug]; !ok {
+			return appErrors.SegmentNotFound(slug)
+		}
+	}
+
+	for _, slug := range slugs {
+		assignment := domain.ScheduledAssignment{UserID: userID, Slug: slug, StartsAt: startsAt, EndsAt: endsAt}
+
+		scheduled := false
+		for i := range n.scheduled {
+			if n.scheduled[i].UserID == userID && n.scheduled[i].Slug == slug && n.scheduled[i].StartsAt.Equal(startsAt) {
+				n.scheduled[i].EndsAt = endsAt
+				scheduled = true
+				break
+			}
+		}
+
+		if !scheduled {
+			n.scheduled = append(n.scheduled, assignment)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryUser) ReadScheduledAssignments(ctx context.Context, userID string) ([]domain.ScheduledAssignment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.namespace(domain.NamespaceFromContext(ctx))
+	assignments := make([]domain.ScheduledAssignment, 0)
+	for _, assignment := range n.scheduled {
+		if assignment.UserID == userID {
+			assignments = append(assignments, assignment)
+		}
+	}
+
+	sort.SliceStable(assignments, func(i, j int) bool { return assignments[i].StartsAt.Before(assignments[j].StartsAt) })
+
+	return assignments, nil
+}
+
+func (r *memoryUser) ActivateScheduledAssignments(ctx context.Context, batchSize int, failedRows domain.FailedRows) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type dueAssignment struct {
+		namespace *memoryNamespace
+		domain.ScheduledAssignment
+	}
+
+	now := time.Now()
+	due := make([]dueAssignment, 0)
+	for _, n := range r.namespaces {
+		scheduled := n.scheduled[:0]
+		for _, assignment := range n.scheduled {
+			if !assignment.StartsAt.After(now) && !failedRows.Has(domain.RowKey{Namespace: n.name, UserID: assignment.UserID, Slug: assignment.Slug, StartsAt: assignment.StartsAt}) {
+				due = append(due, dueAssignment{namespace: n, ScheduledAssignment: assignment})
+				continue
+			}
+			scheduled = append(scheduled, assignment)
+		}
+		n.scheduled = scheduled
+	}
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].StartsAt.Before(due[j].StartsAt) })
+
+	// the assignments which don't fit the batch are scheduled again, to be activated by the next run
+	if len(due) > batchSize {
+		for _, assignment := range due[batchSize:] {
+			assignment.namespace.scheduled = append(assignment.namespace.scheduled, assignment.ScheduledAssignment)
+		}
+		due = due[:batchSize]
+	}
+
+	for _, assignment := range due {
+		r.activateScheduledAssignment(assignment.namespace, assignment.ScheduledAssignment)
+	}
+
+	return len(due), 0, nil
+}
+
+// activateScheduledAssignment drops assignments whose window has already ended or whose segment no longer exists
+func (r *memoryUser) activateScheduledAssignment(n *memoryNamespace, assignment domain.ScheduledAssignment) {
+	if _, ok := n.segments[assignment.Slug]; !ok || (assignment.EndsAt != nil && !assignment.EndsAt.After(time.Now())) {
+		return
+	}
+
+	r.createUser(n, assignment.UserID)
+
+	added := r.addToUser(n, assignment.UserID, assignment.Slug)
+	if added {
+		n.addHistory(assignment.UserID, assignment.Slug, "addition")
+	}
+
+	if assignment.EndsAt != nil {
+		r.setDeletionTime(n, assignment.UserID, assignment.Slug, *assignment.EndsAt)
+	} else if added {
+		r.applyDefaultTTL(n, assignment.UserID, assignment.Slug)
+	}
+}
@@ -2,42 +2,124 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"time"
 
+	"github.com/exaring/otelpgx"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
 
 	"github.com/PoorMercymain/user-segmenter/pkg/logger"
 )
 
+var tracer = otel.Tracer("github.com/PoorMercymain/user-segmenter/internal/repository")
+
+// maxConnectBackoff limits the delay between attempts to connect on startup
+const maxConnectBackoff = 10 * time.Second
+
+// postgres sends writes and reads which have to be up to date to the primary pool, other reads go to replicas
 type postgres struct {
 	*pgxpool.Pool
+	replicas *Replicas
+	retries  RetryConfig
+}
+
+// NewPostgres uses replicas for reads when they are set, nil replicas send every read to the primary
+func NewPostgres(pool *pgxpool.Pool, replicas *Replicas, retries RetryConfig) *postgres {
+	return &postgres{Pool: pool, replicas: replicas, retries: retries}
 }
 
-func NewPostgres(pool *pgxpool.Pool) *postgres {
-	return &postgres{pool}
+// PoolConfig sets up the pool of connections, the defaults of pgxpool and of the server are used for zero values
+type PoolConfig struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	// ConnectTimeout limits establishing of a single connection
+	ConnectTimeout time.Duration
+	// StatementTimeout is set as statement_timeout of every connection
+	StatementTimeout time.Duration
+	// ConnectAttempts is the amount of attempts to reach the database on startup, the delay between them
+	// starts with ConnectBackoff and is doubled every time
+	ConnectAttempts int
+	ConnectBackoff  time.Duration
 }
 
-func ConnectToPostgres(DSN string) (*pgxpool.Pool, error) {
-	log, err := logger.GetLogger()
+// ConnectToPostgres creates the pool and waits for the database to become available, e.g. while it is starting
+// next to the service. Errors which can't be fixed by waiting, like a wrong password, are returned at once
+func ConnectToPostgres(ctx context.Context, DSN string, poolConfig PoolConfig) (*pgxpool.Pool, error) {
+	pool, err := NewPool(ctx, DSN, poolConfig)
 	if err != nil {
 		return nil, err
 	}
 
+	for attempt := 1; ; attempt++ {
+		err = pool.Ping(ctx)
+		if err == nil {
+			return pool, nil
+		}
+
+		if attempt >= poolConfig.ConnectAttempts || ctx.Err() != nil || !canWaitFor(err) {
+			pool.Close()
+			return nil, err
+		}
+
+		delay := backoff(poolConfig.ConnectBackoff, attempt, maxConnectBackoff)
+		logger.FromContext(ctx).Warnln("failed to connect to postgres, attempt", attempt, "of", poolConfig.ConnectAttempts, "retrying in", delay.Round(time.Millisecond), "error:", err)
+
+		if !sleep(ctx, delay) {
+			pool.Close()
+			return nil, err
+		}
+	}
+}
+
+// NewPool creates the pool without waiting for the database, e.g. for a replica which may become available later
+func NewPool(ctx context.Context, DSN string, poolConfig PoolConfig) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(DSN)
 	if err != nil {
-		log.Infoln(err)
 		return nil, err
 	}
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), config)
-	if err != nil {
-		log.Infoln(err)
-		return nil, err
+	if poolConfig.MaxConns > 0 {
+		config.MaxConns = poolConfig.MaxConns
 	}
 
-	err = pool.Ping(context.Background())
-	if err != nil {
-		return nil, err
+	if poolConfig.MinConns > 0 {
+		config.MinConns = poolConfig.MinConns
+	}
+
+	if poolConfig.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = poolConfig.MaxConnLifetime
+	}
+
+	if poolConfig.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = poolConfig.MaxConnIdleTime
+	}
+
+	if poolConfig.ConnectTimeout > 0 {
+		config.ConnConfig.ConnectTimeout = poolConfig.ConnectTimeout
+	}
+
+	if poolConfig.StatementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(poolConfig.StatementTimeout.Milliseconds(), 10)
+	}
+
+	config.ConnConfig.Tracer = otelpgx.NewTracer(otelpgx.WithTrimSQLInSpanName())
+
+	return pgxpool.NewWithConfig(ctx, config)
+}
+
+// canWaitFor reports whether the database may become available later. Errors returned by the server
+// other than the ones about connections mean that the settings are wrong
+func canWaitFor(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgerrcode.IsConnectionException(pgErr.Code) || pgErr.Code == pgerrcode.CannotConnectNow
 	}
 
-	return pool, nil
+	return true
 }
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/metrics"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+)
+
+// states of a replica, a replica is not used until its first health check passes
+const (
+	replicaUnknown int32 = iota
+	replicaHealthy
+	replicaUnhealthy
+)
+
+// replicaCheckTimeout limits a health check of a single replica
+const replicaCheckTimeout = 5 * time.Second
+
+// Replicas route reads which may be slightly stale to healthy read replicas in turn. A replica is healthy while it
+// answers health checks and, when the max lag is set, replays the changes of the primary in time
+type Replicas struct {
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+}
+
+type replica struct {
+	*pgxpool.Pool
+	// name is the address of the replica, it is used in logs and metrics
+	name  string
+	state atomic.Int32
+}
+
+// NewReplicas uses the pools of the replicas, a max lag of 0 disables the lag check
+func NewReplicas(pools []*pgxpool.Pool, maxLag time.Duration) *Replicas {
+	r := &Replicas{maxLag: maxLag}
+	for _, pool := range pools {
+		config := pool.Config().ConnConfig
+		r.replicas = append(r.replicas, &replica{Pool: pool, name: net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port)))})
+	}
+
+	return r
+}
+
+// Watch checks the replicas at once and then every interval until ctx is done
+func (r *Replicas) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, rep := range r.replicas {
+			checkCtx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+			err := r.check(checkCtx, rep)
+			cancel()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			rep.setHealthy(ctx, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check returns why the replica should not be used. The lag is 0 when the replica has replayed everything
+// it received, so a primary without writes doesn't make the replica look stale
+func (r *Replicas) check(ctx context.Context, rep *replica) error {
+	var lag float64
+	err := rep.QueryRow(ctx, `SELECT CASE WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END`).Scan(&lag)
+	if err != nil {
+		return err
+	}
+
+	if r.maxLag > 0 && lag > r.maxLag.Seconds() {
+		return fmt.Errorf("%w: %s", appErrors.ErrorReplicaLagging, time.Duration(lag*float64(time.Second)).Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+// pick returns the next healthy replica, or nil when there is none
+func (r *Replicas) pick() *replica {
+	if r == nil || len(r.replicas) == 0 {
+		return nil
+	}
+
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		rep := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if rep.state.Load() == replicaHealthy {
+			return rep
+		}
+	}
+
+	return nil
+}
+
+// setHealthy marks the replica healthy when err is nil, changes of the state are logged
+func (rep *replica) setHealthy(ctx context.Context, err error) {
+	state, healthy := replicaHealthy, 1.0
+	if err != nil {
+		state, healthy = replicaUnhealthy, 0
+	}
+	metrics.DBReplicaHealthy.WithLabelValues(rep.name).Set(healthy)
+
+	if rep.state.Swap(state) == state {
+		return
+	}
+
+	if err != nil {
+		logger.FromContext(ctx).Warnln("read replica", rep.name, "is unhealthy, reads are sent to other replicas or to the primary:", err)
+		return
+	}
+
+	logger.FromContext(ctx).Infoln("read replica", rep.name, "is healthy")
+}
+
+// readResult is retryResult for reads which may be slightly stale. They are sent to a healthy replica unless
+// the request asked for strong consistency. When the connection to the replica fails, the replica is marked
+// unhealthy and the read is made on the primary
+func readResult[T any](ctx context.Context, pg *postgres, op func(ctx context.Context, db *pgxpool.Pool) (T, error)) (T, error) {
+	return retryResult(ctx, pg, true, func(ctx context.Context) (T, error) {
+		if domain.ReadConsistencyFromContext(ctx) == domain.ReadConsistencyEventual {
+			if rep := pg.replicas.pick(); rep != nil {
+				result, err := op(ctx, rep.Pool)
+				if err == nil || ctx.Err() != nil || transientReason(err, true) != retryConnection {
+					metrics.DBReads.WithLabelValues("replica").Inc()
+					return result, err
+				}
+
+				rep.setHealthy(ctx, err)
+			}
+		}
+
+		metrics.DBReads.WithLabelValues("primary").Inc()
+		return op(ctx, pg.Pool)
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	appErrors "github.com/PoorMercymain/user-segmenter/errors"
 	"github.com/PoorMercymain/user-segmenter/internal/domain"
@@ -23,63 +24,97 @@ var (
 
 type report struct {
 	*postgres
+	reportFiles
 }
 
-func NewReport(pg *postgres) *report {
-	return &report{pg}
+// NewReport stores reports in subdirectories of dir, one for each namespace
+func NewReport(pg *postgres, dir string) *report {
+	return &report{postgres: pg, reportFiles: reportFiles{dir: dir}}
 }
 
 func (r *report) ReadUserSegmentsHistory(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int) ([]domain.HistoryElem, error) {
-	conn, err := r.Acquire(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Release()
-
-	var history []domain.HistoryElem
+	return readResult(ctx, r.postgres, func(ctx context.Context, db *pgxpool.Pool) ([]domain.HistoryElem, error) {
+		conn, err := db.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Release()
 
-	var str string
+		var history []domain.HistoryElem
 
-	err = conn.QueryRow(ctx, "SELECT user_id FROM users WHERE user_id = $1", userID).Scan(&str)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, appErrors.ErrorNoRows
-		}
-		return nil, err
-	}
+		namespace := domain.NamespaceFromContext(ctx)
 
-	rows, err := conn.Query(ctx, "SELECT * FROM users_segment_history WHERE user_id = $1 AND modified_at <= $2 AND modified_at >= $3 ORDER BY modified_at DESC LIMIT $4 OFFSET $5", userID, endDate, startDate, limit, offset)
-	if err != nil {
-		return nil, err
-	}
+		var str string
 
-	for rows.Next() {
-		var historyElement domain.HistoryElem
-		var isDeletion bool
-		err = rows.Scan(&historyElement.UserID, &historyElement.Slug, &historyElement.DateTime, &isDeletion)
+		err = conn.QueryRow(ctx, "SELECT user_id FROM users WHERE namespace = $1 AND user_id = $2", namespace, userID).Scan(&str)
 		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, appErrors.UserNotFound()
+			}
 			return nil, err
 		}
 
-		historyElement.Operation = "addition"
-		if isDeletion {
-			historyElement.Operation = "deletion"
+		rows, err := conn.Query(ctx, "SELECT user_id, slug, modified_at, is_deletion, operation FROM users_segment_history WHERE namespace = $1 AND user_id = $2 AND modified_at <= $3 AND modified_at >= $4 ORDER BY modified_at DESC LIMIT $5 OFFSET $6", namespace, userID, endDate, startDate, limit, offset)
+		if err != nil {
+			return nil, err
 		}
 
-		history = append(history, historyElement)
-	}
+		for rows.Next() {
+			var historyElement domain.HistoryElem
+			var isDeletion bool
+			var operation *string
+			err = rows.Scan(&historyElement.UserID, &historyElement.Slug, &historyElement.DateTime, &isDeletion, &operation)
+			if err != nil {
+				return nil, err
+			}
+
+			historyElement.Operation = "addition"
+			if isDeletion {
+				historyElement.Operation = "deletion"
+			}
 
-	return history, nil
+			if operation != nil {
+				historyElement.Operation = *operation
+			}
+
+			history = append(history, historyElement)
+		}
+
+		return history, nil
+	})
 }
 
+// CreateCSV reads every page of the report from the primary. Replicas lag behind by different amounts,
+// so pages read from different ones could miss or repeat rows
 func (r *report) CreateCSV(ctx context.Context, userID string, startDate, endDate time.Time) (string, error) {
+	ctx = domain.ContextWithReadConsistency(ctx, domain.ReadConsistencyStrong)
+	return r.createCSV(ctx, userID, startDate, endDate, r.ReadUserSegmentsHistory)
+}
+
+// reportFiles keeps csv reports in subdirectories of dir, one for each namespace. It is shared by the storages,
+// which differ only in the way history is read
+type reportFiles struct {
+	dir string
+}
+
+type historyReader func(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int) ([]domain.HistoryElem, error)
+
+// createCSV writes the report to the directory of the namespace and returns the report name
+func (r *reportFiles) createCSV(ctx context.Context, userID string, startDate, endDate time.Time, readHistory historyReader) (string, error) {
 	filenamePattern := fmt.Sprintf("report*%d.csv", time.Now().UnixNano())
 
-	log, _ := logger.GetLogger()
+	log := logger.FromContext(ctx)
+
+	dir := r.reportsDir(ctx)
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		log.Errorln(err)
+		return "", err
+	}
 
-	f, err := os.CreateTemp("reports", filenamePattern)
+	f, err := os.CreateTemp(dir, filenamePattern)
 	if err != nil {
-		log.Infoln(err)
+		log.Errorln(err)
 		return "", err
 	}
 	defer f.Close()
@@ -88,7 +123,7 @@ func (r *report) CreateCSV(ctx context.Context, userID string, startDate, endDat
 	w.Comma = ';'
 
 	for i := 0; ; i++ {
-		history, err := r.ReadUserSegmentsHistory(ctx, userID, startDate, endDate, 15, 15*i)
+		history, err := readHistory(ctx, userID, startDate, endDate, 15, 15*i)
 		if err != nil {
 			return "", err
 		}
@@ -97,7 +132,7 @@ func (r *report) CreateCSV(ctx context.Context, userID string, startDate, endDat
 			break
 		}
 
-		log.Infoln(len(history))
+		log.Debugln(len(history))
 
 		for _, historyElement := range history {
 			historyElementStrSlice := []string{historyElement.UserID, historyElement.Slug, historyElement.Operation, historyElement.DateTime.Format(time.RFC3339)}
@@ -107,10 +142,10 @@ func (r *report) CreateCSV(ctx context.Context, userID string, startDate, endDat
 		}
 		w.Flush()
 	}
-	return f.Name(), nil
+	return filepath.Base(f.Name()), nil
 }
 
-func (r *report) SendCSVReportFile(reportName string, writer io.Writer) error {
+func (r *reportFiles) SendCSVReportFile(ctx context.Context, reportName string, writer io.Writer) error {
 	pattern := `^report\d+\.csv$`
 
 	re := regexp.MustCompile(pattern)
@@ -118,7 +153,7 @@ func (r *report) SendCSVReportFile(reportName string, writer io.Writer) error {
 	if !re.MatchString(reportName) {
 		return appErrors.ErrorBadFilename
 	}
-	pathToReport := filepath.Join("reports", reportName)
+	pathToReport := filepath.Join(r.reportsDir(ctx), reportName)
 
 	_, err := os.Stat(pathToReport)
 	if err != nil {
@@ -147,3 +182,29 @@ func (r *report) SendCSVReportFile(reportName string, writer io.Writer) error {
 
 	return nil
 }
+
+// CheckStorage checks that a report file can be created in the reports directory. The directory is created
+// if it does not exist yet, as createCSV does, so a fresh instance is not reported as unhealthy
+func (r *reportFiles) CheckStorage(ctx context.Context) error {
+	err := os.MkdirAll(r.dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(r.dir, "healthcheck*")
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(f.Name())
+}
+
+// reportsDir keeps reports of namespaces apart, so a report can be read only in its namespace
+func (r *reportFiles) reportsDir(ctx context.Context) string {
+	return filepath.Join(r.dir, domain.NamespaceFromContext(ctx))
+}
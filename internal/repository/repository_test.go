@@ -1,21 +1,168 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
 )
 
 func TestNewSegment(t *testing.T) {
-	seg := NewSegment(nil)
+	seg := NewSegment(nil, nil)
 	require.Empty(t, seg)
 
 	usr := NewUser(nil)
 	require.Empty(t, usr)
 
-	rep := NewReport(nil)
+	rep := NewReport(nil, "")
 	require.Empty(t, rep)
 
-	pg := NewPostgres(nil)
+	health := NewHealth(nil)
+	require.Empty(t, health)
+
+	key := NewAPIKey(nil)
+	require.Empty(t, key)
+
+	pg := NewPostgres(nil, nil, RetryConfig{})
 	require.Empty(t, pg)
 }
+
+func TestTransientReason(t *testing.T) {
+	serializationFailure := fmt.Errorf("commit: %w", &pgconn.PgError{Code: pgerrcode.SerializationFailure})
+	require.Equal(t, retrySerializationFailure, transientReason(serializationFailure, false))
+	require.Equal(t, retryDeadlock, transientReason(&pgconn.PgError{Code: pgerrcode.DeadlockDetected}, false))
+	require.Equal(t, retryConnection, transientReason(&pgconn.PgError{Code: pgerrcode.AdminShutdown}, false))
+	require.Empty(t, transientReason(&pgconn.PgError{Code: pgerrcode.UniqueViolation}, true))
+
+	// the transaction may have been committed before the connection was reset
+	reset := fmt.Errorf("read: %w", syscall.ECONNRESET)
+	require.Empty(t, transientReason(reset, false))
+	require.Equal(t, retryConnection, transientReason(reset, true))
+	require.Equal(t, retryConnection, transientReason(io.ErrUnexpectedEOF, true))
+
+	require.Empty(t, transientReason(appErrors.ErrorNoRows, true))
+}
+
+func TestRetry(t *testing.T) {
+	pg := NewPostgres(nil, nil, RetryConfig{Attempts: 3, Backoff: time.Millisecond})
+
+	attempts := 0
+	err := pg.retry(context.Background(), false, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = pg.retry(context.Background(), true, func(ctx context.Context) error {
+		attempts++
+		return io.ErrUnexpectedEOF
+	})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	_, err = retryResult(context.Background(), pg, true, func(ctx context.Context) (int, error) {
+		attempts++
+		return 0, appErrors.ErrorNoRows
+	})
+	require.ErrorIs(t, err, appErrors.ErrorNoRows)
+	require.Equal(t, 1, attempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	err = pg.retry(ctx, true, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return errors.Join(context.Canceled, io.EOF)
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, attempts)
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 10; attempt++ {
+		d := backoff(100*time.Millisecond, attempt, time.Second)
+		require.LessOrEqual(t, d, time.Second)
+		require.GreaterOrEqual(t, d, 50*time.Millisecond)
+	}
+
+	require.GreaterOrEqual(t, backoff(100*time.Millisecond, 3, time.Second), 200*time.Millisecond)
+	require.Zero(t, backoff(0, 3, time.Second))
+}
+
+func TestCanWaitFor(t *testing.T) {
+	require.True(t, canWaitFor(fmt.Errorf("dial: %w", syscall.ECONNREFUSED)))
+	require.True(t, canWaitFor(&pgconn.PgError{Code: pgerrcode.CannotConnectNow}))
+	require.False(t, canWaitFor(&pgconn.PgError{Code: pgerrcode.InvalidPassword}))
+}
+
+func TestReadResult(t *testing.T) {
+	primary, first, second := new(pgxpool.Pool), new(pgxpool.Pool), new(pgxpool.Pool)
+	replicas := &Replicas{replicas: []*replica{{Pool: first, name: "first"}, {Pool: second, name: "second"}}}
+	pg := NewPostgres(primary, replicas, RetryConfig{Attempts: 1})
+
+	read := func(ctx context.Context, fail *pgxpool.Pool) *pgxpool.Pool {
+		db, err := readResult(ctx, pg, func(ctx context.Context, db *pgxpool.Pool) (*pgxpool.Pool, error) {
+			if db == fail {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return db, nil
+		})
+		require.NoError(t, err)
+		return db
+	}
+
+	// replicas are not used until they pass a health check
+	ctx := context.Background()
+	require.Equal(t, primary, read(ctx, nil))
+
+	replicas.replicas[0].setHealthy(ctx, nil)
+	replicas.replicas[1].setHealthy(ctx, nil)
+	require.ElementsMatch(t, []*pgxpool.Pool{first, second}, []*pgxpool.Pool{read(ctx, nil), read(ctx, nil)})
+	require.Equal(t, primary, read(domain.ContextWithReadConsistency(ctx, domain.ReadConsistencyStrong), nil))
+
+	// a replica with a broken connection is not used anymore, the read falls back to the primary
+	db := read(ctx, first)
+	if db == second {
+		db = read(ctx, first)
+	}
+	require.Equal(t, primary, db)
+	require.Equal(t, second, read(ctx, nil))
+	require.Equal(t, second, read(ctx, nil))
+
+	replicas.replicas[1].setHealthy(ctx, appErrors.ErrorReplicaLagging)
+	require.Equal(t, primary, read(ctx, nil))
+}
+
+func TestCheckStorage(t *testing.T) {
+	// the directory is created by the first report, the health check may run before it
+	dir := filepath.Join(t.TempDir(), "reports")
+	rep := NewMemoryReport(NewMemory(), dir)
+	require.NoError(t, rep.CheckStorage(context.Background()))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	require.Error(t, NewMemoryReport(NewMemory(), file).CheckStorage(context.Background()))
+}
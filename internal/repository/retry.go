@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/PoorMercymain/user-segmenter/internal/metrics"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+)
+
+// reasons of retries, they are used as labels of the retries metric
+const (
+	retrySerializationFailure = "serialization_failure"
+	retryDeadlock             = "deadlock"
+	retryConnection           = "connection"
+)
+
+// maxRetryBackoff limits the delay between retries of an operation, they are made while a request waits
+const maxRetryBackoff = time.Second
+
+// RetryConfig sets how operations failed with transient errors are repeated
+type RetryConfig struct {
+	// Attempts is the max amount of attempts of an operation, 1 or less disables retries
+	Attempts int
+	// Backoff is the delay before the first retry, it is doubled for every next one
+	Backoff time.Duration
+}
+
+// retry runs op until it succeeds, fails with an error which is not transient or runs out of attempts.
+// op should do all of its work in one transaction, so a failed attempt leaves nothing behind. When a connection
+// breaks after a statement was sent, the transaction may have been committed, so such errors are retried
+// only for idempotent operations
+func (pg *postgres) retry(ctx context.Context, idempotent bool, op func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil || attempt >= pg.retries.Attempts || ctx.Err() != nil {
+			return err
+		}
+
+		reason := transientReason(err, idempotent)
+		if reason == "" {
+			return err
+		}
+
+		metrics.DBRetries.WithLabelValues(reason).Inc()
+		logger.FromContext(ctx).Warnln("retrying database operation, attempt", attempt, "failed:", err)
+
+		if !sleep(ctx, backoff(pg.retries.Backoff, attempt, maxRetryBackoff)) {
+			return err
+		}
+	}
+}
+
+// retryResult is retry for operations which return a result
+func retryResult[T any](ctx context.Context, pg *postgres, idempotent bool, op func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := pg.retry(ctx, idempotent, func(ctx context.Context) error {
+		var err error
+		result, err = op(ctx)
+		return err
+	})
+
+	return result, err
+}
+
+// retryBatch is retry for batches of the scheduler, which return the amounts of processed and failed rows.
+// A batch takes rows which are due, so repeating it is idempotent
+func retryBatch(ctx context.Context, pg *postgres, op func(ctx context.Context) (int, int, error)) (int, int, error) {
+	var processed, failed int
+	err := pg.retry(ctx, true, func(ctx context.Context) error {
+		var err error
+		processed, failed, err = op(ctx)
+		return err
+	})
+
+	return processed, failed, err
+}
+
+// transientReason returns why the operation failed with err may be repeated, or an empty string if it may not.
+// An error returned by the server means that the transaction was not committed. Errors caused by the context
+// of the operation are checked before
+func transientReason(err error, idempotent bool) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == pgerrcode.SerializationFailure:
+			return retrySerializationFailure
+		case pgErr.Code == pgerrcode.DeadlockDetected:
+			return retryDeadlock
+		case pgerrcode.IsConnectionException(pgErr.Code), pgErr.Code == pgerrcode.CannotConnectNow, pgErr.Code == pgerrcode.AdminShutdown:
+			return retryConnection
+		}
+
+		return ""
+	}
+
+	if pgconn.SafeToRetry(err) || (idempotent && isConnectionError(err)) {
+		return retryConnection
+	}
+
+	return ""
+}
+
+// isConnectionError reports whether the connection was reset or closed
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// backoff doubles base for every attempt up to limit, the delay is randomized so clients don't retry at the same time
+func backoff(base time.Duration, attempt int, limit time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+
+	if d > limit {
+		d = limit
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep returns false if ctx is done before d passes
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -8,9 +8,13 @@ import (
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
 
 	appErrors "github.com/PoorMercymain/user-segmenter/errors"
 	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/metrics"
+	backgroundtracker "github.com/PoorMercymain/user-segmenter/pkg/background-tracker"
 	"github.com/PoorMercymain/user-segmenter/pkg/logger"
 	uniquenumbersgenerator "github.com/PoorMercymain/user-segmenter/pkg/unique-numbers-generator"
 )
@@ -21,257 +25,539 @@ var (
 
 type segment struct {
 	*postgres
+	bg *backgroundtracker.Tracker
 }
 
-func NewSegment(pg *postgres) *segment {
-	return &segment{pg}
+func NewSegment(pg *postgres, bg *backgroundtracker.Tracker) *segment {
+	return &segment{postgres: pg, bg: bg}
 }
 
-func (r *segment) CreateSegment(ctx context.Context, slug string) error {
-	conn, err := r.Acquire(ctx)
-	if err != nil {
-		return err
-	}
-	defer conn.Release()
+func (r *segment) CreateSegment(ctx context.Context, slug string, options domain.SegmentOptions) error {
+	return r.retry(ctx, false, func(ctx context.Context) error {
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
 
-	tx, err := conn.Begin(ctx)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback(ctx)
-
-	var pgErr *pgconn.PgError
-	_, err = tx.Exec(ctx, "INSERT INTO slugs VALUES ($1)", slug)
-	errors.As(err, &pgErr)
-	if err != nil && pgErr.Code == pgerrcode.UniqueViolation {
-		return appErrors.ErrorUniqueViolation
-	} else if err != nil {
-		return err
-	}
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		var pgErr *pgconn.PgError
+		_, err = tx.Exec(ctx, "INSERT INTO slugs (namespace, slug, default_ttl, expires_at, created_by) VALUES ($1, $2, $3, $4, $5)", domain.NamespaceFromContext(ctx), slug, defaultTTLSeconds(options.DefaultTTL), expiresAt(options.ExpiresAt), domain.ActorFromContext(ctx))
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return appErrors.SegmentAlreadyExists(slug)
+		} else if err != nil {
+			return err
+		}
 
-	return tx.Commit(ctx)
+		return tx.Commit(ctx)
+	})
 }
 
-func (r *segment) DeleteSegment(ctx context.Context, slug string) error {
-	log, err := logger.GetLogger()
-	if err != nil {
-		return err
-	}
+func (r *segment) UpdateSegment(ctx context.Context, slug string, options domain.SegmentOptions) error {
+	return r.retry(ctx, true, func(ctx context.Context) error {
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
 
-	conn, err := r.Acquire(ctx)
-	if err != nil {
-		return err
-	}
-	defer conn.Release()
-
-	var sl string
-	err = conn.QueryRow(ctx, "SELECT slug FROM slugs WHERE slug = $1", slug).Scan(&sl)
-	if err == pgx.ErrNoRows {
-		return appErrors.ErrorNoRows
-	} else if err != nil {
-		log.Infoln(err)
-		return err
-	}
-	log.Infoln(sl)
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
 
-	_, err = conn.Exec(ctx, "DELETE FROM slugs WHERE slug = $1", slug)
-	if err != nil {
-		return err
-	}
+		namespace := domain.NamespaceFromContext(ctx)
 
-	go func() {
-		c := context.Background()
+		var sl string
+		err = tx.QueryRow(ctx, "SELECT slug FROM slugs WHERE namespace = $1 AND slug = $2 FOR UPDATE", namespace, slug).Scan(&sl)
+		if err == pgx.ErrNoRows {
+			return appErrors.SegmentNotFound(slug)
+		} else if err != nil {
+			return err
+		}
 
-		conn, err := r.Acquire(c)
-		if err != nil {
-			log.Infoln(err)
-			return
+		if options.DefaultTTL != nil {
+			_, err = tx.Exec(ctx, "UPDATE slugs SET default_ttl = $1 WHERE namespace = $2 AND slug = $3", defaultTTLSeconds(options.DefaultTTL), namespace, slug)
+			if err != nil {
+				return err
+			}
+		}
+
+		if options.ExpiresAt != nil {
+			_, err = tx.Exec(ctx, "UPDATE slugs SET expires_at = $1 WHERE namespace = $2 AND slug = $3", expiresAt(options.ExpiresAt), namespace, slug)
+			if err != nil {
+				return err
+			}
 		}
-		defer conn.Release()
 
-		tx, err := conn.Begin(c)
+		_, err = tx.Exec(ctx, "UPDATE slugs SET updated_by = $1 WHERE namespace = $2 AND slug = $3", domain.ActorFromContext(ctx), namespace, slug)
 		if err != nil {
-			log.Infoln(err)
-			return
+			return err
 		}
-		defer tx.Rollback(c)
 
-		userIDs := make([]string, 0, 1)
+		return tx.Commit(ctx)
+	})
+}
+
+func (r *segment) DeleteSegment(ctx context.Context, slug string) error {
+	log := logger.FromContext(ctx)
+
+	namespace := domain.NamespaceFromContext(ctx)
 
-		rows, err := tx.Query(c, "SELECT user_id FROM users WHERE $1 = ANY(slugs)", slug)
+	err := r.retry(ctx, false, func(ctx context.Context) error {
+		conn, err := r.Acquire(ctx)
 		if err != nil {
-			log.Infoln(err)
+			return err
 		}
+		defer conn.Release()
 
-		for rows.Next() {
-			var id string
-			err = rows.Scan(&id)
+		var sl string
+		err = conn.QueryRow(ctx, "SELECT slug FROM slugs WHERE namespace = $1 AND slug = $2", namespace, slug).Scan(&sl)
+		if err == pgx.ErrNoRows {
+			return appErrors.SegmentNotFound(slug)
+		} else if err != nil {
+			log.Errorln(err)
+			return err
+		}
+		log.Debugln(sl)
+
+		_, err = conn.Exec(ctx, "DELETE FROM slugs WHERE namespace = $1 AND slug = $2", namespace, slug)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	actor := domain.ActorFromContext(ctx)
+	spanContext := trace.SpanContextFromContext(ctx)
+	r.bg.Go(func(c context.Context) {
+		c, span := tracer.Start(trace.ContextWithSpanContext(c, spanContext), "segment.removeSegmentFromUsers")
+		defer span.End()
+
+		// users which no longer have the segment are skipped, so the removal may be repeated
+		err := r.retry(c, true, func(c context.Context) error {
+			conn, err := r.Acquire(c)
 			if err != nil {
-				log.Infoln(err)
-				break
+				return err
 			}
-			userIDs = append(userIDs, id)
-		}
+			defer conn.Release()
 
-		for _, id := range userIDs {
-			_, err = tx.Exec(c, "UPDATE users SET slugs = array_remove(slugs, $1) WHERE user_id = $2", slug, id)
+			tx, err := conn.Begin(c)
 			if err != nil {
-				log.Infoln(err)
+				return err
 			}
-			_, err = tx.Exec(c, "INSERT INTO users_segment_history VALUES ($1, $2, $3, $4)", id, slug, time.Now(), true)
+			defer tx.Rollback(c)
+
+			err = removeSegmentFromUsers(c, tx, namespace, slug, actor)
 			if err != nil {
-				log.Infoln(err)
+				return err
 			}
+
+			return tx.Commit(c)
+		})
+		if err != nil {
+			log.Errorln(err)
 		}
+	})
+
+	return nil
+}
 
-		_, err = tx.Exec(c, "DELETE FROM deletion_times WHERE slug = $1", slug)
+func (r *segment) ReadSegments(ctx context.Context) ([]domain.Segment, error) {
+	return readResult(ctx, r.postgres, func(ctx context.Context, db *pgxpool.Pool) ([]domain.Segment, error) {
+		conn, err := db.Acquire(ctx)
 		if err != nil {
-			log.Infoln(err)
+			return nil, err
 		}
-		err = tx.Commit(c)
+		defer conn.Release()
+
+		rows, err := conn.Query(ctx, "SELECT slug, default_ttl, expires_at, COALESCE(created_by, ''), COALESCE(updated_by, '') FROM slugs WHERE namespace = $1 ORDER BY slug", domain.NamespaceFromContext(ctx))
 		if err != nil {
-			log.Infoln(err)
+			return nil, err
 		}
-	}()
+		defer rows.Close()
 
-	return nil
+		segments := make([]domain.Segment, 0)
+		for rows.Next() {
+			var segment domain.Segment
+			var defaultTTL *int64
+			err = rows.Scan(&segment.Slug, &defaultTTL, &segment.ExpiresAt, &segment.CreatedBy, &segment.UpdatedBy)
+			if err != nil {
+				return nil, err
+			}
+
+			if defaultTTL != nil {
+				segment.TTL = (time.Duration(*defaultTTL) * time.Second).String()
+			}
+
+			segments = append(segments, segment)
+		}
+
+		return segments, rows.Err()
+	})
 }
 
 func (r *segment) AddSegmentToPercentOfUsers(ctx context.Context, slug string, percent int) error {
-	log, err := logger.GetLogger()
-	if err != nil {
-		return err
-	}
+	log := logger.FromContext(ctx)
 
-	conn, err := r.Acquire(ctx)
-	if err != nil {
-		return err
-	}
-	defer conn.Release()
+	namespace := domain.NamespaceFromContext(ctx)
 
-	var usersAmount int
-	err = conn.QueryRow(ctx, "SELECT COUNT(user_id) FROM users").Scan(&usersAmount)
-	if err != nil {
+	usersAmount, err := retryResult(ctx, r.postgres, true, func(ctx context.Context) (int, error) {
+		var usersAmount int
+		err := r.QueryRow(ctx, "SELECT COUNT(user_id) FROM users WHERE namespace = $1", namespace).Scan(&usersAmount)
 		if err == pgx.ErrNoRows {
-			log.Infoln(usersAmount)
-			return appErrors.ErrorNoRows
+			log.Debugln(usersAmount)
+			return 0, appErrors.ErrorNoRows
 		}
+
+		return usersAmount, err
+	})
+	if err != nil {
 		return err
 	}
 
-	go func() {
+	actor := domain.ActorFromContext(ctx)
+	spanContext := trace.SpanContextFromContext(ctx)
+	r.bg.Go(func(c context.Context) {
+		c, span := tracer.Start(trace.ContextWithSpanContext(c, spanContext), "segment.addSegmentToUsers")
+		defer span.End()
+
 		choosenAmount := int((float64(usersAmount) / 100) * float64(percent))
-		log.Infoln(choosenAmount, usersAmount, percent)
+		log.Debugln(choosenAmount, usersAmount, percent)
 		randomNumbersMap, err := uniquenumbersgenerator.GenerateUniqueNonNegativeNumbers(choosenAmount, usersAmount)
 		if err != nil {
-			log.Infoln(err)
+			log.Errorln(err)
 			return
 		}
 
-		log.Infoln(randomNumbersMap)
-		c := context.Background()
+		log.Debugln(randomNumbersMap)
+
+		// the enrolled users aren't known after a broken commit, so the rollout is repeated only when it surely failed
+		var enrolled int
+		err = r.retry(c, false, func(c context.Context) error {
+			enrolled = 0
 
-		conn, err := r.Acquire(c)
+			conn, err := r.Acquire(c)
+			if err != nil {
+				return err
+			}
+			defer conn.Release()
+
+			tx, err := conn.Begin(c)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback(c)
+
+			for randNum := range randomNumbersMap {
+				var userID string
+				err = tx.QueryRow(c, "SELECT user_id FROM users WHERE namespace = $1 ORDER BY user_id DESC LIMIT 1 OFFSET $2", namespace, randNum).Scan(&userID)
+				if err != nil {
+					return err
+				}
+				// users which are already in the segment are skipped, as the memory storage does
+				execResult, err := tx.Exec(c, "UPDATE users SET slugs = array_append(slugs, $1) WHERE namespace = $2 AND user_id = $3 AND NOT ($1 = ANY(slugs))", slug, namespace, userID)
+				if err != nil {
+					return err
+				}
+				if execResult.RowsAffected() == 0 {
+					continue
+				}
+
+				// the entry is written as UpdateUserSegments writes it, so it is read as an addition made by the client which started the rollout
+				_, err = tx.Exec(c, "INSERT INTO users_segment_history (namespace, user_id, slug, modified_at, is_deletion, actor) VALUES ($1, $2, $3, $4, $5, $6)", namespace, userID, slug, time.Now(), false, actor)
+				if err != nil {
+					return err
+				}
+				err = applyDefaultTTL(c, tx, namespace, userID, slug)
+				if err != nil {
+					return err
+				}
+				enrolled++
+			}
+
+			return tx.Commit(c)
+		})
 		if err != nil {
-			log.Infoln(err)
+			log.Errorln(err)
 			return
 		}
+
+		metrics.PercentRolloutEnrolled.Add(float64(enrolled))
+	})
+
+	return nil
+}
+
+// DeleteExpiredSegments leaves out failedRows and adds the rows which fail to them
+func (r *segment) DeleteExpiredSegments(ctx context.Context, batchSize int, failedRows domain.FailedRows) (int, int, error) {
+	namespaces, userIDs, slugs, _ := failedRowColumns(failedRows)
+
+	var failedInBatch []domain.RowKey
+	processed, failed, err := retryBatch(ctx, r.postgres, func(ctx context.Context) (int, int, error) {
+		log := logger.FromContext(ctx)
+		failedInBatch = failedInBatch[:0]
+
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
 		defer conn.Release()
 
-		tx, err := conn.Begin(c)
+		tx, err := conn.Begin(ctx)
 		if err != nil {
-			log.Infoln(err)
-			return
+			return 0, 0, err
 		}
-		defer tx.Rollback(c)
+		defer tx.Rollback(ctx)
 
-		for randNum := range randomNumbersMap {
-			var userID string
-			err = tx.QueryRow(c, "SELECT user_id FROM users ORDER BY user_id DESC LIMIT 1 OFFSET $1 ", randNum).Scan(&userID)
-			if err != nil {
-				log.Infoln(err)
-				return
-			}
-			_, err = tx.Exec(c, "UPDATE users SET slugs = array_append(slugs, $1) WHERE user_id = $2", slug, userID)
+		rows, err := tx.Query(ctx, `SELECT namespace, user_id, slug FROM deletion_times WHERE deletion_timestamp <= $1
+			AND (namespace, user_id, slug) NOT IN (SELECT * FROM unnest($3::text[], $4::text[], $5::text[]))
+			ORDER BY deletion_timestamp LIMIT $2 FOR UPDATE SKIP LOCKED`, time.Now(), batchSize, namespaces, userIDs, slugs)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		expired := make([]domain.DeletionTime, 0, batchSize)
+		for rows.Next() {
+			var deletionTime domain.DeletionTime
+			err = rows.Scan(&deletionTime.Namespace, &deletionTime.UserID, &deletionTime.Slug)
 			if err != nil {
-				log.Infoln(err)
-				return
+				rows.Close()
+				return 0, 0, err
 			}
-			_, err = tx.Exec(c, "INSERT INTO users_segment_history VALUES ($1, $2, $3, $4)", userID, slug, time.Now(), false)
+			expired = append(expired, deletionTime)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return 0, 0, err
+		}
+
+		processed := 0
+		for _, deletionTime := range expired {
+			err = deleteExpiredSegment(ctx, tx, deletionTime.Namespace, deletionTime.UserID, deletionTime.Slug)
 			if err != nil {
-				log.Infoln(err)
-				return
+				log.Errorln("failed to delete expired segment", deletionTime.Slug, "of user", deletionTime.UserID, "in namespace", deletionTime.Namespace, err)
+				failedInBatch = append(failedInBatch, domain.RowKey{Namespace: deletionTime.Namespace, UserID: deletionTime.UserID, Slug: deletionTime.Slug})
+				continue
 			}
+			processed++
 		}
-		err = tx.Commit(c)
+
+		err = tx.Commit(ctx)
 		if err != nil {
-			log.Infoln(err)
+			return 0, 0, err
 		}
-	}()
 
-	return nil
+		return processed, len(failedInBatch), nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	failedRows.Add(failedInBatch...)
+	return processed, failed, nil
+}
+
+// failedRowColumns splits the keys of failed rows into arrays of their columns, which are unnested to leave the rows out of a batch
+func failedRowColumns(failedRows domain.FailedRows) ([]string, []string, []string, []time.Time) {
+	namespaces := make([]string, 0, len(failedRows))
+	userIDs := make([]string, 0, len(failedRows))
+	slugs := make([]string, 0, len(failedRows))
+	startsAt := make([]time.Time, 0, len(failedRows))
+	for key := range failedRows {
+		namespaces = append(namespaces, key.Namespace)
+		userIDs = append(userIDs, key.UserID)
+		slugs = append(slugs, key.Slug)
+		startsAt = append(startsAt, key.StartsAt)
+	}
+
+	return namespaces, userIDs, slugs, startsAt
 }
 
-func (r *segment) DeleteExpiredSegments(ctx context.Context) error {
-	log, err := logger.GetLogger()
+// deleteExpiredSegment runs in a savepoint, so an error affects only one row of the batch
+func deleteExpiredSegment(ctx context.Context, tx pgx.Tx, namespace string, userID string, slug string) error {
+	savepoint, err := tx.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer savepoint.Rollback(ctx)
 
-	conn, err := r.Acquire(ctx)
+	execResult, err := savepoint.Exec(ctx, "UPDATE users SET slugs = array_remove(slugs, $1) WHERE namespace = $2 AND user_id = $3 AND $1 = ANY(slugs)", slug, namespace, userID)
 	if err != nil {
-		log.Infoln(err)
 		return err
 	}
-	defer conn.Release()
 
-	rows, err := conn.Query(ctx, "SELECT user_id, slug FROM deletion_times WHERE deletion_timestamp <= $1", time.Now())
+	_, err = savepoint.Exec(ctx, "DELETE FROM deletion_times WHERE namespace = $1 AND user_id = $2 AND slug = $3", namespace, userID, slug)
 	if err != nil {
 		return err
 	}
 
-	for rows.Next() {
-		var userID, slug string
-		err = rows.Scan(&userID, &slug)
+	if execResult.RowsAffected() != 0 {
+		_, err = savepoint.Exec(ctx, "INSERT INTO users_segment_history (namespace, user_id, slug, modified_at, is_deletion) VALUES ($1, $2, $3, $4, $5)", namespace, userID, slug, time.Now(), true)
 		if err != nil {
 			return err
 		}
+	}
+
+	return savepoint.Commit(ctx)
+}
+
+// RetireExpiredSegments leaves out failedRows and adds the segments which fail to them
+func (r *segment) RetireExpiredSegments(ctx context.Context, batchSize int, failedRows domain.FailedRows) (int, int, error) {
+	namespaces, _, failedSlugs, _ := failedRowColumns(failedRows)
+
+	var failedInBatch []domain.RowKey
+	processed, failed, err := retryBatch(ctx, r.postgres, func(ctx context.Context) (int, int, error) {
+		log := logger.FromContext(ctx)
+		failedInBatch = failedInBatch[:0]
 
 		conn, err := r.Acquire(ctx)
 		if err != nil {
-			log.Infoln(err)
-			return err
+			return 0, 0, err
 		}
 		defer conn.Release()
 
 		tx, err := conn.Begin(ctx)
 		if err != nil {
-			log.Infoln(err)
-			return err
+			return 0, 0, err
 		}
 		defer tx.Rollback(ctx)
 
-		execResult, err := tx.Exec(ctx, "UPDATE users SET slugs = array_remove(slugs, $1) WHERE user_id = $2 AND $1 = ANY(slugs)", slug, userID)
+		rows, err := tx.Query(ctx, `SELECT namespace, slug FROM slugs WHERE expires_at <= $1
+			AND (namespace, slug) NOT IN (SELECT * FROM unnest($3::text[], $4::text[]))
+			ORDER BY expires_at LIMIT $2 FOR UPDATE SKIP LOCKED`, time.Now(), batchSize, namespaces, failedSlugs)
 		if err != nil {
-			return err
+			return 0, 0, err
+		}
+
+		type expiredSlug struct {
+			Namespace string
+			Slug      string
 		}
-		t := time.Now()
-		_, err = tx.Exec(ctx, "DELETE FROM deletion_times WHERE user_id = $1 AND slug = $2", userID, slug)
+
+		slugs, err := pgx.CollectRows(rows, pgx.RowToStructByPos[expiredSlug])
 		if err != nil {
-			return err
+			return 0, 0, err
 		}
-		if execResult.RowsAffected() != 0 {
-			_, err = tx.Exec(ctx, "INSERT INTO users_segment_history VALUES ($1, $2, $3, $4)", userID, slug, t, true)
+
+		processed := 0
+		for _, slug := range slugs {
+			err = retireSegment(ctx, tx, slug.Namespace, slug.Slug)
 			if err != nil {
-				log.Infoln(err)
-				return err
+				log.Errorln("failed to retire expired segment", slug.Slug, "in namespace", slug.Namespace, err)
+				failedInBatch = append(failedInBatch, domain.RowKey{Namespace: slug.Namespace, Slug: slug.Slug})
+				continue
 			}
+			processed++
 		}
+
 		err = tx.Commit(ctx)
 		if err != nil {
-			log.Infoln(err)
+			return 0, 0, err
+		}
+
+		return processed, len(failedInBatch), nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	failedRows.Add(failedInBatch...)
+	return processed, failed, nil
+}
+
+// retireSegment runs in a savepoint, so an error affects only one segment of the batch
+func retireSegment(ctx context.Context, tx pgx.Tx, namespace string, slug string) error {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer savepoint.Rollback(ctx)
+
+	_, err = savepoint.Exec(ctx, "DELETE FROM slugs WHERE namespace = $1 AND slug = $2", namespace, slug)
+	if err != nil {
+		return err
+	}
+
+	err = removeSegmentFromUsers(ctx, savepoint, namespace, slug, nil)
+	if err != nil {
+		return err
+	}
+
+	return savepoint.Commit(ctx)
+}
+
+// removeSegmentFromUsers removes the segment from every user which has it, writing the deletions to history.
+// actor is nil when the segment is removed by the service itself
+func removeSegmentFromUsers(ctx context.Context, tx pgx.Tx, namespace string, slug string, actor *string) error {
+	rows, err := tx.Query(ctx, "SELECT user_id FROM users WHERE namespace = $1 AND $2 = ANY(slugs)", namespace, slug)
+	if err != nil {
+		return err
+	}
+
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	metrics.DeletionFanoutsInProgress.Inc()
+	metrics.DeletionFanoutPendingUsers.Add(float64(len(userIDs)))
+	pending := len(userIDs)
+	defer func() {
+		metrics.DeletionFanoutsInProgress.Dec()
+		metrics.DeletionFanoutPendingUsers.Sub(float64(pending))
+	}()
+
+	for _, id := range userIDs {
+		_, err = tx.Exec(ctx, "UPDATE users SET slugs = array_remove(slugs, $1) WHERE namespace = $2 AND user_id = $3", slug, namespace, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, "INSERT INTO users_segment_history (namespace, user_id, slug, modified_at, is_deletion, actor) VALUES ($1, $2, $3, $4, $5, $6)", namespace, id, slug, time.Now(), true, actor)
+		if err != nil {
 			return err
 		}
+
+		pending--
+		metrics.DeletionFanoutPendingUsers.Dec()
+		metrics.DeletionFanoutUsers.Inc()
 	}
-	return nil
+
+	_, err = tx.Exec(ctx, "DELETE FROM deletion_times WHERE namespace = $1 AND slug = $2", namespace, slug)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM scheduled_assignments WHERE namespace = $1 AND slug = $2", namespace, slug)
+	return err
+}
+
+// applyDefaultTTL schedules deletion of a just added segment if the segment has a default TTL
+func applyDefaultTTL(ctx context.Context, tx pgx.Tx, namespace string, userID string, slug string) error {
+	_, err := tx.Exec(ctx, "INSERT INTO deletion_times (namespace, user_id, slug, deletion_timestamp) SELECT namespace, $2, slug, now() + make_interval(secs => default_ttl) FROM slugs WHERE namespace = $1 AND slug = $3 AND default_ttl IS NOT NULL ON CONFLICT(namespace, user_id, slug) DO UPDATE SET deletion_timestamp = EXCLUDED.deletion_timestamp", namespace, userID, slug)
+	return err
+}
+
+func defaultTTLSeconds(defaultTTL *time.Duration) *int64 {
+	if defaultTTL == nil || *defaultTTL <= 0 {
+		return nil
+	}
+
+	seconds := int64(defaultTTL.Seconds())
+	return &seconds
+}
+
+func expiresAt(t *time.Time) *time.Time {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+
+	return t
 }
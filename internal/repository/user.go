@@ -5,9 +5,11 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	appErrors "github.com/PoorMercymain/user-segmenter/errors"
 	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
 )
 
 var (
@@ -23,119 +25,432 @@ func NewUser(pg *postgres) *user {
 }
 
 func (r *user) UpdateUserSegments(ctx context.Context, userID string, slugsToAdd []string, slugsToDelete []string) error {
-	conn, err := r.Acquire(ctx)
-	if err != nil {
-		return err
-	}
-	defer conn.Release()
+	return r.retry(ctx, false, func(ctx context.Context) error {
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
 
-	slugs := append(slugsToAdd, slugsToDelete...)
+		slugs := append(slugsToAdd, slugsToDelete...)
 
-	var str string
+		namespace := domain.NamespaceFromContext(ctx)
+
+		var str string
+
+		for _, slug := range slugs {
 
-	for _, slug := range slugs {
+			err = conn.QueryRow(ctx, "SELECT slug FROM slugs WHERE namespace = $1 AND slug = $2", namespace, slug).Scan(&str)
+			if err != nil {
+				if err == pgx.ErrNoRows {
+					return appErrors.SegmentNotFound(slug)
+				}
+				return err
+			}
+		}
 
-		err = conn.QueryRow(ctx, "SELECT slug FROM slugs WHERE slug = $1", slug).Scan(&str)
+		err = conn.QueryRow(ctx, "SELECT user_id FROM users WHERE namespace = $1 AND user_id = $2", namespace, userID).Scan(&str)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				return appErrors.ErrorNoRows
+				conn.Exec(ctx, "INSERT INTO users (namespace, user_id, slugs) VALUES ($1, $2, $3)", namespace, userID, make([]string, 0))
+			} else {
+				return err
 			}
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
 			return err
 		}
-	}
+		defer tx.Rollback(ctx)
 
-	err = conn.QueryRow(ctx, "SELECT user_id FROM users WHERE user_id = $1", userID).Scan(&str)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			conn.Exec(ctx, "INSERT INTO users VALUES ($1, $2)", userID, make([]string, 0))
-		} else {
+		for _, slug := range slugsToAdd {
+			updateResult, err := tx.Exec(ctx, "UPDATE users SET slugs = array_append(slugs, $1) WHERE namespace = $2 AND user_id = $3 AND NOT $1 = ANY(slugs)", slug, namespace, userID)
+			if err != nil {
+				return err
+			}
+
+			if updateResult.RowsAffected() != 0 {
+				_, err = tx.Exec(ctx, "INSERT INTO users_segment_history (namespace, user_id, slug, modified_at, is_deletion, actor) VALUES ($1, $2, $3, $4, $5, $6)", namespace, userID, slug, time.Now(), false, domain.ActorFromContext(ctx))
+				if err != nil {
+					return err
+				}
+
+				err = applyDefaultTTL(ctx, tx, namespace, userID, slug)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, slug := range slugsToDelete {
+			err = conn.QueryRow(ctx, "SELECT user_id FROM users WHERE namespace = $1 AND user_id = $2 AND $3 = ANY(slugs)", namespace, userID, slug).Scan(&str)
+			if err != nil {
+				if err == pgx.ErrNoRows {
+					return appErrors.UserNotInSegment(slug)
+				}
+				return err
+			}
+		}
+
+		for _, slug := range slugsToDelete {
+			updateResult, err := tx.Exec(ctx, "UPDATE users SET slugs = array_remove(slugs, $1) WHERE namespace = $2 AND user_id = $3 AND $1 = ANY(slugs)", slug, namespace, userID)
+			if err != nil {
+				return err
+			}
+			if updateResult.RowsAffected() != 0 {
+				_, err = tx.Exec(ctx, "INSERT INTO users_segment_history (namespace, user_id, slug, modified_at, is_deletion, actor) VALUES ($1, $2, $3, $4, $5, $6)", namespace, userID, slug, time.Now(), true, domain.ActorFromContext(ctx))
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = tx.Exec(ctx, "DELETE FROM deletion_times WHERE namespace = $1 AND user_id = $2 AND slug = $3", namespace, userID, slug)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit(ctx)
+	})
+}
+
+func (r *user) ReadUserSegments(ctx context.Context, userID string) ([]string, error) {
+	return readResult(ctx, r.postgres, func(ctx context.Context, db *pgxpool.Pool) ([]string, error) {
+		conn, err := db.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Release()
+
+		var slugs []string
+
+		// segments, which have already expired but were not processed by the scheduler yet, are not active
+		err = conn.QueryRow(ctx, `SELECT ARRAY(
+			SELECT s.slug FROM unnest(u.slugs) WITH ORDINALITY AS s(slug, ord)
+			WHERE NOT EXISTS (SELECT 1 FROM deletion_times d WHERE d.namespace = u.namespace AND d.user_id = u.user_id AND d.slug = s.slug AND d.deletion_timestamp <= now())
+			AND NOT EXISTS (SELECT 1 FROM slugs sl WHERE sl.namespace = u.namespace AND sl.slug = s.slug AND sl.expires_at <= now())
+			ORDER BY s.ord
+		) FROM users u WHERE u.namespace = $1 AND u.user_id = $2`, domain.NamespaceFromContext(ctx), userID).Scan(&slugs)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, appErrors.UserNotFound()
+			}
+			return nil, err
+		}
+
+		return slugs, nil
+	})
+}
+
+func (r *user) CreateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error {
+	return r.retry(ctx, true, func(ctx context.Context) error {
+		conn, err := r.Acquire(ctx)
+		if err != nil {
 			return err
 		}
-	}
+		defer conn.Release()
 
-	tx, err := conn.Begin(ctx)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback(ctx)
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
 
-	for _, slug := range slugsToAdd {
-		updateResult, err := tx.Exec(ctx, "UPDATE users SET slugs = array_append(slugs, $1) WHERE user_id = $2 AND NOT $1 = ANY(slugs)", slug, userID)
+		_, err = tx.Exec(ctx, "INSERT INTO deletion_times (namespace, user_id, slug, deletion_timestamp) VALUES ($1, $2, $3, $4) ON CONFLICT(namespace, user_id, slug) DO UPDATE SET deletion_timestamp = $4", domain.NamespaceFromContext(ctx), userID, slug, deletionTime)
 		if err != nil {
 			return err
 		}
 
-		if updateResult.RowsAffected() != 0 {
-			_, err = tx.Exec(ctx, "INSERT INTO users_segment_history VALUES ($1, $2, $3, $4)", userID, slug, time.Now(), false)
+		return tx.Commit(ctx)
+	})
+}
+
+func (r *user) ReadDeletionTimes(ctx context.Context, userID string, slug string) ([]domain.DeletionTime, error) {
+	return readResult(ctx, r.postgres, func(ctx context.Context, db *pgxpool.Pool) ([]domain.DeletionTime, error) {
+		conn, err := db.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Release()
+
+		rows, err := conn.Query(ctx, "SELECT user_id, slug, deletion_timestamp FROM deletion_times WHERE namespace = $1 AND ($2 = '' OR user_id = $2) AND ($3 = '' OR slug = $3) ORDER BY deletion_timestamp", domain.NamespaceFromContext(ctx), userID, slug)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		deletionTimes := make([]domain.DeletionTime, 0)
+		for rows.Next() {
+			var deletionTime domain.DeletionTime
+			err = rows.Scan(&deletionTime.UserID, &deletionTime.Slug, &deletionTime.DeletionTime)
 			if err != nil {
-				return err
+				return nil, err
 			}
+
+			deletionTimes = append(deletionTimes, deletionTime)
 		}
-	}
 
-	for _, slug := range slugsToDelete {
-		err = conn.QueryRow(ctx, "SELECT user_id FROM users WHERE user_id = $1 AND $2 = ANY(slugs)", userID, slug).Scan(&str)
+		return deletionTimes, rows.Err()
+	})
+}
+
+func (r *user) UpdateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error {
+	return r.retry(ctx, false, func(ctx context.Context) error {
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		namespace := domain.NamespaceFromContext(ctx)
+
+		var str string
+		err = tx.QueryRow(ctx, "SELECT user_id FROM users WHERE namespace = $1 AND user_id = $2 AND $3 = ANY(slugs) FOR UPDATE", namespace, userID, slug).Scan(&str)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				return appErrors.ErrorNoRows
+				return appErrors.UserNotInSegment(slug)
 			}
 			return err
 		}
-	}
 
-	for _, slug := range slugsToDelete {
-		updateResult, err := tx.Exec(ctx, "UPDATE users SET slugs = array_remove(slugs, $1) WHERE user_id = $2 AND $1 = ANY(slugs)", slug, userID)
+		_, err = tx.Exec(ctx, "INSERT INTO deletion_times (namespace, user_id, slug, deletion_timestamp) VALUES ($1, $2, $3, $4) ON CONFLICT(namespace, user_id, slug) DO UPDATE SET deletion_timestamp = $4", namespace, userID, slug, deletionTime)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, "INSERT INTO users_segment_history (namespace, user_id, slug, modified_at, is_deletion, operation, actor) VALUES ($1, $2, $3, $4, $5, $6, $7)", namespace, userID, slug, time.Now(), false, domain.OperationTTLUpdate, domain.ActorFromContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit(ctx)
+	})
+}
+
+func (r *user) DeleteDeletionTime(ctx context.Context, userID string, slug string) error {
+	return r.retry(ctx, false, func(ctx context.Context) error {
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		namespace := domain.NamespaceFromContext(ctx)
+
+		deleteResult, err := tx.Exec(ctx, "DELETE FROM deletion_times WHERE namespace = $1 AND user_id = $2 AND slug = $3", namespace, userID, slug)
+		if err != nil {
+			return err
+		}
+
+		if deleteResult.RowsAffected() == 0 {
+			return appErrors.TTLNotFound(slug)
+		}
+
+		_, err = tx.Exec(ctx, "INSERT INTO users_segment_history (namespace, user_id, slug, modified_at, is_deletion, operation, actor) VALUES ($1, $2, $3, $4, $5, $6, $7)", namespace, userID, slug, time.Now(), false, domain.OperationTTLRemoval, domain.ActorFromContext(ctx))
 		if err != nil {
 			return err
 		}
-		if updateResult.RowsAffected() != 0 {
-			_, err = tx.Exec(ctx, "INSERT INTO users_segment_history VALUES ($1, $2, $3, $4)", userID, slug, time.Now(), true)
+
+		return tx.Commit(ctx)
+	})
+}
+
+func (r *user) ScheduleUserSegments(ctx context.Context, userID string, slugs []string, startsAt time.Time, endsAt *time.Time) error {
+	return r.retry(ctx, true, func(ctx context.Context) error {
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Release()
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		namespace := domain.NamespaceFromContext(ctx)
+
+		var str string
+		for _, slug := range slugs {
+			err = tx.QueryRow(ctx, "SELECT slug FROM slugs WHERE namespace = $1 AND slug = $2", namespace, slug).Scan(&str)
+			if err != nil {
+				if err == pgx.ErrNoRows {
+					return appErrors.SegmentNotFound(slug)
+				}
+				return err
+			}
+
+			_, err = tx.Exec(ctx, "INSERT INTO scheduled_assignments (namespace, user_id, slug, starts_at, ends_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT(namespace, user_id, slug, starts_at) DO UPDATE SET ends_at = $5", namespace, userID, slug, startsAt, endsAt)
 			if err != nil {
 				return err
 			}
 		}
-	}
 
-	return tx.Commit(ctx)
+		return tx.Commit(ctx)
+	})
 }
 
-func (r *user) ReadUserSegments(ctx context.Context, userID string) ([]string, error) {
-	conn, err := r.Acquire(ctx)
+func (r *user) ReadScheduledAssignments(ctx context.Context, userID string) ([]domain.ScheduledAssignment, error) {
+	return readResult(ctx, r.postgres, func(ctx context.Context, db *pgxpool.Pool) ([]domain.ScheduledAssignment, error) {
+		conn, err := db.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Release()
+
+		rows, err := conn.Query(ctx, "SELECT user_id, slug, starts_at, ends_at FROM scheduled_assignments WHERE namespace = $1 AND user_id = $2 ORDER BY starts_at", domain.NamespaceFromContext(ctx), userID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		assignments := make([]domain.ScheduledAssignment, 0)
+		for rows.Next() {
+			var assignment domain.ScheduledAssignment
+			err = rows.Scan(&assignment.UserID, &assignment.Slug, &assignment.StartsAt, &assignment.EndsAt)
+			if err != nil {
+				return nil, err
+			}
+
+			assignments = append(assignments, assignment)
+		}
+
+		return assignments, rows.Err()
+	})
+}
+
+// ActivateScheduledAssignments leaves out failedRows and adds the assignments which fail to them
+func (r *user) ActivateScheduledAssignments(ctx context.Context, batchSize int, failedRows domain.FailedRows) (int, int, error) {
+	namespaces, userIDs, slugs, startsAt := failedRowColumns(failedRows)
+
+	var failedInBatch []domain.RowKey
+	processed, failed, err := retryBatch(ctx, r.postgres, func(ctx context.Context) (int, int, error) {
+		log := logger.FromContext(ctx)
+		failedInBatch = failedInBatch[:0]
+
+		conn, err := r.Acquire(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer conn.Release()
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer tx.Rollback(ctx)
+
+		rows, err := tx.Query(ctx, `SELECT namespace, user_id, slug, starts_at, ends_at FROM scheduled_assignments WHERE starts_at <= $1
+			AND (namespace, user_id, slug, starts_at) NOT IN (SELECT * FROM unnest($3::text[], $4::text[], $5::text[], $6::timestamptz[]))
+			ORDER BY starts_at LIMIT $2 FOR UPDATE SKIP LOCKED`, time.Now(), batchSize, namespaces, userIDs, slugs, startsAt)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		due := make([]domain.ScheduledAssignment, 0, batchSize)
+		for rows.Next() {
+			var assignment domain.ScheduledAssignment
+			err = rows.Scan(&assignment.Namespace, &assignment.UserID, &assignment.Slug, &assignment.StartsAt, &assignment.EndsAt)
+			if err != nil {
+				rows.Close()
+				return 0, 0, err
+			}
+			due = append(due, assignment)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return 0, 0, err
+		}
+
+		processed := 0
+		for _, assignment := range due {
+			err = activateScheduledAssignment(ctx, tx, assignment)
+			if err != nil {
+				log.Errorln("failed to activate scheduled segment", assignment.Slug, "of user", assignment.UserID, "in namespace", assignment.Namespace, err)
+				failedInBatch = append(failedInBatch, domain.RowKey{Namespace: assignment.Namespace, UserID: assignment.UserID, Slug: assignment.Slug, StartsAt: assignment.StartsAt})
+				continue
+			}
+			processed++
+		}
+
+		err = tx.Commit(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		return processed, len(failedInBatch), nil
+	})
 	if err != nil {
-		return nil, err
+		return 0, 0, err
 	}
-	defer conn.Release()
 
-	var slugs []string
+	failedRows.Add(failedInBatch...)
+	return processed, failed, nil
+}
 
-	err = conn.QueryRow(ctx, "SELECT slugs FROM users WHERE user_id = $1", userID).Scan(&slugs)
+// activateScheduledAssignment runs in a savepoint, so an error affects only one assignment of the batch.
+// Assignments whose window has already ended or whose segment no longer exists are dropped
+func activateScheduledAssignment(ctx context.Context, tx pgx.Tx, assignment domain.ScheduledAssignment) error {
+	savepoint, err := tx.Begin(ctx)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, appErrors.ErrorNoRows
-		}
-		return nil, err
+		return err
 	}
+	defer savepoint.Rollback(ctx)
 
-	return slugs, nil
-}
+	_, err = savepoint.Exec(ctx, "DELETE FROM scheduled_assignments WHERE namespace = $1 AND user_id = $2 AND slug = $3 AND starts_at = $4", assignment.Namespace, assignment.UserID, assignment.Slug, assignment.StartsAt)
+	if err != nil {
+		return err
+	}
 
-func (r *user) CreateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error {
-	conn, err := r.Acquire(ctx)
+	activatedAt := time.Now()
+
+	var str string
+	err = savepoint.QueryRow(ctx, "SELECT slug FROM slugs WHERE namespace = $1 AND slug = $2", assignment.Namespace, assignment.Slug).Scan(&str)
+	if err == pgx.ErrNoRows || (assignment.EndsAt != nil && !assignment.EndsAt.After(activatedAt)) {
+		return savepoint.Commit(ctx)
+	} else if err != nil {
+		return err
+	}
+
+	_, err = savepoint.Exec(ctx, "INSERT INTO users (namespace, user_id, slugs) VALUES ($1, $2, $3) ON CONFLICT(namespace, user_id) DO NOTHING", assignment.Namespace, assignment.UserID, make([]string, 0))
 	if err != nil {
 		return err
 	}
-	defer conn.Release()
 
-	tx, err := conn.Begin(ctx)
+	updateResult, err := savepoint.Exec(ctx, "UPDATE users SET slugs = array_append(slugs, $1) WHERE namespace = $2 AND user_id = $3 AND NOT $1 = ANY(slugs)", assignment.Slug, assignment.Namespace, assignment.UserID)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback(ctx)
 
-	_, err = tx.Exec(ctx, "INSERT INTO deletion_times VALUES ($1, $2, $3) ON CONFLICT(user_id, slug) DO UPDATE SET deletion_timestamp = $3", userID, slug, deletionTime)
+	if updateResult.RowsAffected() != 0 {
+		_, err = savepoint.Exec(ctx, "INSERT INTO users_segment_history (namespace, user_id, slug, modified_at, is_deletion) VALUES ($1, $2, $3, $4, $5)", assignment.Namespace, assignment.UserID, assignment.Slug, activatedAt, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if assignment.EndsAt != nil {
+		_, err = savepoint.Exec(ctx, "INSERT INTO deletion_times (namespace, user_id, slug, deletion_timestamp) VALUES ($1, $2, $3, $4) ON CONFLICT(namespace, user_id, slug) DO UPDATE SET deletion_timestamp = $4", assignment.Namespace, assignment.UserID, assignment.Slug, *assignment.EndsAt)
+	} else if updateResult.RowsAffected() != 0 {
+		err = applyDefaultTTL(ctx, savepoint, assignment.Namespace, assignment.UserID, assignment.Slug)
+	}
 	if err != nil {
 		return err
 	}
 
-	return tx.Commit(ctx)
+	return savepoint.Commit(ctx)
 }
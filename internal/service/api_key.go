@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.APIKeyService = (*apiKey)(nil)
+)
+
+const (
+	// APIKeyPrefix makes keys easy to recognize, e.g. by secret scanners
+	APIKeyPrefix = "usk_"
+
+	apiKeyIDBytes     = 8
+	apiKeySecretBytes = 24
+)
+
+type apiKey struct {
+	repo domain.APIKeyRepository
+}
+
+func NewAPIKey(repo domain.APIKeyRepository) *apiKey {
+	return &apiKey{repo: repo}
+}
+
+// IssueAPIKey creates a key with the given scopes for the namespace from ctx, the key itself is returned only here
+func (s *apiKey) IssueAPIKey(ctx context.Context, name string, scopes []string) (domain.IssuedAPIKey, error) {
+	ctx, span := tracer.Start(ctx, "APIKeyService.IssueAPIKey")
+	defer span.End()
+
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return domain.IssuedAPIKey{}, appErrors.InvalidField("scopes", errors.Join(appErrors.ErrorUnknownScope, errors.New(scope)))
+		}
+	}
+
+	id, err := randomHex(apiKeyIDBytes)
+	if err != nil {
+		return domain.IssuedAPIKey{}, err
+	}
+
+	secret, err := randomHex(apiKeySecretBytes)
+	if err != nil {
+		return domain.IssuedAPIKey{}, err
+	}
+
+	issued := domain.IssuedAPIKey{
+		APIKey: domain.APIKey{
+			ID:        id,
+			Name:      name,
+			Namespace: domain.NamespaceFromContext(ctx),
+			Scopes:    scopes,
+			CreatedAt: time.Now(),
+		},
+		Key: APIKeyPrefix + secret,
+	}
+
+	err = s.repo.CreateAPIKey(ctx, issued.APIKey, hashAPIKey(issued.Key))
+	if err != nil {
+		return domain.IssuedAPIKey{}, err
+	}
+
+	return issued, nil
+}
+
+func (s *apiKey) ReadAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	ctx, span := tracer.Start(ctx, "APIKeyService.ReadAPIKeys")
+	defer span.End()
+
+	return s.repo.ReadAPIKeys(ctx)
+}
+
+func (s *apiKey) RevokeAPIKey(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "APIKeyService.RevokeAPIKey")
+	defer span.End()
+
+	return s.repo.RevokeAPIKey(ctx, id)
+}
+
+// Authenticate returns the client of a not revoked key. Unknown keys result in an unauthenticated error
+func (s *apiKey) Authenticate(ctx context.Context, key string) (domain.Client, error) {
+	ctx, span := tracer.Start(ctx, "APIKeyService.Authenticate")
+	defer span.End()
+
+	// other credentials, e.g. JWTs, are not looked up in the database
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return domain.Client{}, appErrors.Unauthenticated()
+	}
+
+	storedKey, err := s.repo.ReadAPIKeyByHash(ctx, hashAPIKey(key))
+	if errors.Is(err, appErrors.ErrorAPIKeyNotFound) {
+		return domain.Client{}, appErrors.Unauthenticated()
+	} else if err != nil {
+		return domain.Client{}, err
+	}
+
+	return domain.Client{ID: "api_key:" + storedKey.ID, Name: storedKey.Name, Namespace: storedKey.Namespace, Scopes: storedKey.Scopes}, nil
+}
+
+// hashAPIKey does not need a salt or a slow hash, as keys are long random strings
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func isKnownScope(scope string) bool {
+	for _, s := range domain.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.EvaluationService = (*evaluation)(nil)
+)
+
+type evaluation struct {
+	repo domain.EvaluationRepository
+}
+
+func NewEvaluation(repo domain.EvaluationRepository) *evaluation {
+	return &evaluation{repo: repo}
+}
+
+func (s *evaluation) ReadSnapshot(ctx context.Context, userIDs []string) (domain.EvaluationSnapshot, error) {
+	ctx, span := tracer.Start(ctx, "EvaluationService.ReadSnapshot")
+	defer span.End()
+
+	return s.repo.ReadSnapshot(ctx, userIDs)
+}
+
+func (s *evaluation) ReadChanges(ctx context.Context, cursor domain.ChangesCursor, limit int) (domain.ChangesPage, error) {
+	ctx, span := tracer.Start(ctx, "EvaluationService.ReadChanges")
+	defer span.End()
+
+	return s.repo.ReadChanges(ctx, cursor, limit)
+}
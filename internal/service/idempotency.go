@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+)
+
+var (
+	_ domain.IdempotencyService = (*idempotency)(nil)
+)
+
+// idempotencyLockTimeout is how long a key stays reserved for a request in progress. A key of a request
+// which was interrupted, e.g. by a crash, may be used again after it
+const idempotencyLockTimeout = time.Minute
+
+type idempotency struct {
+	repo domain.IdempotencyRepository
+	ttl  time.Duration
+}
+
+// NewIdempotency keeps responses for ttl, retries made later are processed again
+func NewIdempotency(repo domain.IdempotencyRepository, ttl time.Duration) *idempotency {
+	return &idempotency{repo: repo, ttl: ttl}
+}
+
+func (s *idempotency) Begin(ctx context.Context, request domain.IdempotentRequest) (*domain.IdempotentResponse, error) {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.Begin")
+	defer span.End()
+
+	record, reserved, err := s.repo.ReserveIdempotencyKey(ctx, request, time.Now().Add(idempotencyLockTimeout))
+	if err != nil || reserved {
+		return nil, err
+	}
+
+	if record.Fingerprint != request.Fingerprint {
+		return nil, appErrors.IdempotencyKeyReused()
+	}
+
+	if record.Response == nil {
+		return nil, appErrors.IdempotencyKeyInProgress()
+	}
+
+	return record.Response, nil
+}
+
+func (s *idempotency) Complete(ctx context.Context, request domain.IdempotentRequest, response domain.IdempotentResponse) error {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.Complete")
+	defer span.End()
+
+	return s.repo.SaveIdempotentResponse(ctx, request, response, time.Now().Add(s.ttl))
+}
+
+func (s *idempotency) Abort(ctx context.Context, request domain.IdempotentRequest) error {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.Abort")
+	defer span.End()
+
+	return s.repo.ReleaseIdempotencyKey(ctx, request)
+}
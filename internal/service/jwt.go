@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+)
+
+var (
+	_ domain.Authenticator = (*jwtAuth)(nil)
+)
+
+// jwtMethods are asymmetric only, so a public key from JWKS can never be used as an HMAC secret
+var jwtMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+type jwtAuth struct {
+	keys           domain.JWTKeys
+	parser         *jwt.Parser
+	scopeClaim     string
+	namespaceClaim string
+}
+
+func NewJWT(keys domain.JWTKeys, options domain.JWTOptions) *jwtAuth {
+	parserOptions := []jwt.ParserOption{jwt.WithValidMethods(jwtMethods), jwt.WithLeeway(options.Leeway)}
+	if options.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(options.Issuer))
+	}
+
+	if options.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(options.Audience))
+	}
+
+	scopeClaim := options.ScopeClaim
+	if scopeClaim == "" {
+		scopeClaim = "scope"
+	}
+
+	namespaceClaim := options.NamespaceClaim
+	if namespaceClaim == "" {
+		namespaceClaim = "namespace"
+	}
+
+	return &jwtAuth{keys: keys, parser: jwt.NewParser(parserOptions...), scopeClaim: scopeClaim, namespaceClaim: namespaceClaim}
+}
+
+// Authenticate validates the token and maps its scope claim to the scopes of the API, unknown scopes are ignored.
+// The reason of a token being rejected is only logged, clients get an unauthenticated error
+func (s *jwtAuth) Authenticate(ctx context.Context, token string) (domain.Client, error) {
+	ctx, span := tracer.Start(ctx, "JWTAuth.Authenticate")
+	defer span.End()
+
+	// API keys are not JWTs, there is no need to parse them
+	if strings.HasPrefix(token, APIKeyPrefix) {
+		return domain.Client{}, appErrors.Unauthenticated()
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := s.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return s.keys.Key(ctx, kid)
+	})
+	if err == nil {
+		err = requireExpiration(claims)
+	}
+
+	if err != nil {
+		logger.FromContext(ctx).Debugln("token rejected:", err)
+		return domain.Client{}, appErrors.Unauthenticated()
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		logger.FromContext(ctx).Debugln("token rejected: no subject")
+		return domain.Client{}, appErrors.Unauthenticated()
+	}
+
+	return domain.Client{ID: "jwt:" + subject, Name: clientName(claims, subject), Namespace: s.namespace(claims), Scopes: s.scopes(claims)}, nil
+}
+
+// namespace gives tokens without the claim access only to the default namespace
+func (s *jwtAuth) namespace(claims jwt.MapClaims) string {
+	if namespace, ok := claims[s.namespaceClaim].(string); ok && namespace != "" {
+		return namespace
+	}
+
+	return domain.DefaultNamespace
+}
+
+// scopes reads the claim either as a space separated string, as OAuth does, or as an array of strings
+func (s *jwtAuth) scopes(claims jwt.MapClaims) []string {
+	var raw []string
+	switch value := claims[s.scopeClaim].(type) {
+	case string:
+		raw = strings.Fields(value)
+	case []interface{}:
+		for _, item := range value {
+			if scope, ok := item.(string); ok {
+				raw = append(raw, scope)
+			}
+		}
+	}
+
+	scopes := make([]string, 0, len(raw))
+	for _, scope := range raw {
+		if isKnownScope(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+func requireExpiration(claims jwt.MapClaims) error {
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		return err
+	}
+
+	if exp == nil {
+		return appErrors.ErrorNoExpiration
+	}
+
+	return nil
+}
+
+// clientName prefers the OAuth client of the token, as tokens of services usually have a technical subject
+func clientName(claims jwt.MapClaims, subject string) string {
+	for _, claim := range []string{"azp", "client_id"} {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			return name
+		}
+	}
+
+	return subject
+}
@@ -21,13 +21,19 @@ func NewReport(repo domain.ReportRepository) *report {
 }
 
 func (s *report) ReadUserSegmentsHistory(ctx context.Context, userID string, startDate, endDate time.Time, limit, offset int) ([]domain.HistoryElem, error) {
+	ctx, span := tracer.Start(ctx, "ReportService.ReadUserSegmentsHistory")
+	defer span.End()
+
 	return s.repo.ReadUserSegmentsHistory(ctx, userID, startDate, endDate, limit, offset)
 }
 
 func (s *report) CreateCSV(ctx context.Context, userID string, startDate, endDate time.Time) (string, error) {
+	ctx, span := tracer.Start(ctx, "ReportService.CreateCSV")
+	defer span.End()
+
 	return s.repo.CreateCSV(ctx, userID, startDate, endDate)
 }
 
-func (s *report) SendCSVReportFile(reportName string, writer io.Writer) error {
-	return s.repo.SendCSVReportFile(reportName, writer)
+func (s *report) SendCSVReportFile(ctx context.Context, reportName string, writer io.Writer) error {
+	return s.repo.SendCSVReportFile(ctx, reportName, writer)
 }
@@ -21,18 +21,41 @@ func NewSegment(repo domain.SegmentRepository) *segment {
 	return &segment{repo: repo}
 }
 
-func (s *segment) CreateSegment(ctx context.Context, slug string) error {
+func (s *segment) CreateSegment(ctx context.Context, slug string, options domain.SegmentOptions) error {
+	ctx, span := tracer.Start(ctx, "SegmentService.CreateSegment")
+	defer span.End()
+
 	if slugValidator.IsSlug(strings.ToLower(slug)) {
-		return s.repo.CreateSegment(ctx, slug)
+		return s.repo.CreateSegment(ctx, slug, options)
 	}
 
-	return appErrors.ErrorNotASlug
+	return appErrors.InvalidSlug(slug)
+}
+
+func (s *segment) UpdateSegment(ctx context.Context, slug string, options domain.SegmentOptions) error {
+	ctx, span := tracer.Start(ctx, "SegmentService.UpdateSegment")
+	defer span.End()
+
+	return s.repo.UpdateSegment(ctx, slug, options)
 }
 
 func (s *segment) DeleteSegment(ctx context.Context, slug string) error {
+	ctx, span := tracer.Start(ctx, "SegmentService.DeleteSegment")
+	defer span.End()
+
 	return s.repo.DeleteSegment(ctx, slug)
 }
 
+func (s *segment) ReadSegments(ctx context.Context) ([]domain.Segment, error) {
+	ctx, span := tracer.Start(ctx, "SegmentService.ReadSegments")
+	defer span.End()
+
+	return s.repo.ReadSegments(ctx)
+}
+
 func (s *segment) AddSegmentToPercentOfUsers(ctx context.Context, slug string, percent int) error {
+	ctx, span := tracer.Start(ctx, "SegmentService.AddSegmentToPercentOfUsers")
+	defer span.End()
+
 	return s.repo.AddSegmentToPercentOfUsers(ctx, slug, percent)
 }
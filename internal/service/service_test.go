@@ -2,16 +2,20 @@ package service
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 
 	appErrors "github.com/PoorMercymain/user-segmenter/errors"
 	"github.com/PoorMercymain/user-segmenter/internal/domain"
 	"github.com/PoorMercymain/user-segmenter/internal/domain/mocks"
-	"github.com/PoorMercymain/user-segmenter/pkg/logger"
 )
 
 func TestNewSegment(t *testing.T) {
@@ -28,7 +32,6 @@ func TestNewSegment(t *testing.T) {
 }
 
 func TestCreateSegment(t *testing.T) {
-	logger.InitLogger()
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -36,17 +39,36 @@ func TestCreateSegment(t *testing.T) {
 
 	seg := NewSegment(mockRepo)
 
-	mockRepo.EXPECT().CreateSegment(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockRepo.EXPECT().CreateSegment(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
-	err := seg.CreateSegment(context.Background(), "~not~a~slug~")
+	err := seg.CreateSegment(context.Background(), "~not~a~slug~", domain.SegmentOptions{})
 	require.Error(t, err)
 
-	err = seg.CreateSegment(context.Background(), "a-slug")
+	err = seg.CreateSegment(context.Background(), "a-slug", domain.SegmentOptions{})
+	require.NoError(t, err)
+}
+
+func TestUpdateSegment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockSegmentRepository(ctrl)
+
+	seg := NewSegment(mockRepo)
+
+	mockRepo.EXPECT().UpdateSegment(gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorNoRows).MaxTimes(1)
+	mockRepo.EXPECT().UpdateSegment(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	ttl := 48 * time.Hour
+
+	err := seg.UpdateSegment(context.Background(), "a-slug", domain.SegmentOptions{DefaultTTL: &ttl})
+	require.Error(t, err)
+
+	err = seg.UpdateSegment(context.Background(), "a-slug", domain.SegmentOptions{DefaultTTL: &ttl})
 	require.NoError(t, err)
 }
 
 func TestDeleteSegment(t *testing.T) {
-	logger.InitLogger()
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -60,8 +82,22 @@ func TestDeleteSegment(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestReadSegments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockSegmentRepository(ctrl)
+
+	seg := NewSegment(mockRepo)
+
+	mockRepo.EXPECT().ReadSegments(gomock.Any()).Return([]domain.Segment{{Slug: "a-slug"}}, nil).AnyTimes()
+
+	segments, err := seg.ReadSegments(context.Background())
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+}
+
 func TestUpdateUserSegments(t *testing.T) {
-	logger.InitLogger()
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -80,7 +116,6 @@ func TestUpdateUserSegments(t *testing.T) {
 }
 
 func TestReadUserSegments(t *testing.T) {
-	logger.InitLogger()
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -101,7 +136,6 @@ func TestReadUserSegments(t *testing.T) {
 }
 
 func TestReadUserSegmentsHistory(t *testing.T) {
-	logger.InitLogger()
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -122,7 +156,6 @@ func TestReadUserSegmentsHistory(t *testing.T) {
 }
 
 func TestCreateDeletionTime(t *testing.T) {
-	logger.InitLogger()
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -140,8 +173,101 @@ func TestCreateDeletionTime(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestReadDeletionTimes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockUserRepository(ctrl)
+
+	usr := NewUser(mockRepo)
+
+	mockRepo.EXPECT().ReadDeletionTimes(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
+	mockRepo.EXPECT().ReadDeletionTimes(gomock.Any(), gomock.Any(), gomock.Any()).Return([]domain.DeletionTime{{UserID: "1", Slug: "a", DeletionTime: time.Now()}}, nil).AnyTimes()
+
+	deletionTimes, err := usr.ReadDeletionTimes(context.Background(), "1", "")
+	require.Error(t, err)
+	require.Empty(t, deletionTimes)
+
+	deletionTimes, err = usr.ReadDeletionTimes(context.Background(), "1", "")
+	require.NoError(t, err)
+	require.Len(t, deletionTimes, 1)
+}
+
+func TestUpdateDeletionTime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockUserRepository(ctrl)
+
+	usr := NewUser(mockRepo)
+
+	mockRepo.EXPECT().UpdateDeletionTime(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorNoRows).MaxTimes(1)
+	mockRepo.EXPECT().UpdateDeletionTime(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	err := usr.UpdateDeletionTime(context.Background(), "1", "a", time.Now())
+	require.Error(t, err)
+
+	err = usr.UpdateDeletionTime(context.Background(), "1", "a", time.Now())
+	require.NoError(t, err)
+}
+
+func TestDeleteDeletionTime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockUserRepository(ctrl)
+
+	usr := NewUser(mockRepo)
+
+	mockRepo.EXPECT().DeleteDeletionTime(gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorNoRows).MaxTimes(1)
+	mockRepo.EXPECT().DeleteDeletionTime(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	err := usr.DeleteDeletionTime(context.Background(), "1", "a")
+	require.Error(t, err)
+
+	err = usr.DeleteDeletionTime(context.Background(), "1", "a")
+	require.NoError(t, err)
+}
+
+func TestScheduleUserSegments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockUserRepository(ctrl)
+
+	usr := NewUser(mockRepo)
+
+	mockRepo.EXPECT().ScheduleUserSegments(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(appErrors.ErrorNoRows).MaxTimes(1)
+	mockRepo.EXPECT().ScheduleUserSegments(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	err := usr.ScheduleUserSegments(context.Background(), "1", []string{"a"}, time.Now(), nil)
+	require.Error(t, err)
+
+	err = usr.ScheduleUserSegments(context.Background(), "1", []string{"a"}, time.Now(), nil)
+	require.NoError(t, err)
+}
+
+func TestReadScheduledAssignments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockUserRepository(ctrl)
+
+	usr := NewUser(mockRepo)
+
+	mockRepo.EXPECT().ReadScheduledAssignments(gomock.Any(), gomock.Any()).Return(nil, appErrors.ErrorLoggerNotInitialized).MaxTimes(1)
+	mockRepo.EXPECT().ReadScheduledAssignments(gomock.Any(), gomock.Any()).Return([]domain.ScheduledAssignment{{UserID: "1", Slug: "a", StartsAt: time.Now()}}, nil).AnyTimes()
+
+	assignments, err := usr.ReadScheduledAssignments(context.Background(), "1")
+	require.Error(t, err)
+	require.Empty(t, assignments)
+
+	assignments, err = usr.ReadScheduledAssignments(context.Background(), "1")
+	require.NoError(t, err)
+	require.Len(t, assignments, 1)
+}
+
 func TestAddSegmentToPercentOfUsers(t *testing.T) {
-	logger.InitLogger()
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -158,3 +284,228 @@ func TestAddSegmentToPercentOfUsers(t *testing.T) {
 	err = seg.AddSegmentToPercentOfUsers(context.Background(), "a", 10)
 	require.NoError(t, err)
 }
+
+func TestIssueAPIKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockAPIKeyRepository(ctrl)
+
+	keys := NewAPIKey(mockRepo)
+
+	var storedHash string
+	mockRepo.EXPECT().CreateAPIKey(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ domain.APIKey, keyHash string) error {
+		storedHash = keyHash
+		return nil
+	}).Times(1)
+
+	_, err := keys.IssueAPIKey(context.Background(), "billing", []string{"users:delete"})
+	require.ErrorIs(t, err, appErrors.ErrorUnknownScope)
+	require.Equal(t, appErrors.CodeInvalidField, appErrors.CodeOf(err))
+
+	issued, err := keys.IssueAPIKey(context.Background(), "billing", []string{domain.ScopeUsersRead})
+	require.NoError(t, err)
+	require.NotEmpty(t, issued.ID)
+	require.Equal(t, []string{domain.ScopeUsersRead}, issued.Scopes)
+	require.Contains(t, issued.Key, APIKeyPrefix)
+	require.NotContains(t, storedHash, issued.Key)
+	require.Equal(t, hashAPIKey(issued.Key), storedHash)
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockAPIKeyRepository(ctrl)
+
+	keys := NewAPIKey(mockRepo)
+
+	mockRepo.EXPECT().ReadAPIKeyByHash(gomock.Any(), hashAPIKey("usk_valid")).Return(domain.APIKey{ID: "1", Name: "billing", Scopes: []string{domain.ScopeUsersRead}}, nil).AnyTimes()
+	mockRepo.EXPECT().ReadAPIKeyByHash(gomock.Any(), hashAPIKey("usk_broken")).Return(domain.APIKey{}, appErrors.ErrorLoggerNotInitialized).AnyTimes()
+	mockRepo.EXPECT().ReadAPIKeyByHash(gomock.Any(), gomock.Any()).Return(domain.APIKey{}, appErrors.APIKeyNotFound()).AnyTimes()
+
+	client, err := keys.Authenticate(context.Background(), "usk_valid")
+	require.NoError(t, err)
+	require.Equal(t, "api_key:1", client.ID)
+	require.True(t, client.HasScope(domain.ScopeUsersRead))
+	require.False(t, client.HasScope(domain.ScopeUsersWrite))
+
+	_, err = keys.Authenticate(context.Background(), "usk_revoked")
+	require.Equal(t, appErrors.CodeUnauthenticated, appErrors.CodeOf(err))
+
+	_, err = keys.Authenticate(context.Background(), "eyJhbGciOiJSUzI1NiJ9.e30.c2ln")
+	require.Equal(t, appErrors.CodeUnauthenticated, appErrors.CodeOf(err))
+
+	_, err = keys.Authenticate(context.Background(), "usk_broken")
+	require.ErrorIs(t, err, appErrors.ErrorLoggerNotInitialized)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockAPIKeyRepository(ctrl)
+
+	keys := NewAPIKey(mockRepo)
+
+	mockRepo.EXPECT().RevokeAPIKey(gomock.Any(), "1").Return(nil).Times(1)
+	mockRepo.EXPECT().RevokeAPIKey(gomock.Any(), gomock.Any()).Return(appErrors.APIKeyNotFound()).AnyTimes()
+	mockRepo.EXPECT().ReadAPIKeys(gomock.Any()).Return([]domain.APIKey{{ID: "1"}}, nil).Times(1)
+
+	require.NoError(t, keys.RevokeAPIKey(context.Background(), "1"))
+	require.ErrorIs(t, keys.RevokeAPIKey(context.Background(), "2"), appErrors.ErrorNoRows)
+
+	list, err := keys.ReadAPIKeys(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+}
+
+type staticKeys map[string]crypto.PublicKey
+
+func (k staticKeys) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	key, ok := k[kid]
+	if !ok {
+		return nil, appErrors.ErrorJWKNotFound
+	}
+
+	return key, nil
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	auth := NewJWT(staticKeys{"key": &private.PublicKey}, domain.JWTOptions{Issuer: "https://idp.example.com", Audience: "user-segmenter"})
+
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = "key"
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   "https://idp.example.com",
+			"aud":   "user-segmenter",
+			"sub":   "service-account-1",
+			"azp":   "billing",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "openid users:read segments:write",
+		}
+	}
+
+	client, err := auth.Authenticate(context.Background(), sign(jwt.SigningMethodES256, private, valid()))
+	require.NoError(t, err)
+	require.Equal(t, "jwt:service-account-1", client.ID)
+	require.Equal(t, "billing", client.Name)
+	require.Equal(t, []string{domain.ScopeUsersRead, domain.ScopeSegmentsWrite}, client.Scopes)
+	require.Equal(t, domain.DefaultNamespace, client.Namespace)
+
+	claims := valid()
+	claims["namespace"] = "team-a"
+
+	client, err = auth.Authenticate(context.Background(), sign(jwt.SigningMethodES256, private, claims))
+	require.NoError(t, err)
+	require.Equal(t, "team-a", client.Namespace)
+
+	invalid := []func(claims jwt.MapClaims){
+		func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+		func(claims jwt.MapClaims) { delete(claims, "exp") },
+		func(claims jwt.MapClaims) { claims["iss"] = "https://other.example.com" },
+		func(claims jwt.MapClaims) { claims["aud"] = "other-service" },
+		func(claims jwt.MapClaims) { delete(claims, "sub") },
+	}
+
+	for _, change := range invalid {
+		claims := valid()
+		change(claims)
+
+		_, err = auth.Authenticate(context.Background(), sign(jwt.SigningMethodES256, private, claims))
+		require.Equal(t, appErrors.CodeUnauthenticated, appErrors.CodeOf(err))
+	}
+
+	_, err = auth.Authenticate(context.Background(), sign(jwt.SigningMethodHS256, []byte("secret"), valid()))
+	require.Equal(t, appErrors.CodeUnauthenticated, appErrors.CodeOf(err))
+
+	_, err = auth.Authenticate(context.Background(), APIKeyPrefix+"0123")
+	require.Equal(t, appErrors.CodeUnauthenticated, appErrors.CodeOf(err))
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, err = auth.Authenticate(context.Background(), sign(jwt.SigningMethodES256, other, valid()))
+	require.Equal(t, appErrors.CodeUnauthenticated, appErrors.CodeOf(err))
+
+	arrayAuth := NewJWT(staticKeys{"key": &private.PublicKey}, domain.JWTOptions{ScopeClaim: "scp"})
+
+	claims = valid()
+	delete(claims, "azp")
+	claims["scp"] = []string{domain.ScopeReportsRead, "profile"}
+
+	client, err = arrayAuth.Authenticate(context.Background(), sign(jwt.SigningMethodES256, private, claims))
+	require.NoError(t, err)
+	require.Equal(t, "service-account-1", client.Name)
+	require.Equal(t, []string{domain.ScopeReportsRead}, client.Scopes)
+}
+
+func TestEvaluation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockEvaluationRepository(ctrl)
+
+	evl := NewEvaluation(mockRepo)
+
+	mockRepo.EXPECT().ReadSnapshot(gomock.Any(), []string{"1"}).Return(domain.EvaluationSnapshot{Cursor: "10.0"}, nil)
+	mockRepo.EXPECT().ReadChanges(gomock.Any(), domain.ChangesCursor{Tx: 10}, 100).Return(domain.ChangesPage{}, appErrors.CursorExpired())
+
+	snapshot, err := evl.ReadSnapshot(context.Background(), []string{"1"})
+	require.NoError(t, err)
+	require.Equal(t, "10.0", snapshot.Cursor)
+
+	_, err = evl.ReadChanges(context.Background(), domain.ChangesCursor{Tx: 10}, 100)
+	require.ErrorIs(t, err, appErrors.ErrorCursorExpired)
+}
+
+func TestIdempotency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockIdempotencyRepository(ctrl)
+
+	idm := NewIdempotency(mockRepo, time.Hour)
+	request := domain.IdempotentRequest{ClientID: "key-1", Key: "retry-1", Fingerprint: "A"}
+	response := domain.IdempotentResponse{Status: 202}
+
+	gomock.InOrder(
+		mockRepo.EXPECT().ReserveIdempotencyKey(gomock.Any(), request, gomock.Any()).Return(domain.IdempotencyRecord{}, true, nil),
+		mockRepo.EXPECT().ReserveIdempotencyKey(gomock.Any(), request, gomock.Any()).Return(domain.IdempotencyRecord{Fingerprint: "A"}, false, nil),
+		mockRepo.EXPECT().ReserveIdempotencyKey(gomock.Any(), request, gomock.Any()).Return(domain.IdempotencyRecord{Fingerprint: "B", Response: &response}, false, nil),
+		mockRepo.EXPECT().ReserveIdempotencyKey(gomock.Any(), request, gomock.Any()).Return(domain.IdempotencyRecord{Fingerprint: "A", Response: &response}, false, nil),
+	)
+
+	stored, err := idm.Begin(context.Background(), request)
+	require.NoError(t, err)
+	require.Nil(t, stored)
+
+	_, err = idm.Begin(context.Background(), request)
+	require.Equal(t, appErrors.CodeIdempotencyKeyInProgress, appErrors.CodeOf(err))
+
+	_, err = idm.Begin(context.Background(), request)
+	require.Equal(t, appErrors.CodeIdempotencyKeyReused, appErrors.CodeOf(err))
+
+	stored, err = idm.Begin(context.Background(), request)
+	require.NoError(t, err)
+	require.Equal(t, &response, stored)
+
+	mockRepo.EXPECT().SaveIdempotentResponse(gomock.Any(), request, response, gomock.Any()).DoAndReturn(func(_ context.Context, _ domain.IdempotentRequest, _ domain.IdempotentResponse, expiresAt time.Time) error {
+		require.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+		return nil
+	})
+	require.NoError(t, idm.Complete(context.Background(), request, response))
+
+	mockRepo.EXPECT().ReleaseIdempotencyKey(gomock.Any(), request).Return(nil)
+	require.NoError(t, idm.Abort(context.Background(), request))
+}
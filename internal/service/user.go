@@ -20,13 +20,57 @@ func NewUser(repo domain.UserRepository) *user {
 }
 
 func (s *user) UpdateUserSegments(ctx context.Context, userID string, slugsToAdd []string, slugsToDelete []string) error {
+	ctx, span := tracer.Start(ctx, "UserService.UpdateUserSegments")
+	defer span.End()
+
 	return s.repo.UpdateUserSegments(ctx, userID, slugsToAdd, slugsToDelete)
 }
 
 func (s *user) ReadUserSegments(ctx context.Context, userID string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "UserService.ReadUserSegments")
+	defer span.End()
+
 	return s.repo.ReadUserSegments(ctx, userID)
 }
 
 func (s *user) CreateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error {
+	ctx, span := tracer.Start(ctx, "UserService.CreateDeletionTime")
+	defer span.End()
+
 	return s.repo.CreateDeletionTime(ctx, userID, slug, deletionTime)
 }
+
+func (s *user) ReadDeletionTimes(ctx context.Context, userID string, slug string) ([]domain.DeletionTime, error) {
+	ctx, span := tracer.Start(ctx, "UserService.ReadDeletionTimes")
+	defer span.End()
+
+	return s.repo.ReadDeletionTimes(ctx, userID, slug)
+}
+
+func (s *user) UpdateDeletionTime(ctx context.Context, userID string, slug string, deletionTime time.Time) error {
+	ctx, span := tracer.Start(ctx, "UserService.UpdateDeletionTime")
+	defer span.End()
+
+	return s.repo.UpdateDeletionTime(ctx, userID, slug, deletionTime)
+}
+
+func (s *user) DeleteDeletionTime(ctx context.Context, userID string, slug string) error {
+	ctx, span := tracer.Start(ctx, "UserService.DeleteDeletionTime")
+	defer span.End()
+
+	return s.repo.DeleteDeletionTime(ctx, userID, slug)
+}
+
+func (s *user) ScheduleUserSegments(ctx context.Context, userID string, slugs []string, startsAt time.Time, endsAt *time.Time) error {
+	ctx, span := tracer.Start(ctx, "UserService.ScheduleUserSegments")
+	defer span.End()
+
+	return s.repo.ScheduleUserSegments(ctx, userID, slugs, startsAt, endsAt)
+}
+
+func (s *user) ReadScheduledAssignments(ctx context.Context, userID string) ([]domain.ScheduledAssignment, error) {
+	ctx, span := tracer.Start(ctx, "UserService.ReadScheduledAssignments")
+	defer span.End()
+
+	return s.repo.ReadScheduledAssignments(ctx, userID)
+}
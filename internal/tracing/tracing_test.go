@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+)
+
+func TestInit(t *testing.T) {
+	shutdown, err := Init(context.Background(), ExporterNone)
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	shutdown, err = Init(context.Background(), ExporterStdout)
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	_, err = Init(context.Background(), "zipkin")
+	require.ErrorIs(t, err, appErrors.ErrorUnknownTracingExporter)
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	_, err := Init(context.Background(), ExporterNone)
+	require.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+
+	e := echo.New()
+	e.Use(otelecho.Middleware(ServiceName))
+	e.GET("/api/user/:user", func(c echo.Context) error {
+		_, span := otel.Tracer("test").Start(c.Request().Context(), "UserService.ReadUserSegments")
+		span.End()
+		return c.NoContent(http.StatusOK)
+	})
+
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/user/1", nil)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		require.Equal(t, "0af7651916cd43dd8448eb211c80319c", span.SpanContext().TraceID().String())
+	}
+	require.Equal(t, "/api/user/:user", spans[1].Name())
+	require.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
@@ -0,0 +1,275 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/pkg/logger"
+)
+
+var tracer = otel.Tracer("github.com/PoorMercymain/user-segmenter/internal/worker")
+
+// Stats is a snapshot of the scheduler counters
+type Stats struct {
+	Runs            int64
+	FailedRuns      int64
+	Expired         int64
+	Retired         int64
+	Activated       int64
+	PrunedChanges   int64
+	PrunedKeys      int64
+	FailedRows      int64
+	LastRun         time.Time
+	LastSuccess     time.Time
+	LastRunDuration time.Duration
+}
+
+type Scheduler struct {
+	segRepo   domain.SegmentRepository
+	usrRepo   domain.UserRepository
+	evlRepo   domain.EvaluationRepository
+	idmRepo   domain.IdempotencyRepository
+	interval  atomic.Int64
+	batchSize atomic.Int64
+
+	runs            atomic.Int64
+	failedRuns      atomic.Int64
+	expired         atomic.Int64
+	retired         atomic.Int64
+	activated       atomic.Int64
+	prunedChanges   atomic.Int64
+	prunedKeys      atomic.Int64
+	failedRows      atomic.Int64
+	lastRun         atomic.Int64
+	lastSuccess     atomic.Int64
+	lastRunDuration atomic.Int64
+	started         atomic.Int64
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	reset    chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewScheduler(segRepo domain.SegmentRepository, usrRepo domain.UserRepository, evlRepo domain.EvaluationRepository, idmRepo domain.IdempotencyRepository, interval time.Duration, batchSize int, log *zap.SugaredLogger) *Scheduler {
+	ctx, cancel := context.WithCancel(logger.WithContext(context.Background(), log))
+
+	s := &Scheduler{
+		segRepo: segRepo,
+		usrRepo: usrRepo,
+		evlRepo: evlRepo,
+		idmRepo: idmRepo,
+		ctx:     ctx,
+		cancel:  cancel,
+		reset:   make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.interval.Store(int64(interval))
+	s.batchSize.Store(int64(batchSize))
+
+	return s
+}
+
+// SetInterval changes the interval between runs, the next run starts the new interval after the current one
+func (s *Scheduler) SetInterval(interval time.Duration) {
+	if time.Duration(s.interval.Swap(int64(interval))) == interval {
+		return
+	}
+
+	select {
+	case s.reset <- struct{}{}:
+	default:
+	}
+}
+
+// SetBatchSize changes the size of batches, starting with the next one
+func (s *Scheduler) SetBatchSize(batchSize int) {
+	s.batchSize.Store(int64(batchSize))
+}
+
+// Start runs the scheduler loop in a separate goroutine until Stop is called
+func (s *Scheduler) Start() {
+	s.started.Store(time.Now().UnixNano())
+	go s.run()
+}
+
+// Stop waits for the current run to finish. If ctx expires first, the run is cancelled
+// and its transaction is rolled back
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+
+	select {
+	case <-s.done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) Stats() Stats {
+	return Stats{
+		Runs:            s.runs.Load(),
+		FailedRuns:      s.failedRuns.Load(),
+		Expired:         s.expired.Load(),
+		Retired:         s.retired.Load(),
+		Activated:       s.activated.Load(),
+		PrunedChanges:   s.prunedChanges.Load(),
+		PrunedKeys:      s.prunedKeys.Load(),
+		FailedRows:      s.failedRows.Load(),
+		LastRun:         unixNanoToTime(s.lastRun.Load()),
+		LastSuccess:     unixNanoToTime(s.lastSuccess.Load()),
+		LastRunDuration: time.Duration(s.lastRunDuration.Load()),
+	}
+}
+
+// Check reports an error if the scheduler has not finished a run successfully for several intervals
+func (s *Scheduler) Check(ctx context.Context) error {
+	staleAfter := 3 * time.Duration(s.interval.Load())
+	if staleAfter < time.Minute {
+		staleAfter = time.Minute
+	}
+
+	lastSuccess := s.lastSuccess.Load()
+	if lastSuccess == 0 {
+		lastSuccess = s.started.Load()
+	}
+
+	if lastSuccess == 0 || time.Since(time.Unix(0, lastSuccess)) > staleAfter {
+		return appErrors.ErrorSchedulerStale
+	}
+
+	return nil
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(time.Duration(s.interval.Load()))
+	defer ticker.Stop()
+
+	for {
+		s.tick(s.ctx)
+
+		if !s.wait(ticker) {
+			return
+		}
+	}
+}
+
+// wait waits for the next tick and returns false when the scheduler is stopping
+func (s *Scheduler) wait(ticker *time.Ticker) bool {
+	for {
+		select {
+		case <-s.stop:
+			return false
+		case <-s.reset:
+			ticker.Reset(time.Duration(s.interval.Load()))
+		case <-ticker.C:
+			return true
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "scheduler.tick")
+	defer span.End()
+
+	log := logger.FromContext(ctx)
+
+	start := time.Now()
+	s.runs.Add(1)
+	s.lastRun.Store(start.UnixNano())
+
+	var expired, retired, activated, pruned, prunedKeys, failed int
+	err := s.drain(ctx, s.segRepo.DeleteExpiredSegments, &expired, &failed)
+	if err == nil {
+		err = s.drain(ctx, s.segRepo.RetireExpiredSegments, &retired, &failed)
+	}
+	if err == nil {
+		err = s.drain(ctx, s.usrRepo.ActivateScheduledAssignments, &activated, &failed)
+	}
+	if err == nil {
+		err = s.drain(ctx, withoutFailedRows(s.evlRepo.PruneChanges), &pruned, &failed)
+	}
+	if err == nil {
+		err = s.drain(ctx, withoutFailedRows(s.idmRepo.PruneIdempotencyKeys), &prunedKeys, &failed)
+	}
+
+	s.expired.Add(int64(expired))
+	s.retired.Add(int64(retired))
+	s.activated.Add(int64(activated))
+	s.prunedChanges.Add(int64(pruned))
+	s.prunedKeys.Add(int64(prunedKeys))
+	s.failedRows.Add(int64(failed))
+	s.lastRunDuration.Store(int64(time.Since(start)))
+
+	if err != nil {
+		s.failedRuns.Add(1)
+		log.Errorln("scheduler run failed:", err)
+		return
+	}
+
+	s.lastSuccess.Store(time.Now().UnixNano())
+
+	if expired != 0 || retired != 0 || activated != 0 || pruned != 0 || prunedKeys != 0 || failed != 0 {
+		log.Infoln("scheduler run finished, expired:", expired, "retired segments:", retired, "activated:", activated, "pruned changes:", pruned, "pruned idempotency keys:", prunedKeys, "failed:", failed, "took:", time.Since(start))
+	}
+}
+
+// drain processes batches until there are no more due rows or the scheduler is stopping. The rows which failed
+// stay due, so they are left out of the next batches of the run, a full batch of them doesn't stop the run early
+func (s *Scheduler) drain(ctx context.Context, batch func(ctx context.Context, batchSize int, failedRows domain.FailedRows) (int, int, error), processed *int, failed *int) error {
+	failedRows := make(domain.FailedRows)
+	for {
+		batchSize := int(s.batchSize.Load())
+		failedBefore := len(failedRows)
+		processedInBatch, failedInBatch, err := batch(ctx, batchSize, failedRows)
+		if err != nil {
+			return err
+		}
+
+		*processed += processedInBatch
+		*failed += failedInBatch
+
+		// a batch which neither processed a row nor added a failed one would take the same rows again
+		if processedInBatch+failedInBatch < batchSize || (processedInBatch == 0 && len(failedRows) == failedBefore) {
+			return nil
+		}
+
+		select {
+		case <-s.stop:
+			return nil
+		default:
+		}
+	}
+}
+
+// withoutFailedRows adapts batches whose rows don't fail one by one
+func withoutFailedRows(batch func(ctx context.Context, batchSize int) (int, int, error)) func(context.Context, int, domain.FailedRows) (int, int, error) {
+	return func(ctx context.Context, batchSize int, _ domain.FailedRows) (int, int, error) {
+		return batch(ctx, batchSize)
+	}
+}
+
+func unixNanoToTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
@@ -0,0 +1,215 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/domain/mocks"
+)
+
+func TestSchedulerDrainsBatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockSegmentRepository(ctrl)
+	mockUsrRepo := mocks.NewMockUserRepository(ctrl)
+	mockEvlRepo := mocks.NewMockEvaluationRepository(ctrl)
+	mockIdmRepo := mocks.NewMockIdempotencyRepository(ctrl)
+
+	gomock.InOrder(
+		mockRepo.EXPECT().DeleteExpiredSegments(gomock.Any(), 2, gomock.Any()).Return(2, 0, nil),
+		mockRepo.EXPECT().DeleteExpiredSegments(gomock.Any(), 2, gomock.Any()).Return(1, 1, nil),
+		mockRepo.EXPECT().DeleteExpiredSegments(gomock.Any(), 2, gomock.Any()).Return(1, 0, nil),
+		mockRepo.EXPECT().RetireExpiredSegments(gomock.Any(), 2, gomock.Any()).Return(1, 0, nil),
+		mockUsrRepo.EXPECT().ActivateScheduledAssignments(gomock.Any(), 2, gomock.Any()).Return(2, 0, nil),
+		mockUsrRepo.EXPECT().ActivateScheduledAssignments(gomock.Any(), 2, gomock.Any()).Return(0, 0, nil),
+		mockEvlRepo.EXPECT().PruneChanges(gomock.Any(), 2).Return(1, 0, nil),
+		mockIdmRepo.EXPECT().PruneIdempotencyKeys(gomock.Any(), 2).Return(2, 0, nil),
+		mockIdmRepo.EXPECT().PruneIdempotencyKeys(gomock.Any(), 2).Return(1, 0, nil),
+	)
+
+	sched := NewScheduler(mockRepo, mockUsrRepo, mockEvlRepo, mockIdmRepo, time.Hour, 2, zaptest.NewLogger(t).Sugar())
+	sched.tick(sched.ctx)
+
+	stats := sched.Stats()
+	require.Equal(t, int64(1), stats.Runs)
+	require.Equal(t, int64(0), stats.FailedRuns)
+	require.Equal(t, int64(4), stats.Expired)
+	require.Equal(t, int64(1), stats.Retired)
+	require.Equal(t, int64(2), stats.Activated)
+	require.Equal(t, int64(1), stats.PrunedChanges)
+	require.Equal(t, int64(3), stats.PrunedKeys)
+	require.Equal(t, int64(1), stats.FailedRows)
+	require.False(t, stats.LastSuccess.IsZero())
+}
+
+func TestSchedulerSkipsFailedRows(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockSegmentRepository(ctrl)
+	mockUsrRepo := mocks.NewMockUserRepository(ctrl)
+	mockEvlRepo := mocks.NewMockEvaluationRepository(ctrl)
+	mockIdmRepo := mocks.NewMockIdempotencyRepository(ctrl)
+
+	// the first batch is made of rows which always fail, they stay due and are taken first unless left out
+	due := []string{"broken-1", "broken-2", "1", "2", "3"}
+	mockRepo.EXPECT().DeleteExpiredSegments(gomock.Any(), 2, gomock.Any()).DoAndReturn(func(_ context.Context, batchSize int, failedRows domain.FailedRows) (int, int, error) {
+		processed, failed := 0, 0
+		remaining := due[:0]
+		for _, userID := range due {
+			key := domain.RowKey{UserID: userID, Slug: "A"}
+			if failedRows.Has(key) || processed+failed == batchSize {
+				remaining = append(remaining, userID)
+				continue
+			}
+
+			if strings.HasPrefix(userID, "broken") {
+				failedRows.Add(key)
+				remaining = append(remaining, userID)
+				failed++
+				continue
+			}
+			processed++
+		}
+		due = remaining
+
+		return processed, failed, nil
+	}).Times(3)
+	mockRepo.EXPECT().RetireExpiredSegments(gomock.Any(), 2, gomock.Any()).Return(0, 0, nil)
+	mockUsrRepo.EXPECT().ActivateScheduledAssignments(gomock.Any(), 2, gomock.Any()).Return(0, 0, nil)
+	mockEvlRepo.EXPECT().PruneChanges(gomock.Any(), 2).Return(0, 0, nil)
+	mockIdmRepo.EXPECT().PruneIdempotencyKeys(gomock.Any(), 2).Return(0, 0, nil)
+
+	sched := NewScheduler(mockRepo, mockUsrRepo, mockEvlRepo, mockIdmRepo, time.Hour, 2, zaptest.NewLogger(t).Sugar())
+	sched.tick(sched.ctx)
+
+	stats := sched.Stats()
+	require.Equal(t, int64(3), stats.Expired)
+	require.Equal(t, int64(2), stats.FailedRows)
+	require.Equal(t, []string{"broken-1", "broken-2"}, due)
+}
+
+func TestSchedulerFailedRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockSegmentRepository(ctrl)
+	mockUsrRepo := mocks.NewMockUserRepository(ctrl)
+	mockEvlRepo := mocks.NewMockEvaluationRepository(ctrl)
+	mockIdmRepo := mocks.NewMockIdempotencyRepository(ctrl)
+
+	mockRepo.EXPECT().DeleteExpiredSegments(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, 0, appErrors.ErrorNoRows)
+
+	sched := NewScheduler(mockRepo, mockUsrRepo, mockEvlRepo, mockIdmRepo, time.Hour, 10, zaptest.NewLogger(t).Sugar())
+	sched.tick(sched.ctx)
+
+	stats := sched.Stats()
+	require.Equal(t, int64(1), stats.Runs)
+	require.Equal(t, int64(1), stats.FailedRuns)
+	require.True(t, stats.LastSuccess.IsZero())
+	require.False(t, stats.LastRun.IsZero())
+}
+
+func TestSchedulerStop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockSegmentRepository(ctrl)
+	mockUsrRepo := mocks.NewMockUserRepository(ctrl)
+	mockEvlRepo := mocks.NewMockEvaluationRepository(ctrl)
+	mockIdmRepo := mocks.NewMockIdempotencyRepository(ctrl)
+
+	mockRepo.EXPECT().DeleteExpiredSegments(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, 0, nil).MinTimes(1)
+	mockRepo.EXPECT().RetireExpiredSegments(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, 0, nil).MinTimes(1)
+	mockUsrRepo.EXPECT().ActivateScheduledAssignments(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, 0, nil).MinTimes(1)
+	mockEvlRepo.EXPECT().PruneChanges(gomock.Any(), gomock.Any()).Return(0, 0, nil).MinTimes(1)
+	mockIdmRepo.EXPECT().PruneIdempotencyKeys(gomock.Any(), gomock.Any()).Return(0, 0, nil).MinTimes(1)
+
+	sched := NewScheduler(mockRepo, mockUsrRepo, mockEvlRepo, mockIdmRepo, time.Millisecond, 10, zaptest.NewLogger(t).Sugar())
+	sched.Start()
+
+	require.Eventually(t, func() bool {
+		return sched.Stats().Runs > 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	require.NoError(t, sched.Stop(ctx))
+	require.NoError(t, sched.Stop(ctx))
+
+	runs := sched.Stats().Runs
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, runs, sched.Stats().Runs)
+}
+
+func TestSchedulerCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockSegmentRepository(ctrl)
+	mockUsrRepo := mocks.NewMockUserRepository(ctrl)
+	mockEvlRepo := mocks.NewMockEvaluationRepository(ctrl)
+	mockIdmRepo := mocks.NewMockIdempotencyRepository(ctrl)
+
+	sched := NewScheduler(mockRepo, mockUsrRepo, mockEvlRepo, mockIdmRepo, time.Hour, 10, zaptest.NewLogger(t).Sugar())
+	require.ErrorIs(t, sched.Check(context.Background()), appErrors.ErrorSchedulerStale)
+
+	sched.started.Store(time.Now().UnixNano())
+	require.NoError(t, sched.Check(context.Background()))
+
+	sched.started.Store(time.Now().Add(-4 * time.Hour).UnixNano())
+	require.ErrorIs(t, sched.Check(context.Background()), appErrors.ErrorSchedulerStale)
+
+	sched.lastSuccess.Store(time.Now().Add(-time.Hour).UnixNano())
+	require.NoError(t, sched.Check(context.Background()))
+}
+
+func TestSchedulerSetInterval(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockSegmentRepository(ctrl)
+	mockUsrRepo := mocks.NewMockUserRepository(ctrl)
+	mockEvlRepo := mocks.NewMockEvaluationRepository(ctrl)
+	mockIdmRepo := mocks.NewMockIdempotencyRepository(ctrl)
+
+	runs := make(chan int, 10)
+	mockRepo.EXPECT().DeleteExpiredSegments(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, batchSize int, _ domain.FailedRows) (int, int, error) {
+		select {
+		case runs <- batchSize:
+		default:
+		}
+		return 0, 0, nil
+	}).MinTimes(2)
+	mockRepo.EXPECT().RetireExpiredSegments(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, 0, nil).MinTimes(2)
+	mockUsrRepo.EXPECT().ActivateScheduledAssignments(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, 0, nil).MinTimes(2)
+	mockEvlRepo.EXPECT().PruneChanges(gomock.Any(), gomock.Any()).Return(0, 0, nil).MinTimes(2)
+	mockIdmRepo.EXPECT().PruneIdempotencyKeys(gomock.Any(), gomock.Any()).Return(0, 0, nil).MinTimes(2)
+
+	sched := NewScheduler(mockRepo, mockUsrRepo, mockEvlRepo, mockIdmRepo, time.Hour, 10, zaptest.NewLogger(t).Sugar())
+	sched.Start()
+	require.Equal(t, 10, <-runs)
+
+	// the hour long interval is replaced without waiting for it to pass
+	sched.SetBatchSize(20)
+	sched.SetInterval(10 * time.Millisecond)
+
+	select {
+	case batchSize := <-runs:
+		require.Equal(t, 20, batchSize)
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler didn't run with the new interval")
+	}
+
+	require.NoError(t, sched.Stop(context.Background()))
+}
@@ -0,0 +1,4 @@
+// Package api contains protobuf definitions of the gRPC API and the code generated from them
+package api
+
+//go:generate protoc -I . --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative segmenter/v1/segmenter.proto
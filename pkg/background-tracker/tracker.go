@@ -0,0 +1,52 @@
+package backgroundtracker
+
+import (
+	"context"
+	"sync"
+)
+
+// Tracker keeps track of goroutines started outside of request handling,
+// so they can be waited for on shutdown instead of being killed mid-transaction
+type Tracker struct {
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func New() *Tracker {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Tracker{ctx: ctx, cancel: cancel}
+}
+
+// Go runs f in a new goroutine. The context passed to f is cancelled only when Shutdown gives up waiting.
+// Go should not be called after Shutdown
+func (t *Tracker) Go(f func(ctx context.Context)) {
+	t.wg.Add(1)
+
+	go func() {
+		defer t.wg.Done()
+		f(t.ctx)
+	}()
+}
+
+// Shutdown waits for all tracked goroutines. If ctx is done first, the goroutines' context is cancelled,
+// Shutdown waits for them to return and ctx error is returned
+func (t *Tracker) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.cancel()
+		return nil
+	case <-ctx.Done():
+		t.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,43 @@
+package backgroundtracker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownWaitsForGoroutines(t *testing.T) {
+	tracker := New()
+
+	var finished atomic.Int32
+	for i := 0; i < 3; i++ {
+		tracker.Go(func(ctx context.Context) {
+			time.Sleep(10 * time.Millisecond)
+			finished.Add(1)
+		})
+	}
+
+	err := tracker.Shutdown(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int32(3), finished.Load())
+}
+
+func TestShutdownCancelsAfterDeadline(t *testing.T) {
+	tracker := New()
+
+	var cancelled atomic.Bool
+	tracker.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		cancelled.Store(true)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := tracker.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.True(t, cancelled.Load())
+}
@@ -0,0 +1,266 @@
+// Package client is a Go client of the user-segmenter HTTP API
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+
+	apiKeyHeader          = "X-API-Key"
+	namespaceHeader       = "X-Namespace"
+	readConsistencyHeader = "X-Read-Consistency"
+	idempotencyKeyHeader  = "Idempotency-Key"
+)
+
+type Config struct {
+	// HTTPClient sends the requests, http.DefaultClient is used when it is nil
+	HTTPClient *http.Client
+	// APIKey is sent in the X-API-Key header
+	APIKey string
+	// BearerToken is a JWT or an API key sent in the Authorization header, it is not sent when APIKey is set
+	BearerToken string
+	// Namespace is sent in the X-Namespace header, the server uses the default namespace when it is empty
+	Namespace string
+	// StrongReads sends reads to the primary database, so they see the writes made just before. Otherwise
+	// the server may read from replicas, which lag behind a little
+	StrongReads bool
+	// Gzip compresses bodies of the requests which the server accepts compressed
+	Gzip bool
+	// MaxRetries is the amount of retries of requests failed with 5xx or 429, 0 uses DefaultMaxRetries
+	// and a negative value disables retries
+	MaxRetries int
+	// MinBackoff and MaxBackoff limit the exponential delay between retries, defaults are used when they are 0
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+	cfg     Config
+}
+
+// New creates a client of the server at baseURL, e.g. http://localhost:8080
+func New(baseURL string, cfg Config) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.New("base URL should contain a scheme and a host")
+	}
+
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+
+	switch {
+	case cfg.MaxRetries == 0:
+		cfg.MaxRetries = DefaultMaxRetries
+	case cfg.MaxRetries < 0:
+		cfg.MaxRetries = 0
+	}
+
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = cfg.MinBackoff
+	}
+
+	return &Client{baseURL: u, http: cfg.HTTPClient, cfg: cfg}, nil
+}
+
+// InNamespace returns a copy of the client which sends requests to another namespace
+func (c *Client) InNamespace(namespace string) *Client {
+	clone := *c
+	clone.cfg.Namespace = namespace
+	return &clone
+}
+
+// WithStrongReads returns a copy of the client whose reads see the writes made just before
+func (c *Client) WithStrongReads() *Client {
+	clone := *c
+	clone.cfg.StrongReads = true
+	return &clone
+}
+
+// request describes a call of the API. body is encoded as JSON, gzip marks routes accepting compressed bodies
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	gzip   bool
+	// noRetry is set for requests whose 5xx responses are meaningful, e.g. the readiness check
+	noRetry bool
+	// idempotent requests are sent with an Idempotency-Key which is the same for every attempt, so a retry
+	// of a request which has been processed gets the first response instead of being processed again
+	idempotent bool
+}
+
+// do sends the request, retrying it on 5xx, 429 and on 409 for an earlier attempt still in progress. Responses with other statuses are returned as is,
+// the caller has to close the body
+func (c *Client) do(ctx context.Context, r request) (*http.Response, error) {
+	var body []byte
+	if r.body != nil {
+		var err error
+		body, err = json.Marshal(r.body)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.gzip && c.cfg.Gzip {
+			body, err = compress(body)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var idempotencyKey string
+	if r.idempotent {
+		key := make([]byte, 16)
+		if _, err := cryptorand.Read(key); err != nil {
+			return nil, err
+		}
+		idempotencyKey = hex.EncodeToString(key)
+	}
+
+	u := *c.baseURL
+	u.Path += r.path
+	u.RawQuery = r.query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, r.method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		if r.body != nil {
+			req.Header.Set("Content-Type", "application/json")
+			if r.gzip && c.cfg.Gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+		}
+
+		switch {
+		case c.cfg.APIKey != "":
+			req.Header.Set(apiKeyHeader, c.cfg.APIKey)
+		case c.cfg.BearerToken != "":
+			req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+		}
+
+		if c.cfg.Namespace != "" {
+			req.Header.Set(namespaceHeader, c.cfg.Namespace)
+		}
+
+		if c.cfg.StrongReads {
+			req.Header.Set(readConsistencyHeader, "strong")
+		}
+
+		if idempotencyKey != "" {
+			req.Header.Set(idempotencyKeyHeader, idempotencyKey)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		retry := retryable(resp.StatusCode) || (idempotencyKey != "" && inProgress(resp))
+		if r.noRetry || !retry || attempt >= c.cfg.MaxRetries {
+			return resp, nil
+		}
+
+		delay := c.backoff(attempt, resp.Header.Get("Retry-After"))
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// backoff returns the delay before the next attempt. It grows exponentially with jitter,
+// the Retry-After header of the server is used instead when it is longer
+func (c *Client) backoff(attempt int, retryAfter string) time.Duration {
+	delay := c.cfg.MaxBackoff
+	if attempt < 32 && c.cfg.MinBackoff<<attempt < c.cfg.MaxBackoff {
+		delay = c.cfg.MinBackoff << attempt
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && time.Duration(seconds)*time.Second > delay {
+		delay = time.Duration(seconds) * time.Second
+	}
+
+	return delay
+}
+
+func compress(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+
+	if _, err := gz.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// call sends the request and decodes a successful JSON response to out, if it is not nil.
+// Empty responses (204) leave out unchanged
+func (c *Client) call(ctx context.Context, r request, out interface{}) error {
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return responseError(resp)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
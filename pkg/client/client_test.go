@@ -0,0 +1,372 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/domain"
+	"github.com/PoorMercymain/user-segmenter/internal/domain/mocks"
+	"github.com/PoorMercymain/user-segmenter/internal/handler"
+	"github.com/PoorMercymain/user-segmenter/internal/middleware"
+	"github.com/PoorMercymain/user-segmenter/internal/service"
+)
+
+type testRepos struct {
+	seg *mocks.MockSegmentRepository
+	usr *mocks.MockUserRepository
+}
+
+// testServer serves the segment and user routes with the real handlers, so requests of the client are checked
+// by the same validation as in production
+func testServer(t *testing.T) (*Client, testRepos) {
+	ctrl := gomock.NewController(t)
+	repos := testRepos{seg: mocks.NewMockSegmentRepository(ctrl), usr: mocks.NewMockUserRepository(ctrl)}
+
+	e := echo.New()
+	e.HTTPErrorHandler = handler.ErrorHandler
+
+	segHan := handler.NewSegment(service.NewSegment(repos.seg))
+	usrHan := handler.NewUser(service.NewUser(repos.usr), 1024)
+
+	g := e.Group("/api", middleware.Namespace(), middleware.ReadConsistency())
+	g.POST("/segment", segHan.CreateSegment, middleware.UseGzipReader(0))
+	g.PATCH("/segment", segHan.UpdateSegment, middleware.UseGzipReader(0))
+	g.DELETE("/segment", segHan.DeleteSegment, middleware.UseGzipReader(0))
+	g.GET("/segment", segHan.ReadSegments)
+	g.POST("/user", usrHan.UpdateUserSegments, middleware.UseGzipReader(0))
+	g.GET("/user/:user", usrHan.ReadUserSegments)
+	g.GET("/ttl", usrHan.ReadDeletionTimes)
+	g.PATCH("/ttl", usrHan.UpdateDeletionTime, middleware.UseGzipReader(0))
+	g.DELETE("/ttl", usrHan.DeleteDeletionTime, middleware.UseGzipReader(0))
+	g.POST("/schedule", usrHan.ScheduleUserSegments, middleware.UseGzipReader(0))
+	g.GET("/schedule/:user", usrHan.ReadScheduledAssignments)
+
+	ts := httptest.NewServer(e)
+	t.Cleanup(ts.Close)
+
+	c, err := New(ts.URL, Config{Gzip: true, Namespace: "team-a", MaxRetries: -1})
+	require.NoError(t, err)
+
+	return c, repos
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("localhost:8080", Config{})
+	require.Error(t, err)
+
+	c, err := New("http://localhost:8080/", Config{})
+	require.NoError(t, err)
+	require.Equal(t, DefaultMaxRetries, c.cfg.MaxRetries)
+	require.Equal(t, "http://localhost:8080", c.baseURL.String())
+
+	c, err = New("http://localhost:8080", Config{MaxRetries: -1})
+	require.NoError(t, err)
+	require.Zero(t, c.cfg.MaxRetries)
+	require.Equal(t, "team-a", c.InNamespace("team-a").cfg.Namespace)
+	require.Empty(t, c.cfg.Namespace)
+	require.True(t, c.WithStrongReads().cfg.StrongReads)
+	require.False(t, c.cfg.StrongReads)
+}
+
+func TestSegments(t *testing.T) {
+	c, repos := testServer(t)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	repos.seg.EXPECT().CreateSegment(gomock.Any(), "A", gomock.Any()).DoAndReturn(func(ctx context.Context, _ string, options domain.SegmentOptions) error {
+		require.Equal(t, "team-a", domain.NamespaceFromContext(ctx))
+		require.Equal(t, 48*time.Hour, *options.DefaultTTL)
+		require.True(t, expiresAt.Equal(*options.ExpiresAt))
+		return nil
+	})
+	require.NoError(t, c.CreateSegment(ctx, Segment{Slug: "A", TTL: 48 * time.Hour, ExpiresAt: expiresAt}))
+
+	repos.seg.EXPECT().CreateSegment(gomock.Any(), "A", gomock.Any()).Return(appErrors.SegmentAlreadyExists("A"))
+	err := c.CreateSegment(ctx, Segment{Slug: "A"})
+	var clientErr *Error
+	require.ErrorAs(t, err, &clientErr)
+	require.Equal(t, http.StatusConflict, clientErr.Status)
+	require.Equal(t, appErrors.CodeSegmentAlreadyExists, clientErr.Code)
+	require.Equal(t, "A", clientErr.Slug)
+	require.ErrorIs(t, err, appErrors.ErrorUniqueViolation)
+
+	err = c.CreateSegment(ctx, Segment{Slug: "A", Percent: 101})
+	require.ErrorAs(t, err, &clientErr)
+	require.Zero(t, clientErr.Status)
+	require.Equal(t, "percent", clientErr.Field)
+
+	removeTTL := time.Duration(0)
+	repos.seg.EXPECT().UpdateSegment(gomock.Any(), "A", gomock.Any()).DoAndReturn(func(_ context.Context, _ string, options domain.SegmentOptions) error {
+		require.Zero(t, *options.DefaultTTL)
+		require.Nil(t, options.ExpiresAt)
+		return nil
+	})
+	require.NoError(t, c.UpdateSegment(ctx, SegmentUpdate{Slug: "A", TTL: &removeTTL}))
+
+	repos.seg.EXPECT().ReadSegments(gomock.Any()).Return([]domain.Segment{{Slug: "A", TTL: "48h0m0s", ExpiresAt: &expiresAt, CreatedBy: "key:1"}, {Slug: "B"}}, nil)
+	segments, err := c.ListSegments(ctx)
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	require.Equal(t, 48*time.Hour, segments[0].TTL)
+	require.True(t, expiresAt.Equal(segments[0].ExpiresAt))
+	require.Equal(t, "key:1", segments[0].CreatedBy)
+	require.Equal(t, SegmentInfo{Slug: "B"}, segments[1])
+
+	repos.seg.EXPECT().DeleteSegment(gomock.Any(), "B").Return(appErrors.SegmentNotFound("B"))
+	err = c.DeleteSegment(ctx, "B")
+	require.ErrorIs(t, err, appErrors.ErrorSegmentNotFound)
+	require.ErrorIs(t, err, appErrors.ErrorNoRows)
+}
+
+func TestUsers(t *testing.T) {
+	c, repos := testServer(t)
+	ctx := context.Background()
+	TTL := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	repos.usr.EXPECT().UpdateUserSegments(gomock.Any(), "1", []string{"A", "B"}, []string{"C"}).Return(nil)
+	repos.usr.EXPECT().CreateDeletionTime(gomock.Any(), "1", "A", gomock.Any()).Return(nil)
+	repos.usr.EXPECT().CreateDeletionTime(gomock.Any(), "1", "B", gomock.Any()).Return(nil)
+	err := c.UpdateUserSegments(ctx, UserUpdate{UserID: "1", Add: []Assignment{{Slug: "A", TTL: TTL}, {Slug: "B", TTL: TTL}}, Delete: []string{"C"}})
+	require.NoError(t, err)
+
+	err = c.UpdateUserSegments(ctx, UserUpdate{UserID: "1", Add: []Assignment{{Slug: "A", TTL: TTL}, {Slug: "B"}}})
+	var clientErr *Error
+	require.ErrorAs(t, err, &clientErr)
+	require.Equal(t, "ttl", clientErr.Field)
+	require.ErrorIs(t, err, appErrors.ErrorInvalidField)
+
+	repos.usr.EXPECT().UpdateUserSegments(gomock.Any(), "1", []string{}, []string{}).Return(nil)
+	require.NoError(t, c.UpdateUserSegments(ctx, UserUpdate{UserID: "1"}))
+
+	err = c.UpdateUserSegments(ctx, UserUpdate{})
+	require.ErrorAs(t, err, &clientErr)
+	require.Equal(t, http.StatusBadRequest, clientErr.Status)
+	require.Equal(t, appErrors.CodeMissingField, clientErr.Code)
+	require.Equal(t, "user_id", clientErr.Field)
+
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "1").Return([]string{"A"}, nil)
+	slugs, err := c.GetUserSegments(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"A"}, slugs)
+
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "2").Return(nil, nil)
+	slugs, err = c.GetUserSegments(ctx, "2")
+	require.NoError(t, err)
+	require.Nil(t, slugs)
+
+	repos.usr.EXPECT().ReadUserSegments(gomock.Any(), "1").DoAndReturn(func(ctx context.Context, _ string) ([]string, error) {
+		require.Equal(t, domain.ReadConsistencyStrong, domain.ReadConsistencyFromContext(ctx))
+		return []string{"A"}, nil
+	})
+	_, err = c.WithStrongReads().GetUserSegments(ctx, "1")
+	require.NoError(t, err)
+
+	repos.usr.EXPECT().ReadDeletionTimes(gomock.Any(), "1", "").Return([]domain.DeletionTime{{UserID: "1", Slug: "A", DeletionTime: TTL}}, nil)
+	deletionTimes, err := c.ListDeletionTimes(ctx, "1", "")
+	require.NoError(t, err)
+	require.Len(t, deletionTimes, 1)
+	require.True(t, TTL.Equal(deletionTimes[0].TTL))
+
+	repos.usr.EXPECT().UpdateDeletionTime(gomock.Any(), "1", "A", gomock.Any()).Return(nil)
+	require.NoError(t, c.UpdateDeletionTime(ctx, "1", "A", TTL))
+
+	repos.usr.EXPECT().DeleteDeletionTime(gomock.Any(), "1", "A").Return(appErrors.TTLNotFound("A"))
+	require.ErrorIs(t, c.DeleteDeletionTime(ctx, "1", "A"), appErrors.ErrorTTLNotFound)
+
+	repos.usr.EXPECT().ScheduleUserSegments(gomock.Any(), "1", []string{"A"}, gomock.Any(), nil).Return(nil)
+	require.NoError(t, c.ScheduleUserSegments(ctx, Schedule{UserID: "1", Slugs: []string{"A"}, StartsAt: TTL}))
+
+	repos.usr.EXPECT().ReadScheduledAssignments(gomock.Any(), "1").Return([]domain.ScheduledAssignment{{UserID: "1", Slug: "A", StartsAt: TTL}}, nil)
+	assignments, err := c.ListScheduledAssignments(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, assignments, 1)
+	require.Nil(t, assignments[0].EndsAt)
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "key", r.Header.Get(apiKeyHeader))
+		require.Empty(t, r.Header.Get("Authorization"))
+
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`["A"]`))
+		}
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL, Config{APIKey: "key", BearerToken: "token", MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	require.NoError(t, err)
+
+	slugs, err := c.GetUserSegments(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"A"}, slugs)
+	require.EqualValues(t, 3, calls.Load())
+
+	calls.Store(0)
+	c.cfg.MaxRetries = 1
+	_, err = c.GetUserSegments(context.Background(), "1")
+	var clientErr *Error
+	require.ErrorAs(t, err, &clientErr)
+	require.Equal(t, http.StatusTooManyRequests, clientErr.Status)
+	require.Equal(t, "too_many_requests", clientErr.Code)
+	require.EqualValues(t, 2, calls.Load())
+
+	// the server is not retried on client errors
+	calls.Store(0)
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", handler.ProblemContentType)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"status":403,"code":"insufficient_scope","field":"users:read","detail":"insufficient scope: users:read"}`))
+	}))
+	defer ts.Close()
+
+	c, err = New(ts.URL, Config{MinBackoff: time.Millisecond})
+	require.NoError(t, err)
+
+	_, err = c.GetUserSegments(context.Background(), "1")
+	require.ErrorIs(t, err, appErrors.ErrorInsufficientScope)
+	require.ErrorAs(t, err, &clientErr)
+	require.Equal(t, "users:read", clientErr.Field)
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	var calls atomic.Int32
+	var key string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			require.Empty(t, r.Header.Get(idempotencyKeyHeader))
+			w.Write([]byte(`["A"]`))
+			return
+		}
+
+		// every attempt of the request is sent with the same key
+		if calls.Add(1) == 1 {
+			key = r.Header.Get(idempotencyKeyHeader)
+			require.NotEmpty(t, key)
+		}
+		require.Equal(t, key, r.Header.Get(idempotencyKeyHeader))
+
+		switch calls.Load() {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Content-Type", handler.ProblemContentType)
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"status":409,"code":"idempotency_key_in_progress"}`))
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL, Config{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	require.NoError(t, err)
+
+	require.NoError(t, c.UpdateUserSegments(context.Background(), UserUpdate{UserID: "1", Delete: []string{"A"}}))
+	require.EqualValues(t, 3, calls.Load())
+
+	_, err = c.GetUserSegments(context.Background(), "1")
+	require.NoError(t, err)
+
+	// another call gets another key
+	firstKey := key
+	calls.Store(0)
+	require.NoError(t, c.UpdateUserSegments(context.Background(), UserUpdate{UserID: "1", Delete: []string{"A"}}))
+	require.NotEqual(t, firstKey, key)
+}
+
+func TestRetriesContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL, Config{BearerToken: "token"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = c.GetUserSegments(ctx, "1")
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestBackoff(t *testing.T) {
+	c, err := New("http://localhost:8080", Config{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	require.NoError(t, err)
+
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		delay := c.backoff(attempt, "")
+		require.GreaterOrEqual(t, delay, max/2)
+		require.LessOrEqual(t, delay, max)
+	}
+
+	require.Equal(t, 2*time.Second, c.backoff(0, "2"))
+	require.LessOrEqual(t, c.backoff(100, ""), time.Second)
+}
+
+func TestReports(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/user-history/1":
+			require.Equal(t, "2023-9", r.URL.Query().Get("start"))
+			require.Empty(t, r.URL.Query().Get("end"))
+			w.Write([]byte("http://0.0.0.0:8080/api/ns/team-a/reports/report1.csv"))
+		case "/api/reports/report1.csv":
+			require.Equal(t, "team-a", r.Header.Get(namespaceHeader))
+			w.Write([]byte("1,A,addition,2023-09-30 20:19:05\n"))
+		case "/api/reports/empty.csv":
+			w.WriteHeader(http.StatusNoContent)
+		case "/readyz":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"not ready","checks":{"postgres":{"status":"error","error":"connection refused"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL, Config{Namespace: "team-a"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	link, err := c.CreateHistoryReport(ctx, "1", Period{Start: time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+
+	report, err := c.ReadHistoryReport(ctx, link)
+	require.NoError(t, err)
+	require.Equal(t, "1,A,addition,2023-09-30 20:19:05\n", string(report))
+
+	report, err = c.ReadHistoryReport(ctx, "empty.csv")
+	require.NoError(t, err)
+	require.Nil(t, report)
+
+	_, err = c.ReadHistoryReport(ctx, "unknown.csv")
+	require.ErrorIs(t, err, appErrors.ErrorNoRows)
+
+	status, err := c.Readiness(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "not ready", status.Status)
+	require.Equal(t, "error", status.Checks["postgres"].Status)
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+)
+
+const maxErrorBodySize = 64 << 10
+
+// Error is a problem details response of the server. Code is one of the Code* constants of the errors package,
+// Status is 0 for requests rejected by the client before they were sent
+type Error struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Slug   string `json:"slug"`
+	Field  string `json:"field"`
+	// RetryAfter is the delay requested by the server when the client is rate limited
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Code
+	if e.Status != 0 {
+		msg = strconv.Itoa(e.Status) + " " + msg
+	}
+
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+
+	return msg
+}
+
+// Unwrap returns the error of the errors package with the same code, so errors.Is(err, appErrors.ErrorNoRows)
+// works with responses of the server like it does on the server itself
+func (e *Error) Unwrap() error {
+	return sentinels[e.Code]
+}
+
+var sentinels = map[string]error{
+	appErrors.CodeNotFound:                 appErrors.ErrorNoRows,
+	appErrors.CodeSegmentNotFound:          appErrors.ErrorSegmentNotFound,
+	appErrors.CodeSegmentAlreadyExists:     appErrors.ErrorUniqueViolation,
+	appErrors.CodeUserNotFound:             appErrors.ErrorUserNotFound,
+	appErrors.CodeUserNotInSegment:         appErrors.ErrorUserNotInSegment,
+	appErrors.CodeTTLNotFound:              appErrors.ErrorTTLNotFound,
+	appErrors.CodeInvalidSlug:              appErrors.ErrorNotASlug,
+	appErrors.CodeInvalidContentType:       appErrors.ErrorInvalidContentType,
+	appErrors.CodeInvalidJSON:              appErrors.ErrorInvalidJSON,
+	appErrors.CodeDuplicateJSONKey:         appErrors.ErrorDuplicateInJSON,
+	appErrors.CodeUnknownField:             appErrors.ErrorUnknownField,
+	appErrors.CodeMissingField:             appErrors.ErrorMissingField,
+	appErrors.CodeInvalidField:             appErrors.ErrorInvalidField,
+	appErrors.CodeReportNotFound:           appErrors.ErrorFileNotFound,
+	appErrors.CodeInvalidReportName:        appErrors.ErrorBadFilename,
+	appErrors.CodeUnauthenticated:          appErrors.ErrorUnauthenticated,
+	appErrors.CodeInsufficientScope:        appErrors.ErrorInsufficientScope,
+	appErrors.CodeAPIKeyNotFound:           appErrors.ErrorAPIKeyNotFound,
+	appErrors.CodeInvalidNamespace:         appErrors.ErrorInvalidNamespace,
+	appErrors.CodeNamespaceForbidden:       appErrors.ErrorNamespaceForbidden,
+	appErrors.CodeRateLimited:              appErrors.ErrorRateLimited,
+	appErrors.CodeBodyTooLarge:             appErrors.ErrorBodyTooLarge,
+	appErrors.CodeCursorExpired:            appErrors.ErrorCursorExpired,
+	appErrors.CodeIdempotencyKeyReused:     appErrors.ErrorIdempotencyKeyReused,
+	appErrors.CodeIdempotencyKeyInProgress: appErrors.ErrorIdempotencyKeyInProgress,
+}
+
+// responseError reads an error response. Responses which are not problem details, e.g. of a proxy,
+// get a code made of the status text like the server does for errors without a code
+func responseError(resp *http.Response) error {
+	e := &Error{
+		Status: resp.StatusCode,
+		Code:   strings.ReplaceAll(strings.ToLower(http.StatusText(resp.StatusCode)), " ", "_"),
+		Title:  http.StatusText(resp.StatusCode),
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return fmt.Errorf("%w: %w", e, err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/problem+json" {
+		if err := json.Unmarshal(body, e); err == nil {
+			e.Status = resp.StatusCode
+			return e
+		}
+	}
+
+	e.Detail = strings.TrimSpace(string(body))
+	return e
+}
+
+// inProgress reports whether the response says that an earlier attempt of the request is still being processed.
+// The body is read, so it is replaced with a copy for the caller
+func inProgress(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusConflict {
+		return false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var e Error
+	return json.Unmarshal(body, &e) == nil && e.Code == appErrors.CodeIdempotencyKeyInProgress
+}
+
+// invalidField is returned for arguments which the server would reject, without sending the request
+func invalidField(field string, detail string) error {
+	return &Error{Code: appErrors.CodeInvalidField, Title: "Bad Request", Detail: detail, Field: field}
+}
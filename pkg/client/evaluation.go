@@ -0,0 +1,284 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/pkg/evaluation"
+)
+
+const (
+	DefaultSyncInterval = 5 * time.Second
+
+	// maxSnapshotUsers is the limit of users in one snapshot request of the server
+	maxSnapshotUsers = 1000
+)
+
+// Snapshot is the state of segments and users for local evaluation, changes after it are read starting with Cursor
+type Snapshot struct {
+	Cursor   string               `json:"cursor"`
+	Segments []evaluation.Segment `json:"segments"`
+	Users    []evaluation.User    `json:"users"`
+}
+
+// Change tells that the user or the segment was changed, their new state is read with a snapshot
+type Change struct {
+	UserID string `json:"user_id,omitempty"`
+	Slug   string `json:"slug,omitempty"`
+}
+
+type ChangesPage struct {
+	Changes []Change `json:"changes"`
+	Cursor  string   `json:"cursor"`
+	HasMore bool     `json:"has_more"`
+}
+
+type snapshotBody struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// EvaluationSnapshot returns all segments and the users from userIDs which exist, up to 1000 users at once
+func (c *Client) EvaluationSnapshot(ctx context.Context, userIDs []string) (Snapshot, error) {
+	var snapshot Snapshot
+	err := c.call(ctx, request{method: http.MethodPost, path: "/api/evaluation/snapshot", body: snapshotBody{UserIDs: userIDs}, gzip: true}, &snapshot)
+	return snapshot, err
+}
+
+// EvaluationChanges returns changes after the cursor, limit 0 uses the default of the server.
+// The error wraps appErrors.ErrorCursorExpired when changes after the cursor were pruned
+func (c *Client) EvaluationChanges(ctx context.Context, cursor string, limit int) (ChangesPage, error) {
+	query := url.Values{"cursor": {cursor}}
+	if limit != 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var page ChangesPage
+	err := c.call(ctx, request{method: http.MethodGet, path: "/api/evaluation/changes", query: query}, &page)
+	return page, err
+}
+
+type LocalConfig struct {
+	// UserIDs are the users evaluated locally, other users are not known to the evaluator
+	UserIDs []string
+	// SyncInterval is the delay between reads of the changes feed, DefaultSyncInterval is used when it is 0
+	SyncInterval time.Duration
+	// OnError is called with errors of the background sync, the last known state is used until a sync succeeds
+	OnError func(error)
+}
+
+// LocalEvaluator answers whether users are in segments without requests, using the state downloaded from the server.
+// The state is refreshed in the background from the changes feed, results are the same as the server gives
+// for the same state
+type LocalEvaluator struct {
+	client   *Client
+	userIDs  []string
+	users    map[string]struct{}
+	state    *evaluation.State
+	interval time.Duration
+	onError  func(error)
+	now      func() time.Time
+
+	// mu serializes syncs, cursor is changed only under it
+	mu     sync.Mutex
+	cursor string
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewLocalEvaluator downloads the state of the users and starts the background sync, which runs until Close.
+// The namespace of the client is used
+func (c *Client) NewLocalEvaluator(ctx context.Context, cfg LocalConfig) (*LocalEvaluator, error) {
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = DefaultSyncInterval
+	}
+
+	e := &LocalEvaluator{
+		client:   c,
+		userIDs:  cfg.UserIDs,
+		users:    make(map[string]struct{}, len(cfg.UserIDs)),
+		state:    evaluation.NewState(),
+		interval: cfg.SyncInterval,
+		onError:  cfg.OnError,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	for _, userID := range cfg.UserIDs {
+		e.users[userID] = struct{}{}
+	}
+
+	e.mu.Lock()
+	err := e.resync(ctx)
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	go e.run()
+
+	return e, nil
+}
+
+// IsMember returns whether the user is in the segment now
+func (e *LocalEvaluator) IsMember(userID string, slug string) bool {
+	return e.state.IsMember(userID, slug, e.now())
+}
+
+// Segments returns the segments the user is in now, found is false for users which don't exist
+// or were not configured
+func (e *LocalEvaluator) Segments(userID string) (slugs []string, found bool) {
+	return e.state.Segments(userID, e.now())
+}
+
+// Close stops the background sync
+func (e *LocalEvaluator) Close() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+	<-e.done
+}
+
+func (e *LocalEvaluator) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+		err := e.Sync(ctx)
+		cancel()
+
+		if err != nil && e.onError != nil {
+			e.onError(err)
+		}
+	}
+}
+
+// Sync applies the changes made since the previous sync. It is called in the background and may be called
+// to refresh the state right away. When the changes were pruned, the whole state is downloaded again
+func (e *LocalEvaluator) Sync(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cursor := e.cursor
+	changedUsers := make(map[string]struct{})
+	segmentsChanged := false
+
+	for {
+		page, err := e.client.EvaluationChanges(ctx, cursor, 0)
+		if errors.Is(err, appErrors.ErrorCursorExpired) {
+			return e.resync(ctx)
+		} else if err != nil {
+			return err
+		}
+
+		for _, change := range page.Changes {
+			if change.Slug != "" {
+				segmentsChanged = true
+			}
+
+			if _, ok := e.users[change.UserID]; ok {
+				changedUsers[change.UserID] = struct{}{}
+			}
+		}
+
+		cursor = page.Cursor
+		if !page.HasMore {
+			break
+		}
+	}
+
+	userIDs := make([]string, 0, len(changedUsers))
+	for userID := range changedUsers {
+		userIDs = append(userIDs, userID)
+	}
+
+	if segmentsChanged || len(userIDs) != 0 {
+		if err := e.refresh(ctx, userIDs); err != nil {
+			return err
+		}
+	}
+
+	e.cursor = cursor
+	return nil
+}
+
+// refresh downloads the segments and the users. Users missing in the snapshot were deleted
+func (e *LocalEvaluator) refresh(ctx context.Context, userIDs []string) error {
+	var segments []evaluation.Segment
+	users := make(map[string]evaluation.User, len(userIDs))
+
+	for start := 0; start == 0 || start < len(userIDs); start += maxSnapshotUsers {
+		end := start + maxSnapshotUsers
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+
+		snapshot, err := e.client.EvaluationSnapshot(ctx, userIDs[start:end])
+		if err != nil {
+			return err
+		}
+
+		segments = snapshot.Segments
+		for _, user := range snapshot.Users {
+			users[user.UserID] = user
+		}
+	}
+
+	e.state.SetSegments(segments)
+	for _, userID := range userIDs {
+		if user, ok := users[userID]; ok {
+			e.state.SetUser(user)
+		} else {
+			e.state.DeleteUser(userID)
+		}
+	}
+
+	return nil
+}
+
+// resync downloads the whole state. The cursor of the first snapshot is kept, so changes made while
+// the other parts were downloaded are applied again on the next sync
+func (e *LocalEvaluator) resync(ctx context.Context) error {
+	var cursor string
+	var segments []evaluation.Segment
+	var users []evaluation.User
+
+	for start := 0; start == 0 || start < len(e.userIDs); start += maxSnapshotUsers {
+		end := start + maxSnapshotUsers
+		if end > len(e.userIDs) {
+			end = len(e.userIDs)
+		}
+
+		snapshot, err := e.client.EvaluationSnapshot(ctx, e.userIDs[start:end])
+		if err != nil {
+			return err
+		}
+
+		if cursor == "" {
+			cursor = snapshot.Cursor
+		}
+		segments = snapshot.Segments
+		users = append(users, snapshot.Users...)
+	}
+
+	e.state.Reset(segments, users)
+	e.cursor = cursor
+	return nil
+}
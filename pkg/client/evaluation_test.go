@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+	"github.com/PoorMercymain/user-segmenter/internal/handler"
+	"github.com/PoorMercymain/user-segmenter/pkg/evaluation"
+)
+
+// fakeFeed serves snapshots of its state and the changes appended to it, the cursor is the amount of changes
+type fakeFeed struct {
+	mu        sync.Mutex
+	segments  []evaluation.Segment
+	users     map[string]evaluation.User
+	changes   []Change
+	pruned    int
+	snapshots [][]string
+}
+
+func (f *fakeFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/api/evaluation/snapshot":
+		var body snapshotBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.snapshots = append(f.snapshots, body.UserIDs)
+
+		snapshot := Snapshot{Cursor: cursorOf(len(f.changes)), Segments: f.segments, Users: make([]evaluation.User, 0)}
+		for _, userID := range body.UserIDs {
+			if user, ok := f.users[userID]; ok {
+				snapshot.Users = append(snapshot.Users, user)
+			}
+		}
+		json.NewEncoder(w).Encode(snapshot)
+	case "/api/evaluation/changes":
+		position, err := strconv.Atoi(r.URL.Query().Get("cursor"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if position < f.pruned {
+			w.Header().Set("Content-Type", handler.ProblemContentType)
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"status":410,"code":"cursor_expired","field":"cursor"}`))
+			return
+		}
+
+		// pages of a single change check that the client follows has_more
+		page := ChangesPage{Changes: make([]Change, 0), Cursor: cursorOf(position)}
+		if position < len(f.changes) {
+			page.Changes = append(page.Changes, f.changes[position])
+			page.Cursor = cursorOf(position + 1)
+			page.HasMore = position+1 < len(f.changes)
+		}
+		json.NewEncoder(w).Encode(page)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func cursorOf(position int) string {
+	return strconv.Itoa(position)
+}
+
+func TestLocalEvaluatorVectors(t *testing.T) {
+	vectors, err := evaluation.Vectors()
+	require.NoError(t, err)
+
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			feed := &fakeFeed{segments: v.Segments, users: make(map[string]evaluation.User)}
+			for _, user := range v.Users {
+				feed.users[user.UserID] = user
+			}
+
+			ts := httptest.NewServer(feed)
+			defer ts.Close()
+
+			c, err := New(ts.URL, Config{})
+			require.NoError(t, err)
+
+			userIDs := make([]string, 0, len(v.Expected))
+			for _, expected := range v.Expected {
+				userIDs = append(userIDs, expected.UserID)
+			}
+
+			e, err := c.NewLocalEvaluator(context.Background(), LocalConfig{UserIDs: userIDs, SyncInterval: time.Hour})
+			require.NoError(t, err)
+			defer e.Close()
+			e.now = func() time.Time { return v.Now }
+
+			for _, expected := range v.Expected {
+				slugs, found := e.Segments(expected.UserID)
+				require.Equal(t, expected.Found, found, expected.UserID)
+				if found {
+					require.Equal(t, expected.Segments, slugs, expected.UserID)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalEvaluatorSync(t *testing.T) {
+	feed := &fakeFeed{
+		segments: []evaluation.Segment{{Slug: "A"}, {Slug: "B"}},
+		users: map[string]evaluation.User{
+			"1": {UserID: "1", Memberships: []evaluation.Membership{{Slug: "A"}}},
+			"2": {UserID: "2", Memberships: []evaluation.Membership{{Slug: "B"}}},
+		},
+	}
+
+	ts := httptest.NewServer(feed)
+	defer ts.Close()
+
+	c, err := New(ts.URL, Config{})
+	require.NoError(t, err)
+
+	e, err := c.NewLocalEvaluator(context.Background(), LocalConfig{UserIDs: []string{"1", "3"}, SyncInterval: time.Hour})
+	require.NoError(t, err)
+	defer e.Close()
+
+	require.True(t, e.IsMember("1", "A"))
+	require.False(t, e.IsMember("2", "B"), "users which were not configured are not known")
+	_, found := e.Segments("3")
+	require.False(t, found)
+
+	// nothing changed, nothing is downloaded
+	require.NoError(t, e.Sync(context.Background()))
+	require.Len(t, feed.snapshots, 1)
+
+	expired := time.Now().Add(-time.Minute)
+	feed.mu.Lock()
+	feed.segments = []evaluation.Segment{{Slug: "A", ExpiresAt: &expired}, {Slug: "B"}}
+	feed.users["1"] = evaluation.User{UserID: "1", Memberships: []evaluation.Membership{{Slug: "A"}, {Slug: "B"}}}
+	feed.users["2"] = evaluation.User{UserID: "2", Memberships: []evaluation.Membership{}}
+	feed.users["3"] = evaluation.User{UserID: "3", Memberships: []evaluation.Membership{{Slug: "B"}}}
+	feed.changes = append(feed.changes, Change{Slug: "A"}, Change{UserID: "1"}, Change{UserID: "2"}, Change{UserID: "3"})
+	feed.mu.Unlock()
+
+	require.NoError(t, e.Sync(context.Background()))
+	require.ElementsMatch(t, []string{"1", "3"}, feed.snapshots[1], "only changed users which were configured are downloaded")
+
+	slugs, found := e.Segments("1")
+	require.True(t, found)
+	require.Equal(t, []string{"B"}, slugs)
+	require.True(t, e.IsMember("3", "B"))
+
+	feed.mu.Lock()
+	delete(feed.users, "3")
+	feed.changes = append(feed.changes, Change{UserID: "3"})
+	feed.pruned = len(feed.changes)
+	feed.mu.Unlock()
+
+	// the cursor of the evaluator was pruned, so the whole state is downloaded again
+	require.NoError(t, e.Sync(context.Background()))
+	require.ElementsMatch(t, []string{"1", "3"}, feed.snapshots[2])
+	_, found = e.Segments("3")
+	require.False(t, found)
+
+	_, err = c.EvaluationChanges(context.Background(), cursorOf(0), 0)
+	require.ErrorIs(t, err, appErrors.ErrorCursorExpired)
+}
+
+func TestLocalEvaluatorBackgroundSync(t *testing.T) {
+	feed := &fakeFeed{segments: []evaluation.Segment{{Slug: "A"}}, users: map[string]evaluation.User{}}
+
+	ts := httptest.NewServer(feed)
+	defer ts.Close()
+
+	c, err := New(ts.URL, Config{})
+	require.NoError(t, err)
+
+	e, err := c.NewLocalEvaluator(context.Background(), LocalConfig{UserIDs: []string{"1"}, SyncInterval: time.Millisecond})
+	require.NoError(t, err)
+	defer e.Close()
+
+	require.False(t, e.IsMember("1", "A"))
+
+	feed.mu.Lock()
+	feed.users["1"] = evaluation.User{UserID: "1", Memberships: []evaluation.Membership{{Slug: "A"}}}
+	feed.changes = append(feed.changes, Change{UserID: "1"})
+	feed.mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		return e.IsMember("1", "A")
+	}, time.Second, time.Millisecond)
+
+	e.Close()
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Liveness returns an error when the server is not running
+func (c *Client) Liveness(ctx context.Context) error {
+	return c.call(ctx, request{method: http.MethodGet, path: "/healthz", noRetry: true}, nil)
+}
+
+// Readiness returns the state of the server and its dependencies, a server which is not ready is not an error
+func (c *Client) Readiness(ctx context.Context) (HealthStatus, error) {
+	var status HealthStatus
+
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/readyz", noRetry: true})
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return status, responseError(resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	return status, err
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Namespace string     `json:"namespace"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IssuedAPIKey contains the key itself, it can't be read again
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type apiKeyBody struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// IssueAPIKey creates a key in the namespace of the client
+func (c *Client) IssueAPIKey(ctx context.Context, name string, scopes []string) (IssuedAPIKey, error) {
+	var issued IssuedAPIKey
+	err := c.call(ctx, request{method: http.MethodPost, path: "/api/keys", body: apiKeyBody{Name: name, Scopes: scopes}}, &issued)
+	return issued, err
+}
+
+func (c *Client) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	err := c.call(ctx, request{method: http.MethodGet, path: "/api/keys"}, &keys)
+	return keys, err
+}
+
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: "/api/keys/" + url.PathEscape(id), idempotent: true}, nil)
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+const monthLayout = "2006-1"
+
+// Period limits a history report by months, zero Start or End leaves the period open
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// CreateHistoryReport creates a CSV report of the user segments history and returns the link to it
+func (c *Client) CreateHistoryReport(ctx context.Context, userID string, period Period) (string, error) {
+	query := url.Values{}
+	if !period.Start.IsZero() {
+		query.Set("start", period.Start.Format(monthLayout))
+	}
+
+	if !period.End.IsZero() {
+		query.Set("end", period.End.Format(monthLayout))
+	}
+
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/api/user-history/" + url.PathEscape(userID), query: query})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", responseError(resp)
+	}
+
+	link, err := io.ReadAll(resp.Body)
+	return string(link), err
+}
+
+// ReadHistoryReport returns the CSV report by the link returned by CreateHistoryReport or by its file name.
+// The report is requested from the base URL of the client, as the host in the link may be unreachable
+func (c *Client) ReadHistoryReport(ctx context.Context, link string) ([]byte, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/api/reports/" + url.PathEscape(path.Base(link))})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, responseError(resp)
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	return io.ReadAll(resp.Body)
+}
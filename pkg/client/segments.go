@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type Segment struct {
+	Slug string
+	// Percent of users is added to the segment in the background after it is created
+	Percent int
+	// TTL is the default time users stay in the segment, 0 keeps them forever
+	TTL time.Duration
+	// ExpiresAt is the time when the segment is deleted, zero time keeps it forever
+	ExpiresAt time.Time
+}
+
+// SegmentUpdate changes only the settings which are not nil, a zero value removes the setting
+type SegmentUpdate struct {
+	Slug      string
+	TTL       *time.Duration
+	ExpiresAt *time.Time
+}
+
+// SegmentInfo is a segment as it is listed by the server
+type SegmentInfo struct {
+	Slug      string
+	TTL       time.Duration
+	ExpiresAt time.Time
+	// CreatedBy and UpdatedBy are the clients which created and last changed the segment, e.g. key:<id>
+	CreatedBy string
+	UpdatedBy string
+}
+
+type segmentBody struct {
+	Slug      string  `json:"slug"`
+	Percent   int     `json:"percent,omitempty"`
+	TTL       *string `json:"ttl,omitempty"`
+	ExpiresAt *string `json:"expires_at,omitempty"`
+}
+
+func (c *Client) CreateSegment(ctx context.Context, segment Segment) error {
+	if segment.Percent < 0 || segment.Percent > 100 {
+		return invalidField("percent", "percent should be between 0 and 100")
+	}
+
+	body := segmentBody{Slug: segment.Slug, Percent: segment.Percent}
+	if segment.TTL != 0 {
+		body.TTL = formatDuration(segment.TTL)
+	}
+
+	if !segment.ExpiresAt.IsZero() {
+		body.ExpiresAt = formatTime(segment.ExpiresAt)
+	}
+
+	return c.call(ctx, request{method: http.MethodPost, path: "/api/segment", body: body, gzip: true, idempotent: true}, nil)
+}
+
+func (c *Client) UpdateSegment(ctx context.Context, update SegmentUpdate) error {
+	body := segmentBody{Slug: update.Slug}
+	if update.TTL != nil {
+		body.TTL = formatDuration(*update.TTL)
+	}
+
+	if update.ExpiresAt != nil {
+		body.ExpiresAt = formatTime(*update.ExpiresAt)
+	}
+
+	return c.call(ctx, request{method: http.MethodPatch, path: "/api/segment", body: body, gzip: true, idempotent: true}, nil)
+}
+
+type segmentInfoBody struct {
+	Slug      string     `json:"slug"`
+	TTL       string     `json:"ttl"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedBy string     `json:"created_by"`
+	UpdatedBy string     `json:"updated_by"`
+}
+
+// ListSegments returns all segments of the namespace ordered by slug
+func (c *Client) ListSegments(ctx context.Context) ([]SegmentInfo, error) {
+	var bodies []segmentInfoBody
+	err := c.call(ctx, request{method: http.MethodGet, path: "/api/segment"}, &bodies)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]SegmentInfo, 0, len(bodies))
+	for _, body := range bodies {
+		segment := SegmentInfo{Slug: body.Slug, CreatedBy: body.CreatedBy, UpdatedBy: body.UpdatedBy}
+		if body.TTL != "" {
+			segment.TTL, err = time.ParseDuration(body.TTL)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if body.ExpiresAt != nil {
+			segment.ExpiresAt = *body.ExpiresAt
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+// DeleteSegment deletes the segment, users are removed from it in the background
+func (c *Client) DeleteSegment(ctx context.Context, slug string) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: "/api/segment", body: segmentBody{Slug: slug}, gzip: true, idempotent: true}, nil)
+}
+
+// formatDuration and formatTime return an empty string for zero values, which the server treats as a removal
+func formatDuration(d time.Duration) *string {
+	s := ""
+	if d != 0 {
+		s = d.String()
+	}
+
+	return &s
+}
+
+func formatTime(t time.Time) *string {
+	s := ""
+	if !t.IsZero() {
+		s = t.Format(time.RFC3339)
+	}
+
+	return &s
+}
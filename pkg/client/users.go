@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Assignment adds the user to the segment, until TTL when it is not zero
+type Assignment struct {
+	Slug string
+	TTL  time.Time
+}
+
+type UserUpdate struct {
+	UserID string
+	Add    []Assignment
+	Delete []string
+}
+
+type userUpdateBody struct {
+	UserID        string   `json:"user_id"`
+	SlugsToAdd    []string `json:"slugs_to_add"`
+	SlugsToDelete []string `json:"slugs_to_delete"`
+	TTL           []string `json:"ttl,omitempty"`
+}
+
+type DeletionTime struct {
+	UserID string    `json:"user_id"`
+	Slug   string    `json:"slug"`
+	TTL    time.Time `json:"ttl"`
+}
+
+type deletionTimeBody struct {
+	UserID string  `json:"user_id"`
+	Slug   string  `json:"slug"`
+	TTL    *string `json:"ttl,omitempty"`
+}
+
+type Schedule struct {
+	UserID   string
+	Slugs    []string
+	StartsAt time.Time
+	// EndsAt removes the user from the segments, zero time keeps the user in them
+	EndsAt time.Time
+}
+
+type scheduleBody struct {
+	UserID   string   `json:"user_id"`
+	Slugs    []string `json:"slugs"`
+	StartsAt string   `json:"starts_at"`
+	EndsAt   string   `json:"ends_at,omitempty"`
+}
+
+type ScheduledAssignment struct {
+	UserID   string     `json:"user_id"`
+	Slug     string     `json:"slug"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+// UpdateUserSegments adds the user to segments and removes it from others. The server accepts TTLs
+// either for every added segment or for none of them, so assignments with and without TTL can't be mixed
+func (c *Client) UpdateUserSegments(ctx context.Context, update UserUpdate) error {
+	body := userUpdateBody{
+		UserID:        update.UserID,
+		SlugsToAdd:    make([]string, 0, len(update.Add)),
+		SlugsToDelete: update.Delete,
+	}
+
+	if body.SlugsToDelete == nil {
+		body.SlugsToDelete = []string{}
+	}
+
+	withTTL := 0
+	for _, assignment := range update.Add {
+		body.SlugsToAdd = append(body.SlugsToAdd, assignment.Slug)
+		if !assignment.TTL.IsZero() {
+			withTTL++
+		}
+	}
+
+	if withTTL != 0 && withTTL != len(update.Add) {
+		return invalidField("ttl", "TTL should be set for every added segment or for none of them")
+	}
+
+	if withTTL != 0 {
+		body.TTL = make([]string, 0, len(update.Add))
+		for _, assignment := range update.Add {
+			body.TTL = append(body.TTL, assignment.TTL.Format(time.RFC3339))
+		}
+	}
+
+	return c.call(ctx, request{method: http.MethodPost, path: "/api/user", body: body, gzip: true, idempotent: true}, nil)
+}
+
+// GetUserSegments returns the slugs of the segments the user is in, nil if there are none
+func (c *Client) GetUserSegments(ctx context.Context, userID string) ([]string, error) {
+	var slugs []string
+	err := c.call(ctx, request{method: http.MethodGet, path: "/api/user/" + url.PathEscape(userID)}, &slugs)
+	return slugs, err
+}
+
+// ListDeletionTimes returns scheduled removals of users from segments, filtered by the user, the segment or both
+func (c *Client) ListDeletionTimes(ctx context.Context, userID string, slug string) ([]DeletionTime, error) {
+	query := url.Values{}
+	if userID != "" {
+		query.Set("user_id", userID)
+	}
+
+	if slug != "" {
+		query.Set("slug", slug)
+	}
+
+	var deletionTimes []DeletionTime
+	err := c.call(ctx, request{method: http.MethodGet, path: "/api/ttl", query: query}, &deletionTimes)
+	return deletionTimes, err
+}
+
+// UpdateDeletionTime sets the time when the user is removed from the segment
+func (c *Client) UpdateDeletionTime(ctx context.Context, userID string, slug string, TTL time.Time) error {
+	body := deletionTimeBody{UserID: userID, Slug: slug, TTL: formatTime(TTL)}
+	return c.call(ctx, request{method: http.MethodPatch, path: "/api/ttl", body: body, gzip: true, idempotent: true}, nil)
+}
+
+// DeleteDeletionTime keeps the user in the segment forever
+func (c *Client) DeleteDeletionTime(ctx context.Context, userID string, slug string) error {
+	body := deletionTimeBody{UserID: userID, Slug: slug}
+	return c.call(ctx, request{method: http.MethodDelete, path: "/api/ttl", body: body, gzip: true, idempotent: true}, nil)
+}
+
+func (c *Client) ScheduleUserSegments(ctx context.Context, schedule Schedule) error {
+	body := scheduleBody{
+		UserID:   schedule.UserID,
+		Slugs:    schedule.Slugs,
+		StartsAt: schedule.StartsAt.Format(time.RFC3339),
+	}
+
+	if !schedule.EndsAt.IsZero() {
+		body.EndsAt = schedule.EndsAt.Format(time.RFC3339)
+	}
+
+	return c.call(ctx, request{method: http.MethodPost, path: "/api/schedule", body: body, gzip: true, idempotent: true}, nil)
+}
+
+// ListScheduledAssignments returns assignments of the user which are not active yet
+func (c *Client) ListScheduledAssignments(ctx context.Context, userID string) ([]ScheduledAssignment, error) {
+	var assignments []ScheduledAssignment
+	err := c.call(ctx, request{method: http.MethodGet, path: "/api/schedule/" + url.PathEscape(userID)}, &assignments)
+	return assignments, err
+}
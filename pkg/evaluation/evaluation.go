@@ -0,0 +1,127 @@
+// Package evaluation answers whether a user is in a segment the same way the server does,
+// so clients can keep the state locally and evaluate it without requests
+package evaluation
+
+import (
+	"sync"
+	"time"
+)
+
+type Segment struct {
+	Slug      string     `json:"slug"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Membership is an explicit assignment of a user to a segment, users assigned by percent have them too
+type Membership struct {
+	Slug string     `json:"slug"`
+	TTL  *time.Time `json:"ttl,omitempty"`
+}
+
+type User struct {
+	UserID      string       `json:"user_id"`
+	Memberships []Membership `json:"memberships"`
+}
+
+// State keeps segments and memberships of users, it is safe for concurrent use
+type State struct {
+	mu       sync.RWMutex
+	segments map[string]Segment
+	users    map[string][]Membership
+}
+
+func NewState() *State {
+	return &State{segments: make(map[string]Segment), users: make(map[string][]Membership)}
+}
+
+// Reset replaces the whole state, e.g. with a snapshot downloaded from the server
+func (s *State) Reset(segments []Segment, users []User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setSegments(segments)
+
+	s.users = make(map[string][]Membership, len(users))
+	for _, user := range users {
+		s.users[user.UserID] = user.Memberships
+	}
+}
+
+// SetSegments replaces all segments, segments are always read from the server together
+func (s *State) SetSegments(segments []Segment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setSegments(segments)
+}
+
+func (s *State) SetUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.UserID] = user.Memberships
+}
+
+func (s *State) DeleteUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, userID)
+}
+
+func (s *State) setSegments(segments []Segment) {
+	s.segments = make(map[string]Segment, len(segments))
+	for _, segment := range segments {
+		s.segments[segment.Slug] = segment
+	}
+}
+
+// Segments returns slugs of the segments the user is in at the moment now, in the order of assignment.
+// found is false for users which are not known, the server responds with user_not_found for them
+func (s *State) Segments(userID string, now time.Time) (slugs []string, found bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	memberships, found := s.users[userID]
+	if !found {
+		return nil, false
+	}
+
+	slugs = make([]string, 0, len(memberships))
+	for _, membership := range memberships {
+		if s.isActive(membership, now) {
+			slugs = append(slugs, membership.Slug)
+		}
+	}
+
+	return slugs, true
+}
+
+func (s *State) IsMember(userID string, slug string, now time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, membership := range s.users[userID] {
+		if membership.Slug == slug {
+			return s.isActive(membership, now)
+		}
+	}
+
+	return false
+}
+
+// isActive is the rule of the server: a membership stops being active when its TTL comes or the segment expires,
+// even if the scheduler has not removed it yet. Memberships of deleted segments stay active until they are removed
+// in the background, as the server does not check that the segment exists
+func (s *State) isActive(membership Membership, now time.Time) bool {
+	if membership.TTL != nil && !membership.TTL.After(now) {
+		return false
+	}
+
+	segment, ok := s.segments[membership.Slug]
+	if ok && segment.ExpiresAt != nil && !segment.ExpiresAt.After(now) {
+		return false
+	}
+
+	return true
+}
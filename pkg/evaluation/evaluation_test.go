@@ -0,0 +1,55 @@
+package evaluation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectors(t *testing.T) {
+	vectors, err := Vectors()
+	require.NoError(t, err)
+	require.NotEmpty(t, vectors)
+
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			state := NewState()
+			state.Reset(v.Segments, v.Users)
+
+			for _, expected := range v.Expected {
+				slugs, found := state.Segments(expected.UserID, v.Now)
+				require.Equal(t, expected.Found, found, expected.UserID)
+				if found {
+					require.Equal(t, expected.Segments, slugs, expected.UserID)
+				}
+
+				for _, slug := range expected.Segments {
+					require.True(t, state.IsMember(expected.UserID, slug, v.Now), slug)
+				}
+			}
+		})
+	}
+}
+
+func TestStateUpdates(t *testing.T) {
+	now := time.Now()
+	expired := now.Add(-time.Hour)
+
+	state := NewState()
+	state.SetSegments([]Segment{{Slug: "A"}})
+	state.SetUser(User{UserID: "1", Memberships: []Membership{{Slug: "A"}}})
+	require.True(t, state.IsMember("1", "A", now))
+	require.False(t, state.IsMember("1", "B", now))
+	require.False(t, state.IsMember("2", "A", now))
+
+	state.SetSegments([]Segment{{Slug: "A", ExpiresAt: &expired}})
+	require.False(t, state.IsMember("1", "A", now))
+
+	state.SetSegments(nil)
+	require.True(t, state.IsMember("1", "A", now))
+
+	state.DeleteUser("1")
+	_, found := state.Segments("1", now)
+	require.False(t, found)
+}
@@ -0,0 +1,30 @@
+package evaluation
+
+import (
+	_ "embed"
+	"encoding/json"
+	"time"
+)
+
+//go:embed testdata/vectors.json
+var vectors []byte
+
+// Vector is a case of the suite shared by the local evaluation and the server. Each implementation loads
+// the segments and users, evaluates them at the moment Now and has to get the expected segments
+type Vector struct {
+	Name     string    `json:"name"`
+	Now      time.Time `json:"now"`
+	Segments []Segment `json:"segments"`
+	Users    []User    `json:"users"`
+	Expected []struct {
+		UserID   string   `json:"user_id"`
+		Found    bool     `json:"found"`
+		Segments []string `json:"segments"`
+	} `json:"expected"`
+}
+
+func Vectors() ([]Vector, error) {
+	var v []Vector
+	err := json.Unmarshal(vectors, &v)
+	return v, err
+}
@@ -3,6 +3,7 @@ package jsonduplicatechecker
 import (
 	"encoding/json"
 	"strconv"
+	"strings"
 
 	appErrors "github.com/PoorMercymain/user-segmenter/errors"
 )
@@ -30,7 +31,7 @@ func CheckDuplicatesInJSON(d *json.Decoder, path []string) error {
 			key := t.(string)
 
 			if keys[key] {
-				return appErrors.ErrorDuplicateInJSON
+				return appErrors.DuplicateJSONKey(strings.Join(append(path, key), "."))
 			}
 			keys[key] = true
 
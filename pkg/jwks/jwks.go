@@ -0,0 +1,247 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+)
+
+// minReloadInterval limits reloads caused by tokens with unknown key IDs, so such tokens can not flood the identity provider
+const minReloadInterval = time.Minute
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Set is a JSON Web Key Set loaded from a file or an http(s) URL. The set is reloaded
+// when a token is signed with an unknown key, so keys can be rotated without a restart
+type Set struct {
+	source string
+	client *http.Client
+
+	mu         sync.RWMutex
+	keys       map[string]crypto.PublicKey
+	loadedAt   time.Time
+	reloadLock sync.Mutex
+}
+
+// Load reads the set from source, which is a path to a file (optionally with the file:// scheme) or an http(s) URL
+func Load(ctx context.Context, source string) (*Set, error) {
+	if source == "" {
+		return nil, appErrors.ErrorJWKSSourceNotSet
+	}
+
+	s := &Set{source: source, client: &http.Client{Timeout: 10 * time.Second}}
+	if err := s.load(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Key returns the key by its ID. An empty ID is accepted only when the set has a single key
+func (s *Set) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	// the set may have been reloaded while waiting for the lock
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+
+	s.mu.RLock()
+	loadedAt := s.loadedAt
+	s.mu.RUnlock()
+
+	if time.Since(loadedAt) >= minReloadInterval {
+		if err := s.load(ctx); err != nil {
+			return nil, err
+		}
+
+		if key, ok := s.lookup(kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", appErrors.ErrorJWKNotFound, kid)
+}
+
+func (s *Set) lookup(kid string) (crypto.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (s *Set) load(ctx context.Context) error {
+	data, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys, err := Parse(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Set) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(s.source, "file://"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to load JWKS from %s: %s", s.source, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// Parse returns the signature keys of a JWKS document by their IDs, encryption keys are skipped
+func Parse(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: curve %q", appErrors.ErrorUnsupportedJWK, k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("%w: point is not on the curve", appErrors.ErrorUnsupportedJWK)
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %q", appErrors.ErrorUnsupportedJWK, k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: wrong Ed25519 key size", appErrors.ErrorUnsupportedJWK)
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("%w: key type %q", appErrors.ErrorUnsupportedJWK, k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
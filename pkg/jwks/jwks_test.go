@@ -0,0 +1,141 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
+)
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(t *testing.T, kid string) (jwk, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	return jwk{Kty: "RSA", Kid: kid, N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}, key
+}
+
+func marshal(t *testing.T, keys ...jwk) []byte {
+	data, err := json.Marshal(map[string][]jwk{"keys": keys})
+	require.NoError(t, err)
+	return data
+}
+
+func TestParse(t *testing.T) {
+	rsaKey, rsaPrivate := rsaJWK(t, "rsa")
+
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecKey := jwk{Kty: "EC", Kid: "ec", Crv: "P-256", X: encode(ecPrivate.X.Bytes()), Y: encode(ecPrivate.Y.Bytes())}
+
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edKey := jwk{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: encode(edPublic)}
+
+	encKey, _ := rsaJWK(t, "enc")
+	encKey.Use = "enc"
+
+	keys, err := Parse(marshal(t, rsaKey, ecKey, edKey, encKey))
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+	require.True(t, rsaPrivate.PublicKey.Equal(keys["rsa"]))
+	require.True(t, ecPrivate.PublicKey.Equal(keys["ec"]))
+	require.True(t, edPublic.Equal(keys["ed"]))
+
+	_, err = Parse(marshal(t, jwk{Kty: "oct", Kid: "hmac"}))
+	require.ErrorIs(t, err, appErrors.ErrorUnsupportedJWK)
+
+	_, err = Parse(marshal(t, jwk{Kty: "EC", Kid: "bad", Crv: "P-256", X: encode([]byte{1}), Y: encode([]byte{2})}))
+	require.ErrorIs(t, err, appErrors.ErrorUnsupportedJWK)
+
+	_, err = Parse([]byte("{"))
+	require.Error(t, err)
+}
+
+func TestLoadFile(t *testing.T) {
+	first, firstPrivate := rsaJWK(t, "first")
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, marshal(t, first), 0o600))
+
+	_, err := Load(context.Background(), "")
+	require.ErrorIs(t, err, appErrors.ErrorJWKSSourceNotSet)
+
+	_, err = Load(context.Background(), filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+
+	set, err := Load(context.Background(), "file://"+path)
+	require.NoError(t, err)
+
+	key, err := set.Key(context.Background(), "first")
+	require.NoError(t, err)
+	require.True(t, firstPrivate.PublicKey.Equal(key))
+
+	// a single key is used for tokens without a key ID
+	key, err = set.Key(context.Background(), "")
+	require.NoError(t, err)
+	require.True(t, firstPrivate.PublicKey.Equal(key))
+
+	_, err = set.Key(context.Background(), "second")
+	require.ErrorIs(t, err, appErrors.ErrorJWKNotFound)
+}
+
+func TestReloadOnUnknownKey(t *testing.T) {
+	first, _ := rsaJWK(t, "first")
+	second, secondPrivate := rsaJWK(t, "second")
+
+	var rotated atomic.Bool
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if rotated.Load() {
+			_, _ = w.Write(marshal(t, first, second))
+			return
+		}
+		_, _ = w.Write(marshal(t, first))
+	}))
+	defer ts.Close()
+
+	set, err := Load(context.Background(), ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), requests.Load())
+
+	rotated.Store(true)
+
+	// reloads are limited, so the new key is not seen right after loading
+	_, err = set.Key(context.Background(), "second")
+	require.ErrorIs(t, err, appErrors.ErrorJWKNotFound)
+	require.Equal(t, int32(1), requests.Load())
+
+	set.loadedAt = time.Now().Add(-minReloadInterval)
+
+	key, err := set.Key(context.Background(), "second")
+	require.NoError(t, err)
+	require.True(t, secondPrivate.PublicKey.Equal(key))
+	require.Equal(t, int32(2), requests.Load())
+
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	_, err = Load(context.Background(), ts.URL)
+	require.Error(t, err)
+}
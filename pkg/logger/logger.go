@@ -1,32 +1,106 @@
 package logger
 
 import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 
 	appErrors "github.com/PoorMercymain/user-segmenter/errors"
 )
 
-var instance *zap.SugaredLogger
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
 
-func InitLogger() error {
-	cfg := zap.NewProductionConfig()
-	cfg.OutputPaths = []string{"logfile.log", "stdout"}
+type Config struct {
+	Level   string
+	Format  string
+	Outputs []string
+	// MaxSize is the size of a log file in megabytes after which it is rotated
+	MaxSize int
+	// MaxBackups is the amount of rotated files to keep, 0 keeps all of them
+	MaxBackups int
+	// MaxAge is the amount of days to keep rotated files, 0 keeps them forever
+	MaxAge int
+}
 
-	logger, err := cfg.Build()
+type loggerKey struct{}
+
+// New builds a logger writing to every output. stdout and stderr are written as is,
+// any other output is treated as a file path and is rotated
+func New(cfg Config) (*zap.SugaredLogger, error) {
+	log, _, err := NewLeveled(cfg)
+	return log, err
+}
+
+// NewLeveled builds a logger like New and returns its level, which can be changed while the logger is used
+func NewLeveled(cfg Config) (*zap.SugaredLogger, zap.AtomicLevel, error) {
+	level, err := zap.ParseAtomicLevel(cfg.Level)
 	if err != nil {
-		return err
+		return nil, level, err
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	var encoder zapcore.Encoder
+	switch cfg.Format {
+	case FormatJSON, "":
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case FormatConsole:
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	default:
+		return nil, level, appErrors.ErrorUnknownLogFormat
 	}
 
-	instance = logger.Sugar()
-	return nil
+	if len(cfg.Outputs) == 0 {
+		return nil, level, appErrors.ErrorNoLogOutputs
+	}
+
+	syncers := make([]zapcore.WriteSyncer, 0, len(cfg.Outputs))
+	for _, output := range cfg.Outputs {
+		switch output {
+		case "stdout":
+			syncers = append(syncers, zapcore.Lock(os.Stdout))
+		case "stderr":
+			syncers = append(syncers, zapcore.Lock(os.Stderr))
+		default:
+			syncers = append(syncers, zapcore.AddSync(&lumberjack.Logger{
+				Filename:   output,
+				MaxSize:    cfg.MaxSize,
+				MaxBackups: cfg.MaxBackups,
+				MaxAge:     cfg.MaxAge,
+			}))
+		}
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(syncers...), level)
+
+	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)).Sugar(), level, nil
+}
+
+// WithContext returns a copy of ctx which carries the logger
+func WithContext(ctx context.Context, log *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
 }
 
-func GetLogger() (*zap.SugaredLogger, error) {
-	var err error
+// FromContext returns the logger stored in ctx with trace and span IDs of the span from ctx added to log lines.
+// If ctx has no logger, the returned logger discards everything
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	log, ok := ctx.Value(loggerKey{}).(*zap.SugaredLogger)
+	if !ok {
+		return zap.NewNop().Sugar()
+	}
 
-	if instance == nil {
-		err = appErrors.ErrorLoggerNotInitialized
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return log
 	}
 
-	return instance, err
+	return log.With("trace_id", spanContext.TraceID().String(), "span_id", spanContext.SpanID().String())
 }
@@ -1,20 +1,61 @@
 package logger
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	appErrors "github.com/PoorMercymain/user-segmenter/errors"
 )
 
-func TestLogger(t *testing.T) {
-	logger, err := GetLogger()
-	require.Empty(t, logger)
+func TestNew(t *testing.T) {
+	_, err := New(Config{Level: "loud", Outputs: []string{"stdout"}})
 	require.Error(t, err)
 
-	err = InitLogger()
+	_, err = New(Config{Level: "info", Format: "xml", Outputs: []string{"stdout"}})
+	require.ErrorIs(t, err, appErrors.ErrorUnknownLogFormat)
+
+	_, err = New(Config{Level: "info"})
+	require.ErrorIs(t, err, appErrors.ErrorNoLogOutputs)
+
+	filename := filepath.Join(t.TempDir(), "test.log")
+
+	log, err := New(Config{Level: "warn", Format: FormatConsole, Outputs: []string{filename}, MaxSize: 1})
 	require.NoError(t, err)
 
-	logger, err = GetLogger()
-	require.NotEmpty(t, logger)
+	log.Infoln("skipped")
+	log.Warnln("written")
+	require.NoError(t, log.Sync())
+
+	b, err := os.ReadFile(filename)
 	require.NoError(t, err)
+	require.NotContains(t, string(b), "skipped")
+	require.Contains(t, string(b), "written")
+}
+
+func TestFromContext(t *testing.T) {
+	require.NotNil(t, FromContext(context.Background()))
+
+	core, logs := observer.New(zap.InfoLevel)
+	ctx := WithContext(context.Background(), zap.New(core).Sugar())
+
+	FromContext(ctx).Infoln("without span")
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+	})
+	FromContext(trace.ContextWithSpanContext(ctx, spanContext)).Infoln("with span")
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	require.Empty(t, entries[0].ContextMap())
+	require.Equal(t, spanContext.TraceID().String(), entries[1].ContextMap()["trace_id"])
+	require.Equal(t, spanContext.SpanID().String(), entries[1].ContextMap()["span_id"])
 }
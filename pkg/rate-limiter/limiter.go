@@ -0,0 +1,105 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// bucketTTL is how long a bucket of an idle key is kept, a new bucket is full anyway
+const bucketTTL = 10 * time.Minute
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter keeps a token bucket per key, e.g. per client
+type Limiter struct {
+	limit     rate.Limit
+	burst     int
+	bucketsMu sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// New creates a limiter allowing limit events per second with bursts of burst events for every key.
+// A limit of 0 or less allows every event
+func New(limit float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		limit:     rate.Limit(limit),
+		burst:     burst,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// SetLimit changes the limit of every key, buckets keep their tokens
+func (l *Limiter) SetLimit(limit float64, burst int) {
+	l.bucketsMu.Lock()
+	defer l.bucketsMu.Unlock()
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.limit = rate.Limit(limit)
+	l.burst = burst
+
+	now := time.Now()
+	for _, b := range l.buckets {
+		b.limiter.SetLimitAt(now, l.limit)
+		b.limiter.SetBurstAt(now, l.burst)
+	}
+}
+
+// Allow takes a token from the bucket of key. When there are no tokens it returns false
+// and the time after which a token will be available
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	limiter := l.bucket(key, now)
+	if limiter == nil {
+		return true, 0
+	}
+
+	reservation := limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// bucket returns nil when the limit is disabled
+func (l *Limiter) bucket(key string, now time.Time) *rate.Limiter {
+	l.bucketsMu.Lock()
+	defer l.bucketsMu.Unlock()
+
+	if l.limit <= 0 {
+		return nil
+	}
+
+	if now.Sub(l.lastSweep) > bucketTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > bucketTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	return b.limiter
+}
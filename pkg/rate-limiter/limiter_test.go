@@ -0,0 +1,59 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllow(t *testing.T) {
+	limiter := New(1, 2)
+
+	for i := 0; i < 2; i++ {
+		ok, _ := limiter.Allow("a")
+		require.True(t, ok)
+	}
+
+	ok, retryAfter := limiter.Allow("a")
+	require.False(t, ok)
+	require.Greater(t, retryAfter, time.Duration(0))
+	require.LessOrEqual(t, retryAfter, time.Second)
+
+	ok, _ = limiter.Allow("b")
+	require.True(t, ok)
+}
+
+func TestAllowRefills(t *testing.T) {
+	limiter := New(100, 1)
+
+	ok, _ := limiter.Allow("a")
+	require.True(t, ok)
+
+	ok, _ = limiter.Allow("a")
+	require.False(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+
+	ok, _ = limiter.Allow("a")
+	require.True(t, ok)
+}
+
+func TestSetLimit(t *testing.T) {
+	limiter := New(0, 1)
+	for i := 0; i < 10; i++ {
+		ok, _ := limiter.Allow("a")
+		require.True(t, ok)
+	}
+
+	limiter.SetLimit(1, 1)
+	ok, _ := limiter.Allow("a")
+	require.True(t, ok)
+	ok, _ = limiter.Allow("a")
+	require.False(t, ok)
+
+	limiter.SetLimit(1, 3)
+	time.Sleep(10 * time.Millisecond)
+	ok, _ = limiter.Allow("b")
+	require.True(t, ok)
+}